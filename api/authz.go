@@ -0,0 +1,81 @@
+package api
+
+import (
+	"ej_final/internal/apperror"
+	"ej_final/internal/sales"
+	"ej_final/internal/user"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authorizeUser lets a caller whose API key is bound to a user act only on
+// that user. The other users are answered as missing, like sales.CheckOwner
+// does for sales. Callers not bound to a user are not restricted.
+func authorizeUser(ctx *gin.Context, userID string) error {
+	if id := ctx.GetString(authUserKey); id != "" && id != userID {
+		return user.ErrNotFound
+	}
+	return nil
+}
+
+// authorizeSale lets a caller bound to a user see only its own sales, with
+// the same ownership rule as the nested /users/:id/sales routes.
+func authorizeSale(ctx *gin.Context, sale *sales.Sales) error {
+	if id := ctx.GetString(authUserKey); id != "" {
+		return sales.CheckOwner(sale, id)
+	}
+	return nil
+}
+
+// scopeUser is the user of a query over the sales of one or every user: a
+// caller bound to a user gets its own when userID is empty, and
+// authorizeUser otherwise.
+func scopeUser(ctx *gin.Context, userID string) (string, error) {
+	if id := ctx.GetString(authUserKey); id != "" && userID == "" {
+		return id, nil
+	}
+	return userID, authorizeUser(ctx, userID)
+}
+
+// requireUnbound keeps the callers bound to a user out of the operations
+// over the data of every user, like imports.
+func requireUnbound(ctx *gin.Context) error {
+	if ctx.GetString(authUserKey) != "" {
+		return apperror.New(http.StatusForbidden, "forbidden", "this API key can only act on the sales of its user")
+	}
+	return nil
+}
+
+// authorizeSales checks the caller may change every sale of changes. A sale
+// that does not exist is left for the Service to report on its item.
+func (h *handler) authorizeSales(ctx *gin.Context, changes []sales.StatusChange) error {
+	if ctx.GetString(authUserKey) == "" {
+		return nil
+	}
+	for _, ch := range changes {
+		sale, err := h.salesService.Get(ctx.Request.Context(), ch.ID)
+		if err != nil {
+			continue
+		}
+		if err := authorizeSale(ctx, sale); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ownSale loads the sale :id and checks the caller may act on it. On failure
+// the error is already attached to ctx.
+func (h *handler) ownSale(ctx *gin.Context) (*sales.Sales, bool) {
+	sale, err := h.salesService.Get(ctx.Request.Context(), ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return nil, false
+	}
+	if err := authorizeSale(ctx, sale); err != nil {
+		ctx.Error(err)
+		return nil, false
+	}
+	return sale, true
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"ej_final/internal/coupon"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// couponCodes joins the coupon_code and coupon_codes of a request, nil if
+// there are none.
+func couponCodes(code string, codes []string) []string {
+	if code != "" {
+		codes = append([]string{code}, codes...)
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return codes
+}
+
+// handleCreateCoupon handles POST /coupons
+func (h *handler) handleCreateCoupon(ctx *gin.Context) {
+	var req struct {
+		Code           string     `json:"code"`
+		Kind           string     `json:"kind"`
+		Value          float32    `json:"value"`
+		MinAmount      float32    `json:"min_amount"`
+		ValidFrom      *time.Time `json:"valid_from"`
+		ValidUntil     *time.Time `json:"valid_until"`
+		MaxUses        int        `json:"max_uses"`
+		MaxUsesPerUser int        `json:"max_uses_per_user"`
+		Stackable      bool       `json:"stackable"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(invalidBody(err))
+		return
+	}
+
+	c := &coupon.Coupon{
+		Code:           req.Code,
+		Kind:           req.Kind,
+		Value:          req.Value,
+		MinAmount:      req.MinAmount,
+		ValidFrom:      req.ValidFrom,
+		ValidUntil:     req.ValidUntil,
+		MaxUses:        req.MaxUses,
+		MaxUsesPerUser: req.MaxUsesPerUser,
+		Stackable:      req.Stackable,
+	}
+	if err := h.couponService.Create(ctx.Request.Context(), c); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	h.log(ctx).Info("coupon created", zap.Any("coupon", c))
+	ctx.JSON(http.StatusCreated, c)
+}
+
+// handleListCoupons handles GET /coupons
+func (h *handler) handleListCoupons(ctx *gin.Context) {
+	coupons, err := h.couponService.List(ctx.Request.Context())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"results": coupons})
+}
+
+// handleGetCoupon handles GET /coupons/:code
+func (h *handler) handleGetCoupon(ctx *gin.Context) {
+	c, err := h.couponService.Get(ctx.Request.Context(), ctx.Param("code"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, c)
+}
+
+// handleDeleteCoupon handles DELETE /coupons/:code
+func (h *handler) handleDeleteCoupon(ctx *gin.Context) {
+	if err := h.couponService.Delete(ctx.Request.Context(), ctx.Param("code")); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
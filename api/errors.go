@@ -0,0 +1,46 @@
+package api
+
+import (
+	"ej_final/internal/apperror"
+	"ej_final/internal/logging"
+	"ej_final/internal/requestid"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// errorHandler returns the middleware that renders the last error attached
+// with ctx.Error as an application/problem+json response. Handlers only have
+// to call ctx.Error(err) and return.
+func errorHandler(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+
+		last := ctx.Errors.Last()
+		if last == nil {
+			return
+		}
+
+		appErr := apperror.From(last.Err)
+		if appErr.Status >= http.StatusInternalServerError {
+			logging.FromContext(ctx.Request.Context(), logger).Error("request failed",
+				zap.String("code", appErr.Code),
+				zap.Error(last.Err))
+		}
+
+		if ctx.Writer.Written() {
+			return
+		}
+
+		problem := appErr.Problem(ctx.Request.URL.Path, requestid.FromContext(ctx.Request.Context()))
+		body, _ := json.Marshal(problem)
+		ctx.Data(appErr.Status, apperror.ContentType, body)
+	}
+}
+
+// handleNoRoute answers unknown paths with a problem as well.
+func handleNoRoute(ctx *gin.Context) {
+	ctx.Error(apperror.New(http.StatusNotFound, apperror.CodeRouteNotFound, "no route for "+ctx.Request.Method+" "+ctx.Request.URL.Path))
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"ej_final/internal/sales"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// exportFormat picks the format of GET /sales/export: the format query
+// parameter wins, then the Accept header, and CSV by default.
+func exportFormat(ctx *gin.Context) (sales.Format, error) {
+	if f := ctx.Query("format"); f != "" {
+		return sales.ParseFormat(f)
+	}
+	accept := ctx.GetHeader("Accept")
+	if strings.Contains(accept, "ndjson") {
+		return sales.FormatNDJSON, nil
+	}
+	return sales.FormatCSV, nil
+}
+
+// streamWriter sends the export headers right before the first byte, so an
+// error found before any row is written can still be answered as a problem.
+type streamWriter struct {
+	ctx    *gin.Context
+	format sales.Format
+	sent   bool
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.start()
+	return w.ctx.Writer.Write(p)
+}
+
+// start sends the headers if they were not sent yet.
+func (w *streamWriter) start() {
+	if w.sent {
+		return
+	}
+	w.sent = true
+	w.ctx.Header("Content-Type", w.format.ContentType())
+	w.ctx.Header("Content-Disposition", `attachment; filename="sales.`+string(w.format)+`"`)
+	w.ctx.Status(http.StatusOK)
+	w.ctx.Writer.WriteHeaderNow()
+}
+
+func (w *streamWriter) Flush() {
+	if w.sent {
+		w.ctx.Writer.Flush()
+	}
+}
+
+// handleExportSales handles GET /sales/export
+func (h *handler) handleExportSales(ctx *gin.Context) {
+	format, err := exportFormat(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	w := &streamWriter{ctx: ctx, format: format}
+	exp, err := sales.NewExporter(w, format)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	filter := sales.Filter{UserID: ctx.Query("user_id"), Status: ctx.Query("status")}
+	if filter.UserID, err = scopeUser(ctx, filter.UserID); err != nil {
+		ctx.Error(err)
+		return
+	}
+	if err := h.salesService.Export(ctx.Request.Context(), filter, exp); err != nil {
+		// Si ya se mandaron filas no hay forma de avisar con un problem, el cliente ve el archivo cortado
+		ctx.Error(err)
+		return
+	}
+	// Un NDJSON vacio no escribe nada, igual hay que mandar los headers
+	w.start()
+
+	h.log(ctx).Info("sales exported",
+		zap.String("format", string(format)),
+		zap.Int("rows", exp.Rows()))
+}
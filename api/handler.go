@@ -1,19 +1,43 @@
 package api
 
 import (
+	"ej_final/internal/apperror"
+	"ej_final/internal/coupon"
+	"ej_final/internal/importer"
+	"ej_final/internal/logging"
+	"ej_final/internal/payment"
+	"ej_final/internal/product"
 	"ej_final/internal/sales"
 	"ej_final/internal/user"
-	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
 type handler struct {
-	userService  *user.Service
-	salesService *sales.Service
-	logger       *zap.Logger
+	userService    *user.Service
+	salesService   *sales.Service
+	productService *product.Service
+	couponService  *coupon.Service
+	importer       *importer.Importer
+	logger         *zap.Logger
+
+	// callbacks verifies the payment callbacks; nil when they are not accepted.
+	callbacks *payment.Verifier
+}
+
+// log returns the handler logger tagged with the correlation fields of the request.
+func (h *handler) log(ctx *gin.Context) *zap.Logger {
+	return logging.FromContext(ctx.Request.Context(), h.logger)
+}
+
+// invalidBody wraps a binding error so it is answered as a 400 problem.
+func invalidBody(err error) *apperror.Error {
+	e := apperror.BadRequest(apperror.CodeInvalidBody, err.Error())
+	e.Err = err
+	return e
 }
 
 // handleCreate handles POST /users
@@ -25,7 +49,7 @@ func (h *handler) handleCreate(ctx *gin.Context) {
 		NickName string `json:"nickname"`
 	}
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(invalidBody(err))
 		return
 	}
 
@@ -34,12 +58,12 @@ func (h *handler) handleCreate(ctx *gin.Context) {
 		Address:  req.Address,
 		NickName: req.NickName,
 	}
-	if err := h.userService.Create(u); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.userService.Create(ctx.Request.Context(), u); err != nil {
+		ctx.Error(err)
 		return
 	}
 
-	h.logger.Info("user created", zap.Any("user", u))
+	h.log(ctx).Info("user created", zap.Any("user", u))
 	ctx.JSON(http.StatusCreated, u)
 }
 
@@ -47,42 +71,66 @@ func (h *handler) handleCreate(ctx *gin.Context) {
 func (h *handler) handleRead(ctx *gin.Context) {
 	id := ctx.Param("id")
 
-	u, err := h.userService.Get(id)
+	u, err := h.userService.Get(ctx.Request.Context(), id)
 	if err != nil {
-		if errors.Is(err, user.ErrNotFound) {
-			h.logger.Warn("user not found", zap.String("id", id))
-			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		h.log(ctx).Warn("error trying to get user", zap.String("id", id), zap.Error(err))
+		ctx.Error(err)
+		return
+	}
+
+	h.log(ctx).Info("get user succeed", zap.Any("user", u))
+	ctx.JSON(http.StatusOK, u)
+}
+
+// handleListUsers handles GET /users
+func (h *handler) handleListUsers(ctx *gin.Context) {
+	query := user.ListQuery{
+		Search: ctx.Query("search"),
+		SortBy: ctx.Query("sort"),
+		Cursor: ctx.Query("cursor"),
+	}
+
+	switch ctx.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		ctx.Error(apperror.BadRequest(apperror.CodeInvalidParameter, "order must be asc or desc"))
+		return
+	}
+
+	if raw := ctx.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			ctx.Error(apperror.BadRequest(apperror.CodeInvalidParameter, "limit must be a positive integer"))
 			return
 		}
+		query.Limit = limit
+	}
 
-		h.logger.Error("error trying to get user", zap.Error(err))
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	res, err := h.userService.List(ctx.Request.Context(), query)
+	if err != nil {
+		ctx.Error(err)
 		return
 	}
 
-	h.logger.Info("get user succeed", zap.Any("user", u))
-	ctx.JSON(http.StatusOK, u)
+	ctx.JSON(http.StatusOK, res)
 }
 
-// handleUpdate handles PUT /users/:id
+// handleUpdate handles PATCH /users/:id
 func (h *handler) handleUpdate(ctx *gin.Context) {
 	id := ctx.Param("id")
 
 	// bind partial update fields
 	var fields *user.UpdateFields
 	if err := ctx.ShouldBindJSON(&fields); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(invalidBody(err))
 		return
 	}
 
-	u, err := h.userService.Update(id, fields)
+	u, err := h.userService.Update(ctx.Request.Context(), id, fields)
 	if err != nil {
-		if errors.Is(err, user.ErrNotFound) {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
-		}
-
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
@@ -93,13 +141,8 @@ func (h *handler) handleUpdate(ctx *gin.Context) {
 func (h *handler) handleDelete(ctx *gin.Context) {
 	id := ctx.Param("id")
 
-	if err := h.userService.Delete(id); err != nil {
-		if errors.Is(err, user.ErrNotFound) {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
-		}
-
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.userService.Delete(ctx.Request.Context(), id); err != nil {
+		ctx.Error(err)
 		return
 	}
 
@@ -114,6 +157,20 @@ type SalesResponse struct {
 		Rejected    int     `json:"rejected"`
 		Pending     int     `json:"pending"`
 		TotalAmount float32 `json:"total_amount"`
+
+		// Las ventas canceladas y devueltas, y cuanto se devolvio en total
+		Cancelled         int     `json:"cancelled"`
+		PartiallyRefunded int     `json:"partially_refunded"`
+		Refunded          int     `json:"refunded"`
+		RefundedAmount    float32 `json:"refunded_amount"`
+
+		// Totales de impuestos; las ventas sin desglose cuentan todo como neto
+		NetAmount float32            `json:"net_amount"`
+		TaxAmount float32            `json:"tax_amount"`
+		Taxes     map[string]float32 `json:"taxes"`
+
+		// Moneda de todos los montos, vacia si el servicio no tiene cotizaciones
+		Currency string `json:"currency,omitempty"`
 	} `json:"metadata"`
 	Results []*sales.Sales `json:"results"`
 }
@@ -122,30 +179,289 @@ type SalesResponse struct {
 func (h *handler) handleCreateSales(ctx *gin.Context) {
 	// request payload
 	var req struct {
-		UserID string  `json:"user_id"`
-		Amount float32 `json:"amount"`
+		UserID       string        `json:"user_id"`
+		Amount       float32       `json:"amount"`
+		Lines        []lineRequest `json:"lines"`
+		CouponCode   string        `json:"coupon_code"`
+		CouponCodes  []string      `json:"coupon_codes"`
+		Jurisdiction string        `json:"jurisdiction"`
+		Currency     string        `json:"currency"`
 	}
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(invalidBody(err))
 		return
 	}
 
 	s := &sales.Sales{
 		UserID: req.UserID,
 		Amount: req.Amount,
+		Lines:  saleLines(req.Lines),
+
+		CouponCodes:  couponCodes(req.CouponCode, req.CouponCodes),
+		Jurisdiction: req.Jurisdiction,
+		Currency:     req.Currency,
+	}
+	if err := authorizeUser(ctx, s.UserID); err != nil {
+		ctx.Error(err)
+		return
+	}
+	if err := h.salesService.Create(ctx.Request.Context(), s); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	h.log(ctx).Info("sale created", zap.Any("sale", s))
+	ctx.JSON(http.StatusCreated, s)
+}
+
+// handleCreateUserSale handles POST /users/:id/sales
+func (h *handler) handleCreateUserSale(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	var req struct {
+		Amount       float32       `json:"amount"`
+		Lines        []lineRequest `json:"lines"`
+		CouponCode   string        `json:"coupon_code"`
+		CouponCodes  []string      `json:"coupon_codes"`
+		Jurisdiction string        `json:"jurisdiction"`
+		Currency     string        `json:"currency"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(invalidBody(err))
+		return
 	}
-	if err := h.salesService.Create(s); err != nil {
-		if errors.Is(err, sales.ErrUserNotFound) || errors.Is(err, sales.ErrInvalidAmount) {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+	if err := authorizeUser(ctx, id); err != nil {
+		ctx.Error(err)
+		return
+	}
+	if _, err := h.userService.Get(ctx.Request.Context(), id); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	s := &sales.Sales{
+		UserID:       id,
+		Amount:       req.Amount,
+		Lines:        saleLines(req.Lines),
+		CouponCodes:  couponCodes(req.CouponCode, req.CouponCodes),
+		Jurisdiction: req.Jurisdiction,
+		Currency:     req.Currency,
+	}
+	if err := h.salesService.Create(ctx.Request.Context(), s); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	h.log(ctx).Info("sale created", zap.Any("sale", s))
+	ctx.JSON(http.StatusCreated, s)
+}
+
+// handleGetSale handles GET /sales/:id
+func (h *handler) handleGetSale(ctx *gin.Context) {
+	sale, ok := h.ownSale(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, sale)
+}
+
+// handleGetUserSale handles GET /users/:id/sales/:saleId
+func (h *handler) handleGetUserSale(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	if err := authorizeUser(ctx, id); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	sale, err := h.salesService.GetForUser(ctx.Request.Context(), id, ctx.Param("saleId"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, sale)
+}
+
+// batchItemResult is the outcome of one item of POST /sales/batch or PATCH /sales.
+type batchItemResult struct {
+	Index  int           `json:"index"`
+	Status string        `json:"status"`
+	Sale   *sales.Sales  `json:"sale,omitempty"`
+	Error  *batchItemErr `json:"error,omitempty"`
+}
+
+// batchItemErr is the error of a failed batch item, with the same code a single request would get.
+type batchItemErr struct {
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+// handleCreateSalesBatch handles POST /sales/batch
+func (h *handler) handleCreateSalesBatch(ctx *gin.Context) {
+	var req struct {
+		Mode  sales.BatchMode `json:"mode"`
+		Items []struct {
+			UserID       string  `json:"user_id"`
+			Amount       float32 `json:"amount"`
+			Currency     string  `json:"currency"`
+			Jurisdiction string  `json:"jurisdiction"`
+		} `json:"items"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(invalidBody(err))
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = sales.BatchAllOrNothing
+	}
+
+	items := make([]*sales.Sales, 0, len(req.Items))
+	for _, it := range req.Items {
+		// Un item de otro usuario rechaza todo el batch, como lo haria un POST /sales
+		if err := authorizeUser(ctx, it.UserID); err != nil {
+			ctx.Error(err)
 			return
 		}
+		items = append(items, &sales.Sales{UserID: it.UserID, Amount: it.Amount, Currency: it.Currency,
+			Jurisdiction: it.Jurisdiction})
+	}
 
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	results, err := h.salesService.CreateBatch(ctx.Request.Context(), items, req.Mode)
+	if err != nil {
+		ctx.Error(err)
 		return
 	}
 
-	h.logger.Info("sale created", zap.Any("sale", s))
-	ctx.JSON(http.StatusCreated, s)
+	var response struct {
+		Mode    sales.BatchMode   `json:"mode"`
+		Created int               `json:"created"`
+		Failed  int               `json:"failed"`
+		Results []batchItemResult `json:"results"`
+	}
+	response.Mode = req.Mode
+	response.Results = make([]batchItemResult, 0, len(results))
+	for _, r := range results {
+		item := batchItemResult{Index: r.Index, Status: "created", Sale: r.Sale}
+		if r.Err != nil {
+			appErr := apperror.From(r.Err)
+			item.Status = "failed"
+			item.Error = &batchItemErr{Code: appErr.Code, Detail: appErr.Detail}
+			response.Failed++
+		} else {
+			response.Created++
+		}
+		response.Results = append(response.Results, item)
+	}
+
+	h.log(ctx).Info("sales batch processed",
+		zap.String("mode", string(req.Mode)),
+		zap.Int("created", response.Created),
+		zap.Int("failed", response.Failed))
+	ctx.JSON(http.StatusOK, response)
+}
+
+// handleUpdateSalesBatch handles PATCH /sales
+func (h *handler) handleUpdateSalesBatch(ctx *gin.Context) {
+	var req struct {
+		Mode  sales.BatchMode `json:"mode"`
+		Items []struct {
+			ID      string `json:"id"`
+			Status  string `json:"status"`
+			Version int    `json:"version"`
+		} `json:"items"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(invalidBody(err))
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = sales.BatchAllOrNothing
+	}
+
+	changes := make([]sales.StatusChange, 0, len(req.Items))
+	for _, it := range req.Items {
+		changes = append(changes, sales.StatusChange{ID: it.ID, Status: it.Status, Version: it.Version})
+	}
+	if err := h.authorizeSales(ctx, changes); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	results, err := h.salesService.UpdateBatch(ctx.Request.Context(), changes, req.Mode)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var response struct {
+		Mode    sales.BatchMode   `json:"mode"`
+		Updated int               `json:"updated"`
+		Failed  int               `json:"failed"`
+		Results []batchItemResult `json:"results"`
+	}
+	response.Mode = req.Mode
+	response.Results = make([]batchItemResult, 0, len(results))
+	for _, r := range results {
+		item := batchItemResult{Index: r.Index, Status: "updated", Sale: r.Sale}
+		if r.Err != nil {
+			appErr := apperror.From(r.Err)
+			item.Status = "failed"
+			item.Error = &batchItemErr{Code: appErr.Code, Detail: appErr.Detail}
+			response.Failed++
+		} else {
+			response.Updated++
+		}
+		response.Results = append(response.Results, item)
+	}
+
+	h.log(ctx).Info("sales status batch processed",
+		zap.String("mode", string(req.Mode)),
+		zap.Int("updated", response.Updated),
+		zap.Int("failed", response.Failed))
+	ctx.JSON(http.StatusOK, response)
+}
+
+// handleSalesSummary handles GET /users/:id/sales/summary
+func (h *handler) handleSalesSummary(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	if err := authorizeUser(ctx, id); err != nil {
+		ctx.Error(err)
+		return
+	}
+	// El usuario tiene que existir, sino un resumen vacio no dice nada
+	if _, err := h.userService.Get(ctx.Request.Context(), id); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	summary, err := h.salesService.Summary(ctx.Request.Context(), id)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, summary)
+}
+
+// handleRebuildSummaries handles POST /sales/summaries/rebuild
+func (h *handler) handleRebuildSummaries(ctx *gin.Context) {
+	if err := requireUnbound(ctx); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	n, err := h.salesService.RebuildSummaries(ctx.Request.Context())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	h.log(ctx).Info("sales summaries rebuilt", zap.Int("users", n))
+	ctx.JSON(http.StatusOK, gin.H{"users": n})
 }
 
 // handleGetSales handles GET /sales
@@ -154,25 +470,57 @@ func (h *handler) handleGetSales(ctx *gin.Context) {
 	status := ctx.Query("status")
 
 	if user_id == "" {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "user_id es requerido"})
+		ctx.Error(apperror.BadRequest(apperror.CodeMissingParameter, "user_id is required"))
+		return
+	}
+	if err := authorizeUser(ctx, user_id); err != nil {
+		ctx.Error(err)
 		return
 	}
 
-	salesList, err := h.salesService.GetSales(user_id, status)
+	h.respondSales(ctx, user_id, status)
+}
+
+// handleGetUserSales handles GET /users/:id/sales
+func (h *handler) handleGetUserSales(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	if err := authorizeUser(ctx, id); err != nil {
+		ctx.Error(err)
+		return
+	}
+	if _, err := h.userService.Get(ctx.Request.Context(), id); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	h.respondSales(ctx, id, ctx.Query("status"))
+}
+
+// respondSales answers the sales of user_id, optionally filtered by status,
+// with their metadata. The amounts of the metadata are converted to the
+// currency query parameter, the base currency if it is not given.
+func (h *handler) respondSales(ctx *gin.Context, user_id, status string) {
+	conv, err := h.salesService.Converter(ctx.Request.Context(), ctx.Query("currency"))
 	if err != nil {
-		if errors.Is(err, sales.ErrInvalidStatus) {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-		h.logger.Error("error obteniendo ventas",
-			zap.String("user_id", user_id),
-			zap.String("status", status),
-			zap.Error(err))
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		ctx.Error(err)
+		return
+	}
+
+	salesList, err := h.salesService.GetSales(ctx.Request.Context(), user_id, status)
+	if err != nil {
+		ctx.Error(err)
 		return
 	}
 
-	// Calcular metadata
+	// La metadata sale del resumen del usuario, no de recorrer las ventas
+	sum, err := h.salesService.Summary(ctx.Request.Context(), user_id)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	totals := sum.Totals(status)
+
 	var response SalesResponse
 
 	// Asegurar que Results sea un array vacío si no hay ventas
@@ -182,28 +530,40 @@ func (h *handler) handleGetSales(ctx *gin.Context) {
 		response.Results = salesList
 	}
 
-	response.Metadata.Quantity = len(response.Results) // Usar len del slice asignado
+	response.Metadata.Quantity = totals.Count
+	response.Metadata.TotalAmount = conv.Base(totals.Amount)
+	response.Metadata.RefundedAmount = conv.Base(totals.Refunded)
+	response.Metadata.NetAmount = conv.Base(totals.Net)
+	response.Metadata.TaxAmount = conv.Base(totals.Tax)
+	response.Metadata.Taxes = make(map[string]float32, len(totals.Taxes))
+	for name, amount := range totals.Taxes {
+		response.Metadata.Taxes[name] = conv.Base(amount)
+	}
+	response.Metadata.Currency = conv.Currency
 
-	for _, s := range response.Results { // Iterar sobre response.Results
-		response.Metadata.TotalAmount += s.Amount
-		switch s.Status {
-		case "approved":
-			response.Metadata.Approved++
-		case "rejected":
-			response.Metadata.Rejected++
-		case "pending":
-			response.Metadata.Pending++
+	// Con filtro de estado solo cuenta ese estado
+	byStatus := func(st string) int {
+		if status != "" && st != status {
+			return 0
 		}
+		return sum.ByStatus[st]
 	}
+	response.Metadata.Approved = byStatus("approved")
+	response.Metadata.Rejected = byStatus("rejected")
+	response.Metadata.Pending = byStatus("pending")
+	response.Metadata.Cancelled = byStatus(sales.StatusCancelled)
+	response.Metadata.PartiallyRefunded = byStatus(sales.StatusPartiallyRefunded)
+	response.Metadata.Refunded = byStatus(sales.StatusRefunded)
 
 	ctx.JSON(http.StatusOK, response)
 }
-// handleUpdateSales handles PATCH /sales
+
+// handleUpdateSales handles PATCH /sales/:id
 func (h *handler) handleUpdateSales(ctx *gin.Context) {
 	sale_id := ctx.Param("id") // cambie aca para usar Param en lugar de Query
 
 	if sale_id == "" {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "id es requerido"})
+		ctx.Error(apperror.BadRequest(apperror.CodeMissingParameter, "id is required"))
 		return
 	}
 
@@ -211,40 +571,27 @@ func (h *handler) handleUpdateSales(ctx *gin.Context) {
 		Status string `json:"status"`
 	}
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(invalidBody(err))
 		return
 	}
 
 	// Validar que el status esté presente
 	if req.Status == "" {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "status es requerido"})
+		ctx.Error(apperror.BadRequest(apperror.CodeMissingParameter, "status is required"))
+		return
+	}
+
+	if _, ok := h.ownSale(ctx); !ok {
 		return
 	}
 
 	// Actualizar la venta
-	updatedSale, err := h.salesService.Update(sale_id, req.Status)
+	updatedSale, err := h.salesService.Update(ctx.Request.Context(), sale_id, req.Status)
 	if err != nil {
-		if errors.Is(err, sales.ErrNotFound) {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": "sale not found"})
-			return
-		}
-		if errors.Is(err, sales.ErrInvalidStatus) || errors.Is(err, sales.ErrEmptyID) {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-		if errors.Is(err, sales.ErrInvalidTransition) {
-			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
-			return
-		}
-
-		h.logger.Error("error actualizando venta",
-			zap.String("sale_id", sale_id),
-			zap.String("status", req.Status),
-			zap.Error(err))
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		ctx.Error(err)
 		return
 	}
 
-	h.logger.Info("sale updated", zap.Any("sale", updatedSale))
+	h.log(ctx).Info("sale updated", zap.Any("sale", updatedSale))
 	ctx.JSON(http.StatusOK, updatedSale)
 }
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"ej_final/internal/health"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleHealthz handles GET /healthz, it only tells the process is alive.
+func handleHealthz(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"status": health.StatusUp})
+}
+
+// handleReadyz handles GET /readyz, answering 503 if any registered check is down.
+func handleReadyz(reg *health.Registry) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		report := reg.Run(ctx.Request.Context())
+
+		status := http.StatusOK
+		if report.Status != health.StatusUp {
+			status = http.StatusServiceUnavailable
+		}
+		ctx.JSON(status, report)
+	}
+}
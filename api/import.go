@@ -0,0 +1,103 @@
+package api
+
+import (
+	"ej_final/internal/apperror"
+	"ej_final/internal/importer"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// maxImportSize is the largest CSV file accepted by the import endpoints.
+const maxImportSize = 32 << 20
+
+// importRowErr is a failed row of an import, with the code a single
+// request would get.
+type importRowErr struct {
+	Row    int    `json:"row"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+// importResponse is the body of the import endpoints.
+type importResponse struct {
+	Kind    importer.Kind  `json:"kind"`
+	DryRun  bool           `json:"dry_run"`
+	Rows    int            `json:"rows"`
+	Valid   int            `json:"valid"`
+	Invalid int            `json:"invalid"`
+	Written int            `json:"written"`
+	Errors  []importRowErr `json:"errors"`
+}
+
+// handleImportUsers handles POST /imports/users
+func (h *handler) handleImportUsers(ctx *gin.Context) {
+	h.handleImport(ctx, importer.KindUsers)
+}
+
+// handleImportSales handles POST /imports/sales
+func (h *handler) handleImportSales(ctx *gin.Context) {
+	h.handleImport(ctx, importer.KindSales)
+}
+
+// handleImport reads the CSV body and answers the row-level report.
+// With dry_run=true nothing is written.
+func (h *handler) handleImport(ctx *gin.Context, kind importer.Kind) {
+	if err := requireUnbound(ctx); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	dryRun := false
+	if raw := ctx.Query("dry_run"); raw != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(raw); err != nil {
+			ctx.Error(apperror.BadRequest(apperror.CodeInvalidParameter, "dry_run must be a boolean"))
+			return
+		}
+	}
+
+	body := http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxImportSize)
+	report, err := h.importer.Import(ctx.Request.Context(), kind, body, dryRun)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			ctx.Error(apperror.New(http.StatusRequestEntityTooLarge, "import_too_large",
+				fmt.Sprintf("the file must not exceed %d bytes", maxImportSize)))
+			return
+		}
+		ctx.Error(err)
+		return
+	}
+
+	response := importResponse{
+		Kind:    report.Kind,
+		DryRun:  report.DryRun,
+		Rows:    report.Rows,
+		Valid:   report.Valid,
+		Invalid: len(report.Errors),
+		Written: report.Written,
+		Errors:  make([]importRowErr, 0, len(report.Errors)),
+	}
+	for _, e := range report.Errors {
+		appErr := apperror.From(e.Err)
+		// El detalle del error de la fila dice que columna fallo, salvo que sea un error interno
+		detail := appErr.Detail
+		if appErr.Status < http.StatusInternalServerError {
+			detail = e.Err.Error()
+		}
+		response.Errors = append(response.Errors, importRowErr{Row: e.Row, Code: appErr.Code, Detail: detail})
+	}
+
+	h.log(ctx).Info("import processed",
+		zap.String("kind", string(kind)),
+		zap.Bool("dry_run", dryRun),
+		zap.Int("rows", response.Rows),
+		zap.Int("invalid", response.Invalid),
+		zap.Int("written", response.Written))
+	ctx.JSON(http.StatusOK, response)
+}
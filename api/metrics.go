@@ -0,0 +1,52 @@
+package api
+
+import (
+	"ej_final/internal/metrics"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// httpMetrics are the per-route HTTP collectors.
+type httpMetrics struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+}
+
+func newHTTPMetrics(reg *metrics.Registry) *httpMetrics {
+	return &httpMetrics{
+		requests: reg.NewCounterVec("http_requests_total",
+			"HTTP requests served, by route and status code.", "method", "route", "status"),
+		duration: reg.NewHistogramVec("http_request_duration_seconds",
+			"HTTP request latency, by route.", nil, "method", "route"),
+	}
+}
+
+// middleware records the count, status and latency of every request.
+func (m *httpMetrics) middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		// Usamos el template de la ruta para no explotar la cardinalidad con los IDs
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := ctx.Request.Method
+
+		m.requests.Inc(method, route, strconv.Itoa(ctx.Writer.Status()))
+		m.duration.Observe(time.Since(start).Seconds(), method, route)
+	}
+}
+
+// handleMetrics handles GET /metrics
+func handleMetrics(reg *metrics.Registry) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+		ctx.Header("Content-Type", metrics.ContentType)
+		_ = reg.WriteText(ctx.Writer)
+	}
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"ej_final/internal/openapi"
+	_ "embed"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed openapi.json
+var openAPIDocument []byte
+
+//go:embed docs.html
+var docsPage []byte
+
+// spec is the parsed contract, loaded once at startup.
+var spec = mustLoadSpec()
+
+func mustLoadSpec() *openapi.Spec {
+	s, err := openapi.Load(openAPIDocument)
+	if err != nil {
+		panic(fmt.Sprintf("api: invalid embedded openapi.json: %v", err))
+	}
+	return s
+}
+
+// handleOpenAPI handles GET /openapi.json
+func handleOpenAPI(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "application/json", openAPIDocument)
+}
+
+// handleDocs handles GET /docs
+func handleDocs(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", docsPage)
+}
+
+// bodyRecorder keeps a copy of what the handlers write.
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// ValidateOpenAPI returns a middleware that checks every request and response
+// against the embedded OpenAPI document and calls report for each mismatch.
+// It is meant for tests: register it on the engine before InitRoutes so drift
+// between the handlers and the contract fails the suite. Traffic is never modified.
+func ValidateOpenAPI(report func(err error)) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		route, err := spec.FindRoute(ctx.Request.Method, ctx.Request.URL.Path)
+		if err != nil {
+			report(err)
+			ctx.Next()
+			return
+		}
+
+		body, _ := io.ReadAll(ctx.Request.Body)
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err := spec.ValidateRequest(route, ctx.Request.URL.Query(), ctx.ContentType(), body); err != nil {
+			report(fmt.Errorf("%s %s request: %w", ctx.Request.Method, ctx.Request.URL.Path, err))
+		}
+
+		rec := &bodyRecorder{ResponseWriter: ctx.Writer}
+		ctx.Writer = rec
+		ctx.Next()
+
+		if err := spec.ValidateResponse(route, rec.Status(), rec.Header().Get("Content-Type"), rec.body.Bytes()); err != nil {
+			report(fmt.Errorf("%s %s response: %w", ctx.Request.Method, ctx.Request.URL.Path, err))
+		}
+	}
+}
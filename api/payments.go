@@ -0,0 +1,69 @@
+package api
+
+import (
+	"ej_final/internal/apperror"
+	"ej_final/internal/payment"
+	"ej_final/internal/sales"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// maxCallbackSize is the largest body accepted by POST /payments/callback.
+const maxCallbackSize = 64 << 10
+
+// callbackResponse is the answer of POST /payments/callback. Applied is false
+// for callbacks acknowledged without changing the sale, and Conflict true for
+// the ones that contradict its final status.
+type callbackResponse struct {
+	EventID  string       `json:"event_id,omitempty"`
+	Applied  bool         `json:"applied"`
+	Conflict bool         `json:"conflict,omitempty"`
+	Sale     *sales.Sales `json:"sale"`
+}
+
+// handlePaymentCallback handles POST /payments/callback
+func (h *handler) handlePaymentCallback(ctx *gin.Context) {
+	if h.callbacks == nil {
+		ctx.Error(payment.ErrCallbacksDisabled)
+		return
+	}
+
+	// La firma es sobre el body tal cual llego, asi que se lee antes de decodificarlo
+	body, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxCallbackSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			ctx.Error(apperror.New(http.StatusRequestEntityTooLarge, "callback_too_large",
+				fmt.Sprintf("the callback must not exceed %d bytes", maxCallbackSize)))
+			return
+		}
+		ctx.Error(invalidBody(err))
+		return
+	}
+
+	cb, err := h.callbacks.Parse(body, ctx.GetHeader(payment.SignatureHeader))
+	if err != nil {
+		h.log(ctx).Warn("payment callback rejected", zap.Error(err))
+		ctx.Error(err)
+		return
+	}
+
+	outcome, err := h.salesService.ApplyPayment(ctx.Request.Context(), cb)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	h.log(ctx).Info("payment callback processed",
+		zap.String("event_id", cb.EventID),
+		zap.String("sale_id", outcome.Sale.ID),
+		zap.Bool("applied", outcome.Applied),
+		zap.Bool("conflict", outcome.Conflict))
+	ctx.JSON(http.StatusOK, callbackResponse{EventID: cb.EventID, Applied: outcome.Applied,
+		Conflict: outcome.Conflict, Sale: outcome.Sale})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"ej_final/internal/product"
+	"ej_final/internal/sales"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// lineRequest is a line of the body of POST /sales. Its SKU and price come
+// from the catalog, so the client only says what and how many.
+type lineRequest struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+// saleLines converts the lines of a request, nil if there are none.
+func saleLines(req []lineRequest) []sales.Line {
+	if len(req) == 0 {
+		return nil
+	}
+	lines := make([]sales.Line, 0, len(req))
+	for _, l := range req {
+		lines = append(lines, sales.Line{ProductID: l.ProductID, Quantity: l.Quantity})
+	}
+	return lines
+}
+
+// handleCreateProduct handles POST /products
+func (h *handler) handleCreateProduct(ctx *gin.Context) {
+	var req struct {
+		SKU   string  `json:"sku"`
+		Name  string  `json:"name"`
+		Price float32 `json:"price"`
+		Stock int     `json:"stock"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(invalidBody(err))
+		return
+	}
+
+	p := &product.Product{
+		SKU:   req.SKU,
+		Name:  req.Name,
+		Price: req.Price,
+		Stock: req.Stock,
+	}
+	if err := h.productService.Create(ctx.Request.Context(), p); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	h.log(ctx).Info("product created", zap.Any("product", p))
+	ctx.JSON(http.StatusCreated, p)
+}
+
+// handleListProducts handles GET /products
+func (h *handler) handleListProducts(ctx *gin.Context) {
+	products, err := h.productService.List(ctx.Request.Context())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"results": products})
+}
+
+// handleGetProduct handles GET /products/:id
+func (h *handler) handleGetProduct(ctx *gin.Context) {
+	p, err := h.productService.Get(ctx.Request.Context(), ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, p)
+}
+
+// handleUpdateProduct handles PATCH /products/:id
+func (h *handler) handleUpdateProduct(ctx *gin.Context) {
+	var fields product.UpdateFields
+	if err := ctx.ShouldBindJSON(&fields); err != nil {
+		ctx.Error(invalidBody(err))
+		return
+	}
+
+	p, err := h.productService.Update(ctx.Request.Context(), ctx.Param("id"), &fields)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	h.log(ctx).Info("product updated", zap.Any("product", p))
+	ctx.JSON(http.StatusOK, p)
+}
+
+// handleDeleteProduct handles DELETE /products/:id
+func (h *handler) handleDeleteProduct(ctx *gin.Context) {
+	if err := h.productService.Delete(ctx.Request.Context(), ctx.Param("id")); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"crypto/subtle"
+	"ej_final/internal/apperror"
+	"ej_final/internal/logging"
+	"ej_final/internal/ratelimit"
+	"ej_final/internal/sales"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// rateLimitKey identifies the client of the request with what authenticate
+// validated: the user its API key is bound to, then the API key, and
+// finally the client IP. An X-API-Key that was not checked counts for
+// nothing, otherwise a new made-up key per request would never be limited.
+func rateLimitKey(ctx *gin.Context) string {
+	if id := ctx.GetString(authUserKey); id != "" {
+		return "user:" + id
+	}
+
+	if id := ctx.GetString(apiKeyIDKey); id != "" {
+		return "key:" + id
+	}
+
+	return "ip:" + ctx.ClientIP()
+}
+
+// rateLimit returns a middleware that applies the configured token bucket per
+// client and route, answering 429 Too Many Requests once the bucket is empty.
+// Requests carrying internalToken in sales.InternalTokenHeader are the lookups
+// of the service itself and are not throttled; an empty token exempts nothing.
+func rateLimit(l ratelimit.Limiter, cfg ratelimit.Config, internalToken string, logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if internalToken != "" && subtle.ConstantTimeCompare([]byte(ctx.GetHeader(sales.InternalTokenHeader)), []byte(internalToken)) == 1 {
+			ctx.Next()
+			return
+		}
+
+		route := unversionedRoute(ctx.FullPath())
+		rule := cfg.RuleFor(ctx.Request.Method, route)
+
+		res, err := l.Allow(rateLimitKey(ctx)+"|"+ctx.Request.Method+" "+route, rule)
+		if err != nil {
+			// Si el limiter falla dejamos pasar la request, no queremos cortar la API por esto
+			logging.FromContext(ctx.Request.Context(), logger).Error("rate limiter failed", zap.String("route", route), zap.Error(err))
+			ctx.Next()
+			return
+		}
+
+		ctx.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+		ctx.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		ctx.Header("RateLimit-Reset", durationToSeconds(res.Reset))
+
+		if !res.Allowed {
+			ctx.Header("Retry-After", durationToSeconds(res.RetryAfter))
+			ctx.Error(apperror.New(http.StatusTooManyRequests, apperror.CodeRateLimited, "rate limit exceeded"))
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// durationToSeconds renders d as whole seconds, rounding up.
+func durationToSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"ej_final/internal/sales"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// refundResponse is the answer of POST /sales/:id/refunds: the updated sale
+// and the refund just recorded.
+type refundResponse struct {
+	Sale   *sales.Sales  `json:"sale"`
+	Refund *sales.Refund `json:"refund"`
+}
+
+// refundsResponse is the answer of GET /sales/:id/refunds.
+type refundsResponse struct {
+	Results       []*sales.Refund `json:"results"`
+	TotalRefunded float32         `json:"total_refunded"`
+}
+
+// handleCancelSale handles POST /sales/:id/cancel
+func (h *handler) handleCancelSale(ctx *gin.Context) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(invalidBody(err))
+		return
+	}
+
+	if _, ok := h.ownSale(ctx); !ok {
+		return
+	}
+
+	sale, err := h.salesService.Cancel(ctx.Request.Context(), ctx.Param("id"), req.Reason)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	h.log(ctx).Info("sale cancelled", zap.String("sale_id", sale.ID))
+	ctx.JSON(http.StatusOK, sale)
+}
+
+// handleRefundSale handles POST /sales/:id/refunds
+func (h *handler) handleRefundSale(ctx *gin.Context) {
+	var req struct {
+		Amount float32 `json:"amount"`
+		Reason string  `json:"reason"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(invalidBody(err))
+		return
+	}
+
+	if _, ok := h.ownSale(ctx); !ok {
+		return
+	}
+
+	sale, refund, err := h.salesService.Refund(ctx.Request.Context(), ctx.Param("id"), req.Amount, req.Reason)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	h.log(ctx).Info("sale refunded", zap.String("sale_id", sale.ID), zap.String("refund_id", refund.ID))
+	ctx.JSON(http.StatusCreated, refundResponse{Sale: sale, Refund: refund})
+}
+
+// handleGetRefunds handles GET /sales/:id/refunds
+func (h *handler) handleGetRefunds(ctx *gin.Context) {
+	sale, ok := h.ownSale(ctx)
+	if !ok {
+		return
+	}
+
+	refunds, err := h.salesService.Refunds(ctx.Request.Context(), sale.ID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	response := refundsResponse{Results: refunds}
+	for _, r := range refunds {
+		// Las fallidas no se devolvieron, las pendientes la venta ya las cuenta
+		if r.Status != sales.RefundFailed {
+			response.TotalRefunded += r.Amount
+		}
+	}
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"ej_final/internal/requestid"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestID returns a middleware that accepts the client's X-Request-ID (or
+// generates a new one), stores it in the request context and echoes it back.
+func requestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		ctx.Request = ctx.Request.WithContext(requestid.NewContext(ctx.Request.Context(), id))
+		ctx.Header(requestid.Header, id)
+		ctx.Next()
+	}
+}
@@ -1,46 +1,159 @@
 package api
 
 import (
+	"context"
+	"ej_final/internal/coupon"
+	"ej_final/internal/currency"
+	"ej_final/internal/health"
+	"ej_final/internal/importer"
+	"ej_final/internal/metrics"
+	"ej_final/internal/payment"
+	"ej_final/internal/product"
+	"ej_final/internal/ratelimit"
 	"ej_final/internal/sales"
+	"ej_final/internal/tax"
+	"ej_final/internal/tracing"
 	"ej_final/internal/user"
-	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
+// rateLimits are the per-route token buckets applied to every client.
+// POST /sales is tighter because each call also does a request to /users/:id,
+// and batches even more since each one carries up to sales.MaxBatchSize sales.
+// Imports read whole files, so they get the lowest rate. Payment callbacks come
+// from the gateway, which can retry many of them at once.
+var rateLimits = ratelimit.Config{
+	Default: ratelimit.Rule{Rate: 20, Burst: 100},
+	Routes: map[string]ratelimit.Rule{
+		"POST /sales":             {Rate: 5, Burst: 20},
+		"POST /users/:id/sales":   {Rate: 5, Burst: 20},
+		"POST /sales/batch":       {Rate: 1, Burst: 5},
+		"PATCH /sales":            {Rate: 1, Burst: 5},
+		"POST /sales/:id/refunds": {Rate: 5, Burst: 20},
+		"GET /sales/export":       {Rate: 1, Burst: 5},
+		"POST /imports/users":     {Rate: 0.2, Burst: 5},
+		"POST /imports/sales":     {Rate: 0.2, Burst: 5},
+		"POST /payments/callback": {Rate: 50, Burst: 200},
+
+		"POST /sales/summaries/rebuild": {Rate: 0.2, Burst: 2},
+	},
+}
+
+// reservationSweepInterval is how often expired stock reservations are released.
+const reservationSweepInterval = time.Minute
+
 // InitRoutes registers all user CRUD endpoints on the given Gin engine.
 // It initializes the storage, service, and handler, then binds each HTTP
-// method and path to the appropriate handler function.
+// method and path to the appropriate handler function. Business endpoints
+// are mounted once per API version (/v1, /v2) and, for old clients, without
+// prefix as a deprecated alias of the current version.
 func InitRoutes(e *gin.Engine, url string) {
 	logger, _ := zap.NewProduction()
 	defer logger.Sync()
 
+	registry := metrics.NewRegistry()
+
+	exporter, err := tracing.ExporterFromEnv()
+	if err != nil {
+		logger.Error("invalid tracing configuration, spans will not be exported", zap.Error(err))
+	}
+	tracer := tracing.NewTracer(exporter)
+
 	// Inicializar user service
 	userStorage := user.NewLocalStorage()
 	userService := user.NewService(userStorage, logger)
 
+	// Inicializar el catalogo de productos
+	productStorage := product.NewLocalStorage()
+	productService := product.NewService(productStorage, logger)
+	// Las reservas vencidas tambien se liberan al reservar; esto devuelve el stock de los productos quietos
+	go productService.RunExpirer(context.Background(), reservationSweepInterval)
+
+	// Inicializar los cupones de descuento
+	couponStorage := coupon.NewLocalStorage()
+	couponService := coupon.NewService(couponStorage, logger)
+
+	// Las consultas de sales a /users/:id van con este token para que el rate limit no las frene
+	internalToken := uuid.NewString()
+
+	// Inicializar los impuestos, sin reglas validas las ventas quedan sin desglose
+	salesOpts := []sales.Option{
+		sales.WithMetrics(sales.NewMetrics(registry)),
+		sales.WithInternalToken(internalToken),
+		sales.WithCatalog(productService),
+		sales.WithCoupons(couponService),
+	}
+	taxes, err := tax.TableFromEnv()
+	if err != nil {
+		logger.Error("invalid tax rules, sales will not be taxed", zap.Error(err))
+	} else {
+		salesOpts = append(salesOpts, sales.WithTaxes(taxes))
+	}
+	// Sin tabla de cotizaciones las ventas quedan todas en una misma moneda
+	rates, err := currency.TableFromEnv()
+	switch {
+	case err != nil:
+		logger.Error("invalid currency rates, sales will be kept in a single currency", zap.Error(err))
+	case rates != nil:
+		salesOpts = append(salesOpts, sales.WithRates(rates))
+	}
+	// Sin gateway de pagos el estado inicial de las ventas sigue siendo aleatorio
+	gateway, err := payment.ClientFromEnv()
+	switch {
+	case err != nil:
+		logger.Error("invalid payment gateway configuration, sales will not be charged", zap.Error(err))
+	case gateway != nil:
+		salesOpts = append(salesOpts, sales.WithPayments(gateway))
+	}
+
 	// Inicializar sales service
 	salesStorage := sales.NewLocalStorage()
-	salesService := sales.NewService(salesStorage, logger,url)
+	salesService := sales.NewService(salesStorage, logger, url, salesOpts...)
+
+	checks := health.NewRegistry()
+	checks.Register("user_storage", 0, userStorage.Ping)
+	checks.Register("sales_storage", 0, salesStorage.Ping)
+	checks.Register("product_storage", 0, productStorage.Ping)
+	checks.Register("coupon_storage", 0, couponStorage.Ping)
+	checks.Register("user_lookup", 0, salesService.PingUserAPI)
+	if gateway != nil {
+		checks.Register("payment_gateway", 0, gateway.Ping)
+	}
+
+	// Sin API keys configuradas el header X-API-Key se ignora, no hay duenos y se limita por IP
+	keys, err := apiKeysFromEnv()
+	if err != nil {
+		logger.Error("invalid API keys, every client will be anonymous", zap.Error(err))
+	}
 
 	h := handler{
-		userService:  userService,
-		salesService: salesService,
-		logger:       logger,
-	}
-
-	e.POST("/users", h.handleCreate)
-	e.GET("/users/:id", h.handleRead)
-	e.PATCH("/users/:id", h.handleUpdate)
-	e.DELETE("/users/:id", h.handleDelete)
-	e.POST("/sales", h.handleCreateSales)
-	e.GET("/sales", h.handleGetSales)
-	e.PATCH("/sales/:id", h.handleUpdateSales)
-
-	e.GET("/ping", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "pong",
-		})
-	})
+		userService:    userService,
+		salesService:   salesService,
+		productService: productService,
+		couponService:  couponService,
+		importer:       importer.New(userService, salesService, logger),
+		logger:         logger,
+		callbacks:      payment.VerifierFromEnv(),
+	}
+
+	e.Use(requestID())
+	e.Use(tracingMiddleware(tracer))
+	e.Use(newHTTPMetrics(registry).middleware())
+	e.Use(errorHandler(logger))
+	e.Use(authenticate(keys, internalToken))
+	e.Use(rateLimit(ratelimit.NewMemoryLimiter(), rateLimits, internalToken, logger))
+
+	mountVersions(e, &h)
+
+	e.GET("/metrics", handleMetrics(registry))
+	e.GET("/openapi.json", handleOpenAPI)
+	e.GET("/docs", handleDocs)
+
+	e.NoRoute(handleNoRoute)
+	e.GET("/healthz", handleHealthz)
+	e.GET("/readyz", handleReadyz(checks))
 }
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"ej_final/internal/apperror"
+	"ej_final/internal/sales"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultStatsRange is the range of GET /sales/stats when from is not given.
+const defaultStatsRange = 30 * 24 * time.Hour
+
+// parseStatsTime accepts RFC 3339 timestamps or plain dates (midnight UTC).
+func parseStatsTime(name, value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, apperror.BadRequest(apperror.CodeInvalidParameter, name+" must be a date (YYYY-MM-DD) or an RFC 3339 timestamp")
+}
+
+// handleSalesStats handles GET /sales/stats
+func (h *handler) handleSalesStats(ctx *gin.Context) {
+	q := sales.StatsQuery{
+		Interval: sales.Interval(ctx.DefaultQuery("interval", string(sales.IntervalDay))),
+		UserID:   ctx.Query("user_id"),
+		Currency: ctx.Query("currency"),
+		To:       time.Now().UTC(),
+	}
+	var err error
+	if q.UserID, err = scopeUser(ctx, q.UserID); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	if raw := ctx.Query("to"); raw != "" {
+		to, err := parseStatsTime("to", raw)
+		if err != nil {
+			ctx.Error(err)
+			return
+		}
+		q.To = to
+	}
+	q.From = q.To.Add(-defaultStatsRange)
+	if raw := ctx.Query("from"); raw != "" {
+		from, err := parseStatsTime("from", raw)
+		if err != nil {
+			ctx.Error(err)
+			return
+		}
+		q.From = from
+	}
+
+	if raw := ctx.Query("top"); raw != "" {
+		top, err := strconv.Atoi(raw)
+		if err != nil || top <= 0 {
+			ctx.Error(apperror.BadRequest(apperror.CodeInvalidParameter, "top must be a positive integer"))
+			return
+		}
+		q.TopUsers = top
+	}
+
+	stats, err := h.salesService.Stats(ctx.Request.Context(), q)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"ej_final/internal/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tracingMiddleware starts the server span of every request, continuing the
+// trace of the incoming traceparent header when there is a valid one.
+func tracingMiddleware(t *tracing.Tracer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		remote, _ := tracing.Extract(ctx.Request.Header)
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		c, span := t.Start(ctx.Request.Context(), ctx.Request.Method+" "+route, tracing.KindServer, remote)
+		defer span.End()
+
+		span.SetAttribute("http.method", ctx.Request.Method)
+		span.SetAttribute("http.route", route)
+		ctx.Request = ctx.Request.WithContext(c)
+
+		ctx.Next()
+
+		span.SetAttribute("http.status_code", ctx.Writer.Status())
+		if err := ctx.Errors.Last(); err != nil {
+			span.RecordError(err)
+		}
+	}
+}
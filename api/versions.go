@@ -0,0 +1,161 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// route is one endpoint of a version of the API.
+type route struct {
+	method  string
+	path    string
+	handler gin.HandlerFunc
+}
+
+// apiVersion is a set of routes mounted under /<name>.
+type apiVersion struct {
+	name   string
+	routes func(h *handler) []route
+
+	// deprecated and sunset are set once a newer version replaces this one.
+	deprecated time.Time
+	sunset     time.Time
+}
+
+// currentVersion is the version unversioned paths are aliased to.
+const currentVersion = "v1"
+
+// unversionedDeprecated and unversionedSunset apply to the legacy routes without version prefix.
+var (
+	unversionedDeprecated = time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC)
+	unversionedSunset     = time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// versions lists every mounted API version, oldest first.
+var versions = []apiVersion{
+	{name: "v1", routes: v1Routes},
+	{name: "v2", routes: v2Routes},
+}
+
+// v1Routes are the business endpoints of the first version of the API.
+func v1Routes(h *handler) []route {
+	return []route{
+		{http.MethodPost, "/users", h.handleCreate},
+		{http.MethodGet, "/users", h.handleListUsers},
+		{http.MethodGet, "/users/:id", h.handleRead},
+		{http.MethodPatch, "/users/:id", h.handleUpdate},
+		{http.MethodDelete, "/users/:id", h.handleDelete},
+		{http.MethodGet, "/users/:id/sales", h.handleGetUserSales},
+		{http.MethodPost, "/users/:id/sales", h.handleCreateUserSale},
+		{http.MethodGet, "/users/:id/sales/summary", h.handleSalesSummary},
+		{http.MethodGet, "/users/:id/sales/:saleId", h.handleGetUserSale},
+		{http.MethodPost, "/sales", h.handleCreateSales},
+		{http.MethodPost, "/sales/batch", h.handleCreateSalesBatch},
+		{http.MethodGet, "/sales", h.handleGetSales},
+		{http.MethodGet, "/sales/export", h.handleExportSales},
+		{http.MethodGet, "/sales/stats", h.handleSalesStats},
+		{http.MethodGet, "/sales/:id", h.handleGetSale},
+		{http.MethodPatch, "/sales", h.handleUpdateSalesBatch},
+		{http.MethodPatch, "/sales/:id", h.handleUpdateSales},
+		{http.MethodPost, "/sales/:id/cancel", h.handleCancelSale},
+		{http.MethodPost, "/sales/:id/refunds", h.handleRefundSale},
+		{http.MethodGet, "/sales/:id/refunds", h.handleGetRefunds},
+		{http.MethodPost, "/sales/summaries/rebuild", h.handleRebuildSummaries},
+		{http.MethodPost, "/products", h.handleCreateProduct},
+		{http.MethodGet, "/products", h.handleListProducts},
+		{http.MethodGet, "/products/:id", h.handleGetProduct},
+		{http.MethodPatch, "/products/:id", h.handleUpdateProduct},
+		{http.MethodDelete, "/products/:id", h.handleDeleteProduct},
+		{http.MethodPost, "/coupons", h.handleCreateCoupon},
+		{http.MethodGet, "/coupons", h.handleListCoupons},
+		{http.MethodGet, "/coupons/:code", h.handleGetCoupon},
+		{http.MethodDelete, "/coupons/:code", h.handleDeleteCoupon},
+		{http.MethodPost, "/imports/users", h.handleImportUsers},
+		{http.MethodPost, "/imports/sales", h.handleImportSales},
+		{http.MethodPost, "/payments/callback", h.handlePaymentCallback},
+	}
+}
+
+// v2Routes starts from v1 and replaces the endpoints that change in v2.
+// Breaking changes go in v2Overrides, sharing the same services as v1.
+func v2Routes(h *handler) []route {
+	return overrideRoutes(v1Routes(h), v2Overrides(h))
+}
+
+// v2Overrides are the v2 endpoints that differ from v1. None yet.
+func v2Overrides(h *handler) []route {
+	return nil
+}
+
+// overrideRoutes returns base with the routes of overrides replacing the
+// ones with the same method and path, and new ones appended.
+func overrideRoutes(base, overrides []route) []route {
+	out := append([]route(nil), base...)
+	for _, o := range overrides {
+		replaced := false
+		for i, r := range out {
+			if r.method == o.method && r.path == o.path {
+				out[i] = o
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// mountVersions registers every version under its prefix and the current
+// version again at the root as a deprecated alias for old clients.
+func mountVersions(e *gin.Engine, h *handler) {
+	for _, v := range versions {
+		g := e.Group("/" + v.name)
+		if !v.deprecated.IsZero() {
+			g.Use(deprecation(v.deprecated, v.sunset, ""))
+		}
+		for _, r := range v.routes(h) {
+			g.Handle(r.method, r.path, r.handler)
+		}
+
+		if v.name != currentVersion {
+			continue
+		}
+		legacy := e.Group("/", deprecation(unversionedDeprecated, unversionedSunset, "/"+v.name))
+		for _, r := range v.routes(h) {
+			legacy.Handle(r.method, r.path, r.handler)
+		}
+	}
+}
+
+// deprecation returns a middleware that flags responses as deprecated
+// (RFC 9745) with their Sunset date (RFC 8594). If successor is set, a Link
+// to the same path under it is added.
+func deprecation(since, sunset time.Time, successor string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Header("Deprecation", "@"+strconv.FormatInt(since.Unix(), 10))
+		if !sunset.IsZero() {
+			ctx.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		if successor != "" {
+			ctx.Header("Link", "<"+successor+ctx.Request.URL.Path+`>; rel="successor-version"`)
+		}
+		ctx.Next()
+	}
+}
+
+// unversionedRoute strips the version prefix of a route template, so rules
+// keyed by path apply to every version and to the legacy aliases alike.
+func unversionedRoute(route string) string {
+	for _, v := range versions {
+		if p := "/" + v.name; route == p || strings.HasPrefix(route, p+"/") {
+			return strings.TrimPrefix(route, p)
+		}
+	}
+	return route
+}
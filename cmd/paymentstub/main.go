@@ -0,0 +1,28 @@
+// Command paymentstub runs a local payment gateway that simulates approvals,
+// declines and timeouts, so the API can be run without a real provider.
+//
+// Usage:
+//
+//	paymentstub [-addr :8090] [-delay 30s]
+//
+// Then start the API with PAYMENT_GATEWAY_URL=http://localhost:8090. Sales
+// whose amount ends in .51 are declined, in .52 time out and in .53 are
+// authorized but their capture is declined.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"ej_final/internal/payment"
+)
+
+func main() {
+	addr := flag.String("addr", ":8090", "address to listen on")
+	delay := flag.Duration("delay", payment.DefaultStubDelay, "how long the authorizations that time out are held")
+	flag.Parse()
+
+	log.Printf("payment stub listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, payment.NewStub(*delay)))
+}
@@ -0,0 +1,222 @@
+// Command salesctl runs offline tasks against a running sales API.
+//
+// Usage:
+//
+//	salesctl export [-url http://localhost:8080] [-format csv|ndjson] [-user_id ID] [-status STATUS] [-o FILE]
+//	salesctl import [-url http://localhost:8080] -kind users|sales [-dry-run] FILE
+//	salesctl rebuild-summaries [-url http://localhost:8080]
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+
+	"ej_final/internal/sales"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = runExport(ctx, os.Args[2:])
+	case "import":
+		err = runImport(ctx, os.Args[2:])
+	case "rebuild-summaries":
+		err = runRebuildSummaries(ctx, os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "salesctl:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: salesctl export [flags]")
+	fmt.Fprintln(os.Stderr, "       salesctl import -kind users|sales [-dry-run] FILE")
+	fmt.Fprintln(os.Stderr, "       salesctl rebuild-summaries")
+}
+
+// runExport downloads the sales as NDJSON from the API and writes them with
+// a sales.Exporter, so the file has the same layout as GET /sales/export.
+func runExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	baseURL := fs.String("url", "http://localhost:8080", "base URL of the API")
+	format := fs.String("format", "csv", "output format: csv or ndjson")
+	userID := fs.String("user_id", "", "only export the sales of this user")
+	status := fs.String("status", "", "only export the sales with this status")
+	out := fs.String("o", "", "output file, stdout if empty")
+	fs.Parse(args)
+
+	f, err := sales.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	exp, err := sales.NewExporter(w, f)
+	if err != nil {
+		return err
+	}
+
+	q := url.Values{"format": {string(sales.FormatNDJSON)}}
+	if *userID != "" {
+		q.Set("user_id", *userID)
+	}
+	if *status != "" {
+		q.Set("status", *status)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, *baseURL+"/v1/sales/export?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("API answered %d: %s", resp.StatusCode, body)
+	}
+
+	// Se decodifica de a una venta, sin cargar el export entero en memoria
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var s sales.Sales
+		if err := dec.Decode(&s); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+		if err := exp.Write(&s); err != nil {
+			return err
+		}
+	}
+	if err := exp.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%d sales exported\n", exp.Rows())
+	return nil
+}
+
+// runImport uploads a CSV file to the import endpoint and prints the report.
+// It fails if any row was rejected, so it can gate a migration script.
+func runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	baseURL := fs.String("url", "http://localhost:8080", "base URL of the API")
+	kind := fs.String("kind", "", "what the file holds: users or sales")
+	dryRun := fs.Bool("dry-run", false, "only validate the rows, do not write them")
+	fs.Parse(args)
+
+	if *kind != "users" && *kind != "sales" {
+		return errors.New("-kind must be users or sales")
+	}
+	if fs.NArg() != 1 {
+		return errors.New("missing the CSV file to import")
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	q := url.Values{"dry_run": {strconv.FormatBool(*dryRun)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, *baseURL+"/v1/imports/"+*kind+"?"+q.Encode(), file)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/csv")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API answered %d: %s", resp.StatusCode, body)
+	}
+
+	var report struct {
+		Invalid int `json:"invalid"`
+	}
+	if err := json.Unmarshal(body, &report); err != nil {
+		return err
+	}
+	var pretty bytes.Buffer
+	json.Indent(&pretty, body, "", "  ")
+	fmt.Println(pretty.String())
+
+	if report.Invalid > 0 {
+		return fmt.Errorf("rows rejected: %d", report.Invalid)
+	}
+	return nil
+}
+
+// runRebuildSummaries asks the API to recompute the per-user sales summaries.
+func runRebuildSummaries(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("rebuild-summaries", flag.ExitOnError)
+	baseURL := fs.String("url", "http://localhost:8080", "base URL of the API")
+	fs.Parse(args)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, *baseURL+"/v1/sales/summaries/rebuild", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API answered %d: %s", resp.StatusCode, body)
+	}
+
+	var result struct {
+		Users int `json:"users"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "summaries rebuilt for %d users\n", result.Users)
+	return nil
+}
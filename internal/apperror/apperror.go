@@ -0,0 +1,180 @@
+package apperror
+
+import (
+	"context"
+	"ej_final/internal/coupon"
+	"ej_final/internal/currency"
+	"ej_final/internal/importer"
+	"ej_final/internal/payment"
+	"ej_final/internal/product"
+	"ej_final/internal/sales"
+	"ej_final/internal/tax"
+	"ej_final/internal/user"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error is an application error with a stable, machine-readable Code and
+// the HTTP status it must be answered with.
+type Error struct {
+	Status int
+	Code   string
+	Title  string
+	Detail string
+
+	// Err is the underlying error, if any.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Code, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Detail)
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New creates an Error whose title is the standard text of status.
+func New(status int, code, detail string) *Error {
+	return &Error{
+		Status: status,
+		Code:   code,
+		Title:  http.StatusText(status),
+		Detail: detail,
+	}
+}
+
+// BadRequest creates a 400 Error, used for malformed or incomplete requests.
+func BadRequest(code, detail string) *Error {
+	return New(http.StatusBadRequest, code, detail)
+}
+
+// Codes shared by the handlers that are not tied to a domain sentinel.
+const (
+	CodeInvalidBody      = "invalid_body"
+	CodeMissingParameter = "missing_parameter"
+	CodeInvalidParameter = "invalid_parameter"
+	CodeRouteNotFound    = "route_not_found"
+	CodeRateLimited      = "rate_limited"
+	CodeInternal         = "internal_error"
+)
+
+// mapping ties a sentinel error to its code and status.
+type mapping struct {
+	target error
+	status int
+	code   string
+}
+
+// mappings is the single source of truth for how domain errors are exposed.
+// Order matters only for errors that wrap more than one sentinel.
+var mappings = []mapping{
+	{user.ErrNotFound, http.StatusNotFound, "user_not_found"},
+	{user.ErrEmptyID, http.StatusBadRequest, "empty_user_id"},
+	{user.ErrInvalidCursor, http.StatusBadRequest, "invalid_cursor"},
+	{user.ErrInvalidSort, http.StatusBadRequest, "invalid_sort"},
+	{user.ErrAlreadyExists, http.StatusConflict, "user_exists"},
+	{sales.ErrNotFound, http.StatusNotFound, "sale_not_found"},
+	{sales.ErrEmptyID, http.StatusBadRequest, "empty_sale_id"},
+	{sales.ErrInvalidAmount, http.StatusBadRequest, "invalid_amount"},
+	{sales.ErrUserNotFound, http.StatusBadRequest, "unknown_user"},
+	{sales.ErrUsersUnavailable, http.StatusServiceUnavailable, "users_unavailable"},
+	{sales.ErrInvalidStatus, http.StatusBadRequest, "invalid_status"},
+	{sales.ErrInvalidTransition, http.StatusConflict, "invalid_transition"},
+	{sales.ErrVersionConflict, http.StatusConflict, "version_conflict"},
+	{sales.ErrEmptyBatch, http.StatusBadRequest, "empty_batch"},
+	{sales.ErrBatchTooLarge, http.StatusRequestEntityTooLarge, "batch_too_large"},
+	{sales.ErrInvalidBatchMode, http.StatusBadRequest, "invalid_batch_mode"},
+	{sales.ErrBatchAborted, http.StatusConflict, "batch_aborted"},
+	{sales.ErrInvalidFormat, http.StatusBadRequest, "invalid_format"},
+	{sales.ErrAlreadyExists, http.StatusConflict, "sale_exists"},
+	{sales.ErrInvalidInterval, http.StatusBadRequest, "invalid_interval"},
+	{sales.ErrInvalidRange, http.StatusBadRequest, "invalid_range"},
+	{sales.ErrMissingReason, http.StatusBadRequest, "missing_reason"},
+	{sales.ErrRefundExceedsAmount, http.StatusConflict, "refund_exceeds_amount"},
+	{sales.ErrInvalidLine, http.StatusBadRequest, "invalid_line"},
+	{sales.ErrNoCatalog, http.StatusServiceUnavailable, "catalog_unavailable"},
+	{sales.ErrNoCoupons, http.StatusServiceUnavailable, "coupons_unavailable"},
+	{sales.ErrBatchCoupon, http.StatusBadRequest, "coupon_in_batch"},
+	{sales.ErrNoTaxes, http.StatusServiceUnavailable, "taxes_unavailable"},
+	{tax.ErrUnknownJurisdiction, http.StatusBadRequest, "unknown_jurisdiction"},
+	{sales.ErrNoRates, http.StatusServiceUnavailable, "rates_unavailable"},
+	{sales.ErrLinesCurrency, http.StatusBadRequest, "lines_currency"},
+	{currency.ErrUnknownCurrency, http.StatusBadRequest, "unknown_currency"},
+	{sales.ErrPaymentDeclined, http.StatusConflict, "payment_declined"},
+	{payment.ErrTimeout, http.StatusGatewayTimeout, "payment_timeout"},
+	{payment.ErrUnavailable, http.StatusServiceUnavailable, "payment_unavailable"},
+	{payment.ErrTransactionNotFound, http.StatusNotFound, "payment_not_found"},
+	{payment.ErrInvalidState, http.StatusConflict, "payment_invalid_state"},
+	{payment.ErrInvalidSignature, http.StatusUnauthorized, "invalid_signature"},
+	{payment.ErrInvalidCallback, http.StatusBadRequest, "invalid_callback"},
+	{payment.ErrCallbacksDisabled, http.StatusServiceUnavailable, "payment_callbacks_unavailable"},
+	{sales.ErrPaymentMismatch, http.StatusConflict, "payment_mismatch"},
+	{product.ErrNotFound, http.StatusNotFound, "product_not_found"},
+	{product.ErrEmptyID, http.StatusBadRequest, "empty_product_id"},
+	{product.ErrSKUTaken, http.StatusConflict, "sku_taken"},
+	{product.ErrVersionConflict, http.StatusConflict, "version_conflict"},
+	{product.ErrInsufficientStock, http.StatusConflict, "insufficient_stock"},
+	{product.ErrReservationExpired, http.StatusConflict, "reservation_expired"},
+	{product.ErrReservationNotFound, http.StatusNotFound, "reservation_not_found"},
+	{product.ErrMissingSKU, http.StatusBadRequest, "missing_sku"},
+	{product.ErrMissingName, http.StatusBadRequest, "missing_name"},
+	{product.ErrInvalidPrice, http.StatusBadRequest, "invalid_price"},
+	{product.ErrInvalidStock, http.StatusBadRequest, "invalid_stock"},
+	{product.ErrInvalidQuantity, http.StatusBadRequest, "invalid_quantity"},
+	{coupon.ErrNotFound, http.StatusNotFound, "coupon_not_found"},
+	{coupon.ErrEmptyCode, http.StatusBadRequest, "empty_coupon_code"},
+	{coupon.ErrCodeTaken, http.StatusConflict, "coupon_code_taken"},
+	{coupon.ErrInvalidKind, http.StatusBadRequest, "invalid_coupon_kind"},
+	{coupon.ErrInvalidValue, http.StatusBadRequest, "invalid_coupon_value"},
+	{coupon.ErrInvalidLimit, http.StatusBadRequest, "invalid_coupon_limit"},
+	{coupon.ErrInvalidWindow, http.StatusBadRequest, "invalid_coupon_window"},
+	{coupon.ErrNotActive, http.StatusConflict, "coupon_not_active"},
+	{coupon.ErrBelowMinAmount, http.StatusBadRequest, "coupon_min_amount"},
+	{coupon.ErrNotStackable, http.StatusBadRequest, "coupon_not_stackable"},
+	{coupon.ErrUsageLimit, http.StatusConflict, "coupon_usage_limit"},
+	{coupon.ErrUserUsageLimit, http.StatusConflict, "coupon_user_usage_limit"},
+	{coupon.ErrRedemptionNotFound, http.StatusNotFound, "coupon_redemption_not_found"},
+	{importer.ErrMissingColumn, http.StatusBadRequest, "missing_column"},
+	{importer.ErrInvalidNumber, http.StatusBadRequest, "invalid_number"},
+	{importer.ErrInvalidTimestamp, http.StatusBadRequest, "invalid_timestamp"},
+	{importer.ErrMalformedRow, http.StatusBadRequest, "malformed_row"},
+	{context.DeadlineExceeded, http.StatusGatewayTimeout, "timeout"},
+	{context.Canceled, 499, "request_cancelled"},
+}
+
+// From converts any error into an *Error. Errors already of type *Error are
+// returned as is, known sentinels get their mapped code, and anything else
+// becomes a 500 that does not leak the original message.
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	for _, m := range mappings {
+		if errors.Is(err, m.target) {
+			e := New(m.status, m.code, m.target.Error())
+			e.Err = err
+			if m.status == 499 {
+				e.Title = "Client Closed Request"
+			}
+			return e
+		}
+	}
+
+	e := New(http.StatusInternalServerError, CodeInternal, "internal server error")
+	e.Err = err
+	return e
+}
+
+// Code returns the stable code of err, as From would map it.
+func Code(err error) string {
+	return From(err).Code
+}
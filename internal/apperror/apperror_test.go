@@ -0,0 +1,44 @@
+package apperror
+
+import (
+	"context"
+	"ej_final/internal/sales"
+	"ej_final/internal/user"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrom(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"user not found", user.ErrNotFound, http.StatusNotFound, "user_not_found"},
+		{"wrapped sale not found", fmt.Errorf("reading: %w", sales.ErrNotFound), http.StatusNotFound, "sale_not_found"},
+		{"invalid transition", sales.ErrInvalidTransition, http.StatusConflict, "invalid_transition"},
+		{"deadline", context.DeadlineExceeded, http.StatusGatewayTimeout, "timeout"},
+		{"app error", BadRequest(CodeMissingParameter, "user_id is required"), http.StatusBadRequest, CodeMissingParameter},
+		{"unknown", errors.New("db exploded"), http.StatusInternalServerError, CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := From(tt.err)
+			require.Equal(t, tt.status, e.Status)
+			require.Equal(t, tt.code, e.Code)
+		})
+	}
+}
+
+func TestFrom_DoesNotLeakInternalErrors(t *testing.T) {
+	p := From(errors.New("db password is hunter2")).Problem("/sales", "req-1")
+
+	require.Equal(t, "internal server error", p.Detail)
+	require.Equal(t, "urn:problem-type:internal_error", p.Type)
+	require.Equal(t, "req-1", p.RequestID)
+}
@@ -0,0 +1,32 @@
+package apperror
+
+// ContentType is the media type of RFC 7807 problem details.
+const ContentType = "application/problem+json"
+
+// typePrefix turns a code into the problem "type" URI.
+const typePrefix = "urn:problem-type:"
+
+// Problem is the RFC 7807 body every error response is rendered with.
+// Code and RequestID are extension members.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Problem renders e as problem details for the given request path.
+func (e *Error) Problem(instance, requestID string) Problem {
+	return Problem{
+		Type:      typePrefix + e.Code,
+		Title:     e.Title,
+		Status:    e.Status,
+		Detail:    e.Detail,
+		Instance:  instance,
+		Code:      e.Code,
+		RequestID: requestID,
+	}
+}
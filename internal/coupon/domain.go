@@ -0,0 +1,70 @@
+// Package coupon is the promo codes that discount sales, with their validity
+// window and usage limits.
+package coupon
+
+import "time"
+
+// Kinds of discount a coupon gives.
+const (
+	// KindPercentage takes Value percent off the amount.
+	KindPercentage = "percentage"
+
+	// KindFixed takes Value off the amount, never more than the amount itself.
+	KindFixed = "fixed"
+)
+
+// Coupon represents a promo code. Coupons are not updated once created: to
+// change one, delete it and create it again.
+type Coupon struct {
+	Code  string  `json:"code"`
+	Kind  string  `json:"kind"`
+	Value float32 `json:"value"`
+
+	// MinAmount is the amount a sale needs, before discounts, to use it.
+	MinAmount float32 `json:"min_amount"`
+
+	// ValidFrom and ValidUntil bound when it can be used; nil means no bound.
+	// ValidUntil is exclusive.
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+
+	// MaxUses and MaxUsesPerUser limit the sales that use it, in total and
+	// by each user. Zero means unlimited.
+	MaxUses        int `json:"max_uses"`
+	MaxUsesPerUser int `json:"max_uses_per_user"`
+
+	// Stackable coupons can be combined with other stackable coupons in a
+	// sale; a coupon that is not must be used alone.
+	Stackable bool `json:"stackable"`
+
+	// Uses counts the sales using it. Rejected and cancelled sales give
+	// their use back.
+	Uses int `json:"uses"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Redemption is the use of some coupons by a sale.
+type Redemption struct {
+	SaleID string
+	UserID string
+
+	// Codes are the coupons applied, in order.
+	Codes []string
+
+	// Discount is the total taken off the amount of the sale.
+	Discount float32
+
+	CreatedAt time.Time
+}
+
+// activeAt reports whether now falls in the validity window of c.
+func (c *Coupon) activeAt(now time.Time) bool {
+	if c.ValidFrom != nil && now.Before(*c.ValidFrom) {
+		return false
+	}
+	if c.ValidUntil != nil && !now.Before(*c.ValidUntil) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,219 @@
+package coupon
+
+import (
+	"context"
+	"ej_final/internal/logging"
+	"ej_final/internal/tracing"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrInvalidKind is returned when a coupon kind is not percentage or fixed.
+var ErrInvalidKind = errors.New("invalid coupon kind")
+
+// ErrInvalidValue is returned when a coupon value is not positive, or is a
+// percentage over 100.
+var ErrInvalidValue = errors.New("invalid coupon value")
+
+// ErrInvalidLimit is returned when a minimum amount or a usage limit is negative.
+var ErrInvalidLimit = errors.New("invalid coupon limit")
+
+// ErrInvalidWindow is returned when ValidUntil is not after ValidFrom.
+var ErrInvalidWindow = errors.New("invalid coupon validity window")
+
+// ErrNotActive is returned when a coupon is used outside its validity window.
+var ErrNotActive = errors.New("coupon not active")
+
+// ErrBelowMinAmount is returned when the amount of a sale is below the
+// MinAmount of a coupon.
+var ErrBelowMinAmount = errors.New("amount below coupon minimum")
+
+// ErrNotStackable is returned when a coupon that is not stackable is
+// combined with others, or the same coupon is given twice.
+var ErrNotStackable = errors.New("coupons cannot be combined")
+
+// Service provides high-level coupon operations on a Storage backend.
+type Service struct {
+	// storage is the underlying persistence for Coupon entities.
+	storage Storage
+
+	// logger is our observability component to log.
+	logger *zap.Logger
+}
+
+// NewService creates a new Service.
+func NewService(storage Storage, logger *zap.Logger) *Service {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &Service{
+		storage: storage,
+		logger:  logger,
+	}
+}
+
+// Create adds a brand-new coupon. Its code is trimmed and upper-cased, so
+// codes are matched regardless of case. It sets CreatedAt to the current
+// time and Uses to zero.
+// Returns ErrEmptyCode, ErrInvalidKind, ErrInvalidValue, ErrInvalidLimit,
+// ErrInvalidWindow or ErrCodeTaken.
+func (s *Service) Create(ctx context.Context, coupon *Coupon) error {
+	ctx, span := tracing.Start(ctx, "coupon.Service.Create")
+	defer span.End()
+
+	coupon.Code = normalize(coupon.Code)
+	if err := validate(coupon); err != nil {
+		return err
+	}
+
+	coupon.Uses = 0
+	coupon.CreatedAt = time.Now()
+
+	if err := s.storage.Create(ctx, coupon); err != nil {
+		logging.FromContext(ctx, s.logger).Error("Error al crear el cupon", zap.Error(err), zap.Any("coupon", coupon))
+		return err
+	}
+	return nil
+}
+
+// Get retrieves a coupon by its code.
+// Returns ErrNotFound if no coupon has the given code.
+func (s *Service) Get(ctx context.Context, code string) (*Coupon, error) {
+	ctx, span := tracing.Start(ctx, "coupon.Service.Get")
+	defer span.End()
+
+	return s.storage.Read(ctx, normalize(code))
+}
+
+// List returns every coupon ordered by code.
+func (s *Service) List(ctx context.Context) ([]*Coupon, error) {
+	ctx, span := tracing.Start(ctx, "coupon.Service.List")
+	defer span.End()
+
+	return s.storage.List(ctx)
+}
+
+// Delete removes a coupon by its code. Sales that used it keep their discount.
+// Returns ErrNotFound if the coupon does not exist.
+func (s *Service) Delete(ctx context.Context, code string) error {
+	ctx, span := tracing.Start(ctx, "coupon.Service.Delete")
+	defer span.End()
+
+	return s.storage.Delete(ctx, normalize(code))
+}
+
+// Redeem applies the coupons with the given codes to a sale of userID for
+// amount, and counts their use. Percentages apply to what is left after the
+// previous coupons, in the given order, and the total discount is never more
+// than amount.
+// Returns ErrNotStackable, or an error wrapping ErrNotFound, ErrNotActive,
+// ErrBelowMinAmount, ErrUsageLimit or ErrUserUsageLimit with the code.
+func (s *Service) Redeem(ctx context.Context, saleID, userID string, codes []string, amount float32) (*Redemption, error) {
+	ctx, span := tracing.Start(ctx, "coupon.Service.Redeem")
+	defer span.End()
+
+	log := logging.FromContext(ctx, s.logger)
+
+	now := time.Now()
+	coupons := make([]*Coupon, 0, len(codes))
+	seen := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		code = normalize(code)
+		if seen[code] {
+			return nil, ErrNotStackable
+		}
+		seen[code] = true
+
+		c, err := s.storage.Read(ctx, code)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, code)
+		}
+		if !c.activeAt(now) {
+			return nil, fmt.Errorf("%w: %s", ErrNotActive, code)
+		}
+		if amount < c.MinAmount {
+			return nil, fmt.Errorf("%w: %s", ErrBelowMinAmount, code)
+		}
+		coupons = append(coupons, c)
+	}
+
+	// Solo se combinan cupones que lo permiten todos
+	if len(coupons) > 1 {
+		for _, c := range coupons {
+			if !c.Stackable {
+				return nil, fmt.Errorf("%w: %s", ErrNotStackable, c.Code)
+			}
+		}
+	}
+
+	r := &Redemption{
+		SaleID:    saleID,
+		UserID:    userID,
+		Discount:  discount(coupons, amount),
+		CreatedAt: now,
+	}
+	for _, c := range coupons {
+		r.Codes = append(r.Codes, c.Code)
+	}
+
+	if err := s.storage.Redeem(ctx, r); err != nil {
+		log.Warn("No se pudieron usar los cupones",
+			zap.String("user_id", userID),
+			zap.Strings("codes", r.Codes),
+			zap.Error(err))
+		return nil, err
+	}
+	return r, nil
+}
+
+// Release gives back the uses of the coupons redeemed by a sale.
+// Returns ErrRedemptionNotFound if they were already released.
+func (s *Service) Release(ctx context.Context, saleID string) error {
+	ctx, span := tracing.Start(ctx, "coupon.Service.Release")
+	defer span.End()
+
+	return s.storage.Release(ctx, saleID)
+}
+
+// discount returns how much coupons take off amount, rounded to cents.
+func discount(coupons []*Coupon, amount float32) float32 {
+	left := float64(amount)
+	for _, c := range coupons {
+		var d float64
+		switch c.Kind {
+		case KindPercentage:
+			d = left * float64(c.Value) / 100
+		case KindFixed:
+			d = float64(c.Value)
+		}
+		left -= math.Min(d, left)
+	}
+	return float32(math.Round((float64(amount)-left)*100) / 100)
+}
+
+// validate checks the fields a coupon must always have.
+func validate(c *Coupon) error {
+	switch {
+	case c.Code == "":
+		return ErrEmptyCode
+	case c.Kind != KindPercentage && c.Kind != KindFixed:
+		return ErrInvalidKind
+	case c.Value <= 0, c.Kind == KindPercentage && c.Value > 100:
+		return ErrInvalidValue
+	case c.MinAmount < 0, c.MaxUses < 0, c.MaxUsesPerUser < 0:
+		return ErrInvalidLimit
+	case c.ValidFrom != nil && c.ValidUntil != nil && !c.ValidUntil.After(*c.ValidFrom):
+		return ErrInvalidWindow
+	}
+	return nil
+}
+
+func normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
@@ -0,0 +1,88 @@
+package coupon
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Create(t *testing.T) {
+	s := NewService(NewLocalStorage(), nil)
+	ctx := context.Background()
+
+	c := &Coupon{Code: " verano10 ", Kind: KindPercentage, Value: 10, Uses: 7}
+	require.NoError(t, s.Create(ctx, c))
+	require.Equal(t, "VERANO10", c.Code)
+	require.Zero(t, c.Uses)
+
+	got, err := s.Get(ctx, "Verano10")
+	require.NoError(t, err)
+	require.Equal(t, KindPercentage, got.Kind)
+
+	now := time.Now()
+	for _, tc := range []struct {
+		coupon *Coupon
+		err    error
+	}{
+		{&Coupon{Kind: KindFixed, Value: 1}, ErrEmptyCode},
+		{&Coupon{Code: "X", Kind: "gratis", Value: 1}, ErrInvalidKind},
+		{&Coupon{Code: "X", Kind: KindFixed}, ErrInvalidValue},
+		{&Coupon{Code: "X", Kind: KindPercentage, Value: 120}, ErrInvalidValue},
+		{&Coupon{Code: "X", Kind: KindFixed, Value: 1, MaxUses: -1}, ErrInvalidLimit},
+		{&Coupon{Code: "X", Kind: KindFixed, Value: 1, ValidFrom: &now, ValidUntil: &now}, ErrInvalidWindow},
+		{&Coupon{Code: "verano10", Kind: KindFixed, Value: 1}, ErrCodeTaken},
+	} {
+		require.ErrorIs(t, s.Create(ctx, tc.coupon), tc.err)
+	}
+}
+
+func TestService_Redeem(t *testing.T) {
+	s := NewService(NewLocalStorage(), nil)
+	ctx := context.Background()
+
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	for _, c := range []*Coupon{
+		{Code: "DIEZ", Kind: KindPercentage, Value: 10, Stackable: true},
+		{Code: "CINCO", Kind: KindFixed, Value: 5, Stackable: true},
+		{Code: "SOLO", Kind: KindFixed, Value: 1},
+		{Code: "MIN50", Kind: KindFixed, Value: 1, MinAmount: 50},
+		{Code: "VENCIDO", Kind: KindFixed, Value: 1, ValidUntil: &past},
+		{Code: "FUTURO", Kind: KindFixed, Value: 1, ValidFrom: &future},
+	} {
+		require.NoError(t, s.Create(ctx, c))
+	}
+
+	// Primero el fijo y despues el porcentaje sobre lo que queda
+	r, err := s.Redeem(ctx, "s1", "ana", []string{"cinco", "diez"}, 25)
+	require.NoError(t, err)
+	require.Equal(t, []string{"CINCO", "DIEZ"}, r.Codes)
+	require.Equal(t, float32(7), r.Discount)
+
+	// El descuento nunca supera el monto
+	r, err = s.Redeem(ctx, "s2", "ana", []string{"CINCO"}, 3)
+	require.NoError(t, err)
+	require.Equal(t, float32(3), r.Discount)
+
+	for _, tc := range []struct {
+		codes []string
+		err   error
+	}{
+		{[]string{"NOPE"}, ErrNotFound},
+		{[]string{"VENCIDO"}, ErrNotActive},
+		{[]string{"FUTURO"}, ErrNotActive},
+		{[]string{"MIN50"}, ErrBelowMinAmount},
+		{[]string{"SOLO", "DIEZ"}, ErrNotStackable},
+		{[]string{"DIEZ", "diez"}, ErrNotStackable},
+	} {
+		_, err := s.Redeem(ctx, "s3", "ana", tc.codes, 20)
+		require.ErrorIs(t, err, tc.err, tc.codes)
+	}
+
+	// Los intentos fallidos no cuentan usos
+	c, err := s.Get(ctx, "DIEZ")
+	require.NoError(t, err)
+	require.Equal(t, 1, c.Uses)
+	require.ErrorIs(t, s.Release(ctx, "s3"), ErrRedemptionNotFound)
+}
@@ -0,0 +1,249 @@
+package coupon
+
+import (
+	"context"
+	"ej_final/internal/tracing"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// ErrNotFound is returned when a coupon with the given code is not found.
+var ErrNotFound = errors.New("coupon not found")
+
+// ErrEmptyCode is returned when a coupon has no code.
+var ErrEmptyCode = errors.New("empty coupon code")
+
+// ErrCodeTaken is returned when another coupon already has the code.
+var ErrCodeTaken = errors.New("coupon code already in use")
+
+// ErrUsageLimit is returned when a coupon reached its MaxUses.
+var ErrUsageLimit = errors.New("coupon usage limit reached")
+
+// ErrUserUsageLimit is returned when the user reached the MaxUsesPerUser of
+// a coupon.
+var ErrUserUsageLimit = errors.New("coupon usage limit reached for user")
+
+// ErrRedemptionNotFound is returned for a sale that has no coupons redeemed,
+// or no longer does because they were released.
+var ErrRedemptionNotFound = errors.New("coupon redemption not found")
+
+// Storage is the main interface for our storage layer.
+// Every method returns ctx.Err() if the context is already cancelled or past its deadline.
+type Storage interface {
+	Read(ctx context.Context, code string) (*Coupon, error)
+	Delete(ctx context.Context, code string) error
+	Ping(ctx context.Context) error
+
+	// List returns every coupon ordered by code.
+	List(ctx context.Context) ([]*Coupon, error)
+
+	// Create stores a new coupon. Returns ErrCodeTaken if the code is in use.
+	Create(ctx context.Context, coupon *Coupon) error
+
+	// Redeem counts a use of every coupon of r or of none of them, checking
+	// their usage limits.
+	Redeem(ctx context.Context, r *Redemption) error
+
+	// Release gives back the uses counted by the redemption of a sale.
+	Release(ctx context.Context, saleID string) error
+}
+
+// LocalStorage provides an in-memory implementation for storing coupons.
+// It is safe for concurrent use and keeps its own copies of the coupons.
+type LocalStorage struct {
+	mu sync.RWMutex
+	m  map[string]*Coupon
+
+	// userUses counts the uses of each coupon by each user.
+	userUses map[string]map[string]int
+
+	// redemptions holds the redemption of each sale by sale ID.
+	redemptions map[string]*Redemption
+}
+
+// NewLocalStorage instantiates a new LocalStorage with an empty map.
+func NewLocalStorage() *LocalStorage {
+	return &LocalStorage{
+		m:           map[string]*Coupon{},
+		userUses:    map[string]map[string]int{},
+		redemptions: map[string]*Redemption{},
+	}
+}
+
+// Create stores a new coupon.
+// Returns ErrEmptyCode if the coupon has no code, or ErrCodeTaken.
+func (l *LocalStorage) Create(ctx context.Context, coupon *Coupon) error {
+	ctx, span := tracing.Start(ctx, "coupon.LocalStorage.Create")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if coupon.Code == "" {
+		return ErrEmptyCode
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.m[coupon.Code]; ok {
+		return ErrCodeTaken
+	}
+	c := *coupon
+	l.m[c.Code] = &c
+	return nil
+}
+
+// Read retrieves a coupon from the local storage by code.
+// Returns ErrNotFound if the coupon is not found.
+func (l *LocalStorage) Read(ctx context.Context, code string) (*Coupon, error) {
+	ctx, span := tracing.Start(ctx, "coupon.LocalStorage.Read")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	c, ok := l.m[code]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	copied := *c
+	return &copied, nil
+}
+
+// Delete removes a coupon from the local storage by code. Sales that used it
+// keep their discount.
+// Returns ErrNotFound if the coupon does not exist.
+func (l *LocalStorage) Delete(ctx context.Context, code string) error {
+	ctx, span := tracing.Start(ctx, "coupon.LocalStorage.Delete")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.m[code]; !ok {
+		return ErrNotFound
+	}
+
+	delete(l.m, code)
+	delete(l.userUses, code)
+	// Si se vuelve a crear con el mismo codigo no tiene que heredar estas liberaciones
+	for _, r := range l.redemptions {
+		r.Codes = slices.DeleteFunc(r.Codes, func(c string) bool { return c == code })
+	}
+	return nil
+}
+
+// List returns copies of every coupon ordered by code.
+func (l *LocalStorage) List(ctx context.Context) ([]*Coupon, error) {
+	ctx, span := tracing.Start(ctx, "coupon.LocalStorage.List")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	coupons := make([]*Coupon, 0, len(l.m))
+	for _, c := range l.m {
+		copied := *c
+		coupons = append(coupons, &copied)
+	}
+	sort.Slice(coupons, func(i, j int) bool {
+		return coupons[i].Code < coupons[j].Code
+	})
+	return coupons, nil
+}
+
+// Redeem checks the limits of every coupon of r and counts a use of each
+// under a single lock, so concurrent sales can never use a coupon more than
+// it allows.
+// Returns an error wrapping ErrNotFound, ErrUsageLimit or ErrUserUsageLimit
+// with the code of the coupon; in that case nothing is counted.
+func (l *LocalStorage) Redeem(ctx context.Context, r *Redemption) error {
+	ctx, span := tracing.Start(ctx, "coupon.LocalStorage.Redeem")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, code := range r.Codes {
+		c, ok := l.m[code]
+		switch {
+		case !ok:
+			return fmt.Errorf("%w: %s", ErrNotFound, code)
+		case c.MaxUses > 0 && c.Uses >= c.MaxUses:
+			return fmt.Errorf("%w: %s", ErrUsageLimit, code)
+		case c.MaxUsesPerUser > 0 && l.userUses[code][r.UserID] >= c.MaxUsesPerUser:
+			return fmt.Errorf("%w: %s", ErrUserUsageLimit, code)
+		}
+	}
+
+	for _, code := range r.Codes {
+		l.m[code].Uses++
+		if l.userUses[code] == nil {
+			l.userUses[code] = map[string]int{}
+		}
+		l.userUses[code][r.UserID]++
+	}
+	c := *r
+	c.Codes = append([]string(nil), r.Codes...)
+	l.redemptions[r.SaleID] = &c
+	return nil
+}
+
+// Release gives back the uses counted by the redemption of a sale. Coupons
+// deleted since then are no longer part of it.
+// Returns ErrRedemptionNotFound if the sale has no redemption.
+func (l *LocalStorage) Release(ctx context.Context, saleID string) error {
+	ctx, span := tracing.Start(ctx, "coupon.LocalStorage.Release")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r, ok := l.redemptions[saleID]
+	if !ok {
+		return ErrRedemptionNotFound
+	}
+
+	for _, code := range r.Codes {
+		l.m[code].Uses--
+		uses := l.userUses[code]
+		uses[r.UserID]--
+		if uses[r.UserID] <= 0 {
+			delete(uses, r.UserID)
+		}
+	}
+	delete(l.redemptions, saleID)
+	return nil
+}
+
+// Ping reports whether the storage is reachable. The in-memory storage always
+// is, so it only fails when ctx is done.
+func (l *LocalStorage) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
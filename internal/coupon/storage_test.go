@@ -0,0 +1,88 @@
+package coupon
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newCouponStorage(t *testing.T, coupons ...*Coupon) *LocalStorage {
+	l := NewLocalStorage()
+	for _, c := range coupons {
+		require.NoError(t, l.Create(context.Background(), c))
+	}
+	return l
+}
+
+func uses(t *testing.T, l *LocalStorage, code string) int {
+	c, err := l.Read(context.Background(), code)
+	require.NoError(t, err)
+	return c.Uses
+}
+
+func TestLocalStorage_Redeem_Limits(t *testing.T) {
+	l := newCouponStorage(t,
+		&Coupon{Code: "A", MaxUses: 3, MaxUsesPerUser: 2},
+		&Coupon{Code: "B"})
+	ctx := context.Background()
+
+	require.NoError(t, l.Redeem(ctx, &Redemption{SaleID: "s1", UserID: "ana", Codes: []string{"A", "B"}}))
+	require.NoError(t, l.Redeem(ctx, &Redemption{SaleID: "s2", UserID: "ana", Codes: []string{"A"}}))
+	err := l.Redeem(ctx, &Redemption{SaleID: "s3", UserID: "ana", Codes: []string{"B", "A"}})
+	require.ErrorIs(t, err, ErrUserUsageLimit)
+	// Si uno falla no se cuenta ninguno
+	require.Equal(t, 1, uses(t, l, "B"))
+
+	require.NoError(t, l.Redeem(ctx, &Redemption{SaleID: "s3", UserID: "juan", Codes: []string{"A"}}))
+	err = l.Redeem(ctx, &Redemption{SaleID: "s4", UserID: "pepe", Codes: []string{"A"}})
+	require.ErrorIs(t, err, ErrUsageLimit)
+
+	// Liberar una venta devuelve el uso global y el del usuario
+	require.NoError(t, l.Release(ctx, "s1"))
+	require.ErrorIs(t, l.Release(ctx, "s1"), ErrRedemptionNotFound)
+	require.Equal(t, 2, uses(t, l, "A"))
+	require.Zero(t, uses(t, l, "B"))
+	require.NoError(t, l.Redeem(ctx, &Redemption{SaleID: "s5", UserID: "ana", Codes: []string{"A"}}))
+}
+
+func TestLocalStorage_Delete_ForgetsRedemptions(t *testing.T) {
+	l := newCouponStorage(t, &Coupon{Code: "A"})
+	ctx := context.Background()
+
+	require.NoError(t, l.Redeem(ctx, &Redemption{SaleID: "s1", UserID: "ana", Codes: []string{"A"}}))
+	require.NoError(t, l.Delete(ctx, "A"))
+	require.NoError(t, l.Create(ctx, &Coupon{Code: "A"}))
+
+	// La venta vieja no le descuenta usos al cupon nuevo
+	require.NoError(t, l.Release(ctx, "s1"))
+	require.Zero(t, uses(t, l, "A"))
+}
+
+func TestLocalStorage_Redeem_Concurrent(t *testing.T) {
+	l := newCouponStorage(t, &Coupon{Code: "A", MaxUses: 10, MaxUsesPerUser: 1})
+
+	var redeemed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Cada usuario intenta dos veces, solo una puede contar
+			r := &Redemption{SaleID: fmt.Sprint(i), UserID: fmt.Sprint(i / 2), Codes: []string{"A"}}
+			if err := l.Redeem(context.Background(), r); err == nil {
+				redeemed.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	require.EqualValues(t, 10, redeemed.Load())
+	require.Equal(t, 10, uses(t, l, "A"))
+	for user, n := range l.userUses["A"] {
+		require.Equal(t, 1, n, user)
+	}
+}
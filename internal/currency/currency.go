@@ -0,0 +1,106 @@
+// Package currency converts amounts between currencies with a table of
+// exchange rates.
+package currency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrUnknownCurrency is returned for a currency without rate in the table.
+var ErrUnknownCurrency = errors.New("unknown currency")
+
+// ErrInvalidRates is returned when a rates table has no base, a rate that is
+// not positive or a malformed file.
+var ErrInvalidRates = errors.New("invalid rates table")
+
+// Rates is the content of a rates file: the value of one unit of every
+// currency in Base, as in {"base": "ARS", "rates": {"USD": 1000}}.
+type Rates struct {
+	Base  string             `json:"base"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// Table is a RateProvider for the sales service backed by fixed rates, so it
+// works offline.
+type Table struct {
+	base  string
+	rates map[string]float64
+}
+
+// NewTable builds a Table from r. Currencies are matched regardless of case
+// and surrounding spaces, and the base always has rate 1.
+// Returns ErrInvalidRates if there is no base or a rate is not positive.
+func NewTable(r Rates) (*Table, error) {
+	base := normalize(r.Base)
+	if base == "" {
+		return nil, fmt.Errorf("%w: missing base", ErrInvalidRates)
+	}
+
+	t := &Table{base: base, rates: map[string]float64{base: 1}}
+	for code, rate := range r.Rates {
+		code = normalize(code)
+		if code == "" || rate <= 0 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRates, code)
+		}
+		if code == base && rate != 1 {
+			return nil, fmt.Errorf("%w: base %q must have rate 1", ErrInvalidRates, code)
+		}
+		t.rates[code] = rate
+	}
+	return t, nil
+}
+
+// LoadTable reads a Table from its JSON representation.
+func LoadTable(r io.Reader) (*Table, error) {
+	var rates Rates
+	if err := json.NewDecoder(r).Decode(&rates); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRates, err)
+	}
+	return NewTable(rates)
+}
+
+// TableFromEnv loads the Table of the JSON file in CURRENCY_RATES_FILE. It
+// returns nil, and no error, if it is not set: sales are then kept in a
+// single currency.
+func TableFromEnv() (*Table, error) {
+	path := os.Getenv("CURRENCY_RATES_FILE")
+	if path == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadTable(f)
+}
+
+// Base is the currency the rates are relative to.
+func (t *Table) Base() string {
+	return t.base
+}
+
+// Rate returns the value of one unit of currency in Base.
+// Returns ErrUnknownCurrency if the table has no rate for it.
+func (t *Table) Rate(ctx context.Context, currency string) (float64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	rate, ok := t.rates[normalize(currency)]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownCurrency, currency)
+	}
+	return rate, nil
+}
+
+func normalize(currency string) string {
+	return strings.ToUpper(strings.TrimSpace(currency))
+}
@@ -0,0 +1,64 @@
+package currency
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTable_Rate(t *testing.T) {
+	table, err := NewTable(Rates{Base: " ars ", Rates: map[string]float64{"usd": 1000, "EUR": 1100}})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.Equal(t, "ARS", table.Base())
+
+	rate, err := table.Rate(ctx, "ARS")
+	require.NoError(t, err)
+	require.Equal(t, 1.0, rate)
+
+	rate, err = table.Rate(ctx, " Usd")
+	require.NoError(t, err)
+	require.Equal(t, 1000.0, rate)
+
+	_, err = table.Rate(ctx, "BRL")
+	require.ErrorIs(t, err, ErrUnknownCurrency)
+}
+
+func TestNewTable_Invalid(t *testing.T) {
+	_, err := NewTable(Rates{Rates: map[string]float64{"USD": 1000}})
+	require.ErrorIs(t, err, ErrInvalidRates)
+	_, err = NewTable(Rates{Base: "ARS", Rates: map[string]float64{"USD": 0}})
+	require.ErrorIs(t, err, ErrInvalidRates)
+	_, err = NewTable(Rates{Base: "ARS", Rates: map[string]float64{"ars": 2}})
+	require.ErrorIs(t, err, ErrInvalidRates)
+
+	table, err := LoadTable(strings.NewReader(`{"base": "ARS", "rates": {"USD": 1000}}`))
+	require.NoError(t, err)
+	require.Equal(t, "ARS", table.Base())
+	_, err = LoadTable(strings.NewReader(`{`))
+	require.ErrorIs(t, err, ErrInvalidRates)
+}
+
+func TestTableFromEnv(t *testing.T) {
+	// Sin archivo configurado no hay tabla, las ventas quedan en una sola moneda
+	t.Setenv("CURRENCY_RATES_FILE", "")
+	table, err := TableFromEnv()
+	require.NoError(t, err)
+	require.Nil(t, table)
+
+	path := filepath.Join(t.TempDir(), "rates.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"base": "USD", "rates": {"ARS": 0.001}}`), 0o600))
+	t.Setenv("CURRENCY_RATES_FILE", path)
+	table, err = TableFromEnv()
+	require.NoError(t, err)
+	require.Equal(t, "USD", table.Base())
+
+	t.Setenv("CURRENCY_RATES_FILE", filepath.Join(t.TempDir(), "missing.json"))
+	_, err = TableFromEnv()
+	require.Error(t, err)
+}
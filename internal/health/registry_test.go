@@ -0,0 +1,37 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_Run(t *testing.T) {
+	r := NewRegistry()
+	r.Register("storage", 0, func(ctx context.Context) error { return nil })
+	r.Register("broken", 0, func(ctx context.Context) error { return errors.New("boom") })
+	r.Register("slow", 10*time.Millisecond, func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	report := r.Run(context.Background())
+
+	require.Equal(t, StatusDown, report.Status)
+	require.Len(t, report.Checks, 3)
+	require.Equal(t, CheckResult{Name: "storage", Status: StatusUp, LatencyMs: report.Checks[0].LatencyMs}, report.Checks[0])
+	require.Equal(t, "boom", report.Checks[1].Error)
+	require.Equal(t, StatusDown, report.Checks[2].Status)
+	require.Equal(t, ErrTimeout.Error(), report.Checks[2].Error)
+	require.Less(t, report.Checks[2].LatencyMs, float64(500))
+}
+
+func TestRegistry_Run_AllUp(t *testing.T) {
+	r := NewRegistry()
+	r.Register("storage", 0, func(ctx context.Context) error { return nil })
+
+	require.Equal(t, StatusUp, r.Run(context.Background()).Status)
+}
@@ -0,0 +1,370 @@
+// Package importer loads users and sales from CSV files exported by other
+// systems, validating every row with the same rules as the services.
+package importer
+
+import (
+	"context"
+	"ej_final/internal/logging"
+	"ej_final/internal/sales"
+	"ej_final/internal/tracing"
+	"ej_final/internal/user"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrMissingColumn is returned when the header lacks a required column.
+var ErrMissingColumn = errors.New("missing required column")
+
+// ErrInvalidNumber is reported for a row whose amount is not a number.
+var ErrInvalidNumber = errors.New("invalid number")
+
+// ErrInvalidTimestamp is reported for a row whose timestamps are not RFC 3339.
+var ErrInvalidTimestamp = errors.New("invalid timestamp")
+
+// ErrMalformedRow is reported for a row the CSV reader could not parse.
+var ErrMalformedRow = errors.New("malformed row")
+
+// DefaultBatchSize is how many rows are validated and written together.
+const DefaultBatchSize = sales.MaxBatchSize
+
+// Kind is the entity a file holds.
+type Kind string
+
+const (
+	KindUsers Kind = "users"
+	KindSales Kind = "sales"
+)
+
+// layout lists the columns of a kind. Only the required ones must be in the
+// header; the rest are optional, and unknown columns (like the version of an
+// export) are ignored, so a file from GET /sales/export can be imported as is.
+type layout struct {
+	columns  []string
+	required []string
+}
+
+var layouts = map[Kind]layout{
+	KindUsers: {
+		columns:  []string{"id", "name", "address", "nickname", "created_at", "updated_at"},
+		required: []string{"name"},
+	},
+	KindSales: {
+		columns:  []string{"id", "user_id", "amount", "status", "created_at", "updated_at"},
+		required: []string{"user_id", "amount", "status"},
+	},
+}
+
+// RowError is the error of one row. Row is the line of the file, so the
+// first row after the header is 2.
+type RowError struct {
+	Row int
+	Err error
+}
+
+// Report is the outcome of an import.
+type Report struct {
+	Kind   Kind
+	DryRun bool
+
+	// Rows is the number of data rows read, Valid the ones without errors and
+	// Written the ones stored (always 0 in a dry run).
+	Rows    int
+	Valid   int
+	Written int
+
+	Errors []RowError
+
+	// seen has the IDs of the rows that passed validation so far: in a dry run
+	// nothing is written, so the services cannot spot a repeated ID of an
+	// earlier batch. Rows that failed do not count, so a later corrected row
+	// with the same ID is still imported.
+	seen map[string]bool
+}
+
+// Importer reads CSV files and feeds them to the services in batches.
+type Importer struct {
+	users     *user.Service
+	sales     *sales.Service
+	logger    *zap.Logger
+	batchSize int
+}
+
+// Option configures optional Importer settings.
+type Option func(*Importer)
+
+// WithBatchSize changes how many rows go in each batch. Sizes outside
+// [1, sales.MaxBatchSize] are ignored.
+func WithBatchSize(n int) Option {
+	return func(i *Importer) {
+		if n > 0 && n <= sales.MaxBatchSize {
+			i.batchSize = n
+		}
+	}
+}
+
+// New creates an Importer writing through the given services.
+func New(userService *user.Service, salesService *sales.Service, logger *zap.Logger, opts ...Option) *Importer {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	i := &Importer{
+		users:     userService,
+		sales:     salesService,
+		logger:    logger,
+		batchSize: DefaultBatchSize,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+// Import reads a CSV file of the given kind. Each batch of rows is validated
+// and, unless dryRun is set, its valid rows are written before the next
+// batch is read, so a failed import leaves the earlier batches stored.
+// Returns ErrMissingColumn if the header is incomplete, or the error that
+// stopped the import; the report counts what was done until then.
+func (i *Importer) Import(ctx context.Context, kind Kind, r io.Reader, dryRun bool) (*Report, error) {
+	ctx, span := tracing.Start(ctx, "importer.Importer.Import")
+	defer span.End()
+
+	log := logging.FromContext(ctx, i.logger)
+
+	lay, ok := layouts[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown import kind %q", kind)
+	}
+	flush := i.flushUsers
+	if kind == KindSales {
+		flush = i.flushSales
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	pos := map[string]int{}
+	for n, name := range header {
+		pos[strings.ToLower(strings.TrimSpace(name))] = n
+	}
+	for _, c := range lay.required {
+		if _, ok := pos[c]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrMissingColumn, c)
+		}
+	}
+
+	report := &Report{Kind: kind, DryRun: dryRun, seen: map[string]bool{}}
+	batch := make([]row, 0, i.batchSize)
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		report.Rows++
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return report, err
+			}
+			report.Errors = append(report.Errors, RowError{Row: parseErr.StartLine, Err: fmt.Errorf("%w: %v", ErrMalformedRow, parseErr.Err)})
+			continue
+		}
+		line, _ := cr.FieldPos(0)
+
+		fields := map[string]string{}
+		for _, c := range lay.columns {
+			if n, ok := pos[c]; ok && n < len(record) {
+				fields[c] = strings.TrimSpace(record[n])
+			}
+		}
+		batch = append(batch, row{line: line, fields: fields})
+
+		if len(batch) == i.batchSize {
+			if err := flush(ctx, report, batch); err != nil {
+				return report, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if err := flush(ctx, report, batch); err != nil {
+			return report, err
+		}
+	}
+
+	// Los errores de parseo se agregan antes que los del servicio, los dejamos por fila
+	sort.SliceStable(report.Errors, func(a, b int) bool {
+		return report.Errors[a].Row < report.Errors[b].Row
+	})
+
+	log.Info("import finished",
+		zap.String("kind", string(kind)),
+		zap.Bool("dry_run", dryRun),
+		zap.Int("rows", report.Rows),
+		zap.Int("valid", report.Valid),
+		zap.Int("written", report.Written))
+	return report, nil
+}
+
+// row is a data row with its line in the file and its known columns.
+type row struct {
+	line   int
+	fields map[string]string
+}
+
+// flushUsers validates and writes a batch of user rows. A row repeating the
+// ID of an earlier row of the same batch is held back and flushed after it,
+// once it is known whether that row was valid.
+func (i *Importer) flushUsers(ctx context.Context, report *Report, batch []row) error {
+	users := make([]*user.User, 0, len(batch))
+	lines := make([]int, 0, len(batch))
+	inBatch := map[string]bool{}
+	var later []row
+	for _, r := range batch {
+		u := &user.User{
+			ID:       r.fields["id"],
+			Name:     r.fields["name"],
+			Address:  r.fields["address"],
+			NickName: r.fields["nickname"],
+		}
+		var err error
+		if u.CreatedAt, u.UpdatedAt, err = timestamps(r.fields); err != nil {
+			report.Errors = append(report.Errors, RowError{Row: r.line, Err: err})
+			continue
+		}
+		if report.seen[u.ID] {
+			report.Errors = append(report.Errors, RowError{Row: r.line, Err: user.ErrAlreadyExists})
+			continue
+		}
+		if holdBack(inBatch, u.ID) {
+			later = append(later, r)
+			continue
+		}
+		users = append(users, u)
+		lines = append(lines, r.line)
+	}
+	if len(users) == 0 {
+		return nil
+	}
+
+	errs, err := i.users.Import(ctx, users, report.DryRun)
+	if err != nil {
+		return err
+	}
+	for n, e := range errs {
+		report.add(lines[n], users[n].ID, e)
+	}
+	if len(later) > 0 {
+		return i.flushUsers(ctx, report, later)
+	}
+	return nil
+}
+
+// flushSales validates and writes a batch of sale rows, holding back the
+// repeated IDs like flushUsers.
+func (i *Importer) flushSales(ctx context.Context, report *Report, batch []row) error {
+	items := make([]*sales.Sales, 0, len(batch))
+	lines := make([]int, 0, len(batch))
+	inBatch := map[string]bool{}
+	var later []row
+	for _, r := range batch {
+		amount, err := strconv.ParseFloat(r.fields["amount"], 32)
+		if err != nil {
+			report.Errors = append(report.Errors, RowError{Row: r.line, Err: fmt.Errorf("%w: amount %q", ErrInvalidNumber, r.fields["amount"])})
+			continue
+		}
+		s := &sales.Sales{
+			ID:     r.fields["id"],
+			UserID: r.fields["user_id"],
+			Amount: float32(amount),
+			Status: r.fields["status"],
+		}
+		if s.CreatedAt, s.UpdatedAt, err = timestamps(r.fields); err != nil {
+			report.Errors = append(report.Errors, RowError{Row: r.line, Err: err})
+			continue
+		}
+		if report.seen[s.ID] {
+			report.Errors = append(report.Errors, RowError{Row: r.line, Err: sales.ErrAlreadyExists})
+			continue
+		}
+		if holdBack(inBatch, s.ID) {
+			later = append(later, r)
+			continue
+		}
+		items = append(items, s)
+		lines = append(lines, r.line)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	results, err := i.sales.Import(ctx, items, report.DryRun)
+	if err != nil {
+		return err
+	}
+	for _, res := range results {
+		report.add(lines[res.Index], items[res.Index].ID, res.Err)
+	}
+	if len(later) > 0 {
+		return i.flushSales(ctx, report, later)
+	}
+	return nil
+}
+
+// holdBack reports whether id was already taken by an earlier row of the
+// batch, and takes it otherwise. Empty IDs are generated, so they never repeat.
+func holdBack(inBatch map[string]bool, id string) bool {
+	if id == "" {
+		return false
+	}
+	if inBatch[id] {
+		return true
+	}
+	inBatch[id] = true
+	return false
+}
+
+// add records the outcome of a row that reached the service, remembering its
+// id if it was valid.
+func (r *Report) add(line int, id string, err error) {
+	if err != nil {
+		r.Errors = append(r.Errors, RowError{Row: line, Err: err})
+		return
+	}
+	if id != "" {
+		r.seen[id] = true
+	}
+	r.Valid++
+	if !r.DryRun {
+		r.Written++
+	}
+}
+
+// timestamps parses the optional created_at and updated_at columns.
+func timestamps(fields map[string]string) (created, updated time.Time, err error) {
+	if v := fields["created_at"]; v != "" {
+		if created, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return created, updated, fmt.Errorf("%w: created_at %q", ErrInvalidTimestamp, v)
+		}
+	}
+	if v := fields["updated_at"]; v != "" {
+		if updated, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return created, updated, fmt.Errorf("%w: updated_at %q", ErrInvalidTimestamp, v)
+		}
+	}
+	return created, updated, nil
+}
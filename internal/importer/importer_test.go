@@ -0,0 +1,164 @@
+package importer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ej_final/internal/sales"
+	"ej_final/internal/user"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newImporter arma un Importer cuyo API de usuarios responde con los usuarios del storage.
+func newImporter(t *testing.T, opts ...Option) (*Importer, *user.LocalStorage, *sales.LocalStorage) {
+	userStorage := user.NewLocalStorage()
+	userService := user.NewService(userStorage, zap.NewNop())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/v1/users/")
+		if _, err := userStorage.Read(r.Context(), id); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	salesStorage := sales.NewLocalStorage()
+	salesService := sales.NewService(salesStorage, zap.NewNop(), server.URL)
+	return New(userService, salesService, zap.NewNop(), opts...), userStorage, salesStorage
+}
+
+func TestImporter_Users(t *testing.T) {
+	imp, storage, _ := newImporter(t)
+	ctx := context.Background()
+
+	csv := "id,name,address,nickname,created_at\n" +
+		"u1,Ana,Calle 1,anita,2018-03-04T05:06:07Z\n" +
+		"u2,Beto,,,ayer\n" +
+		"u1,Ana bis,,,\n" +
+		",Carla,,,\n"
+
+	report, err := imp.Import(ctx, KindUsers, strings.NewReader(csv), true)
+	require.NoError(t, err)
+	require.Equal(t, 4, report.Rows)
+	require.Equal(t, 2, report.Valid)
+	require.Zero(t, report.Written)
+	require.Len(t, report.Errors, 2)
+	require.Equal(t, 3, report.Errors[0].Row)
+	require.ErrorIs(t, report.Errors[0].Err, ErrInvalidTimestamp)
+	require.Equal(t, 4, report.Errors[1].Row)
+	require.ErrorIs(t, report.Errors[1].Err, user.ErrAlreadyExists)
+	_, err = storage.Read(ctx, "u1")
+	require.ErrorIs(t, err, user.ErrNotFound)
+
+	report, err = imp.Import(ctx, KindUsers, strings.NewReader(csv), false)
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Written)
+	u, err := storage.Read(ctx, "u1")
+	require.NoError(t, err)
+	require.Equal(t, "anita", u.NickName)
+	require.Equal(t, time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC), u.CreatedAt)
+}
+
+func TestImporter_Sales(t *testing.T) {
+	imp, userStorage, salesStorage := newImporter(t, WithBatchSize(2))
+	ctx := context.Background()
+	require.NoError(t, userStorage.Set(ctx, &user.User{ID: "u1", Name: "Ana"}))
+
+	// Mismo formato que GET /sales/export, con las columnas desde version que se ignoran
+	csv := "id,user_id,amount,status,created_at,updated_at,version,currency,exchange_rate,refunded_amount,tax\n" +
+		"s1,u1,10.5,approved,2020-01-01T00:00:00Z,2020-01-02T00:00:00Z,2,,,0,\n" +
+		"s2,nadie,5,pending,,,1,,,0,\n" +
+		"s3,u1,diez,pending,,,1,,,0,\n" +
+		"s4,u1,0,pending,,,1,,,0,\n" +
+		"s5,u1,7,lost,,,1,,,0,\n" +
+		"s1,u1,3,pending,,,1,,,0,\n" +
+		",u1,8,rejected,,,1,,,0,\n"
+
+	report, err := imp.Import(ctx, KindSales, strings.NewReader(csv), false)
+	require.NoError(t, err)
+	require.Equal(t, 7, report.Rows)
+	require.Equal(t, 2, report.Valid)
+	require.Equal(t, 2, report.Written)
+
+	rows := map[int]error{}
+	for _, e := range report.Errors {
+		rows[e.Row] = e.Err
+	}
+	require.ErrorIs(t, rows[3], sales.ErrUserNotFound)
+	require.ErrorIs(t, rows[4], ErrInvalidNumber)
+	require.ErrorIs(t, rows[5], sales.ErrInvalidAmount)
+	require.ErrorIs(t, rows[6], sales.ErrInvalidStatus)
+	require.ErrorIs(t, rows[7], sales.ErrAlreadyExists)
+
+	s1, err := salesStorage.Read(ctx, "s1")
+	require.NoError(t, err)
+	require.Equal(t, "approved", s1.Status)
+	require.Equal(t, time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), s1.UpdatedAt)
+	require.Equal(t, 1, s1.Version)
+
+	all, err := salesStorage.GetAll(ctx, "u1")
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+}
+
+func TestImporter_CorrectedRow(t *testing.T) {
+	ctx := context.Background()
+
+	// Una fila que fallo no reserva su ID: la corregida mas abajo se importa,
+	// este en el mismo batch o en otro, y una tercera con el mismo ID si es repetida
+	csv := "id,user_id,amount,status\n" +
+		"s1,nadie,5,pending\n" +
+		"s1,u1,5,pending\n" +
+		"s2,u1,5,lost\n" +
+		"s2,u1,6,approved\n" +
+		"s1,u1,7,pending\n"
+
+	for _, size := range []int{1, 2, 10} {
+		for _, dryRun := range []bool{true, false} {
+			imp, userStorage, salesStorage := newImporter(t, WithBatchSize(size))
+			require.NoError(t, userStorage.Set(ctx, &user.User{ID: "u1", Name: "Ana"}))
+
+			report, err := imp.Import(ctx, KindSales, strings.NewReader(csv), dryRun)
+			require.NoError(t, err)
+			require.Equal(t, 2, report.Valid, "batch %d, dry run %v", size, dryRun)
+
+			rows := map[int]error{}
+			for _, e := range report.Errors {
+				rows[e.Row] = e.Err
+			}
+			require.ErrorIs(t, rows[2], sales.ErrUserNotFound)
+			require.ErrorIs(t, rows[4], sales.ErrInvalidStatus)
+			require.ErrorIs(t, rows[6], sales.ErrAlreadyExists)
+			if !dryRun {
+				s1, err := salesStorage.Read(ctx, "s1")
+				require.NoError(t, err)
+				require.Equal(t, float32(5), s1.Amount)
+			}
+		}
+	}
+}
+
+func TestImporter_InvalidFile(t *testing.T) {
+	imp, _, _ := newImporter(t)
+	ctx := context.Background()
+
+	_, err := imp.Import(ctx, KindSales, strings.NewReader("user_id,amount\nu1,3\n"), true)
+	require.ErrorIs(t, err, ErrMissingColumn)
+
+	_, err = imp.Import(ctx, KindUsers, strings.NewReader(""), true)
+	require.ErrorIs(t, err, ErrMissingColumn)
+
+	report, err := imp.Import(ctx, KindUsers, strings.NewReader("name\nAna\n\"sin cerrar\n"), true)
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Valid)
+	require.ErrorIs(t, report.Errors[0].Err, ErrMalformedRow)
+	require.Equal(t, 3, report.Errors[0].Row)
+}
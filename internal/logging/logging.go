@@ -0,0 +1,33 @@
+package logging
+
+import (
+	"context"
+	"ej_final/internal/requestid"
+	"ej_final/internal/tracing"
+
+	"go.uber.org/zap"
+)
+
+// FromContext returns base enriched with the correlation fields found in ctx
+// (request ID and current trace/span IDs), so every log line can be tied to
+// its request. A nil base yields a no-op logger.
+func FromContext(ctx context.Context, base *zap.Logger) *zap.Logger {
+	if base == nil {
+		base = zap.NewNop()
+	}
+
+	var fields []zap.Field
+	if id := requestid.FromContext(ctx); id != "" {
+		fields = append(fields, zap.String("request_id", id))
+	}
+	if sc := tracing.SpanContextFromContext(ctx); sc.IsValid() {
+		fields = append(fields,
+			zap.String("trace_id", sc.TraceID.String()),
+			zap.String("span_id", sc.SpanID.String()))
+	}
+
+	if len(fields) == 0 {
+		return base
+	}
+	return base.With(fields...)
+}
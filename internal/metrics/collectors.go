@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+)
+
+// CounterVec is a monotonically increasing value partitioned by labels.
+type CounterVec struct {
+	v *vec
+}
+
+// NewCounterVec creates and registers a CounterVec.
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{v: newVec(name, help, "counter", labelNames)}
+	r.register(c)
+	return c
+}
+
+// Inc adds one to the series identified by the label values.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta (which must not be negative) to the series identified by the label values.
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+
+	c.v.mu.Lock()
+	defer c.v.mu.Unlock()
+	c.v.get(labelValues).value += delta
+}
+
+func (c *CounterVec) name() string { return c.v.metricName }
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	writeValues(c.v, w)
+}
+
+// GaugeVec is a value that can go up and down, partitioned by labels.
+type GaugeVec struct {
+	v *vec
+}
+
+// NewGaugeVec creates and registers a GaugeVec.
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	g := &GaugeVec{v: newVec(name, help, "gauge", labelNames)}
+	r.register(g)
+	return g
+}
+
+// Set replaces the value of the series identified by the label values.
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+	g.v.get(labelValues).value = value
+}
+
+// Add adds delta (possibly negative) to the series identified by the label values.
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+	g.v.get(labelValues).value += delta
+}
+
+func (g *GaugeVec) name() string { return g.v.metricName }
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	writeValues(g.v, w)
+}
+
+func writeValues(v *vec, w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.writeHeader(w)
+	if len(v.series) == 0 && len(v.labelNames) == 0 {
+		fmt.Fprintf(w, "%s 0\n", v.metricName)
+		return
+	}
+	for _, s := range v.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", v.metricName, labelString(v.labelNames, s.labels), formatFloat(s.value))
+	}
+}
+
+// HistogramVec counts observations in cumulative buckets, partitioned by labels.
+type HistogramVec struct {
+	v       *vec
+	buckets []float64
+}
+
+// NewHistogramVec creates and registers a HistogramVec. Nil buckets means DefaultBuckets.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+
+	h := &HistogramVec{v: newVec(name, help, "histogram", labelNames), buckets: b}
+	r.register(h)
+	return h
+}
+
+// Observe records value in the series identified by the label values.
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.v.mu.Lock()
+	defer h.v.mu.Unlock()
+
+	s := h.v.get(labelValues)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+	for i, le := range h.buckets {
+		if value <= le {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.value++
+}
+
+func (h *HistogramVec) name() string { return h.v.metricName }
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.v.mu.Lock()
+	defer h.v.mu.Unlock()
+
+	h.v.writeHeader(w)
+	for _, s := range h.v.sorted() {
+		for i, le := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.v.metricName, labelString(h.v.labelNames, s.labels, "le", formatFloat(le)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %s\n", h.v.metricName, labelString(h.v.labelNames, s.labels, "le", "+Inf"), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.v.metricName, labelString(h.v.labelNames, s.labels), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %s\n", h.v.metricName, labelString(h.v.labelNames, s.labels), formatFloat(s.value))
+	}
+}
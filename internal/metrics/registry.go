@@ -0,0 +1,189 @@
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrDuplicate is returned when registering two collectors with the same name.
+var ErrDuplicate = errors.New("metric already registered")
+
+// ContentType is the content type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are latency buckets in seconds, same as the Prometheus client defaults.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector is anything that can render itself in the text format.
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds the collectors exposed by one /metrics endpoint.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+// NewRegistry instantiates a new Registry with no collectors.
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: map[string]collector{},
+	}
+}
+
+// register adds c to the registry, panicking on duplicates like
+// prometheus.MustRegister does, since it is always a programming error.
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.collectors[c.name()]; ok {
+		panic(fmt.Errorf("%w: %s", ErrDuplicate, c.name()))
+	}
+	r.collectors[c.name()] = c
+}
+
+// WriteText renders every collector in the Prometheus text exposition format,
+// sorted by metric name.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.collectors))
+	for n := range r.collectors {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	cs := make([]collector, 0, len(names))
+	for _, n := range names {
+		cs = append(cs, r.collectors[n])
+	}
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range cs {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// series is one labelled time series of a vector.
+type series struct {
+	labels []string
+	value  float64
+
+	// Solo para histogramas
+	counts []uint64
+	sum    float64
+}
+
+// vec holds the series of a metric, keyed by their label values.
+type vec struct {
+	mu         sync.Mutex
+	metricName string
+	help       string
+	typ        string
+	labelNames []string
+	series     map[string]*series
+}
+
+func newVec(name, help, typ string, labelNames []string) *vec {
+	return &vec{
+		metricName: name,
+		help:       help,
+		typ:        typ,
+		labelNames: labelNames,
+		series:     map[string]*series{},
+	}
+}
+
+func (v *vec) name() string { return v.metricName }
+
+// get returns the series for the label values, creating it if needed. Must hold v.mu.
+func (v *vec) get(values []string) *series {
+	if len(values) != len(v.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.metricName, len(v.labelNames), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), values...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// sorted returns the series ordered by label values. Must hold v.mu.
+func (v *vec) sorted() []*series {
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make([]*series, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, v.series[k])
+	}
+	return out
+}
+
+func (v *vec) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.metricName, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.metricName, v.typ)
+}
+
+// labelString renders {a="1",b="2"}, adding the extra pair if given.
+func labelString(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, n, escapeLabel(values[i]))
+	}
+	if len(extra) == 2 {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, extra[0], escapeLabel(extra[1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// labelEscaper escapes the only three characters the text format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func escapeHelp(h string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(h)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+
+	c := r.NewCounterVec("http_requests_total", "Total HTTP requests.", "method", "status")
+	c.Inc("GET", "200")
+	c.Inc("GET", "200")
+	c.Add(3, "POST", "201")
+
+	g := r.NewGaugeVec("sales_pending", "Pending sales.")
+	g.Add(2)
+	g.Add(-1)
+
+	h := r.NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, `/a"b`)
+	h.Observe(0.5, `/a"b`)
+
+	var b strings.Builder
+	require.NoError(t, r.WriteText(&b))
+
+	want := `# HELP http_requests_total Total HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",status="200"} 2
+http_requests_total{method="POST",status="201"} 3
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a\"b",le="0.1"} 1
+latency_seconds_bucket{route="/a\"b",le="1"} 2
+latency_seconds_bucket{route="/a\"b",le="+Inf"} 2
+latency_seconds_sum{route="/a\"b"} 0.55
+latency_seconds_count{route="/a\"b"} 2
+# HELP sales_pending Pending sales.
+# TYPE sales_pending gauge
+sales_pending 1
+`
+	require.Equal(t, want, b.String())
+}
+
+func TestRegistry_Duplicate(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("dup_total", "x")
+
+	require.Panics(t, func() { r.NewCounterVec("dup_total", "x") })
+}
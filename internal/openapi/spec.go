@@ -0,0 +1,203 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Spec is the subset of an OpenAPI 3 document needed to validate traffic.
+type Spec struct {
+	Servers    []Server            `json:"servers"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// Server is an entry of the top level "servers" list.
+type Server struct {
+	URL string `json:"url"`
+}
+
+// PathItem holds the operations of one path template.
+type PathItem struct {
+	Servers    []Server    `json:"servers"`
+	Parameters []Parameter `json:"parameters"`
+	Get        *Operation  `json:"get"`
+	Post       *Operation  `json:"post"`
+	Put        *Operation  `json:"put"`
+	Patch      *Operation  `json:"patch"`
+	Delete     *Operation  `json:"delete"`
+}
+
+// Operation is a single method of a path.
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Parameters  []Parameter         `json:"parameters"`
+	RequestBody *RequestBody        `json:"requestBody"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+// Parameter is a path, query or header parameter.
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody describes the accepted payloads of an operation.
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes one response of an operation.
+type Response struct {
+	Ref     string               `json:"$ref"`
+	Content map[string]MediaType `json:"content"`
+}
+
+// MediaType holds the schema of one content type.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the reusable parts of the document.
+type Components struct {
+	Schemas    map[string]*Schema   `json:"schemas"`
+	Parameters map[string]Parameter `json:"parameters"`
+	Responses  map[string]Response  `json:"responses"`
+}
+
+// Schema is the subset of JSON Schema used by our document.
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Enum                 []any              `json:"enum"`
+	Nullable             bool               `json:"nullable"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	ExclusiveMinimum     bool               `json:"exclusiveMinimum"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	OneOf                []*Schema          `json:"oneOf"`
+}
+
+// Load parses an OpenAPI 3 JSON document and checks that every local
+// reference it uses can be resolved.
+func Load(data []byte) (*Spec, error) {
+	var s Spec
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parsing openapi document: %w", err)
+	}
+
+	for path, item := range s.Paths {
+		for _, op := range item.operations() {
+			for _, p := range append(append([]Parameter(nil), item.Parameters...), op.Parameters...) {
+				if _, err := s.parameter(p); err != nil {
+					return nil, fmt.Errorf("%s: %w", path, err)
+				}
+			}
+			for code, r := range op.Responses {
+				if _, err := s.response(r); err != nil {
+					return nil, fmt.Errorf("%s %s: %w", path, code, err)
+				}
+			}
+		}
+	}
+	for name, schema := range s.Components.Schemas {
+		if err := s.checkRefs(schema); err != nil {
+			return nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+	}
+	return &s, nil
+}
+
+func (p PathItem) operations() map[string]*Operation {
+	ops := map[string]*Operation{}
+	for m, op := range map[string]*Operation{"GET": p.Get, "POST": p.Post, "PUT": p.Put, "PATCH": p.Patch, "DELETE": p.Delete} {
+		if op != nil {
+			ops[m] = op
+		}
+	}
+	return ops
+}
+
+func refName(ref, prefix string) (string, error) {
+	if !strings.HasPrefix(ref, prefix) {
+		return "", fmt.Errorf("unsupported reference %q", ref)
+	}
+	return strings.TrimPrefix(ref, prefix), nil
+}
+
+func (s *Spec) parameter(p Parameter) (Parameter, error) {
+	if p.Ref == "" {
+		return p, nil
+	}
+	name, err := refName(p.Ref, "#/components/parameters/")
+	if err != nil {
+		return p, err
+	}
+	resolved, ok := s.Components.Parameters[name]
+	if !ok {
+		return p, fmt.Errorf("unknown parameter %q", p.Ref)
+	}
+	return resolved, nil
+}
+
+func (s *Spec) response(r Response) (Response, error) {
+	if r.Ref == "" {
+		return r, nil
+	}
+	name, err := refName(r.Ref, "#/components/responses/")
+	if err != nil {
+		return r, err
+	}
+	resolved, ok := s.Components.Responses[name]
+	if !ok {
+		return r, fmt.Errorf("unknown response %q", r.Ref)
+	}
+	return resolved, nil
+}
+
+func (s *Spec) schema(sc *Schema) (*Schema, error) {
+	if sc == nil || sc.Ref == "" {
+		return sc, nil
+	}
+	name, err := refName(sc.Ref, "#/components/schemas/")
+	if err != nil {
+		return nil, err
+	}
+	resolved, ok := s.Components.Schemas[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown schema %q", sc.Ref)
+	}
+	return resolved, nil
+}
+
+func (s *Spec) checkRefs(sc *Schema) error {
+	if sc == nil {
+		return nil
+	}
+	if sc.Ref != "" {
+		_, err := s.schema(sc)
+		return err
+	}
+	for _, p := range sc.Properties {
+		if err := s.checkRefs(p); err != nil {
+			return err
+		}
+	}
+	for _, o := range sc.OneOf {
+		if err := s.checkRefs(o); err != nil {
+			return err
+		}
+	}
+	return s.checkRefs(sc.Items)
+}
@@ -0,0 +1,390 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoOperation is returned when the spec does not describe a method and path.
+var ErrNoOperation = errors.New("operation not described by the spec")
+
+// Route is the operation matched for a request.
+type Route struct {
+	Template   string
+	Method     string
+	Operation  *Operation
+	Parameters []Parameter
+	PathParams map[string]string
+}
+
+// FindRoute matches method and the full request path against the path
+// templates of the spec, under any of the server base paths that apply to
+// each template. Literal templates win over templated ones.
+func (s *Spec) FindRoute(method, path string) (*Route, error) {
+	templates := make([]string, 0, len(s.Paths))
+	for t := range s.Paths {
+		templates = append(templates, t)
+	}
+	// Los templates con menos parametros primero, asi /sales/batch gana sobre /sales/{id}
+	sort.Slice(templates, func(i, j int) bool {
+		ci, cj := strings.Count(templates[i], "{"), strings.Count(templates[j], "{")
+		if ci != cj {
+			return ci < cj
+		}
+		return templates[i] < templates[j]
+	})
+
+	for _, t := range templates {
+		item := s.Paths[t]
+		params, ok := s.matchServers(item, t, path)
+		if !ok {
+			continue
+		}
+		op := item.operations()[strings.ToUpper(method)]
+		if op == nil {
+			return nil, fmt.Errorf("%w: %s %s", ErrNoOperation, method, path)
+		}
+
+		// Los parametros de la operacion pisan a los del path con mismo nombre y ubicacion
+		byKey := map[string]Parameter{}
+		var order []string
+		for _, p := range append(append([]Parameter(nil), item.Parameters...), op.Parameters...) {
+			resolved, err := s.parameter(p)
+			if err != nil {
+				return nil, err
+			}
+			key := resolved.In + ":" + resolved.Name
+			if _, seen := byKey[key]; !seen {
+				order = append(order, key)
+			}
+			byKey[key] = resolved
+		}
+		parameters := make([]Parameter, 0, len(order))
+		for _, k := range order {
+			parameters = append(parameters, byKey[k])
+		}
+
+		return &Route{Template: t, Method: strings.ToUpper(method), Operation: op, Parameters: parameters, PathParams: params}, nil
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrNoOperation, method, path)
+}
+
+// matchServers tries template under each server base path of item, which
+// are the path level servers or else the document ones.
+func (s *Spec) matchServers(item PathItem, template, path string) (map[string]string, bool) {
+	servers := item.Servers
+	if len(servers) == 0 {
+		servers = s.Servers
+	}
+	if len(servers) == 0 {
+		servers = []Server{{URL: "/"}}
+	}
+
+	for _, srv := range servers {
+		base := srv.URL
+		if u, err := url.Parse(srv.URL); err == nil {
+			base = u.Path
+		}
+		base = strings.TrimSuffix(base, "/")
+
+		if !strings.HasPrefix(path, base+"/") {
+			continue
+		}
+		if params, ok := matchPath(template, strings.TrimPrefix(path, base)); ok {
+			return params, true
+		}
+	}
+	return nil, false
+}
+
+func matchPath(template, path string) (map[string]string, bool) {
+	ts := strings.Split(strings.Trim(template, "/"), "/")
+	ps := strings.Split(strings.Trim(path, "/"), "/")
+	if len(ts) != len(ps) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for i, t := range ts {
+		if strings.HasPrefix(t, "{") && strings.HasSuffix(t, "}") {
+			if ps[i] == "" {
+				return nil, false
+			}
+			params[t[1:len(t)-1]] = ps[i]
+			continue
+		}
+		if t != ps[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// ValidateRequest checks the query parameters and the body of a request
+// against the matched operation.
+func (s *Spec) ValidateRequest(r *Route, query url.Values, contentType string, body []byte) error {
+	var errs []error
+	for _, p := range r.Parameters {
+		var value string
+		var present bool
+		switch p.In {
+		case "path":
+			value, present = r.PathParams[p.Name]
+		case "query":
+			present = query.Has(p.Name)
+			value = query.Get(p.Name)
+		default:
+			continue
+		}
+
+		if !present {
+			if p.Required {
+				errs = append(errs, fmt.Errorf("%s parameter %q is required", p.In, p.Name))
+			}
+			continue
+		}
+		if err := s.validateParam(p, value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	rb := r.Operation.RequestBody
+	switch {
+	case rb == nil:
+		// Sin body declarado no validamos lo que venga
+	case len(bytes.TrimSpace(body)) == 0:
+		if rb.Required {
+			errs = append(errs, errors.New("request body is required"))
+		}
+	default:
+		if err := s.validateContent("request body", rb.Content, contentType, body); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateResponse checks a response body against the response declared for
+// status, falling back to "default".
+func (s *Spec) ValidateResponse(r *Route, status int, contentType string, body []byte) error {
+	resp, ok := r.Operation.Responses[strconv.Itoa(status)]
+	if !ok {
+		resp, ok = r.Operation.Responses[strconv.Itoa(status/100)+"XX"]
+	}
+	if !ok {
+		resp, ok = r.Operation.Responses["default"]
+	}
+	if !ok {
+		return fmt.Errorf("status %d is not declared for %s %s", status, r.Method, r.Template)
+	}
+
+	resp, err := s.response(resp)
+	if err != nil {
+		return err
+	}
+	if len(resp.Content) == 0 {
+		if len(bytes.TrimSpace(body)) > 0 {
+			return fmt.Errorf("status %d must not have a body", status)
+		}
+		return nil
+	}
+	return s.validateContent(fmt.Sprintf("response %d", status), resp.Content, contentType, body)
+}
+
+func (s *Spec) validateParam(p Parameter, value string) error {
+	schema, err := s.schema(p.Schema)
+	if err != nil || schema == nil {
+		return err
+	}
+
+	// Los parametros llegan como texto, los convertimos segun el tipo declarado
+	var v any = value
+	switch schema.Type {
+	case "integer", "number":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%s parameter %q: %q is not a valid %s", p.In, p.Name, value, schema.Type)
+		}
+		v = f
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s parameter %q: %q is not a boolean", p.In, p.Name, value)
+		}
+		v = b
+	}
+	return s.Validate(schema, v, p.In+" parameter "+p.Name)
+}
+
+func (s *Spec) validateContent(what string, content map[string]MediaType, contentType string, body []byte) error {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt = contentType
+	}
+
+	media, ok := content[mt]
+	if !ok {
+		if len(content) == 1 {
+			for declared := range content {
+				return fmt.Errorf("%s: content type %q, expected %q", what, contentType, declared)
+			}
+		}
+		return fmt.Errorf("%s: content type %q is not declared", what, contentType)
+	}
+	// Solo validamos cuerpos JSON; application/x-ndjson y text/csv pasan sin mirar
+	if media.Schema == nil || (mt != "application/json" && !strings.HasSuffix(mt, "+json")) {
+		return nil
+	}
+
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("%s: invalid JSON: %w", what, err)
+	}
+	return s.Validate(media.Schema, v, what)
+}
+
+// Validate checks a decoded JSON value against schema. at names the value in error messages.
+func (s *Spec) Validate(schema *Schema, v any, at string) error {
+	schema, err := s.schema(schema)
+	if err != nil {
+		return err
+	}
+	if schema == nil {
+		return nil
+	}
+
+	if v == nil {
+		if schema.Nullable || schema.Type == "" {
+			return nil
+		}
+		return fmt.Errorf("%s: must not be null", at)
+	}
+
+	if len(schema.OneOf) > 0 {
+		matches := 0
+		for _, o := range schema.OneOf {
+			if s.Validate(o, v, at) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%s: must match exactly one schema, matched %d", at, matches)
+		}
+		return nil
+	}
+
+	var errs []error
+	switch schema.Type {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: must be an object", at)
+		}
+		for _, name := range schema.Required {
+			if _, ok := obj[name]; !ok {
+				errs = append(errs, fmt.Errorf("%s: missing required property %q", at, name))
+			}
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			prop, ok := schema.Properties[k]
+			if !ok {
+				if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+					errs = append(errs, fmt.Errorf("%s: unknown property %q", at, k))
+				}
+				continue
+			}
+			if err := s.Validate(prop, obj[k], at+"."+k); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s: must be an array", at)
+		}
+		if schema.MinItems != nil && len(arr) < *schema.MinItems {
+			errs = append(errs, fmt.Errorf("%s: must have at least %d items", at, *schema.MinItems))
+		}
+		if schema.MaxItems != nil && len(arr) > *schema.MaxItems {
+			errs = append(errs, fmt.Errorf("%s: must have at most %d items", at, *schema.MaxItems))
+		}
+		for i, item := range arr {
+			if err := s.Validate(schema.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: must be a string", at)
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a date-time", at, str))
+			}
+		}
+	case "integer", "number":
+		f, ok := toFloat(v)
+		if !ok {
+			return fmt.Errorf("%s: must be a %s", at, schema.Type)
+		}
+		if schema.Type == "integer" && f != float64(int64(f)) {
+			errs = append(errs, fmt.Errorf("%s: must be an integer", at))
+		}
+		if schema.Minimum != nil {
+			if schema.ExclusiveMinimum && f <= *schema.Minimum {
+				errs = append(errs, fmt.Errorf("%s: must be greater than %v", at, *schema.Minimum))
+			} else if f < *schema.Minimum {
+				errs = append(errs, fmt.Errorf("%s: must be at least %v", at, *schema.Minimum))
+			}
+		}
+		if schema.Maximum != nil && f > *schema.Maximum {
+			errs = append(errs, fmt.Errorf("%s: must be at most %v", at, *schema.Maximum))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: must be a boolean", at)
+		}
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, v) {
+		errs = append(errs, fmt.Errorf("%s: %v is not one of %v", at, v, schema.Enum))
+	}
+	return errors.Join(errs...)
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func inEnum(enum []any, v any) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
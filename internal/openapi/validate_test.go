@@ -0,0 +1,125 @@
+package openapi
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const doc = `{
+  "openapi": "3.0.3",
+  "paths": {
+    "/items": {
+      "get": {
+        "parameters": [{"name": "limit", "in": "query", "required": true, "schema": {"type": "integer", "minimum": 1}}],
+        "responses": {"200": {"content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Item"}}}}}}
+      },
+      "post": {
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Item"}}}},
+        "responses": {"201": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Item"}}}}}
+      }
+    },
+    "/items/{id}": {
+      "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "delete": {"responses": {"204": {"description": "deleted"}}}
+    },
+    "/items/special": {
+      "delete": {"responses": {"204": {"description": "deleted"}}}
+    }
+  },
+  "components": {
+    "schemas": {
+      "Item": {
+        "type": "object",
+        "required": ["name", "price"],
+        "additionalProperties": false,
+        "properties": {
+          "name": {"type": "string"},
+          "price": {"type": "number", "minimum": 0, "exclusiveMinimum": true},
+          "kind": {"type": "string", "enum": ["a", "b"]}
+        }
+      }
+    }
+  }
+}`
+
+func TestSpec_FindRoute(t *testing.T) {
+	s, err := Load([]byte(doc))
+	require.NoError(t, err)
+
+	r, err := s.FindRoute("DELETE", "/items/42")
+	require.NoError(t, err)
+	require.Equal(t, "/items/{id}", r.Template)
+	require.Equal(t, "42", r.PathParams["id"])
+
+	r, err = s.FindRoute("DELETE", "/items/special")
+	require.NoError(t, err)
+	require.Equal(t, "/items/special", r.Template)
+
+	_, err = s.FindRoute("PUT", "/items")
+	require.ErrorIs(t, err, ErrNoOperation)
+
+	_, err = s.FindRoute("GET", "/nope")
+	require.ErrorIs(t, err, ErrNoOperation)
+}
+
+func TestSpec_ValidateRequest(t *testing.T) {
+	s, err := Load([]byte(doc))
+	require.NoError(t, err)
+
+	post, _ := s.FindRoute("POST", "/items")
+	require.NoError(t, s.ValidateRequest(post, nil, "application/json", []byte(`{"name":"x","price":1.5,"kind":"a"}`)))
+
+	err = s.ValidateRequest(post, nil, "application/json", []byte(`{"price":0,"kind":"c","extra":true}`))
+	require.ErrorContains(t, err, `missing required property "name"`)
+	require.ErrorContains(t, err, "must be greater than 0")
+	require.ErrorContains(t, err, "is not one of")
+	require.ErrorContains(t, err, `unknown property "extra"`)
+
+	require.ErrorContains(t, s.ValidateRequest(post, nil, "application/json", nil), "request body is required")
+	require.ErrorContains(t, s.ValidateRequest(post, nil, "text/plain", []byte(`{}`)), "content type")
+
+	get, _ := s.FindRoute("GET", "/items")
+	require.NoError(t, s.ValidateRequest(get, url.Values{"limit": {"10"}}, "", nil))
+	require.ErrorContains(t, s.ValidateRequest(get, url.Values{}, "", nil), `query parameter "limit" is required`)
+	require.ErrorContains(t, s.ValidateRequest(get, url.Values{"limit": {"diez"}}, "", nil), "is not a valid integer")
+}
+
+func TestSpec_ValidateResponse(t *testing.T) {
+	s, err := Load([]byte(doc))
+	require.NoError(t, err)
+
+	get, _ := s.FindRoute("GET", "/items")
+	require.NoError(t, s.ValidateResponse(get, 200, "application/json; charset=utf-8", []byte(`[{"name":"x","price":2}]`)))
+	require.ErrorContains(t, s.ValidateResponse(get, 200, "application/json", []byte(`[{"name":"x"}]`)), `[0]: missing required property "price"`)
+	require.ErrorContains(t, s.ValidateResponse(get, 500, "application/json", nil), "status 500 is not declared")
+
+	del, _ := s.FindRoute("DELETE", "/items/1")
+	require.NoError(t, s.ValidateResponse(del, 204, "", nil))
+}
+
+func TestLoad_UnknownRef(t *testing.T) {
+	_, err := Load([]byte(`{"paths": {}, "components": {"schemas": {"A": {"$ref": "#/components/schemas/B"}}}}`))
+	require.ErrorContains(t, err, "unknown schema")
+}
+
+func TestSpec_FindRoute_Servers(t *testing.T) {
+	s, err := Load([]byte(`{
+  "servers": [{"url": "http://localhost:8080/v1"}, {"url": "/v2"}],
+  "paths": {
+    "/items": {"get": {"responses": {"200": {"description": "ok"}}}},
+    "/healthz": {"servers": [{"url": "/"}], "get": {"responses": {"200": {"description": "ok"}}}}
+  }
+}`))
+	require.NoError(t, err)
+
+	for _, path := range []string{"/v1/items", "/v2/items", "/healthz"} {
+		_, err := s.FindRoute("GET", path)
+		require.NoError(t, err, path)
+	}
+	for _, path := range []string{"/items", "/v1/healthz", "/v3/items"} {
+		_, err := s.FindRoute("GET", path)
+		require.ErrorIs(t, err, ErrNoOperation, path)
+	}
+}
@@ -0,0 +1,105 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SignatureHeader is the header where the gateway sends the signature of a
+// callback: "sha256=" followed by the hex HMAC-SHA256 of the raw body.
+const SignatureHeader = "X-Payment-Signature"
+
+// ErrInvalidSignature is returned for a callback whose signature is missing
+// or does not match its body.
+var ErrInvalidSignature = errors.New("invalid payment callback signature")
+
+// ErrInvalidCallback is returned for a signed callback that cannot be
+// understood, like one without transaction or with an unknown status.
+var ErrInvalidCallback = errors.New("invalid payment callback")
+
+// ErrCallbacksDisabled is returned when a callback arrives but no secret was
+// configured to verify it.
+var ErrCallbacksDisabled = errors.New("payment callbacks disabled")
+
+// Callback is the asynchronous notice of the gateway about the status of a
+// transaction. Reference is the ID of the sale, as sent in the Request.
+// The gateway may send the same callback more than once and in any order.
+type Callback struct {
+	EventID       string `json:"event_id"`
+	TransactionID string `json:"transaction_id"`
+	Reference     string `json:"reference"`
+	Status        string `json:"status"`
+
+	// Sequence orders the callbacks of a transaction: a later status change
+	// has a greater one. It is 0 when the gateway does not send it.
+	Sequence int64 `json:"sequence,omitempty"`
+}
+
+// Verifier checks the signature of the callbacks with a secret shared with
+// the gateway.
+type Verifier struct {
+	secret []byte
+}
+
+// NewVerifier returns a Verifier for secret.
+func NewVerifier(secret string) *Verifier {
+	return &Verifier{secret: []byte(secret)}
+}
+
+// VerifierFromEnv builds the Verifier from PAYMENT_CALLBACK_SECRET.
+// Returns nil when it is not set, meaning that callbacks are not accepted.
+func VerifierFromEnv() *Verifier {
+	secret := os.Getenv("PAYMENT_CALLBACK_SECRET")
+	if secret == "" {
+		return nil
+	}
+	return NewVerifier(secret)
+}
+
+// Sign returns the value of SignatureHeader for body.
+func (v *Verifier) Sign(body []byte) string {
+	return "sha256=" + hex.EncodeToString(v.mac(body))
+}
+
+// mac returns the HMAC-SHA256 of body with the secret.
+func (v *Verifier) mac(body []byte) []byte {
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// Parse checks signature against body and decodes the callback in it.
+// Returns ErrInvalidSignature or ErrInvalidCallback.
+func (v *Verifier) Parse(body []byte, signature string) (*Callback, error) {
+	got, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return nil, ErrInvalidSignature
+	}
+	mac, err := hex.DecodeString(got)
+	if err != nil || !hmac.Equal(mac, v.mac(body)) {
+		return nil, ErrInvalidSignature
+	}
+
+	var cb Callback
+	if err := json.Unmarshal(body, &cb); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCallback, err)
+	}
+	if cb.TransactionID == "" || cb.Reference == "" {
+		return nil, fmt.Errorf("%w: transaction_id and reference are required", ErrInvalidCallback)
+	}
+	if cb.Sequence < 0 {
+		return nil, fmt.Errorf("%w: negative sequence", ErrInvalidCallback)
+	}
+	switch cb.Status {
+	case StatusAuthorized, StatusCaptured, StatusDeclined, StatusVoided:
+	default:
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidCallback, cb.Status)
+	}
+	return &cb, nil
+}
@@ -0,0 +1,46 @@
+package payment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifier_Parse(t *testing.T) {
+	v := NewVerifier("secreto")
+	body := []byte(`{"event_id":"evt-1","transaction_id":"tx-1","reference":"venta-1","status":"captured","sequence":2}`)
+
+	cb, err := v.Parse(body, v.Sign(body))
+	require.NoError(t, err)
+	require.Equal(t, Callback{EventID: "evt-1", TransactionID: "tx-1", Reference: "venta-1", Status: StatusCaptured,
+		Sequence: 2}, *cb)
+
+	// Firmado con otro secreto, sin prefijo o con el body cambiado
+	_, err = v.Parse(body, NewVerifier("otro").Sign(body))
+	require.ErrorIs(t, err, ErrInvalidSignature)
+	_, err = v.Parse(body, v.Sign(body)[len("sha256="):])
+	require.ErrorIs(t, err, ErrInvalidSignature)
+	_, err = v.Parse(append(body, ' '), v.Sign(body))
+	require.ErrorIs(t, err, ErrInvalidSignature)
+	_, err = v.Parse(body, "sha256=zz")
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	for _, bad := range []string{
+		`{"transaction_id":"tx-1","reference":"venta-1","status":"refunded"}`,
+		`{"reference":"venta-1","status":"captured"}`,
+		`{"transaction_id":"tx-1","reference":"venta-1","status":"captured","sequence":-1}`,
+		`no es json`,
+	} {
+		_, err = v.Parse([]byte(bad), v.Sign([]byte(bad)))
+		require.ErrorIs(t, err, ErrInvalidCallback, bad)
+	}
+}
+
+func TestVerifierFromEnv(t *testing.T) {
+	t.Setenv("PAYMENT_CALLBACK_SECRET", "")
+	require.Nil(t, VerifierFromEnv())
+
+	t.Setenv("PAYMENT_CALLBACK_SECRET", "secreto")
+	body := []byte("x")
+	require.Equal(t, NewVerifier("secreto").Sign(body), VerifierFromEnv().Sign(body))
+}
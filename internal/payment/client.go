@@ -0,0 +1,145 @@
+package payment
+
+import (
+	"context"
+	"ej_final/internal/requestid"
+	"ej_final/internal/tracing"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// DefaultTimeout bounds each call to the gateway when
+// PAYMENT_GATEWAY_TIMEOUT is not set.
+const DefaultTimeout = 5 * time.Second
+
+// Client is a PaymentGateway for the sales service that calls a gateway
+// over HTTP, like the Stub.
+type Client struct {
+	baseURL string
+	http    *resty.Client
+}
+
+// NewClient returns a Client for the gateway at baseURL. Calls that take
+// longer than timeout fail with ErrTimeout.
+func NewClient(baseURL string, timeout time.Duration) *Client {
+	return &Client{baseURL: baseURL, http: resty.New().SetTimeout(timeout)}
+}
+
+// ClientFromEnv builds the Client of the gateway at PAYMENT_GATEWAY_URL,
+// with the timeout of PAYMENT_GATEWAY_TIMEOUT (DefaultTimeout if not set).
+// It returns nil, and no error, if PAYMENT_GATEWAY_URL is not set.
+func ClientFromEnv() (*Client, error) {
+	url := os.Getenv("PAYMENT_GATEWAY_URL")
+	if url == "" {
+		return nil, nil
+	}
+
+	timeout := DefaultTimeout
+	if raw := os.Getenv("PAYMENT_GATEWAY_TIMEOUT"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid PAYMENT_GATEWAY_TIMEOUT %q", raw)
+		}
+		timeout = d
+	}
+	return NewClient(url, timeout), nil
+}
+
+// Authorize holds the amount of req in the gateway.
+// Returns ErrTimeout, ErrUnavailable or the error of ctx.
+func (c *Client) Authorize(ctx context.Context, req Request) (*Result, error) {
+	var res Result
+	if err := c.do(ctx, "payment.Authorize", "/authorizations", req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Capture charges an authorized transaction.
+// Returns ErrTransactionNotFound, ErrTimeout, ErrUnavailable or the error of ctx.
+func (c *Client) Capture(ctx context.Context, transactionID string) (*Result, error) {
+	var res Result
+	if err := c.do(ctx, "payment.Capture", "/transactions/"+transactionID+"/capture", nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Void cancels a transaction.
+// Returns ErrTransactionNotFound, ErrInvalidState, ErrTimeout, ErrUnavailable
+// or the error of ctx.
+func (c *Client) Void(ctx context.Context, transactionID string) error {
+	return c.do(ctx, "payment.Void", "/transactions/"+transactionID+"/void", nil, nil)
+}
+
+// Refund gives back amount of a captured transaction.
+// Returns ErrTransactionNotFound, ErrInvalidState, ErrTimeout,
+// ErrUnavailable or the error of ctx.
+func (c *Client) Refund(ctx context.Context, transactionID string, amount float32) error {
+	body := map[string]float32{"amount": amount}
+	return c.do(ctx, "payment.Refund", "/transactions/"+transactionID+"/refunds", body, nil)
+}
+
+// Ping checks that the gateway answers its liveness endpoint.
+func (c *Client) Ping(ctx context.Context) error {
+	resp, err := c.http.R().SetContext(ctx).Get(c.baseURL + "/healthz")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("payment gateway answered %d", resp.StatusCode())
+	}
+	return nil
+}
+
+// do posts body to path and decodes the answer into out, if not nil,
+// mapping the failures to the errors of the package.
+func (c *Client) do(ctx context.Context, name, path string, body, out any) error {
+	ctx, span := tracing.StartKind(ctx, name, tracing.KindClient)
+	defer span.End()
+
+	req := c.http.R().SetContext(ctx)
+	if id := requestid.FromContext(ctx); id != "" {
+		req.SetHeader(requestid.Header, id)
+	}
+	tracing.Inject(ctx, req.Header)
+	if body != nil {
+		req.SetBody(body)
+	}
+	if out != nil {
+		req.SetResult(out)
+	}
+
+	resp, err := req.Post(c.baseURL + path)
+	if err != nil {
+		span.RecordError(err)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return fmt.Errorf("%w: %v", ErrTimeout, err)
+		}
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	span.SetAttribute("http.status_code", resp.StatusCode())
+	switch code := resp.StatusCode(); {
+	case code >= 200 && code < 300:
+		return nil
+	case code == http.StatusGatewayTimeout:
+		return ErrTimeout
+	case code == http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrTransactionNotFound, path)
+	case code == http.StatusConflict:
+		return fmt.Errorf("%w: %s", ErrInvalidState, resp.String())
+	default:
+		return fmt.Errorf("%w: %s answered %d", ErrUnavailable, path, code)
+	}
+}
@@ -0,0 +1,85 @@
+package payment
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newStubClient levanta el Stub y un Client contra el con un timeout corto.
+func newStubClient(t *testing.T) (*Stub, *Client) {
+	stub := NewStub(time.Second)
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	return stub, NewClient(server.URL, 100*time.Millisecond)
+}
+
+func TestClient_AgainstStub(t *testing.T) {
+	stub, c := newStubClient(t)
+	ctx := context.Background()
+
+	require.NoError(t, c.Ping(ctx))
+
+	res, err := c.Authorize(ctx, Request{Reference: "venta-1", UserID: "ana", Amount: 20, Currency: "ARS"})
+	require.NoError(t, err)
+	require.Equal(t, StatusAuthorized, res.Status)
+	require.NotEmpty(t, res.TransactionID)
+
+	res, err = c.Capture(ctx, res.TransactionID)
+	require.NoError(t, err)
+	require.Equal(t, StatusCaptured, res.Status)
+	require.NoError(t, c.Refund(ctx, res.TransactionID, 5))
+	require.ErrorIs(t, c.Refund(ctx, res.TransactionID, 50), ErrInvalidState)
+
+	tx, err := stub.Fake.Transaction(ctx, res.TransactionID)
+	require.NoError(t, err)
+	require.Equal(t, float32(5), tx.Refunded)
+	require.Equal(t, "ana", tx.Request.UserID)
+
+	res, err = c.Authorize(ctx, Request{Amount: 7.51})
+	require.NoError(t, err)
+	require.Equal(t, StatusDeclined, res.Status)
+
+	_, err = c.Capture(ctx, "nope")
+	require.ErrorIs(t, err, ErrTransactionNotFound)
+	require.ErrorIs(t, c.Void(ctx, "nope"), ErrTransactionNotFound)
+}
+
+func TestClient_Timeout(t *testing.T) {
+	_, c := newStubClient(t)
+
+	// El stub se cuelga mas que el timeout del cliente
+	start := time.Now()
+	_, err := c.Authorize(context.Background(), Request{Amount: 7.52})
+	require.ErrorIs(t, err, ErrTimeout)
+	require.Less(t, time.Since(start), time.Second)
+
+	// Si el que se va es el llamador, se devuelve su error
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.Authorize(ctx, Request{Amount: 7})
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = NewClient("http://127.0.0.1:1", time.Second).Authorize(context.Background(), Request{Amount: 7})
+	require.ErrorIs(t, err, ErrUnavailable)
+}
+
+func TestClientFromEnv(t *testing.T) {
+	t.Setenv("PAYMENT_GATEWAY_URL", "")
+	c, err := ClientFromEnv()
+	require.NoError(t, err)
+	require.Nil(t, c)
+
+	t.Setenv("PAYMENT_GATEWAY_URL", "http://localhost:8090")
+	t.Setenv("PAYMENT_GATEWAY_TIMEOUT", "nope")
+	_, err = ClientFromEnv()
+	require.Error(t, err)
+
+	t.Setenv("PAYMENT_GATEWAY_TIMEOUT", "2s")
+	c, err = ClientFromEnv()
+	require.NoError(t, err)
+	require.NotNil(t, c)
+}
@@ -0,0 +1,154 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// refundEpsilon absorbs the float32 rounding of the amounts, as the sales do.
+const refundEpsilon = 0.005
+
+// Fake is an in-memory gateway for the tests. It keeps every transaction
+// and answers by the cents of the amount (see DeclineCents). Timeouts are
+// returned right away as ErrTimeout, without waiting.
+type Fake struct {
+	mu           sync.Mutex
+	transactions map[string]*Transaction
+}
+
+// NewFake returns a Fake without transactions.
+func NewFake() *Fake {
+	return &Fake{transactions: map[string]*Transaction{}}
+}
+
+// Authorize holds the amount of req. A declined authorization is kept too,
+// with StatusDeclined.
+// Returns ErrTimeout for amounts ending in TimeoutCents.
+func (f *Fake) Authorize(ctx context.Context, req Request) (*Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if cents(req.Amount) == TimeoutCents {
+		return nil, ErrTimeout
+	}
+
+	now := time.Now()
+	t := &Transaction{
+		ID:        uuid.NewString(),
+		Request:   req,
+		Status:    StatusAuthorized,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if cents(req.Amount) == DeclineCents {
+		t.Status = StatusDeclined
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.transactions[t.ID] = t
+	return &Result{TransactionID: t.ID, Status: t.Status}, nil
+}
+
+// Capture charges an authorized transaction; capturing twice is a no-op.
+// Transactions declined or voided, and amounts ending in
+// DeclineCaptureCents, are answered with StatusDeclined.
+// Returns ErrTransactionNotFound.
+func (f *Fake) Capture(ctx context.Context, transactionID string) (*Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, ok := f.transactions[transactionID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTransactionNotFound, transactionID)
+	}
+	if t.Status == StatusAuthorized {
+		t.Status = StatusCaptured
+		if cents(t.Request.Amount) == DeclineCaptureCents {
+			t.Status = StatusDeclined
+		}
+		t.UpdatedAt = time.Now()
+	}
+
+	status := t.Status
+	if status != StatusCaptured {
+		status = StatusDeclined
+	}
+	return &Result{TransactionID: t.ID, Status: status}, nil
+}
+
+// Void cancels a transaction, giving back what was captured; voiding twice,
+// or a declined transaction, is a no-op.
+// Returns ErrTransactionNotFound or ErrInvalidState if it was refunded.
+func (f *Fake) Void(ctx context.Context, transactionID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, ok := f.transactions[transactionID]
+	switch {
+	case !ok:
+		return fmt.Errorf("%w: %s", ErrTransactionNotFound, transactionID)
+	case t.Refunded > 0:
+		return fmt.Errorf("%w: %s has refunds", ErrInvalidState, transactionID)
+	case t.Status == StatusAuthorized || t.Status == StatusCaptured:
+		t.Status = StatusVoided
+		t.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// Refund gives back amount of a captured transaction.
+// Returns ErrTransactionNotFound, or ErrInvalidState if it is not captured
+// or the refunds would go over its amount.
+func (f *Fake) Refund(ctx context.Context, transactionID string, amount float32) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, ok := f.transactions[transactionID]
+	switch {
+	case !ok:
+		return fmt.Errorf("%w: %s", ErrTransactionNotFound, transactionID)
+	case t.Status != StatusCaptured:
+		return fmt.Errorf("%w: %s is %s", ErrInvalidState, transactionID, t.Status)
+	case t.Refunded+amount > t.Request.Amount+refundEpsilon:
+		return fmt.Errorf("%w: refunds exceed the amount of %s", ErrInvalidState, transactionID)
+	}
+	t.Refunded += amount
+	t.UpdatedAt = time.Now()
+	return nil
+}
+
+// Transaction returns a copy of the transaction, for the tests to check how
+// it ended.
+// Returns ErrTransactionNotFound.
+func (f *Fake) Transaction(ctx context.Context, transactionID string) (*Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, ok := f.transactions[transactionID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTransactionNotFound, transactionID)
+	}
+	c := *t
+	return &c, nil
+}
@@ -0,0 +1,73 @@
+package payment
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFake_Lifecycle(t *testing.T) {
+	f := NewFake()
+	ctx := context.Background()
+
+	res, err := f.Authorize(ctx, Request{Reference: "venta-1", Amount: 10})
+	require.NoError(t, err)
+	require.Equal(t, StatusAuthorized, res.Status)
+
+	res, err = f.Capture(ctx, res.TransactionID)
+	require.NoError(t, err)
+	require.Equal(t, StatusCaptured, res.Status)
+	// Capturar de nuevo no cambia nada
+	res, err = f.Capture(ctx, res.TransactionID)
+	require.NoError(t, err)
+	require.Equal(t, StatusCaptured, res.Status)
+
+	require.NoError(t, f.Refund(ctx, res.TransactionID, 4))
+	require.ErrorIs(t, f.Refund(ctx, res.TransactionID, 6.5), ErrInvalidState)
+	require.NoError(t, f.Refund(ctx, res.TransactionID, 6))
+	require.ErrorIs(t, f.Void(ctx, res.TransactionID), ErrInvalidState)
+
+	tx, err := f.Transaction(ctx, res.TransactionID)
+	require.NoError(t, err)
+	require.Equal(t, float32(10), tx.Refunded)
+	require.Equal(t, "venta-1", tx.Request.Reference)
+
+	_, err = f.Capture(ctx, "nope")
+	require.ErrorIs(t, err, ErrTransactionNotFound)
+}
+
+func TestFake_Outcomes(t *testing.T) {
+	f := NewFake()
+	ctx := context.Background()
+
+	res, err := f.Authorize(ctx, Request{Amount: 10.51})
+	require.NoError(t, err)
+	require.Equal(t, StatusDeclined, res.Status)
+	// Una autorizacion rechazada no se puede cobrar, y anularla no hace nada
+	res, err = f.Capture(ctx, res.TransactionID)
+	require.NoError(t, err)
+	require.Equal(t, StatusDeclined, res.Status)
+	require.NoError(t, f.Void(ctx, res.TransactionID))
+
+	_, err = f.Authorize(ctx, Request{Amount: 10.52})
+	require.ErrorIs(t, err, ErrTimeout)
+
+	res, err = f.Authorize(ctx, Request{Amount: 10.53})
+	require.NoError(t, err)
+	require.Equal(t, StatusAuthorized, res.Status)
+	res, err = f.Capture(ctx, res.TransactionID)
+	require.NoError(t, err)
+	require.Equal(t, StatusDeclined, res.Status)
+
+	// Anular lo cobrado lo devuelve, y despues ya no se puede cobrar
+	res, err = f.Authorize(ctx, Request{Amount: 3})
+	require.NoError(t, err)
+	require.NoError(t, f.Void(ctx, res.TransactionID))
+	tx, err := f.Transaction(ctx, res.TransactionID)
+	require.NoError(t, err)
+	require.Equal(t, StatusVoided, tx.Status)
+	res, err = f.Capture(ctx, res.TransactionID)
+	require.NoError(t, err)
+	require.Equal(t, StatusDeclined, res.Status)
+}
@@ -0,0 +1,78 @@
+// Package payment talks to the payment gateway that authorizes and captures
+// the sales. It has an HTTP client for a real gateway, an in-memory Fake for
+// the tests and a Stub server that simulates one locally, plus the Verifier
+// of the callbacks the gateway sends when a payment changes.
+package payment
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// ErrTimeout is returned when the gateway does not answer in time. The
+// outcome of the operation is unknown.
+var ErrTimeout = errors.New("payment gateway timeout")
+
+// ErrUnavailable is returned when the gateway cannot be reached or answers
+// something unexpected.
+var ErrUnavailable = errors.New("payment gateway unavailable")
+
+// ErrTransactionNotFound is returned for a transaction the gateway does not know.
+var ErrTransactionNotFound = errors.New("payment transaction not found")
+
+// ErrInvalidState is returned for an operation the transaction does not
+// allow in its state, like refunding a payment that was not captured or
+// more than was captured.
+var ErrInvalidState = errors.New("invalid payment transaction state")
+
+// Statuses of a transaction.
+const (
+	StatusAuthorized = "authorized"
+	StatusCaptured   = "captured"
+	StatusDeclined   = "declined"
+	StatusVoided     = "voided"
+)
+
+// Request is the payment of a sale. Reference is the ID of the sale.
+type Request struct {
+	Reference string  `json:"reference"`
+	UserID    string  `json:"user_id"`
+	Amount    float32 `json:"amount"`
+	Currency  string  `json:"currency,omitempty"`
+}
+
+// Result is the answer of the gateway to an authorization or a capture.
+type Result struct {
+	TransactionID string `json:"transaction_id"`
+	Status        string `json:"status"`
+}
+
+// Transaction is the state of a payment in the gateway.
+type Transaction struct {
+	ID        string    `json:"id"`
+	Request   Request   `json:"request"`
+	Status    string    `json:"status"`
+	Refunded  float32   `json:"refunded"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// The Fake and the Stub decide by the cents of the amount, like the test
+// cards of real providers. Any other amount is approved.
+const (
+	// DeclineCents makes the authorization be declined, as in 10.51.
+	DeclineCents = 51
+
+	// TimeoutCents makes the authorization time out, as in 10.52.
+	TimeoutCents = 52
+
+	// DeclineCaptureCents authorizes the payment but declines its capture,
+	// as in 10.53.
+	DeclineCaptureCents = 53
+)
+
+// cents returns the cents of amount, 51 for 10.51.
+func cents(amount float32) int {
+	return int(math.Round(float64(amount)*100)) % 100
+}
@@ -0,0 +1,141 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// DefaultStubDelay is how long the Stub holds the requests that time out.
+const DefaultStubDelay = 30 * time.Second
+
+// Stub is a local HTTP gateway that simulates approvals, declines and
+// timeouts with a Fake, for running the API without a real provider. It
+// answers the API the Client speaks:
+//
+//	POST /authorizations                  Request -> 201 Result
+//	POST /transactions/{id}/capture       -> 200 Result
+//	POST /transactions/{id}/void          -> 204
+//	POST /transactions/{id}/refunds       {"amount": ...} -> 204
+//	GET  /transactions/{id}               -> 200 Transaction
+//	GET  /healthz                         -> 200
+//
+// Authorizations that time out are held for Delay (or until the client
+// gives up) and then answered 504.
+type Stub struct {
+	Fake  *Fake
+	Delay time.Duration
+
+	mux *http.ServeMux
+}
+
+// NewStub returns a Stub over a new Fake, holding timeouts for delay.
+func NewStub(delay time.Duration) *Stub {
+	s := &Stub{Fake: NewFake(), Delay: delay, mux: http.NewServeMux()}
+	s.mux.HandleFunc("POST /authorizations", s.handleAuthorize)
+	s.mux.HandleFunc("POST /transactions/{id}/capture", s.handleCapture)
+	s.mux.HandleFunc("POST /transactions/{id}/void", s.handleVoid)
+	s.mux.HandleFunc("POST /transactions/{id}/refunds", s.handleRefund)
+	s.mux.HandleFunc("GET /transactions/{id}", s.handleGetTransaction)
+	s.mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Stub) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Amount <= 0 {
+		writeError(w, http.StatusBadRequest, errors.New("invalid authorization request"))
+		return
+	}
+
+	res, err := s.Fake.Authorize(r.Context(), req)
+	if errors.Is(err, ErrTimeout) {
+		// Simulamos un proveedor colgado: no contestamos hasta que pase el delay
+		select {
+		case <-time.After(s.Delay):
+		case <-r.Context().Done():
+		}
+	}
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, res)
+}
+
+func (s *Stub) handleCapture(w http.ResponseWriter, r *http.Request) {
+	res, err := s.Fake.Capture(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Stub) handleVoid(w http.ResponseWriter, r *http.Request) {
+	if err := s.Fake.Void(r.Context(), r.PathValue("id")); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Stub) handleRefund(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Amount float32 `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Amount <= 0 {
+		writeError(w, http.StatusBadRequest, errors.New("invalid refund request"))
+		return
+	}
+
+	if err := s.Fake.Refund(r.Context(), r.PathValue("id"), req.Amount); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Stub) handleGetTransaction(w http.ResponseWriter, r *http.Request) {
+	t, err := s.Fake.Transaction(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// statusOf is the HTTP status the Stub answers err with, the one the Client
+// maps back to the same error.
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, ErrTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ErrTransactionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidState):
+		return http.StatusConflict
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,36 @@
+// Package product is the catalog of the products that can be sold, with
+// their price and the stock left.
+package product
+
+import "time"
+
+// Product represents an item of the catalog with metadata for auditing and versioning.
+type Product struct {
+	ID        string    `json:"id"`
+	SKU       string    `json:"sku"`
+	Name      string    `json:"name"`
+	Price     float32   `json:"price"`
+	Stock     int       `json:"stock"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int       `json:"version"`
+
+	// Stock is what is left to sell; Reserved is held by pending sales and
+	// goes back to Stock if they are rejected or their reservation expires.
+	Reserved int `json:"reserved"`
+}
+
+// UpdateFields represents the optional fields for updating a Product.
+// A nil pointer means “no change” for that field.
+type UpdateFields struct {
+	SKU   *string  `json:"sku"`
+	Name  *string  `json:"name"`
+	Price *float32 `json:"price"`
+	Stock *int     `json:"stock"`
+}
+
+// Item is a quantity of a product to reserve or release.
+type Item struct {
+	ProductID string
+	Quantity  int
+}
@@ -0,0 +1,298 @@
+package product
+
+import (
+	"container/heap"
+	"context"
+	"ej_final/internal/logging"
+	"ej_final/internal/tracing"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// DefaultReservationTTL is how long a reservation holds its stock unless
+// WithReservationTTL says otherwise.
+const DefaultReservationTTL = 15 * time.Minute
+
+// States of a Reservation.
+const (
+	// ReservationHeld keeps the stock apart until the reservation is
+	// committed, released or expires.
+	ReservationHeld = "held"
+
+	// ReservationCommitted means the stock was sold. It is kept until its
+	// ExpiresAt so a repeated Commit is a no-op and a Release of a sale that
+	// could not be stored can still give the stock back; then it is forgotten.
+	ReservationCommitted = "committed"
+)
+
+// Reservation is the stock held for a sale while it is decided.
+type Reservation struct {
+	ID        string
+	Items     []Item
+	State     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Reserve holds the stock of the items for the reservation TTL and returns
+// the reservation with the products of the items, in order, with their
+// current price.
+// Returns ErrInvalidQuantity, or an error wrapping ErrNotFound or
+// ErrInsufficientStock.
+func (s *Service) Reserve(ctx context.Context, items []Item) (*Reservation, []*Product, error) {
+	ctx, span := tracing.Start(ctx, "product.Service.Reserve")
+	defer span.End()
+
+	if err := validateItems(items); err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	r := &Reservation{
+		ID:        uuid.NewString(),
+		Items:     items,
+		State:     ReservationHeld,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.reservationTTL),
+	}
+	products, err := s.storage.Reserve(ctx, r)
+	if err != nil {
+		logging.FromContext(ctx, s.logger).Warn("No se pudo reservar stock", zap.Error(err))
+		return nil, nil, err
+	}
+	return r, products, nil
+}
+
+// Commit sells the stock of a reservation. Committing it again is a no-op.
+// Returns ErrReservationNotFound, or ErrReservationExpired if its TTL passed.
+func (s *Service) Commit(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "product.Service.Commit")
+	defer span.End()
+
+	return s.storage.Commit(ctx, id)
+}
+
+// Release gives back the stock of a reservation, held or committed.
+// Returns ErrReservationNotFound if it was already released or expired, or
+// if it was committed and its TTL passed.
+func (s *Service) Release(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "product.Service.Release")
+	defer span.End()
+
+	return s.storage.Release(ctx, id)
+}
+
+// ExpireReservations releases the held reservations past their TTL and
+// forgets the committed ones.
+func (s *Service) ExpireReservations(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "product.Service.ExpireReservations")
+	defer span.End()
+
+	n, err := s.storage.ExpireReservations(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if n > 0 {
+		logging.FromContext(ctx, s.logger).Info("Reservas vencidas liberadas", zap.Int("reservations", n))
+	}
+	return n, nil
+}
+
+// RunExpirer calls ExpireReservations every interval until ctx is done.
+// Reserve also expires them, so this only matters to give the stock back
+// to products nobody is buying.
+func (s *Service) RunExpirer(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if _, err := s.ExpireReservations(ctx); err != nil && ctx.Err() == nil {
+				s.logger.Error("Error liberando reservas vencidas", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Reserve moves the stock of the items of r to Reserved under a single
+// lock, so concurrent reservations can never take more than the stock.
+// Expired reservations are released first, and items of the same product
+// are added up before checking. The stock changes bump the Version of the
+// products, so an update read before them conflicts.
+// Returns an error wrapping ErrNotFound or ErrInsufficientStock with the
+// product ID; in that case no stock is taken.
+func (l *LocalStorage) Reserve(ctx context.Context, r *Reservation) ([]*Product, error) {
+	ctx, span := tracing.Start(ctx, "product.LocalStorage.Reserve")
+	defer span.End()
+	span.SetAttribute("items", len(r.Items))
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.expire(l.now())
+
+	wanted := map[string]int{}
+	for _, it := range r.Items {
+		p, ok := l.m[it.ProductID]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, it.ProductID)
+		}
+		wanted[it.ProductID] += it.Quantity
+		if wanted[it.ProductID] > p.Stock {
+			return nil, fmt.Errorf("%w: %s", ErrInsufficientStock, it.ProductID)
+		}
+	}
+
+	for id, q := range wanted {
+		p := l.m[id]
+		p.Stock -= q
+		p.Reserved += q
+		p.Version++
+	}
+
+	c := *r
+	c.Items = append([]Item(nil), r.Items...)
+	l.reservations[c.ID] = &c
+	heap.Push(&l.expiries, &c)
+
+	products := make([]*Product, 0, len(r.Items))
+	for _, it := range r.Items {
+		p := *l.m[it.ProductID]
+		products = append(products, &p)
+	}
+	return products, nil
+}
+
+// Commit takes the stock of a held reservation out of Reserved for good.
+// Returns ErrReservationNotFound, or ErrReservationExpired after releasing
+// it if its TTL passed.
+func (l *LocalStorage) Commit(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "product.LocalStorage.Commit")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r, ok := l.reservations[id]
+	switch {
+	case !ok:
+		return ErrReservationNotFound
+	case r.State == ReservationCommitted:
+		return nil
+	case !l.now().Before(r.ExpiresAt):
+		l.release(r)
+		return ErrReservationExpired
+	}
+
+	for _, it := range r.Items {
+		if p, ok := l.m[it.ProductID]; ok {
+			p.Reserved -= it.Quantity
+			p.Version++
+		}
+	}
+	r.State = ReservationCommitted
+	return nil
+}
+
+// Release gives the stock of a reservation back to the products. Products
+// deleted since then are skipped, there is nothing to give the stock back to.
+// Returns ErrReservationNotFound.
+func (l *LocalStorage) Release(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "product.LocalStorage.Release")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r, ok := l.reservations[id]
+	if !ok {
+		return ErrReservationNotFound
+	}
+	l.release(r)
+	return nil
+}
+
+// ExpireReservations implements Storage.
+func (l *LocalStorage) ExpireReservations(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "product.LocalStorage.ExpireReservations")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.expire(l.now()), nil
+}
+
+// expire releases the held reservations past their TTL at now and forgets
+// the committed ones, returning how many were released. Must hold l.mu.
+func (l *LocalStorage) expire(now time.Time) int {
+	n := 0
+	for len(l.expiries) > 0 && !now.Before(l.expiries[0].ExpiresAt) {
+		r := heap.Pop(&l.expiries).(*Reservation)
+		if l.reservations[r.ID] != r {
+			// Ya liberada, o el ID se volvio a usar para otra reserva
+			continue
+		}
+		if r.State == ReservationHeld {
+			l.release(r)
+			n++
+			continue
+		}
+		delete(l.reservations, r.ID)
+	}
+	return n
+}
+
+// release undoes r and forgets it. Must hold l.mu.
+func (l *LocalStorage) release(r *Reservation) {
+	for _, it := range r.Items {
+		p, ok := l.m[it.ProductID]
+		if !ok {
+			continue
+		}
+		p.Stock += it.Quantity
+		if r.State == ReservationHeld {
+			p.Reserved -= it.Quantity
+		}
+		p.Version++
+	}
+	delete(l.reservations, r.ID)
+}
+
+// reservationQueue is a heap of reservations by ExpiresAt, soonest first.
+type reservationQueue []*Reservation
+
+func (q reservationQueue) Len() int           { return len(q) }
+func (q reservationQueue) Less(i, j int) bool { return q[i].ExpiresAt.Before(q[j].ExpiresAt) }
+func (q reservationQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *reservationQueue) Push(x any) { *q = append(*q, x.(*Reservation)) }
+
+func (q *reservationQueue) Pop() any {
+	old := *q
+	r := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return r
+}
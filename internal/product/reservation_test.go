@@ -0,0 +1,228 @@
+package product
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock es un reloj que los tests mueven a mano, seguro para usar desde varias goroutines.
+type fakeClock struct {
+	nanos atomic.Int64
+}
+
+func newFakeClock(l *LocalStorage) *fakeClock {
+	c := &fakeClock{}
+	c.nanos.Store(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano())
+	l.now = c.Now
+	return c
+}
+
+func (c *fakeClock) Now() time.Time {
+	return time.Unix(0, c.nanos.Load()).UTC()
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.nanos.Add(int64(d))
+}
+
+func reservation(id string, expires time.Time, items ...Item) *Reservation {
+	return &Reservation{ID: id, Items: items, State: ReservationHeld, ExpiresAt: expires}
+}
+
+func stock(t *testing.T, l *LocalStorage, id string) (int, int) {
+	p, err := l.Read(context.Background(), id)
+	require.NoError(t, err)
+	return p.Stock, p.Reserved
+}
+
+func TestLocalStorage_Reserve_AllOrNothing(t *testing.T) {
+	l := newStockStorage(t, map[string]int{"a": 5, "b": 1})
+	clock := newFakeClock(l)
+	ctx := context.Background()
+	later := clock.Now().Add(time.Hour)
+
+	_, err := l.Reserve(ctx, reservation("r1", later, Item{"a", 2}, Item{"b", 2}))
+	require.ErrorIs(t, err, ErrInsufficientStock)
+	_, err = l.Reserve(ctx, reservation("r1", later, Item{"a", 1}, Item{"nope", 1}))
+	require.ErrorIs(t, err, ErrNotFound)
+	// Dos lineas del mismo producto se suman
+	_, err = l.Reserve(ctx, reservation("r1", later, Item{"a", 3}, Item{"a", 3}))
+	require.ErrorIs(t, err, ErrInsufficientStock)
+
+	available, reserved := stock(t, l, "a")
+	require.Equal(t, 5, available)
+	require.Equal(t, 0, reserved)
+	require.ErrorIs(t, l.Release(ctx, "r1"), ErrReservationNotFound)
+
+	products, err := l.Reserve(ctx, reservation("r1", later, Item{"a", 2}, Item{"b", 1}))
+	require.NoError(t, err)
+	require.Equal(t, 3, products[0].Stock)
+	require.Equal(t, 2, products[0].Reserved)
+	require.Equal(t, 0, products[1].Stock)
+}
+
+func TestLocalStorage_CommitRelease(t *testing.T) {
+	l := newStockStorage(t, map[string]int{"a": 5})
+	clock := newFakeClock(l)
+	ctx := context.Background()
+
+	_, err := l.Reserve(ctx, reservation("r1", clock.Now().Add(time.Hour), Item{"a", 2}))
+	require.NoError(t, err)
+
+	require.NoError(t, l.Commit(ctx, "r1"))
+	available, reserved := stock(t, l, "a")
+	require.Equal(t, 3, available)
+	require.Equal(t, 0, reserved)
+
+	// Confirmar de nuevo no hace nada, y mientras dure liberarla devuelve lo vendido
+	require.NoError(t, l.Commit(ctx, "r1"))
+	require.NoError(t, l.Release(ctx, "r1"))
+	available, reserved = stock(t, l, "a")
+	require.Equal(t, 5, available)
+	require.Equal(t, 0, reserved)
+	require.ErrorIs(t, l.Release(ctx, "r1"), ErrReservationNotFound)
+	require.ErrorIs(t, l.Commit(ctx, "r1"), ErrReservationNotFound)
+
+	// Pasado su TTL una confirmada se olvida sin devolver nada
+	_, err = l.Reserve(ctx, reservation("r2", clock.Now().Add(time.Hour), Item{"a", 2}))
+	require.NoError(t, err)
+	require.NoError(t, l.Commit(ctx, "r2"))
+	clock.Advance(2 * time.Hour)
+	n, err := l.ExpireReservations(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+	require.Empty(t, l.reservations)
+	require.Empty(t, l.expiries)
+	require.ErrorIs(t, l.Release(ctx, "r2"), ErrReservationNotFound)
+	available, reserved = stock(t, l, "a")
+	require.Equal(t, 3, available)
+	require.Equal(t, 0, reserved)
+}
+
+func TestLocalStorage_Reservation_Expires(t *testing.T) {
+	l := newStockStorage(t, map[string]int{"a": 3})
+	clock := newFakeClock(l)
+	ctx := context.Background()
+
+	_, err := l.Reserve(ctx, reservation("r1", clock.Now().Add(time.Minute), Item{"a", 2}))
+	require.NoError(t, err)
+	_, err = l.Reserve(ctx, reservation("r2", clock.Now().Add(time.Hour), Item{"a", 1}))
+	require.NoError(t, err)
+	_, err = l.Reserve(ctx, reservation("r3", clock.Now().Add(time.Hour), Item{"a", 1}))
+	require.ErrorIs(t, err, ErrInsufficientStock)
+
+	// Vencida r1, reservar de nuevo libera su stock antes de chequear
+	clock.Advance(time.Minute)
+	_, err = l.Reserve(ctx, reservation("r3", clock.Now().Add(time.Hour), Item{"a", 2}))
+	require.NoError(t, err)
+	require.ErrorIs(t, l.Commit(ctx, "r1"), ErrReservationNotFound)
+
+	clock.Advance(time.Hour)
+	require.ErrorIs(t, l.Commit(ctx, "r2"), ErrReservationExpired)
+	n, err := l.ExpireReservations(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	available, reserved := stock(t, l, "a")
+	require.Equal(t, 3, available)
+	require.Equal(t, 0, reserved)
+}
+
+func TestLocalStorage_Reserve_Concurrent(t *testing.T) {
+	l := newStockStorage(t, map[string]int{"a": 50})
+	clock := newFakeClock(l)
+
+	var reserved atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r := reservation(fmt.Sprint(i), clock.Now().Add(time.Hour), Item{"a", 1})
+			if _, err := l.Reserve(context.Background(), r); err == nil {
+				reserved.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	available, held := stock(t, l, "a")
+	require.EqualValues(t, 50, reserved.Load())
+	require.Equal(t, 0, available)
+	require.Equal(t, 50, held)
+}
+
+// TestLocalStorage_Reservation_ConcurrentLifecycle mezcla reservas, confirmaciones,
+// liberaciones y vencimientos en paralelo: al final lo disponible, lo reservado y
+// lo vendido tienen que sumar el stock inicial, sin quedar nunca en negativo.
+func TestLocalStorage_Reservation_ConcurrentLifecycle(t *testing.T) {
+	const initial = 100
+	l := newStockStorage(t, map[string]int{"a": initial, "b": initial})
+	clock := newFakeClock(l)
+	ctx := context.Background()
+
+	var sold [2]atomic.Int64 // lo confirmado de "a" y de "b"
+	var wg sync.WaitGroup
+	for i := 0; i < 400; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprint(i)
+			qa, qb := 1+i%3, 1+i%2
+			r := reservation(id, clock.Now().Add(time.Duration(1+i%5)*time.Second), Item{"a", qa}, Item{"b", qb})
+			if _, err := l.Reserve(ctx, r); err != nil {
+				require.ErrorIs(t, err, ErrInsufficientStock)
+				return
+			}
+			switch i % 4 {
+			case 0, 1:
+				if err := l.Commit(ctx, id); err == nil {
+					sold[0].Add(int64(qa))
+					sold[1].Add(int64(qb))
+				}
+			case 2:
+				err := l.Release(ctx, id)
+				if err != nil {
+					require.ErrorIs(t, err, ErrReservationNotFound)
+				}
+			}
+			// El resto se queda esperando a vencer
+		}(i)
+	}
+
+	// Mientras tanto el reloj avanza y el barrido libera lo vencido
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				clock.Advance(100 * time.Millisecond)
+				_, _ = l.ExpireReservations(ctx)
+			}
+		}
+	}()
+	wg.Wait()
+	close(done)
+
+	// Pasado el TTL de todas no queda ninguna, tampoco las confirmadas
+	clock.Advance(time.Hour)
+	_, err := l.ExpireReservations(ctx)
+	require.NoError(t, err)
+	require.Empty(t, l.reservations)
+	require.Empty(t, l.expiries)
+
+	for n, id := range []string{"a", "b"} {
+		available, reserved := stock(t, l, id)
+		require.Equal(t, 0, reserved, id)
+		require.GreaterOrEqual(t, available, 0, id)
+		require.EqualValues(t, initial, int64(available)+sold[n].Load(), id)
+	}
+}
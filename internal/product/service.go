@@ -0,0 +1,203 @@
+package product
+
+import (
+	"context"
+	"ej_final/internal/logging"
+	"ej_final/internal/tracing"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ErrMissingSKU is returned when a product has no SKU.
+var ErrMissingSKU = errors.New("sku is required")
+
+// ErrMissingName is returned when a product has no name.
+var ErrMissingName = errors.New("name is required")
+
+// ErrInvalidPrice is returned when a product price is not positive.
+var ErrInvalidPrice = errors.New("invalid price")
+
+// ErrInvalidStock is returned when a product stock is negative.
+var ErrInvalidStock = errors.New("invalid stock")
+
+// ErrInvalidQuantity is returned when an item to reserve has a quantity
+// that is not positive.
+var ErrInvalidQuantity = errors.New("invalid quantity")
+
+// updateAttempts is how many times Update retries when the product changed
+// under it, typically because a sale reserved stock in the meantime.
+const updateAttempts = 3
+
+// Service provides high-level catalog operations on a Storage backend.
+type Service struct {
+	// storage is the underlying persistence for Product entities.
+	storage Storage
+
+	// logger is our observability component to log.
+	logger *zap.Logger
+
+	// reservationTTL is how long a reservation holds its stock.
+	reservationTTL time.Duration
+}
+
+// Option configures optional Service settings.
+type Option func(*Service)
+
+// WithReservationTTL changes how long reservations hold their stock.
+// Non-positive durations are ignored.
+func WithReservationTTL(d time.Duration) Option {
+	return func(s *Service) {
+		if d > 0 {
+			s.reservationTTL = d
+		}
+	}
+}
+
+// NewService creates a new Service.
+func NewService(storage Storage, logger *zap.Logger, opts ...Option) *Service {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	s := &Service{
+		storage:        storage,
+		logger:         logger,
+		reservationTTL: DefaultReservationTTL,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Create adds a brand-new product to the catalog.
+// It sets CreatedAt and UpdatedAt to the current time and initializes Version to 1.
+// Returns ErrMissingSKU, ErrMissingName, ErrInvalidPrice, ErrInvalidStock
+// or ErrSKUTaken.
+func (s *Service) Create(ctx context.Context, product *Product) error {
+	ctx, span := tracing.Start(ctx, "product.Service.Create")
+	defer span.End()
+
+	product.SKU = strings.TrimSpace(product.SKU)
+	if err := validate(product); err != nil {
+		return err
+	}
+
+	product.ID = uuid.NewString()
+	now := time.Now()
+	product.CreatedAt = now
+	product.UpdatedAt = now
+	product.Version = 1
+
+	if err := s.storage.Create(ctx, product); err != nil {
+		logging.FromContext(ctx, s.logger).Error("Error al crear el producto", zap.Error(err), zap.Any("product", product))
+		return err
+	}
+	return nil
+}
+
+// Get retrieves a product by its ID.
+// Returns ErrNotFound if no product exists with the given ID.
+func (s *Service) Get(ctx context.Context, id string) (*Product, error) {
+	ctx, span := tracing.Start(ctx, "product.Service.Get")
+	defer span.End()
+
+	return s.storage.Read(ctx, id)
+}
+
+// List returns the whole catalog ordered by SKU.
+func (s *Service) List(ctx context.Context) ([]*Product, error) {
+	ctx, span := tracing.Start(ctx, "product.Service.List")
+	defer span.End()
+
+	return s.storage.List(ctx)
+}
+
+// Update modifies the given fields of a product, sets UpdatedAt to now and
+// increments Version. Setting Stock replaces the stock left, so it is meant
+// for restocking and inventory counts.
+// Returns ErrNotFound, a validation error like Create, ErrSKUTaken, or
+// ErrVersionConflict if the product kept changing under it.
+func (s *Service) Update(ctx context.Context, id string, fields *UpdateFields) (*Product, error) {
+	ctx, span := tracing.Start(ctx, "product.Service.Update")
+	defer span.End()
+
+	var err error
+	for attempt := 0; attempt < updateAttempts; attempt++ {
+		var existing *Product
+		existing, err = s.storage.Read(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if fields.SKU != nil {
+			existing.SKU = strings.TrimSpace(*fields.SKU)
+		}
+		if fields.Name != nil {
+			existing.Name = *fields.Name
+		}
+		if fields.Price != nil {
+			existing.Price = *fields.Price
+		}
+		if fields.Stock != nil {
+			existing.Stock = *fields.Stock
+		}
+		if err := validate(existing); err != nil {
+			return nil, err
+		}
+
+		existing.UpdatedAt = time.Now()
+		existing.Version++
+
+		err = s.storage.SetVersioned(ctx, existing)
+		if err == nil {
+			return existing, nil
+		}
+		if !errors.Is(err, ErrVersionConflict) {
+			return nil, err
+		}
+	}
+
+	logging.FromContext(ctx, s.logger).Warn("El producto cambio durante la actualizacion",
+		zap.String("product_id", id),
+		zap.Int("attempts", updateAttempts))
+	return nil, err
+}
+
+// Delete removes a product from the catalog by its ID. Sales already made
+// keep their lines.
+// Returns ErrNotFound if the product does not exist.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "product.Service.Delete")
+	defer span.End()
+
+	return s.storage.Delete(ctx, id)
+}
+
+// validate checks the fields a product must always have.
+func validate(p *Product) error {
+	switch {
+	case p.SKU == "":
+		return ErrMissingSKU
+	case strings.TrimSpace(p.Name) == "":
+		return ErrMissingName
+	case p.Price <= 0:
+		return ErrInvalidPrice
+	case p.Stock < 0:
+		return ErrInvalidStock
+	}
+	return nil
+}
+
+func validateItems(items []Item) error {
+	for _, it := range items {
+		if it.Quantity <= 0 {
+			return ErrInvalidQuantity
+		}
+	}
+	return nil
+}
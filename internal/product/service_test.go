@@ -0,0 +1,81 @@
+package product
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Create(t *testing.T) {
+	s := NewService(NewLocalStorage(), nil)
+	ctx := context.Background()
+
+	p := &Product{SKU: " MATE-01 ", Name: "Mate", Price: 15.5, Stock: 3}
+	require.NoError(t, s.Create(ctx, p))
+	require.NotEmpty(t, p.ID)
+	require.Equal(t, "MATE-01", p.SKU)
+	require.Equal(t, 1, p.Version)
+
+	for _, tc := range []struct {
+		product *Product
+		err     error
+	}{
+		{&Product{Name: "Sin SKU", Price: 1}, ErrMissingSKU},
+		{&Product{SKU: "X", Price: 1}, ErrMissingName},
+		{&Product{SKU: "X", Name: "Gratis"}, ErrInvalidPrice},
+		{&Product{SKU: "X", Name: "Negativo", Price: 1, Stock: -1}, ErrInvalidStock},
+		{&Product{SKU: "MATE-01", Name: "Otro mate", Price: 1}, ErrSKUTaken},
+	} {
+		require.ErrorIs(t, s.Create(ctx, tc.product), tc.err)
+	}
+}
+
+func TestService_Update(t *testing.T) {
+	s := NewService(NewLocalStorage(), nil)
+	ctx := context.Background()
+
+	p := &Product{SKU: "YERBA", Name: "Yerba", Price: 5, Stock: 10}
+	require.NoError(t, s.Create(ctx, p))
+
+	// Una reserva en el medio sube la version; Update vuelve a leer y no pisa el stock
+	_, _, err := s.Reserve(ctx, []Item{{ProductID: p.ID, Quantity: 4}})
+	require.NoError(t, err)
+
+	price := float32(6)
+	updated, err := s.Update(ctx, p.ID, &UpdateFields{Price: &price})
+	require.NoError(t, err)
+	require.Equal(t, float32(6), updated.Price)
+	require.Equal(t, 6, updated.Stock)
+	require.Equal(t, 4, updated.Reserved)
+	require.Equal(t, 3, updated.Version)
+
+	stock := -2
+	_, err = s.Update(ctx, p.ID, &UpdateFields{Stock: &stock})
+	require.ErrorIs(t, err, ErrInvalidStock)
+	_, err = s.Update(ctx, "nope", &UpdateFields{})
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestService_Reserve_InvalidQuantity(t *testing.T) {
+	s := NewService(NewLocalStorage(), nil)
+
+	_, _, err := s.Reserve(context.Background(), []Item{{ProductID: "a", Quantity: 0}})
+	require.ErrorIs(t, err, ErrInvalidQuantity)
+}
+
+func TestService_Reserve_TTL(t *testing.T) {
+	s := NewService(NewLocalStorage(), nil, WithReservationTTL(time.Hour))
+	ctx := context.Background()
+
+	p := &Product{SKU: "YERBA", Name: "Yerba", Price: 5, Stock: 10}
+	require.NoError(t, s.Create(ctx, p))
+
+	r, products, err := s.Reserve(ctx, []Item{{ProductID: p.ID, Quantity: 3}})
+	require.NoError(t, err)
+	require.Equal(t, ReservationHeld, r.State)
+	require.WithinDuration(t, time.Now().Add(time.Hour), r.ExpiresAt, time.Minute)
+	require.Equal(t, 7, products[0].Stock)
+	require.Equal(t, 3, products[0].Reserved)
+}
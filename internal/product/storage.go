@@ -0,0 +1,233 @@
+package product
+
+import (
+	"context"
+	"ej_final/internal/tracing"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when a product with the given ID is not found.
+var ErrNotFound = errors.New("product not found")
+
+// ErrEmptyID is returned when trying to store a product with an empty ID.
+var ErrEmptyID = errors.New("empty product ID")
+
+// ErrSKUTaken is returned when another product already has the SKU.
+var ErrSKUTaken = errors.New("sku already in use")
+
+// ErrVersionConflict is returned when a product was modified by someone
+// else since it was read.
+var ErrVersionConflict = errors.New("product version conflict")
+
+// ErrInsufficientStock is returned when there is not enough stock left to
+// reserve an item.
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// ErrReservationNotFound is returned for a reservation that does not exist,
+// or no longer does because it was released or expired.
+var ErrReservationNotFound = errors.New("reservation not found")
+
+// ErrReservationExpired is returned when committing a reservation whose TTL
+// passed; its stock was given back.
+var ErrReservationExpired = errors.New("reservation expired")
+
+// Storage is the main interface for our storage layer.
+// Every method returns ctx.Err() if the context is already cancelled or past its deadline.
+type Storage interface {
+	Read(ctx context.Context, id string) (*Product, error)
+	Delete(ctx context.Context, id string) error
+	Ping(ctx context.Context) error
+
+	// List returns every product ordered by SKU.
+	List(ctx context.Context) ([]*Product, error)
+
+	// Create stores a new product. Returns ErrSKUTaken if the SKU is in use.
+	Create(ctx context.Context, product *Product) error
+
+	// SetVersioned updates an existing product, which must carry the stored
+	// Version plus one. Returns ErrNotFound, ErrVersionConflict or ErrSKUTaken.
+	SetVersioned(ctx context.Context, product *Product) error
+
+	// Reserve holds the stock of every item of r or of none of them, and
+	// returns the products of the items, in order, after the change.
+	Reserve(ctx context.Context, r *Reservation) ([]*Product, error)
+
+	// Commit turns a held reservation into a sale of its stock.
+	Commit(ctx context.Context, id string) error
+
+	// Release gives back the stock of a reservation, held or committed.
+	Release(ctx context.Context, id string) error
+
+	// ExpireReservations releases the held reservations past their
+	// ExpiresAt and returns how many there were. The committed ones past
+	// their ExpiresAt are forgotten.
+	ExpireReservations(ctx context.Context) (int, error)
+}
+
+// LocalStorage provides an in-memory implementation for storing products.
+// It is safe for concurrent use and keeps its own copies of the products.
+type LocalStorage struct {
+	mu sync.RWMutex
+	m  map[string]*Product
+
+	// skus maps each SKU to the ID of its product.
+	skus map[string]string
+
+	// reservations holds the open reservations by ID.
+	reservations map[string]*Reservation
+
+	// expiries has the reservations ordered by ExpiresAt, so expiring them
+	// only looks at the ones due. Released ones are skipped when they come up.
+	expiries reservationQueue
+
+	// now is the clock used to expire reservations, replaced in tests.
+	now func() time.Time
+}
+
+// NewLocalStorage instantiates a new LocalStorage with an empty map.
+func NewLocalStorage() *LocalStorage {
+	return &LocalStorage{
+		m:            map[string]*Product{},
+		skus:         map[string]string{},
+		reservations: map[string]*Reservation{},
+		now:          time.Now,
+	}
+}
+
+// Create stores a new product.
+// Returns ErrEmptyID if the product has an empty ID, or ErrSKUTaken.
+func (l *LocalStorage) Create(ctx context.Context, product *Product) error {
+	ctx, span := tracing.Start(ctx, "product.LocalStorage.Create")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if product.ID == "" {
+		return ErrEmptyID
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.skus[product.SKU]; ok {
+		return ErrSKUTaken
+	}
+	l.put(product)
+	return nil
+}
+
+// SetVersioned updates a product checking that it has the Version stored plus one.
+// Returns ErrNotFound, ErrVersionConflict, or ErrSKUTaken if the SKU changed
+// to the one of another product.
+func (l *LocalStorage) SetVersioned(ctx context.Context, product *Product) error {
+	ctx, span := tracing.Start(ctx, "product.LocalStorage.SetVersioned")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stored, ok := l.m[product.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version+1 != product.Version {
+		return ErrVersionConflict
+	}
+	if id, ok := l.skus[product.SKU]; ok && id != product.ID {
+		return ErrSKUTaken
+	}
+
+	delete(l.skus, stored.SKU)
+	l.put(product)
+	return nil
+}
+
+// Read retrieves a product from the local storage by ID.
+// Returns ErrNotFound if the product is not found.
+func (l *LocalStorage) Read(ctx context.Context, id string) (*Product, error) {
+	ctx, span := tracing.Start(ctx, "product.LocalStorage.Read")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	p, ok := l.m[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	c := *p
+	return &c, nil
+}
+
+// Delete removes a product from the local storage by ID.
+// Returns ErrNotFound if the product does not exist.
+func (l *LocalStorage) Delete(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "product.LocalStorage.Delete")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	p, ok := l.m[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	delete(l.skus, p.SKU)
+	delete(l.m, id)
+	return nil
+}
+
+// List returns copies of every product ordered by SKU.
+func (l *LocalStorage) List(ctx context.Context) ([]*Product, error) {
+	ctx, span := tracing.Start(ctx, "product.LocalStorage.List")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	products := make([]*Product, 0, len(l.m))
+	for _, p := range l.m {
+		c := *p
+		products = append(products, &c)
+	}
+	sort.Slice(products, func(i, j int) bool {
+		return products[i].SKU < products[j].SKU
+	})
+	return products, nil
+}
+
+// Ping reports whether the storage is reachable. The in-memory storage always
+// is, so it only fails when ctx is done.
+func (l *LocalStorage) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// put stores a copy of p and indexes its SKU. Must hold l.mu.
+func (l *LocalStorage) put(p *Product) {
+	c := *p
+	l.m[c.ID] = &c
+	l.skus[c.SKU] = c.ID
+}
@@ -0,0 +1,40 @@
+package product
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newStockStorage(t *testing.T, stock map[string]int) *LocalStorage {
+	l := NewLocalStorage()
+	for id, n := range stock {
+		require.NoError(t, l.Create(context.Background(), &Product{ID: id, SKU: "SKU-" + id, Name: id, Price: 10, Stock: n, Version: 1}))
+	}
+	return l
+}
+
+func TestLocalStorage_Create_SKUTaken(t *testing.T) {
+	l := newStockStorage(t, map[string]int{"a": 1})
+	ctx := context.Background()
+
+	err := l.Create(ctx, &Product{ID: "b", SKU: "SKU-a", Name: "b", Price: 1})
+	require.ErrorIs(t, err, ErrSKUTaken)
+
+	require.NoError(t, l.Create(ctx, &Product{ID: "b", SKU: "SKU-b", Name: "b", Price: 1, Version: 1}))
+	b, err := l.Read(ctx, "b")
+	require.NoError(t, err)
+	b.SKU = "SKU-a"
+	b.Version++
+	require.ErrorIs(t, l.SetVersioned(ctx, b), ErrSKUTaken)
+
+	// Al borrar el producto su SKU queda libre
+	require.NoError(t, l.Delete(ctx, "a"))
+	require.NoError(t, l.SetVersioned(ctx, b))
+
+	products, err := l.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, products, 1)
+	require.Equal(t, "SKU-a", products[0].SKU)
+}
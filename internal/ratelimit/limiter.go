@@ -0,0 +1,52 @@
+package ratelimit
+
+import "time"
+
+// Rule describes a token bucket: Burst tokens at most, refilled at Rate tokens per second.
+type Rule struct {
+	Rate  float64
+	Burst int
+}
+
+// Result is the outcome of a single Allow call.
+type Result struct {
+	// Allowed reports whether the request may go through.
+	Allowed bool
+
+	// Limit is the bucket capacity (Rule.Burst).
+	Limit int
+
+	// Remaining is the number of whole tokens left after this call.
+	Remaining int
+
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+
+	// RetryAfter is the time until the next token is available. Zero when Allowed.
+	RetryAfter time.Duration
+}
+
+// Limiter is the main interface for our rate limiting backends.
+// An in-memory implementation is provided by MemoryLimiter; a shared backend
+// (e.g. Redis) only has to implement this interface to be plugged into the API.
+type Limiter interface {
+	Allow(key string, rule Rule) (Result, error)
+}
+
+// Config holds the per-route rules used by the HTTP middleware.
+type Config struct {
+	// Default applies to every route without an explicit entry in Routes.
+	Default Rule
+
+	// Routes maps "METHOD /path" (the Gin route template) to its Rule.
+	Routes map[string]Rule
+}
+
+// RuleFor returns the rule configured for the given method and route template.
+func (c Config) RuleFor(method, route string) Rule {
+	if r, ok := c.Routes[method+" "+route]; ok {
+		return r
+	}
+
+	return c.Default
+}
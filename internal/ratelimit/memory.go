@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrInvalidRule is returned when a rule has a non-positive rate or burst.
+var ErrInvalidRule = errors.New("invalid rate limit rule")
+
+// sweepEvery is how many Allow calls happen between two sweeps of idle buckets.
+const sweepEvery = 1024
+
+// maxIdle is how long a bucket may go unused before a sweep drops it.
+const maxIdle = 10 * time.Minute
+
+// bucket is the state of a single token bucket.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryLimiter provides an in-memory token bucket implementation of Limiter.
+// It is safe for concurrent use but its state is local to the process.
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+
+	// now is the clock, replaceable in tests.
+	now func() time.Time
+}
+
+// NewMemoryLimiter instantiates a new MemoryLimiter with no buckets.
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// Allow takes one token from the bucket identified by key, creating a full
+// bucket the first time the key is seen.
+// Returns ErrInvalidRule if the rule cannot describe a bucket.
+func (l *MemoryLimiter) Allow(key string, rule Rule) (Result, error) {
+	if rule.Rate <= 0 || rule.Burst <= 0 {
+		return Result{}, ErrInvalidRule
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.calls++
+	if l.calls%sweepEvery == 0 {
+		l.sweep(now, maxIdle)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	// Recargar los tokens que se generaron desde la ultima llamada
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(float64(rule.Burst), b.tokens+elapsed*rule.Rate)
+	b.last = now
+
+	res := Result{Limit: rule.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = secondsToDuration((1 - b.tokens) / rule.Rate)
+	}
+
+	res.Remaining = int(b.tokens)
+	res.Reset = secondsToDuration((float64(rule.Burst) - b.tokens) / rule.Rate)
+	return res, nil
+}
+
+// sweep drops the buckets that have been idle for longer than idle,
+// so the map does not grow forever with one-off clients. Must hold l.mu.
+func (l *MemoryLimiter) sweep(now time.Time, idle time.Duration) {
+	for k, b := range l.buckets {
+		if now.Sub(b.last) > idle {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryLimiter_Allow(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewMemoryLimiter()
+	l.now = func() time.Time { return now }
+
+	rule := Rule{Rate: 1, Burst: 2}
+
+	res, err := l.Allow("ip:1", rule)
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+	require.Equal(t, 2, res.Limit)
+	require.Equal(t, 1, res.Remaining)
+
+	res, _ = l.Allow("ip:1", rule)
+	require.True(t, res.Allowed)
+	require.Equal(t, 0, res.Remaining)
+
+	// El bucket esta vacio, tiene que esperar un segundo
+	res, _ = l.Allow("ip:1", rule)
+	require.False(t, res.Allowed)
+	require.Equal(t, time.Second, res.RetryAfter)
+	require.Equal(t, 2*time.Second, res.Reset)
+
+	// Otra clave tiene su propio bucket
+	res, _ = l.Allow("ip:2", rule)
+	require.True(t, res.Allowed)
+
+	now = now.Add(time.Second)
+	res, _ = l.Allow("ip:1", rule)
+	require.True(t, res.Allowed)
+}
+
+func TestMemoryLimiter_InvalidRule(t *testing.T) {
+	l := NewMemoryLimiter()
+
+	_, err := l.Allow("ip:1", Rule{Rate: 0, Burst: 1})
+	require.ErrorIs(t, err, ErrInvalidRule)
+}
@@ -0,0 +1,47 @@
+package requestid
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Header is the HTTP header used to receive, echo and forward the request ID.
+const Header = "X-Request-ID"
+
+// maxLen bounds the size of IDs accepted from clients.
+const maxLen = 128
+
+type ctxKey struct{}
+
+// New generates a fresh request ID.
+func New() string {
+	return uuid.NewString()
+}
+
+// Valid reports whether id can be accepted from a client as is: non-empty,
+// not too long and made only of printable ASCII without spaces.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewContext returns a copy of ctx carrying the given request ID.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx, or "" if there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
@@ -0,0 +1,26 @@
+package requestid
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValid(t *testing.T) {
+	require.True(t, Valid(New()))
+	require.True(t, Valid("abc-123_x.y"))
+	require.False(t, Valid(""))
+	require.False(t, Valid("con espacios"))
+	require.False(t, Valid("salto\nde-linea"))
+	require.False(t, Valid(strings.Repeat("a", maxLen+1)))
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	require.Empty(t, FromContext(ctx))
+
+	ctx = NewContext(ctx, "req-1")
+	require.Equal(t, "req-1", FromContext(ctx))
+}
@@ -0,0 +1,212 @@
+package sales
+
+import (
+	"context"
+	"ej_final/internal/logging"
+	"ej_final/internal/tracing"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// MaxBatchSize is the largest number of sales accepted by CreateBatch.
+const MaxBatchSize = 500
+
+// ErrEmptyBatch is returned when a batch has no items.
+var ErrEmptyBatch = errors.New("empty batch")
+
+// ErrBatchTooLarge is returned when a batch has more than MaxBatchSize items.
+var ErrBatchTooLarge = errors.New("batch too large")
+
+// ErrInvalidBatchMode is returned for an unknown BatchMode.
+var ErrInvalidBatchMode = errors.New("invalid batch mode")
+
+// ErrBatchAborted is reported for the valid items of an all-or-nothing
+// batch that was not written because another item failed.
+var ErrBatchAborted = errors.New("batch aborted by another item")
+
+// BatchMode tells what to do with the valid items when some items fail.
+type BatchMode string
+
+const (
+	// BatchAllOrNothing writes the batch only if every item is valid.
+	BatchAllOrNothing BatchMode = "all_or_nothing"
+
+	// BatchBestEffort writes every valid item and reports the failed ones.
+	BatchBestEffort BatchMode = "best_effort"
+)
+
+// userLookupConcurrency bounds the parallel calls to the users API of a batch.
+const userLookupConcurrency = 8
+
+// BatchResult is the outcome of one item of a batch.
+// Sale is set when the item was created, Err otherwise.
+type BatchResult struct {
+	Index int
+	Sale  *Sales
+	Err   error
+}
+
+// CreateBatch creates many sales at once. Each distinct user is checked only
+// once against the users API, and all the created sales are written with a
+// single SetBatch call. Items with Lines (ErrInvalidLine) or CouponCodes
+// (ErrBatchCoupon) are not accepted, they must go through Create. Results are returned in the order of the input.
+// Taxes are applied to every item as in Create, from its Jurisdiction or the
+// address of its user.
+// With a PaymentGateway the valid items are authorized as in Create once
+// every item was validated. In BatchAllOrNothing mode nothing is authorized
+// if an item is invalid, and no item after the first failed authorization;
+// the payments of the items that end up not written are voided.
+// Returns ErrEmptyBatch, ErrBatchTooLarge or ErrInvalidBatchMode if the batch
+// itself is invalid, or the storage error if writing failed (in that case
+// nothing was created).
+func (s *Service) CreateBatch(ctx context.Context, items []*Sales, mode BatchMode) ([]BatchResult, error) {
+	ctx, span := tracing.Start(ctx, "sales.Service.CreateBatch")
+	defer span.End()
+	span.SetAttribute("batch.size", len(items))
+
+	log := logging.FromContext(ctx, s.logger)
+
+	switch {
+	case mode != BatchAllOrNothing && mode != BatchBestEffort:
+		return nil, ErrInvalidBatchMode
+	case len(items) == 0:
+		return nil, ErrEmptyBatch
+	case len(items) > MaxBatchSize:
+		return nil, ErrBatchTooLarge
+	}
+
+	userIDs := make([]string, 0, len(items))
+	for _, it := range items {
+		userIDs = append(userIDs, it.UserID)
+	}
+	users, userErrs := s.checkUsers(ctx, userIDs)
+
+	now := time.Now()
+	results := make([]BatchResult, len(items))
+	failed := false
+	for i, it := range items {
+		results[i].Index = i
+		if err := userErrs[it.UserID]; err != nil {
+			results[i].Err = err
+			failed = true
+			continue
+		}
+		// Las lineas reservan stock una por una, solo Create las acepta
+		if len(it.Lines) > 0 {
+			results[i].Err = ErrInvalidLine
+			failed = true
+			continue
+		}
+		if len(it.CouponCodes) > 0 {
+			results[i].Err = ErrBatchCoupon
+			failed = true
+			continue
+		}
+		if err := s.setCurrency(ctx, it); err != nil {
+			results[i].Err = err
+			failed = true
+			continue
+		}
+		if err := s.prepare(it, now); err != nil {
+			results[i].Err = err
+			failed = true
+			continue
+		}
+		// Igual que en Create, con la direccion que ya trajo la consulta del usuario
+		if err := s.applyTaxes(ctx, it, users[it.UserID].Address); err != nil {
+			results[i].Err = err
+			failed = true
+			continue
+		}
+		results[i].Sale = it
+	}
+
+	// Se autoriza despues de validar todo, asi un batch que se va a rechazar no cobra nada
+	valid := make([]*Sales, 0, len(items))
+	for i := range results {
+		if failed && mode == BatchAllOrNothing {
+			break
+		}
+		it := results[i].Sale
+		if it == nil {
+			continue
+		}
+		if err := s.authorize(ctx, it); err != nil {
+			results[i].Sale = nil
+			results[i].Err = err
+			failed = true
+			continue
+		}
+		valid = append(valid, it)
+	}
+
+	if failed && mode == BatchAllOrNothing {
+		abort(results)
+		s.voidPayments(ctx, valid)
+		log.Warn("Batch de ventas rechazado, hay items invalidos", zap.Int("size", len(items)))
+		return results, nil
+	}
+
+	if len(valid) > 0 {
+		if err := s.storage.SetBatch(ctx, valid); err != nil {
+			span.RecordError(err)
+			log.Error("Error al guardar el batch de ventas", zap.Int("size", len(valid)), zap.Error(err))
+			s.voidPayments(ctx, valid)
+			return nil, err
+		}
+	}
+	for _, v := range valid {
+		s.metrics.saleCreated(v.Status)
+	}
+
+	log.Info("Batch de ventas creado",
+		zap.Int("size", len(items)),
+		zap.Int("created", len(valid)),
+		zap.String("mode", string(mode)))
+	return results, nil
+}
+
+// voidPayments voids the payments of sales authorized but not written.
+func (s *Service) voidPayments(ctx context.Context, sales []*Sales) {
+	for _, sale := range sales {
+		s.voidPayment(ctx, sale)
+	}
+}
+
+// checkUsers checks each distinct user ID once, with bounded concurrency,
+// and returns the users found and the error of every user that failed the
+// check.
+func (s *Service) checkUsers(ctx context.Context, userIDs []string) (map[string]*remoteUser, map[string]error) {
+	unique := map[string]struct{}{}
+	for _, id := range userIDs {
+		unique[id] = struct{}{}
+	}
+
+	var mu sync.Mutex
+	users := map[string]*remoteUser{}
+	errs := map[string]error{}
+	sem := make(chan struct{}, userLookupConcurrency)
+	var wg sync.WaitGroup
+	for id := range unique {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			u, err := s.checkUser(ctx, id)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[id] = err
+				return
+			}
+			users[id] = u
+		}(id)
+	}
+	wg.Wait()
+	return users, errs
+}
@@ -0,0 +1,220 @@
+package sales
+
+import (
+	"context"
+	"ej_final/internal/logging"
+	"ej_final/internal/tracing"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// StatusChange is one item of UpdateBatch: move sale ID to Status.
+// Version is the version the caller read; 0 skips the check.
+type StatusChange struct {
+	ID      string
+	Status  string
+	Version int
+}
+
+// UpdateBatch applies the transition rules of Update to many sales at once.
+// Results are returned in the order of the input, with the updated sale or
+// ErrEmptyID, ErrNotFound, ErrInvalidStatus, ErrInvalidTransition or
+// ErrVersionConflict. In BatchAllOrNothing mode nothing is written unless
+// every item is valid, and the valid ones get ErrBatchAborted.
+// A sale listed twice is checked against its state after the first change.
+// Approving a sale captures its payment and, with lines, commits its stock
+// reservation first, failing with ErrPaymentDeclined or
+// product.ErrReservationExpired as Update does. The sales approved but not
+// written, because a later item failed in BatchAllOrNothing mode or the
+// write did, get their payment voided and their stock released. A sale whose
+// reservation expired is rejected as in Update, even if the batch is aborted.
+// Returns ErrEmptyBatch, ErrBatchTooLarge or ErrInvalidBatchMode if the batch
+// itself is invalid, or the storage error if writing failed.
+func (s *Service) UpdateBatch(ctx context.Context, changes []StatusChange, mode BatchMode) ([]BatchResult, error) {
+	ctx, span := tracing.Start(ctx, "sales.Service.UpdateBatch")
+	defer span.End()
+	span.SetAttribute("batch.size", len(changes))
+
+	log := logging.FromContext(ctx, s.logger)
+
+	switch {
+	case mode != BatchAllOrNothing && mode != BatchBestEffort:
+		return nil, ErrInvalidBatchMode
+	case len(changes) == 0:
+		return nil, ErrEmptyBatch
+	case len(changes) > MaxBatchSize:
+		return nil, ErrBatchTooLarge
+	}
+
+	now := time.Now()
+	results := make([]BatchResult, len(changes))
+	from := make([]string, len(changes))
+	// pending guarda el estado que tendria cada venta tras los cambios previos del batch
+	pending := map[string]*Sales{}
+	failed := false
+	for i, ch := range changes {
+		results[i].Index = i
+		sale, prev, err := s.nextState(ctx, ch, pending, now)
+		if err != nil {
+			results[i].Err = err
+			failed = true
+			continue
+		}
+		from[i] = prev
+		pending[ch.ID] = sale
+		results[i].Sale = sale
+	}
+
+	if mode == BatchAllOrNothing {
+		if failed {
+			abort(results)
+			log.Warn("Batch de transiciones rechazado, hay items invalidos", zap.Int("size", len(changes)))
+			return results, nil
+		}
+
+		for i := range results {
+			if err := s.approve(ctx, results[i].Sale); err != nil {
+				s.rejectIfExpired(ctx, results[i].Sale, err)
+				results[i].Sale = nil
+				results[i].Err = err
+				// Los anteriores ya se cobraron y no se van a guardar
+				s.undoApprovals(ctx, results[:i])
+				abort(results)
+				return results, nil
+			}
+		}
+
+		if err := s.storage.SetVersioned(ctx, updatedSales(results)); err != nil {
+			s.undoApprovals(ctx, results)
+			var itemErr *ItemError
+			if !errors.As(err, &itemErr) {
+				span.RecordError(err)
+				log.Error("Error al guardar el batch de transiciones", zap.Error(err))
+				return nil, err
+			}
+			// Otra request modifico una venta entre la lectura y la escritura
+			failedIndex := indexOfSale(results, itemErr.Index)
+			results[failedIndex].Sale = nil
+			results[failedIndex].Err = itemErr.Err
+			abort(results)
+			return results, nil
+		}
+	} else {
+		for i := range results {
+			if results[i].Err != nil {
+				continue
+			}
+			if err := s.approve(ctx, results[i].Sale); err != nil {
+				s.rejectIfExpired(ctx, results[i].Sale, err)
+				results[i].Sale = nil
+				results[i].Err = err
+				continue
+			}
+			if err := s.storage.SetVersioned(ctx, []*Sales{results[i].Sale}); err != nil {
+				s.undoApprove(ctx, results[i].Sale)
+				var itemErr *ItemError
+				if !errors.As(err, &itemErr) {
+					span.RecordError(err)
+					log.Error("Error al guardar una transicion del batch", zap.Error(err))
+					return nil, err
+				}
+				results[i].Sale = nil
+				results[i].Err = itemErr.Err
+			}
+		}
+	}
+
+	updated := 0
+	for i, r := range results {
+		if r.Err == nil {
+			s.transitioned(ctx, from[i], r.Sale)
+			updated++
+		}
+	}
+
+	log.Info("Batch de transiciones aplicado",
+		zap.Int("size", len(changes)),
+		zap.Int("updated", updated),
+		zap.String("mode", string(mode)))
+	return results, nil
+}
+
+// nextState validates ch against the current state of the sale, taking into
+// account the earlier changes of the batch, and returns the updated sale and
+// the status it had before.
+func (s *Service) nextState(ctx context.Context, ch StatusChange, pending map[string]*Sales, now time.Time) (*Sales, string, error) {
+	if ch.ID == "" {
+		return nil, "", ErrEmptyID
+	}
+	if !validStatus(ch.Status) {
+		return nil, "", ErrInvalidStatus
+	}
+
+	current, ok := pending[ch.ID]
+	if !ok {
+		var err error
+		if current, err = s.storage.Read(ctx, ch.ID); err != nil {
+			return nil, "", err
+		}
+	}
+	if ch.Version != 0 && ch.Version != current.Version {
+		return nil, "", ErrVersionConflict
+	}
+	// Como solo se sale de pending, un segundo cambio a la misma venta siempre falla aca
+	if err := checkTransition(current.Status, ch.Status); err != nil {
+		return nil, "", err
+	}
+
+	next := current.clone()
+	next.Status = ch.Status
+	next.UpdatedAt = now
+	next.Version++
+	return next, current.Status, nil
+}
+
+// undoApprovals calls undoApprove on the sales of the successful results.
+func (s *Service) undoApprovals(ctx context.Context, results []BatchResult) {
+	for _, r := range results {
+		if r.Err == nil {
+			s.undoApprove(ctx, r.Sale)
+		}
+	}
+}
+
+// abort marks every item that did not fail with ErrBatchAborted.
+func abort(results []BatchResult) {
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].Sale = nil
+			results[i].Err = ErrBatchAborted
+		}
+	}
+}
+
+// updatedSales returns the sales of the successful results, in order.
+func updatedSales(results []BatchResult) []*Sales {
+	out := make([]*Sales, 0, len(results))
+	for _, r := range results {
+		if r.Err == nil {
+			out = append(out, r.Sale)
+		}
+	}
+	return out
+}
+
+// indexOfSale maps the position n within updatedSales(results) back to the
+// index of its result.
+func indexOfSale(results []BatchResult, n int) int {
+	for i, r := range results {
+		if r.Err != nil {
+			continue
+		}
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	return -1
+}
@@ -0,0 +1,142 @@
+package sales
+
+import (
+	"context"
+	"ej_final/internal/logging"
+	"ej_final/internal/payment"
+	"ej_final/internal/product"
+	"ej_final/internal/tracing"
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// ErrPaymentMismatch is returned for a payment callback whose transaction is
+// not the payment of the sale it references.
+var ErrPaymentMismatch = errors.New("payment does not belong to the sale")
+
+// maxCallbackAttempts is how many times a payment callback is tried when the
+// sale changes between reading and updating it.
+const maxCallbackAttempts = 3
+
+// PaymentOutcome is what a payment callback did to its sale.
+type PaymentOutcome struct {
+	// Sale is the sale after the callback.
+	Sale *Sales
+
+	// Applied is false when the sale was left as it was: a duplicate of a
+	// callback already applied, or one that arrived after the sale had
+	// moved on.
+	Applied bool
+
+	// Conflict is true when the callback contradicts the final status of the
+	// sale, like a voided payment for an approved sale, and was not known to
+	// be older than the callback the sale was left with. The sale is not
+	// changed, someone has to look at it.
+	Conflict bool
+}
+
+// callbackStatus is the status of a sale once its payment has the given
+// status. Authorized payments keep the sale pending.
+func callbackStatus(paymentStatus string) string {
+	switch paymentStatus {
+	case payment.StatusCaptured:
+		return "approved"
+	case payment.StatusDeclined, payment.StatusVoided:
+		return "rejected"
+	}
+	return "pending"
+}
+
+// contradicts reports whether a sale in a final status does not match a
+// payment that would leave it in target: approved or refunded sales whose
+// payment failed, or rejected or cancelled ones whose payment was captured.
+func contradicts(status, target string) bool {
+	switch target {
+	case "approved":
+		return status == "rejected" || status == StatusCancelled
+	case "rejected":
+		return status == "approved" || status == StatusPartiallyRefunded || status == StatusRefunded
+	}
+	return false
+}
+
+// ApplyPayment applies the callback of the gateway to the sale it references,
+// through Update, so approving captures the payment and commits the stock and
+// rejecting releases them. Only pending sales change: callbacks for a sale
+// that already left pending, repeated or out of order, are acknowledged
+// without changes. A callback with a Sequence not greater than the
+// PaymentSequence of the sale is older than the one applied and is ignored;
+// one that contradicts the final status of the sale is reported as a
+// Conflict, logged and counted in the metrics. If the sale changes while
+// applying it, which Update detects with its Version, the callback is
+// evaluated again against the new state.
+// Returns ErrNotFound, ErrPaymentMismatch or the error of Update.
+func (s *Service) ApplyPayment(ctx context.Context, cb *payment.Callback) (*PaymentOutcome, error) {
+	ctx, span := tracing.Start(ctx, "sales.Service.ApplyPayment")
+	defer span.End()
+
+	log := logging.FromContext(ctx, s.logger).With(
+		zap.String("event_id", cb.EventID),
+		zap.String("sale_id", cb.Reference),
+		zap.String("payment_id", cb.TransactionID),
+		zap.String("payment_status", cb.Status),
+		zap.Int64("sequence", cb.Sequence))
+	target := callbackStatus(cb.Status)
+
+	var err error
+	for attempt := 0; attempt < maxCallbackAttempts; attempt++ {
+		var sale *Sales
+		sale, err = s.storage.Read(ctx, cb.Reference)
+		if err != nil {
+			return nil, err
+		}
+		if sale.PaymentID != cb.TransactionID {
+			log.Warn("Callback de pago para otra transaccion", zap.String("sale_payment_id", sale.PaymentID))
+			return nil, ErrPaymentMismatch
+		}
+
+		// El gateway ya nos mando un cambio posterior a este
+		if cb.Sequence > 0 && cb.Sequence <= sale.PaymentSequence {
+			log.Info("Callback de pago atrasado",
+				zap.Int64("payment_sequence", sale.PaymentSequence),
+				zap.String("status", sale.Status))
+			return &PaymentOutcome{Sale: sale}, nil
+		}
+
+		// Repetido o atrasado: la venta ya salio de pending y se deja como esta
+		if sale.Status != "pending" || target == "pending" {
+			// Salvo que diga lo contrario de como quedo: no se toca, pero alguien lo tiene que ver
+			if contradicts(sale.Status, target) {
+				log.Error("Callback de pago en conflicto con la venta",
+					zap.String("status", sale.Status),
+					zap.Int64("payment_sequence", sale.PaymentSequence),
+					zap.Int("version", sale.Version))
+				s.metrics.paymentConflict(sale.Status, cb.Status)
+				return &PaymentOutcome{Sale: sale, Conflict: true}, nil
+			}
+			log.Info("Callback de pago sin cambios",
+				zap.String("status", sale.Status),
+				zap.Int("version", sale.Version))
+			return &PaymentOutcome{Sale: sale}, nil
+		}
+
+		var updated *Sales
+		updated, err = s.update(ctx, sale.ID, target, func(sale *Sales) {
+			sale.PaymentSequence = max(sale.PaymentSequence, cb.Sequence)
+		})
+		if err == nil {
+			log.Info("Callback de pago aplicado",
+				zap.String("status", updated.Status),
+				zap.Int("version", updated.Version))
+			return &PaymentOutcome{Sale: updated, Applied: true}, nil
+		}
+		// Otro cambio la venta entre la lectura y la escritura, o se rechazo por
+		// la reserva vencida: se vuelve a mirar
+		if !errors.Is(err, ErrVersionConflict) && !errors.Is(err, ErrInvalidTransition) &&
+			!errors.Is(err, product.ErrReservationExpired) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,128 @@
+package sales
+
+import (
+	"context"
+	"ej_final/internal/logging"
+	"ej_final/internal/product"
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// ErrInvalidLine is returned for a line without product or with a quantity
+// that is not positive, and for lines given to CreateBatch.
+var ErrInvalidLine = errors.New("invalid sale line")
+
+// ErrNoCatalog is returned for a sale with lines when the Service has no Catalog.
+var ErrNoCatalog = errors.New("product catalog not available")
+
+// Catalog prices the lines of a sale and holds their stock while the sale
+// is pending. It is implemented by *product.Service.
+type Catalog interface {
+	// Reserve holds the stock of every item or of none of them and returns
+	// the reservation and the products of the items, in order.
+	Reserve(ctx context.Context, items []product.Item) (*product.Reservation, []*product.Product, error)
+
+	// Commit sells the stock of a reservation; committing twice is a no-op.
+	Commit(ctx context.Context, id string) error
+
+	// Release gives back the stock of a reservation.
+	Release(ctx context.Context, id string) error
+}
+
+// WithCatalog lets the Service create sales with lines, reserving their
+// stock in c.
+func WithCatalog(c Catalog) Option {
+	return func(s *Service) {
+		s.catalog = c
+	}
+}
+
+// reserveLines validates the lines of sale, reserves their stock and fills
+// in their SKU and UnitPrice from the catalog. The Amount of the sale
+// becomes the total of the lines and ReservationID the reservation.
+// Returns ErrInvalidLine, ErrNoCatalog or the error of the catalog.
+func (s *Service) reserveLines(ctx context.Context, sale *Sales) error {
+	for _, l := range sale.Lines {
+		if l.ProductID == "" || l.Quantity <= 0 {
+			return ErrInvalidLine
+		}
+	}
+	if s.catalog == nil {
+		return ErrNoCatalog
+	}
+
+	reservation, products, err := s.catalog.Reserve(ctx, lineItems(sale))
+	if err != nil {
+		return err
+	}
+	sale.ReservationID = reservation.ID
+
+	sale.Amount = 0
+	for i, p := range products {
+		sale.Lines[i].SKU = p.SKU
+		sale.Lines[i].UnitPrice = p.Price
+		sale.Amount += p.Price * float32(sale.Lines[i].Quantity)
+	}
+	return nil
+}
+
+// commitIfApproved commits the stock reservation of sale if it is being
+// approved. A reservation that is gone was released when its TTL passed, so
+// the stock may be sold already: that is ErrReservationExpired too.
+func (s *Service) commitIfApproved(ctx context.Context, sale *Sales) error {
+	if sale.Status != "approved" || sale.ReservationID == "" || s.catalog == nil {
+		return nil
+	}
+	err := s.catalog.Commit(ctx, sale.ReservationID)
+	if errors.Is(err, product.ErrReservationNotFound) {
+		return product.ErrReservationExpired
+	}
+	return err
+}
+
+// rejectIfExpired rejects sale when approving it failed with err because its
+// reservation expired: its stock may be sold already and approve voided its
+// payment, so it could never be approved. sale is the copy being approved,
+// with the Version to write. A failure to write it is only logged, the sale
+// stays pending and can still be rejected.
+func (s *Service) rejectIfExpired(ctx context.Context, sale *Sales, err error) {
+	if !errors.Is(err, product.ErrReservationExpired) {
+		return
+	}
+
+	log := logging.FromContext(ctx, s.logger)
+	sale.Status = "rejected"
+	if err := s.storage.SetVersioned(ctx, []*Sales{sale}); err != nil {
+		log.Error("No se pudo rechazar la venta con la reserva vencida",
+			zap.String("sale_id", sale.ID),
+			zap.Error(err))
+		return
+	}
+	s.transitioned(ctx, "pending", sale)
+	log.Warn("Venta rechazada, su reserva de stock vencio", zap.String("sale_id", sale.ID))
+}
+
+// releaseLines gives back the stock held by a sale that will not be
+// fulfilled. It runs after the sale was already stored, so a failure is
+// only logged: the sale must not stay in its old status because of it. A
+// reservation already gone expired, and its stock was given back then.
+func (s *Service) releaseLines(ctx context.Context, sale *Sales) {
+	if sale.ReservationID == "" || s.catalog == nil {
+		return
+	}
+	err := s.catalog.Release(ctx, sale.ReservationID)
+	if err != nil && !errors.Is(err, product.ErrReservationNotFound) {
+		logging.FromContext(ctx, s.logger).Error("Error liberando el stock de la venta",
+			zap.String("sale_id", sale.ID),
+			zap.Error(err))
+	}
+}
+
+func lineItems(sale *Sales) []product.Item {
+	items := make([]product.Item, 0, len(sale.Lines))
+	for _, l := range sale.Lines {
+		items = append(items, product.Item{ProductID: l.ProductID, Quantity: l.Quantity})
+	}
+	return items
+}
@@ -0,0 +1,90 @@
+package sales
+
+import (
+	"context"
+	"ej_final/internal/coupon"
+	"ej_final/internal/logging"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// ErrNoCoupons is returned for a sale with coupons when the Service has no
+// Coupons to redeem them.
+var ErrNoCoupons = errors.New("coupons not available")
+
+// ErrBatchCoupon is returned for the items of CreateBatch that have coupons.
+var ErrBatchCoupon = errors.New("coupons are not accepted in batches")
+
+// Coupons discounts sales and counts the use of the coupons. It is
+// implemented by *coupon.Service.
+type Coupons interface {
+	// Redeem applies the coupons to a sale of userID for amount and counts
+	// their use, checking their rules and limits.
+	Redeem(ctx context.Context, saleID, userID string, codes []string, amount float32) (*coupon.Redemption, error)
+
+	// Release gives back the uses of the coupons redeemed by a sale.
+	Release(ctx context.Context, saleID string) error
+}
+
+// WithCoupons lets the Service create sales with coupons, redeeming them in c.
+func WithCoupons(c Coupons) Option {
+	return func(s *Service) {
+		s.coupons = c
+	}
+}
+
+// applyCoupons redeems the coupons of a prepared sale and discounts them:
+// OriginalAmount keeps the amount before them and Amount becomes the final one.
+// Coupons are in the base currency, so the sale is redeemed for its amount
+// in it and the discount converted back to the currency of the sale.
+// Returns ErrNoCoupons, the error of the coupons, or ErrInvalidAmount if
+// they leave nothing to charge; their uses are given back then.
+func (s *Service) applyCoupons(ctx context.Context, sale *Sales) error {
+	if s.coupons == nil {
+		return ErrNoCoupons
+	}
+
+	r, err := s.coupons.Redeem(ctx, sale.ID, sale.UserID, sale.CouponCodes, float32(sale.baseAmount()))
+	if err != nil {
+		return err
+	}
+	discount := r.Discount
+	if rate := sale.rate(); rate != 1 {
+		discount = float32(cents(float64(r.Discount) / rate))
+	}
+	sale.CouponCodes = r.Codes
+
+	// Una venta de 0 no se puede cobrar ni tiene sentido guardarla
+	if cents(float64(sale.Amount-discount)) <= 0 {
+		s.releaseCoupons(ctx, sale)
+		return fmt.Errorf("%w: the coupons cover the whole amount", ErrInvalidAmount)
+	}
+	sale.OriginalAmount = sale.Amount
+	sale.Discount = discount
+	sale.Amount -= discount
+	return nil
+}
+
+// releaseCoupons gives back the uses of the coupons of a sale that will not
+// be fulfilled. Like releaseLines, a failure is only logged.
+func (s *Service) releaseCoupons(ctx context.Context, sale *Sales) {
+	if len(sale.CouponCodes) == 0 || s.coupons == nil {
+		return
+	}
+	err := s.coupons.Release(ctx, sale.ID)
+	if err != nil && !errors.Is(err, coupon.ErrRedemptionNotFound) {
+		logging.FromContext(ctx, s.logger).Error("Error liberando los cupones de la venta",
+			zap.String("sale_id", sale.ID),
+			zap.Error(err))
+	}
+}
+
+// release gives back everything a sale that will not be fulfilled holds:
+// the stock of its lines, the uses of its coupons and its payment.
+func (s *Service) release(ctx context.Context, sale *Sales) {
+	s.releaseLines(ctx, sale)
+	s.releaseCoupons(ctx, sale)
+	s.voidPayment(ctx, sale)
+}
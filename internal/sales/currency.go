@@ -0,0 +1,142 @@
+package sales
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+)
+
+// ErrNoRates is returned for a sale or a query in a currency when the
+// Service has no RateProvider.
+var ErrNoRates = errors.New("exchange rates not available")
+
+// ErrLinesCurrency is returned for a sale with lines in a currency other
+// than the base, as catalog prices are in the base currency.
+var ErrLinesCurrency = errors.New("sales with lines must be in the base currency")
+
+// RateProvider gives the exchange rates of the currencies of the sales. It
+// is implemented by *currency.Table.
+type RateProvider interface {
+	// Base is the currency the rates are relative to. Catalog prices and
+	// coupon amounts are in it.
+	Base() string
+
+	// Rate returns the value of one unit of currency in Base.
+	Rate(ctx context.Context, currency string) (float64, error)
+}
+
+// WithRates lets the Service take sales in several currencies, converting
+// them with the rates of p.
+func WithRates(p RateProvider) Option {
+	return func(s *Service) {
+		s.rates = p
+	}
+}
+
+// setCurrency fills the Currency of a new sale, the base one if it has none,
+// and the ExchangeRate to the base at this moment. Without a RateProvider the
+// sale is left without currency.
+// Returns ErrNoRates, ErrLinesCurrency or the error of the RateProvider.
+func (s *Service) setCurrency(ctx context.Context, sale *Sales) error {
+	code := strings.ToUpper(strings.TrimSpace(sale.Currency))
+	if s.rates == nil {
+		if code != "" {
+			return ErrNoRates
+		}
+		return nil
+	}
+
+	if code == "" {
+		code = s.rates.Base()
+	}
+	if len(sale.Lines) > 0 && code != s.rates.Base() {
+		return ErrLinesCurrency
+	}
+	rate, err := s.rates.Rate(ctx, code)
+	if err != nil {
+		return err
+	}
+	sale.Currency = code
+	sale.ExchangeRate = rate
+	return nil
+}
+
+// rate is the ExchangeRate of the sale, 1 for the sales without currency.
+func (s *Sales) rate() float64 {
+	if s.ExchangeRate == 0 {
+		return 1
+	}
+	return s.ExchangeRate
+}
+
+// baseAmount is Amount in the base currency, at the rate of the sale.
+func (s *Sales) baseAmount() float64 {
+	return float64(s.Amount) * s.rate()
+}
+
+// baseRefunded is RefundedAmount in the base currency, at the rate of the sale.
+func (s *Sales) baseRefunded() float64 {
+	return float64(s.RefundedAmount) * s.rate()
+}
+
+// Converter reports amounts of sales in one currency. Every sale is taken to
+// the base currency with the rate it was created with, and from there to
+// Currency with the current rate.
+type Converter struct {
+	// Currency is the target currency, empty when the Service has no
+	// RateProvider and amounts are left as they are.
+	Currency string
+
+	rate float64
+}
+
+// Converter returns a Converter to currency, the base one if it is empty.
+// Returns ErrNoRates if a currency is asked but the Service has no
+// RateProvider, or the error of the RateProvider.
+func (s *Service) Converter(ctx context.Context, currency string) (*Converter, error) {
+	code := strings.ToUpper(strings.TrimSpace(currency))
+	if s.rates == nil {
+		if code != "" {
+			return nil, ErrNoRates
+		}
+		return &Converter{rate: 1}, nil
+	}
+
+	if code == "" {
+		code = s.rates.Base()
+	}
+	rate, err := s.rates.Rate(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	return &Converter{Currency: code, rate: rate}, nil
+}
+
+// Amount converts amount, of the currency of sale, to the one of c rounded
+// to cents.
+func (c *Converter) Amount(sale *Sales, amount float32) float32 {
+	if sale.rate() == c.rate {
+		return amount
+	}
+	return float32(cents(float64(amount) * sale.rate() / c.rate))
+}
+
+// Base converts a total in the base currency, like the ones of a Summary,
+// to the currency of c.
+func (c *Converter) Base(amount float64) float32 {
+	return float32(cents(c.fromBase(amount)))
+}
+
+// fromBase converts an amount in the base currency to the one of c.
+func (c *Converter) fromBase(amount float64) float64 {
+	if c.rate == 1 {
+		return amount
+	}
+	return cents(amount / c.rate)
+}
+
+// cents rounds amount to two decimals.
+func cents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -1,6 +1,10 @@
 package sales
 
-import "time"
+import (
+	"ej_final/internal/tax"
+	"slices"
+	"time"
+)
 
 // Sales represents a sale in the system with metadata for auditing and versioning.
 type Sales struct {
@@ -11,10 +15,125 @@ type Sales struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Version   int       `json:"version"`
+
+	// RefundedAmount is the sum of the refunds of the sale, never more than Amount.
+	RefundedAmount float32 `json:"refunded_amount"`
+
+	// CancelReason is set when a pending sale was cancelled.
+	CancelReason string `json:"cancel_reason,omitempty"`
+
+	// Lines are the products sold. When a sale has lines its Amount is
+	// computed from them.
+	Lines []Line `json:"lines,omitempty"`
+
+	// ReservationID is the catalog reservation holding the stock of the lines.
+	ReservationID string `json:"-"`
+
+	// CouponCodes are the coupons applied to the sale. When a sale has
+	// coupons, OriginalAmount is its amount before them, Discount what they
+	// took off and Amount the final amount.
+	CouponCodes    []string `json:"coupon_codes,omitempty"`
+	OriginalAmount float32  `json:"original_amount,omitempty"`
+	Discount       float32  `json:"discount,omitempty"`
+
+	// Jurisdiction is where the sale is taxed, empty for the default rules.
+	// Taxes is the breakdown of Amount in net and taxes; it is nil for the
+	// sales created without a TaxCalculator, in batches or imported.
+	Jurisdiction string         `json:"jurisdiction,omitempty"`
+	Taxes        *tax.Breakdown `json:"taxes,omitempty"`
+
+	// Currency is the currency of the amounts of the sale and ExchangeRate
+	// the value of one unit of it in the base currency when the sale was
+	// created. Sales without Currency are in the base currency.
+	Currency     string  `json:"currency,omitempty"`
+	ExchangeRate float64 `json:"exchange_rate,omitempty"`
+
+	// PaymentID is the transaction of the payment gateway, set when the
+	// sale was authorized through one.
+	PaymentID string `json:"payment_id,omitempty"`
+
+	// PaymentSequence is the Sequence of the last payment callback applied
+	// to the sale, 0 if none carried one.
+	PaymentSequence int64 `json:"payment_sequence,omitempty"`
+}
+
+// Line is a product of a sale. SKU and UnitPrice are copied from the
+// catalog when the sale is created, so later price changes do not alter it.
+type Line struct {
+	ProductID string  `json:"product_id"`
+	SKU       string  `json:"sku"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float32 `json:"unit_price"`
+}
+
+// Statuses a sale reaches after being created, through Cancel and Refund.
+const (
+	StatusCancelled         = "cancelled"
+	StatusPartiallyRefunded = "partially_refunded"
+	StatusRefunded          = "refunded"
+)
+
+// Refund is a full or partial refund of an approved sale.
+type Refund struct {
+	ID        string    `json:"id"`
+	SaleID    string    `json:"sale_id"`
+	UserID    string    `json:"user_id"`
+	Amount    float32   `json:"amount"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Status is RefundPending while the PaymentGateway gives the money back,
+	// and RefundCompleted or RefundFailed after it answered.
+	Status string `json:"status"`
 }
 
+// Statuses of a Refund. Only a failed refund is left out of the
+// RefundedAmount of its sale.
+const (
+	RefundPending   = "pending"
+	RefundCompleted = "completed"
+	RefundFailed    = "failed"
+)
+
 // UpdateFields represents the optional fields for updating a User.
 // A nil pointer means “no change” for that field.
 type UpdateFields struct {
 	Status *string `json:"status"`
 }
+
+// Filter selects sales by owner and status. Empty fields match every sale.
+type Filter struct {
+	UserID string
+	Status string
+}
+
+// Match reports whether s passes the filter.
+func (f Filter) Match(s *Sales) bool {
+	return (f.UserID == "" || s.UserID == f.UserID) && (f.Status == "" || s.Status == f.Status)
+}
+
+// CheckOwner returns ErrNotFound unless sale belongs to userID. A sale of
+// someone else is answered as missing, so its ID cannot be probed.
+func CheckOwner(sale *Sales, userID string) error {
+	if sale.UserID != userID {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// clone returns a copy of s that shares no mutable state with it.
+func (s *Sales) clone() *Sales {
+	c := *s
+	if s.Lines != nil {
+		c.Lines = append([]Line(nil), s.Lines...)
+	}
+	if s.CouponCodes != nil {
+		c.CouponCodes = append([]string(nil), s.CouponCodes...)
+	}
+	if s.Taxes != nil {
+		t := *s.Taxes
+		t.Lines = slices.Clone(s.Taxes.Lines)
+		c.Taxes = &t
+	}
+	return &c
+}
@@ -0,0 +1,190 @@
+package sales
+
+import (
+	"context"
+	"ej_final/internal/logging"
+	"ej_final/internal/tracing"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrInvalidFormat is returned for an unknown export format.
+var ErrInvalidFormat = errors.New("invalid export format")
+
+// Format is the encoding of an export.
+type Format string
+
+const (
+	// FormatCSV writes a header row and one row per sale.
+	FormatCSV Format = "csv"
+
+	// FormatNDJSON writes one JSON object per line.
+	FormatNDJSON Format = "ndjson"
+)
+
+// ContentType returns the media type of the format.
+func (f Format) ContentType() string {
+	if f == FormatNDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// ParseFormat returns the Format named s.
+// Returns ErrInvalidFormat if s is not csv nor ndjson.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatCSV, FormatNDJSON:
+		return f, nil
+	}
+	return "", ErrInvalidFormat
+}
+
+// csvHeader are the columns of a CSV export, in order. currency and
+// exchange_rate are empty for the sales in the base currency, and tax for
+// the sales without tax breakdown.
+var csvHeader = []string{"id", "user_id", "amount", "status", "created_at", "updated_at", "version",
+	"currency", "exchange_rate", "refunded_amount", "tax"}
+
+// flushEvery is how many rows an Exporter buffers before flushing, so long
+// exports reach the client while they are being produced.
+const flushEvery = 100
+
+// Exporter encodes sales one by one to a writer. If the writer has a
+// Flush() method (like http.ResponseWriter) it is flushed periodically.
+type Exporter struct {
+	format Format
+	w      io.Writer
+	csv    *csv.Writer
+	json   *json.Encoder
+	rows   int
+
+	headerDone bool
+}
+
+// NewExporter returns an Exporter writing format to w.
+// Returns ErrInvalidFormat for an unknown format.
+func NewExporter(w io.Writer, format Format) (*Exporter, error) {
+	e := &Exporter{format: format, w: w}
+	switch format {
+	case FormatCSV:
+		e.csv = csv.NewWriter(w)
+	case FormatNDJSON:
+		e.json = json.NewEncoder(w)
+	default:
+		return nil, ErrInvalidFormat
+	}
+	return e, nil
+}
+
+// Write encodes one sale.
+func (e *Exporter) Write(s *Sales) error {
+	if e.format == FormatNDJSON {
+		if err := e.json.Encode(s); err != nil {
+			return err
+		}
+	} else {
+		if err := e.writeHeader(); err != nil {
+			return err
+		}
+		var rate, taxes string
+		if s.ExchangeRate != 0 {
+			rate = strconv.FormatFloat(s.ExchangeRate, 'f', -1, 64)
+		}
+		if s.Taxes != nil {
+			taxes = strconv.FormatFloat(float64(s.Taxes.Tax), 'f', -1, 32)
+		}
+		err := e.csv.Write([]string{
+			s.ID,
+			s.UserID,
+			strconv.FormatFloat(float64(s.Amount), 'f', -1, 32),
+			s.Status,
+			s.CreatedAt.Format(time.RFC3339Nano),
+			s.UpdatedAt.Format(time.RFC3339Nano),
+			strconv.Itoa(s.Version),
+			s.Currency,
+			rate,
+			strconv.FormatFloat(float64(s.RefundedAmount), 'f', -1, 32),
+			taxes,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	e.rows++
+	if e.rows%flushEvery == 0 {
+		return e.Flush()
+	}
+	return nil
+}
+
+// Flush writes any buffered data. A CSV export with no rows still gets its
+// header, so it is a valid empty spreadsheet.
+func (e *Exporter) Flush() error {
+	if e.csv != nil {
+		if err := e.writeHeader(); err != nil {
+			return err
+		}
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if f, ok := e.w.(interface{ Flush() }); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// Rows returns how many sales were written.
+func (e *Exporter) Rows() int {
+	return e.rows
+}
+
+func (e *Exporter) writeHeader() error {
+	if e.headerDone {
+		return nil
+	}
+	e.headerDone = true
+	return e.csv.Write(csvHeader)
+}
+
+// Export streams every sale matching filter to exp, oldest first, and
+// flushes it at the end. The filter is the same as GetSales, except that
+// an empty UserID exports the sales of every user.
+// Returns ErrInvalidStatus before writing anything if the status is unknown.
+func (s *Service) Export(ctx context.Context, filter Filter, exp *Exporter) error {
+	ctx, span := tracing.Start(ctx, "sales.Service.Export")
+	defer span.End()
+
+	log := logging.FromContext(ctx, s.logger)
+
+	if filter.Status != "" && !validStatus(filter.Status) {
+		log.Error("El estado dado es invalido", zap.String("status", filter.Status))
+		return ErrInvalidStatus
+	}
+
+	if err := s.storage.Iterate(ctx, filter, exp.Write); err != nil {
+		span.RecordError(err)
+		log.Error("Error exportando ventas", zap.Int("rows", exp.Rows()), zap.Error(err))
+		return err
+	}
+	if err := exp.Flush(); err != nil {
+		return err
+	}
+
+	span.SetAttribute("export.rows", exp.Rows())
+	log.Info("Ventas exportadas",
+		zap.String("user_id", filter.UserID),
+		zap.String("status", filter.Status),
+		zap.String("format", string(exp.format)),
+		zap.Int("rows", exp.Rows()))
+	return nil
+}
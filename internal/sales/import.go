@@ -0,0 +1,115 @@
+package sales
+
+import (
+	"context"
+	"ej_final/internal/logging"
+	"ej_final/internal/tracing"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ErrAlreadyExists is returned when importing a sale whose ID is taken.
+var ErrAlreadyExists = errors.New("sale already exists")
+
+// Import loads historic sales coming from another system. Each item goes
+// through the same checks as Create (the user must exist, the amount must
+// be positive) but its Status and timestamps are kept instead of being
+// generated: the status must be a known one other than the refund ones
+// (refund records are not imported), a missing CreatedAt is set to
+// now and a missing UpdatedAt to CreatedAt. The ID is kept if set, and an
+// ID already taken gets ErrAlreadyExists.
+// Results are returned in the order of the input. Unless dryRun is set the
+// valid items are written with a single SetBatch call.
+// Returns ErrEmptyBatch or ErrBatchTooLarge for an invalid batch, or the
+// storage error if writing failed (in that case nothing was imported).
+func (s *Service) Import(ctx context.Context, items []*Sales, dryRun bool) ([]BatchResult, error) {
+	ctx, span := tracing.Start(ctx, "sales.Service.Import")
+	defer span.End()
+	span.SetAttribute("batch.size", len(items))
+
+	log := logging.FromContext(ctx, s.logger)
+
+	switch {
+	case len(items) == 0:
+		return nil, ErrEmptyBatch
+	case len(items) > MaxBatchSize:
+		return nil, ErrBatchTooLarge
+	}
+
+	userIDs := make([]string, 0, len(items))
+	for _, it := range items {
+		userIDs = append(userIDs, it.UserID)
+	}
+	_, userErrs := s.checkUsers(ctx, userIDs)
+
+	now := time.Now()
+	results := make([]BatchResult, len(items))
+	seen := map[string]bool{}
+	valid := make([]*Sales, 0, len(items))
+	for i, it := range items {
+		results[i].Index = i
+		if err := userErrs[it.UserID]; err != nil {
+			results[i].Err = err
+			continue
+		}
+		if err := s.prepareHistoric(ctx, it, now, seen); err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i].Sale = it
+		valid = append(valid, it)
+	}
+
+	if dryRun || len(valid) == 0 {
+		return results, nil
+	}
+	if err := s.storage.SetBatch(ctx, valid); err != nil {
+		span.RecordError(err)
+		log.Error("Error al importar el batch de ventas", zap.Int("size", len(valid)), zap.Error(err))
+		return nil, err
+	}
+	for _, v := range valid {
+		s.metrics.saleImported(v.Status)
+	}
+
+	log.Info("Batch de ventas importado", zap.Int("size", len(items)), zap.Int("imported", len(valid)))
+	return results, nil
+}
+
+// prepareHistoric is the counterpart of prepare for imported sales: it
+// validates them and fills only the fields that are missing. seen holds the
+// IDs already used in the batch.
+func (s *Service) prepareHistoric(ctx context.Context, sale *Sales, now time.Time, seen map[string]bool) error {
+	if sale.Amount <= 0 {
+		return ErrInvalidAmount
+	}
+	// Las devoluciones no se importan, asi que una venta devuelta quedaria sin sus registros
+	if !validStatus(sale.Status) || sale.Status == StatusRefunded || sale.Status == StatusPartiallyRefunded {
+		return ErrInvalidStatus
+	}
+
+	if sale.ID == "" {
+		sale.ID = uuid.NewString()
+	}
+	if seen[sale.ID] {
+		return ErrAlreadyExists
+	}
+	if _, err := s.storage.Read(ctx, sale.ID); err == nil {
+		return ErrAlreadyExists
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	seen[sale.ID] = true
+
+	if sale.CreatedAt.IsZero() {
+		sale.CreatedAt = now
+	}
+	if sale.UpdatedAt.IsZero() {
+		sale.UpdatedAt = sale.CreatedAt
+	}
+	sale.Version = 1
+	return nil
+}
@@ -0,0 +1,88 @@
+package sales
+
+import (
+	"ej_final/internal/metrics"
+	"time"
+)
+
+// Metrics groups the business metrics reported by the sales Service.
+// A nil *Metrics is valid and records nothing.
+type Metrics struct {
+	created     *metrics.CounterVec
+	transitions *metrics.CounterVec
+	pending     *metrics.GaugeVec
+	userLookup  *metrics.HistogramVec
+	conflicts   *metrics.CounterVec
+}
+
+// NewMetrics creates the sales collectors and registers them in reg.
+func NewMetrics(reg *metrics.Registry) *Metrics {
+	return &Metrics{
+		created: reg.NewCounterVec("sales_created_total",
+			"Sales created, by initial status.", "status"),
+		transitions: reg.NewCounterVec("sales_transitions_total",
+			"Sale status transitions.", "from", "to"),
+		pending: reg.NewGaugeVec("sales_pending",
+			"Sales currently in pending status."),
+		userLookup: reg.NewHistogramVec("sales_user_lookup_duration_seconds",
+			"Latency of the user existence check done when creating a sale.", nil, "outcome"),
+		conflicts: reg.NewCounterVec("sales_payment_conflicts_total",
+			"Payment callbacks that contradict the final status of their sale.", "status", "payment_status"),
+	}
+}
+
+func (m *Metrics) saleCreated(status string) {
+	if m == nil {
+		return
+	}
+
+	m.created.Inc(status)
+	if status == "pending" {
+		m.pending.Add(1)
+	}
+}
+
+// saleImported only tracks the pending gauge: historic sales were created
+// elsewhere, so they are not counted in sales_created_total.
+func (m *Metrics) saleImported(status string) {
+	if m == nil {
+		return
+	}
+
+	if status == "pending" {
+		m.pending.Add(1)
+	}
+}
+
+func (m *Metrics) saleTransitioned(from, to string) {
+	if m == nil {
+		return
+	}
+
+	m.transitions.Inc(from, to)
+	if from == "pending" {
+		m.pending.Add(-1)
+	}
+	if to == "pending" {
+		m.pending.Add(1)
+	}
+}
+
+// paymentConflict counts a callback with paymentStatus for a sale already in
+// a final status that contradicts it.
+func (m *Metrics) paymentConflict(status, paymentStatus string) {
+	if m == nil {
+		return
+	}
+
+	m.conflicts.Inc(status, paymentStatus)
+}
+
+// userLookupDone records how long the user check took; outcome is found, not_found or error.
+func (m *Metrics) userLookupDone(start time.Time, outcome string) {
+	if m == nil {
+		return
+	}
+
+	m.userLookup.Observe(time.Since(start).Seconds(), outcome)
+}
@@ -0,0 +1,150 @@
+package sales
+
+import (
+	"context"
+	"ej_final/internal/logging"
+	"ej_final/internal/payment"
+	"errors"
+	"math/rand"
+
+	"go.uber.org/zap"
+)
+
+// ErrPaymentDeclined is returned when approving a sale whose payment the
+// gateway declines to capture. The sale stays pending.
+var ErrPaymentDeclined = errors.New("payment declined")
+
+// PaymentGateway charges the sales. It is implemented by *payment.Client
+// and, for the tests, by *payment.Fake.
+type PaymentGateway interface {
+	// Authorize holds the amount of a new sale.
+	Authorize(ctx context.Context, req payment.Request) (*payment.Result, error)
+
+	// Capture charges an authorized payment; capturing twice is a no-op.
+	Capture(ctx context.Context, transactionID string) (*payment.Result, error)
+
+	// Void cancels a payment, giving back what was captured.
+	Void(ctx context.Context, transactionID string) error
+
+	// Refund gives back amount of a captured payment.
+	Refund(ctx context.Context, transactionID string, amount float32) error
+}
+
+// WithPayments makes the status of the sales come from g: new sales are
+// authorized and approving them captures the payment. Without it the
+// initial status is random.
+func WithPayments(g PaymentGateway) Option {
+	return func(s *Service) {
+		s.payments = g
+	}
+}
+
+// initialStatus is the status of a new sale before its payment: pending
+// until the gateway answers, or a random one when there is no gateway.
+func (s *Service) initialStatus() string {
+	if s.payments != nil {
+		return "pending"
+	}
+	return status_options[rand.Intn(len(status_options))]
+}
+
+// authorize asks the gateway to hold the amount of a new sale. The sale
+// stays pending if it is authorized and becomes rejected if it is declined;
+// either way PaymentID keeps the transaction. Without a gateway it does nothing.
+// Returns the error of the gateway, like payment.ErrTimeout.
+func (s *Service) authorize(ctx context.Context, sale *Sales) error {
+	if s.payments == nil {
+		return nil
+	}
+
+	res, err := s.payments.Authorize(ctx, payment.Request{
+		Reference: sale.ID,
+		UserID:    sale.UserID,
+		Amount:    sale.Amount,
+		Currency:  sale.Currency,
+	})
+	if err != nil {
+		return err
+	}
+	sale.PaymentID = res.TransactionID
+	if res.Status == payment.StatusDeclined {
+		sale.Status = "rejected"
+	}
+	return nil
+}
+
+// captureIfApproved captures the payment of sale if it is being approved.
+// Sales without PaymentID were not charged through the gateway and are
+// approved as they are.
+// Returns ErrPaymentDeclined or the error of the gateway.
+func (s *Service) captureIfApproved(ctx context.Context, sale *Sales) error {
+	if sale.Status != "approved" || sale.PaymentID == "" || s.payments == nil {
+		return nil
+	}
+
+	res, err := s.payments.Capture(ctx, sale.PaymentID)
+	if err != nil {
+		return err
+	}
+	if res.Status != payment.StatusCaptured {
+		return ErrPaymentDeclined
+	}
+	return nil
+}
+
+// approve captures the payment of sale and commits its stock reservation if
+// it is being approved. If the stock is no longer held the payment is voided.
+// Returns the error of captureIfApproved or commitIfApproved.
+func (s *Service) approve(ctx context.Context, sale *Sales) error {
+	if err := s.captureIfApproved(ctx, sale); err != nil {
+		return err
+	}
+	if err := s.commitIfApproved(ctx, sale); err != nil {
+		s.voidPayment(ctx, sale)
+		return err
+	}
+	return nil
+}
+
+// undoApprove gives back what approve took for a sale that then was not
+// written: it voids the payment and releases the stock, which leaves the
+// sale to be rejected or cancelled. If someone else approved the stored sale
+// in the meantime it shares that payment and reservation, so nothing is
+// given back.
+func (s *Service) undoApprove(ctx context.Context, sale *Sales) {
+	if sale.Status != "approved" {
+		return
+	}
+	stored, err := s.storage.Read(ctx, sale.ID)
+	if err == nil && stored.Status != "pending" && stored.Status != "rejected" && stored.Status != StatusCancelled {
+		return
+	}
+	logging.FromContext(ctx, s.logger).Warn("Se devuelve el cobro de una venta que no se guardo",
+		zap.String("sale_id", sale.ID),
+		zap.String("payment_id", sale.PaymentID))
+	s.releaseLines(ctx, sale)
+	s.voidPayment(ctx, sale)
+}
+
+// voidPayment cancels the payment of a sale that will not be fulfilled.
+// Like releaseLines, a failure is only logged.
+func (s *Service) voidPayment(ctx context.Context, sale *Sales) {
+	if sale.PaymentID == "" || s.payments == nil {
+		return
+	}
+	if err := s.payments.Void(ctx, sale.PaymentID); err != nil {
+		logging.FromContext(ctx, s.logger).Error("Error anulando el pago de la venta",
+			zap.String("sale_id", sale.ID),
+			zap.String("payment_id", sale.PaymentID),
+			zap.Error(err))
+	}
+}
+
+// refundPayment gives back amount of the payment of sale, before the
+// refund is recorded. Sales without PaymentID have nothing to give back.
+func (s *Service) refundPayment(ctx context.Context, sale *Sales, amount float32) error {
+	if sale.PaymentID == "" || s.payments == nil {
+		return nil
+	}
+	return s.payments.Refund(ctx, sale.PaymentID, amount)
+}
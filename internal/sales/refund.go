@@ -0,0 +1,331 @@
+package sales
+
+import (
+	"context"
+	"ej_final/internal/logging"
+	"ej_final/internal/tracing"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ErrMissingReason is returned when a cancellation or refund has no reason.
+var ErrMissingReason = errors.New("reason is required")
+
+// ErrRefundExceedsAmount is returned when a refund would take the refunded
+// total of a sale over its Amount.
+var ErrRefundExceedsAmount = errors.New("refund exceeds the sale amount")
+
+// refundEpsilon absorbs the float32 rounding of the amounts: a refund within
+// it of the remaining amount refunds exactly the remaining amount.
+const refundEpsilon = 0.005
+
+// Cancel moves a pending sale to cancelled, recording why. Like rejecting
+// it, this gives back its stock and coupons and voids its payment.
+// Returns ErrMissingReason, ErrNotFound, ErrInvalidTransition if the sale is
+// not pending, or ErrVersionConflict if it changed in the meantime.
+func (s *Service) Cancel(ctx context.Context, saleID, reason string) (*Sales, error) {
+	ctx, span := tracing.Start(ctx, "sales.Service.Cancel")
+	defer span.End()
+
+	log := logging.FromContext(ctx, s.logger)
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrMissingReason
+	}
+
+	sale, err := s.Get(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+	if sale.Status != "pending" {
+		log.Error("Solo se pueden cancelar ventas pendientes",
+			zap.String("sale_id", saleID),
+			zap.String("current_status", sale.Status))
+		return nil, ErrInvalidTransition
+	}
+
+	sale.Status = StatusCancelled
+	sale.CancelReason = reason
+	sale.UpdatedAt = time.Now()
+	sale.Version++
+
+	if err := s.storage.SetVersioned(ctx, []*Sales{sale}); err != nil {
+		log.Error("Error cancelando la venta", zap.String("sale_id", saleID), zap.Error(err))
+		return nil, err
+	}
+	s.transitioned(ctx, "pending", sale)
+
+	log.Info("Venta cancelada", zap.String("sale_id", saleID), zap.String("reason", reason))
+	return sale, nil
+}
+
+// Refund gives back amount of an approved or partially refunded sale. The
+// sale becomes refunded once the refunds add up to its Amount, and
+// partially_refunded until then; a refund within refundEpsilon of the
+// remaining amount is recorded as the remaining amount, so the refunds never
+// add up to more than Amount. The sale and a RefundPending record are stored
+// before the PaymentGateway gives the money back, so a refund paid out is
+// never missing from the storage. The record is then completed; if the
+// gateway failed it is marked failed and the sale goes back to how it was.
+// A record that could not be completed is left pending and logged, and the
+// refund is returned as pending. The refunds of a sale run one at a time.
+// Returns ErrInvalidAmount, ErrMissingReason, ErrNotFound,
+// ErrInvalidTransition for a sale in another status, ErrRefundExceedsAmount,
+// the error of the PaymentGateway, or ErrVersionConflict if the sale changed
+// in the meantime.
+func (s *Service) Refund(ctx context.Context, saleID string, amount float32, reason string) (*Sales, *Refund, error) {
+	ctx, span := tracing.Start(ctx, "sales.Service.Refund")
+	defer span.End()
+
+	log := logging.FromContext(ctx, s.logger)
+
+	if amount <= 0 {
+		return nil, nil, ErrInvalidAmount
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, nil, ErrMissingReason
+	}
+
+	// De a una por venta, asi dos devoluciones a la vez no chocan por la version
+	unlock := s.refunds.lock(saleID)
+	defer unlock()
+
+	sale, err := s.Get(ctx, saleID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sale.Status != "approved" && sale.Status != StatusPartiallyRefunded {
+		log.Error("Solo se pueden devolver ventas aprobadas",
+			zap.String("sale_id", saleID),
+			zap.String("current_status", sale.Status))
+		return nil, nil, ErrInvalidTransition
+	}
+
+	remaining := sale.Amount - sale.RefundedAmount
+	if amount > remaining+refundEpsilon {
+		log.Error("La devolucion supera lo que queda de la venta",
+			zap.String("sale_id", saleID),
+			zap.Float32("amount", amount),
+			zap.Float32("remaining", remaining))
+		return nil, nil, ErrRefundExceedsAmount
+	}
+
+	// La que completa la venta devuelve justo lo que queda: ni un resto de
+	// centavos imposible de devolver ni un total por encima del monto
+	full := amount >= remaining-refundEpsilon
+	if full {
+		amount = remaining
+	}
+
+	now := time.Now()
+	oldStatus, oldRefunded := sale.Status, sale.RefundedAmount
+	sale.RefundedAmount += amount
+	if full {
+		sale.RefundedAmount = sale.Amount
+		sale.Status = StatusRefunded
+	} else {
+		sale.Status = StatusPartiallyRefunded
+	}
+	sale.UpdatedAt = now
+	sale.Version++
+
+	// La devolucion queda registrada como pendiente antes de pedirle la plata al gateway
+	refund := &Refund{
+		ID:        uuid.NewString(),
+		SaleID:    sale.ID,
+		UserID:    sale.UserID,
+		Amount:    amount,
+		Reason:    reason,
+		CreatedAt: now,
+		Status:    RefundPending,
+	}
+	if err := s.storage.SetRefund(ctx, sale, refund); err != nil {
+		log.Error("Error guardando la devolucion", zap.String("sale_id", saleID), zap.Error(err))
+		return nil, nil, err
+	}
+
+	if err := s.refundPayment(ctx, sale, amount); err != nil {
+		log.Error("El gateway no pudo devolver el pago", zap.String("sale_id", saleID), zap.Error(err))
+		s.failRefund(ctx, sale, refund, oldStatus, oldRefunded)
+		return nil, nil, err
+	}
+
+	refund.Status = RefundCompleted
+	if err := s.storage.UpdateRefund(ctx, refund); err != nil {
+		// La plata ya se devolvio y la venta la cuenta, solo falta marcarla completa
+		refund.Status = RefundPending
+		log.Error("La devolucion se pago pero quedo pendiente",
+			zap.String("sale_id", saleID),
+			zap.String("refund_id", refund.ID),
+			zap.Error(err))
+	}
+	if oldStatus != sale.Status {
+		s.transitioned(ctx, oldStatus, sale)
+	}
+
+	log.Info("Devolucion registrada",
+		zap.String("sale_id", saleID),
+		zap.String("refund_id", refund.ID),
+		zap.Float32("amount", amount),
+		zap.String("status", sale.Status))
+	return sale, refund, nil
+}
+
+// failRefund marks refund failed and gives sale back the status and refunded
+// amount it had before it, after the PaymentGateway did not pay it out. If
+// that cannot be stored the refund stays pending and the mismatch is logged.
+func (s *Service) failRefund(ctx context.Context, sale *Sales, refund *Refund, status string, refunded float32) {
+	sale.Status = status
+	sale.RefundedAmount = refunded
+	sale.UpdatedAt = time.Now()
+	sale.Version++
+	refund.Status = RefundFailed
+
+	if err := s.storage.SetRefund(ctx, sale, refund); err != nil {
+		logging.FromContext(ctx, s.logger).Error("La devolucion fallo pero quedo pendiente en la venta",
+			zap.String("sale_id", sale.ID),
+			zap.String("refund_id", refund.ID),
+			zap.Float32("amount", refund.Amount),
+			zap.Error(err))
+	}
+}
+
+// saleLocks holds a mutex per sale ID, only while someone holds or waits for
+// it. The zero value is ready to use.
+type saleLocks struct {
+	mu    sync.Mutex
+	locks map[string]*saleLock
+}
+
+type saleLock struct {
+	mu      sync.Mutex
+	waiters int
+}
+
+// lock locks the mutex of id and returns the func that unlocks it.
+func (l *saleLocks) lock(id string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*saleLock{}
+	}
+	sl, ok := l.locks[id]
+	if !ok {
+		sl = &saleLock{}
+		l.locks[id] = sl
+	}
+	sl.waiters++
+	l.mu.Unlock()
+
+	sl.mu.Lock()
+	return func() {
+		sl.mu.Unlock()
+		l.mu.Lock()
+		sl.waiters--
+		if sl.waiters == 0 {
+			delete(l.locks, id)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// Refunds returns the refunds of a sale, oldest first.
+// Returns ErrNotFound if the sale does not exist.
+func (s *Service) Refunds(ctx context.Context, saleID string) ([]*Refund, error) {
+	ctx, span := tracing.Start(ctx, "sales.Service.Refunds")
+	defer span.End()
+
+	if _, err := s.Get(ctx, saleID); err != nil {
+		return nil, err
+	}
+	return s.storage.Refunds(ctx, saleID)
+}
+
+// SetRefund stores refund and the sale it updates atomically, replacing the
+// refund with the same ID if there is one. The sale must carry the stored
+// Version plus one, as in SetVersioned.
+// Returns ErrNotFound or ErrVersionConflict; in that case nothing is stored.
+func (l *LocalStorage) SetRefund(ctx context.Context, sale *Sales, refund *Refund) error {
+	ctx, span := tracing.Start(ctx, "sales.LocalStorage.SetRefund")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stored, ok := l.m[sale.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version+1 != sale.Version {
+		return ErrVersionConflict
+	}
+
+	l.put(sale.clone())
+	r := *refund
+	for i, stored := range l.refunds[sale.ID] {
+		if stored.ID == r.ID {
+			l.refunds[sale.ID][i] = &r
+			return nil
+		}
+	}
+	l.refunds[sale.ID] = append(l.refunds[sale.ID], &r)
+	return nil
+}
+
+// UpdateRefund implements Storage.
+// Returns ErrNotFound if refund is not stored.
+func (l *LocalStorage) UpdateRefund(ctx context.Context, refund *Refund) error {
+	ctx, span := tracing.Start(ctx, "sales.LocalStorage.UpdateRefund")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, stored := range l.refunds[refund.SaleID] {
+		if stored.ID == refund.ID {
+			r := *refund
+			l.refunds[refund.SaleID][i] = &r
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// Refunds returns copies of the refunds of saleID ordered by CreatedAt. A
+// sale without refunds gets an empty slice.
+func (l *LocalStorage) Refunds(ctx context.Context, saleID string) ([]*Refund, error) {
+	ctx, span := tracing.Start(ctx, "sales.LocalStorage.Refunds")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	refunds := make([]*Refund, 0, len(l.refunds[saleID]))
+	for _, r := range l.refunds[saleID] {
+		c := *r
+		refunds = append(refunds, &c)
+	}
+	sort.SliceStable(refunds, func(i, j int) bool {
+		return refunds[i].CreatedAt.Before(refunds[j].CreatedAt)
+	})
+	return refunds, nil
+}
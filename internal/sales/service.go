@@ -1,9 +1,13 @@
 package sales
 
 import (
+	"context"
+	"ej_final/internal/logging"
+	"ej_final/internal/requestid"
+	"ej_final/internal/tracing"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"math/rand"
 	"net/http"
 	"time"
 
@@ -22,85 +26,310 @@ type Service struct {
 
 	//baseURL
 	baseUrl string
+
+	// metrics records business metrics, nil disables them.
+	metrics *Metrics
+
+	// catalog holds the stock of the sales with lines, nil disables them.
+	catalog Catalog
+
+	// coupons discounts the sales with coupon codes, nil disables them.
+	coupons Coupons
+
+	// taxes computes the taxes of the sales, nil leaves them untaxed.
+	taxes TaxCalculator
+
+	// rates converts the currencies of the sales, nil keeps a single one.
+	rates RateProvider
+
+	// payments charges the sales, nil makes their initial status random.
+	payments PaymentGateway
+
+	// internalToken is sent on the calls to the users API so they are not
+	// throttled like the ones of the clients.
+	internalToken string
+
+	// refunds serializes the refunds of each sale.
+	refunds saleLocks
+}
+
+// Option configures optional Service dependencies.
+type Option func(*Service)
+
+// WithMetrics makes the Service report its business metrics to m.
+func WithMetrics(m *Metrics) Option {
+	return func(s *Service) {
+		s.metrics = m
+	}
+}
+
+// InternalTokenHeader carries the token that marks the calls of the Service
+// to the users API as internal.
+const InternalTokenHeader = "X-Internal-Token"
+
+// WithInternalToken makes the Service send token in InternalTokenHeader on
+// its calls to the users API, so the API can exempt them from rate limiting.
+func WithInternalToken(token string) Option {
+	return func(s *Service) {
+		s.internalToken = token
+	}
 }
 
 // 0: pending, 1: approved, 2: rejected
 // La forma mas facil que me salio pa que elija aleatoriamente en el create jeje
 var status_options = []string{"pending", "approved", "rejected"}
 
+// knownStatuses are every status a sale can be in: the initial ones plus the
+// ones reached by cancelling or refunding it.
+var knownStatuses = append(append([]string(nil), status_options...),
+	StatusCancelled, StatusPartiallyRefunded, StatusRefunded)
+
 // Para tener el error personalizado jeee
 var ErrInvalidStatus = errors.New("invalid status")
 var ErrInvalidTransition = errors.New("invalid status transition")
 
 // NewService creates a new Service.
-func NewService(storage Storage, logger *zap.Logger, url string) *Service {
+func NewService(storage Storage, logger *zap.Logger, url string, opts ...Option) *Service {
 	if logger == nil {
 		logger, _ = zap.NewProduction()
 		defer logger.Sync() // flushes buffer, if any
 	}
 
-	return &Service{
+	s := &Service{
 		storage: storage,
 		logger:  logger,
 		baseUrl: url,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
 // Create adds a brand-new sale to the system.
 // It sets CreatedAt and UpdatedAt to the current time and initializes Version to 1.
-// Returns ErrEmptyID if sales.ID is empty.
-func (s *Service) Create(sales *Sales) error {
-	// Checks if the ID given is from a User that exits, else it will give an error
-	client := resty.New()
-	resp, err := client.R().
-		Get(fmt.Sprintf("%s/users/%s", s.baseUrl, sales.UserID)) // http://localhost:8080
+// A sale with Lines reserves their stock in the catalog and its Amount is
+// computed from them. The reservation is held while the sale is pending,
+// committed if it starts approved and released if it starts rejected.
+// A sale with CouponCodes is discounted by them, and their uses are given
+// back if it starts rejected. With a TaxCalculator, the final amount is
+// taxed in the Jurisdiction of the sale, or the one of the address of the
+// user if it has none, and Amount becomes the gross amount. With a
+// RateProvider the sale keeps its Currency, the base one by default, and the
+// ExchangeRate of the moment. With a PaymentGateway the final amount is
+// authorized: the sale starts pending, or rejected if the payment is
+// declined, instead of in a random status.
+// Returns ErrEmptyID if sales.ID is empty, ErrInvalidLine, ErrNoCatalog or
+// the error of the catalog for bad lines, ErrNoCoupons or the error of the
+// coupons for bad coupons, ErrNoTaxes or the error of the TaxCalculator,
+// ErrNoRates, ErrLinesCurrency or the error of the RateProvider, or the
+// error of the PaymentGateway.
+func (s *Service) Create(ctx context.Context, sales *Sales) error {
+	ctx, span := tracing.Start(ctx, "sales.Service.Create")
+	defer span.End()
+
+	log := logging.FromContext(ctx, s.logger)
 
+	// Checks if the ID given is from a User that exits, else it will give an error
+	u, err := s.checkUser(ctx, sales.UserID)
 	if err != nil {
-		s.logger.Error("Ocurrio un error al buscar el ID del usuario", zap.Error(err))
+		span.RecordError(err)
 		return err
 	}
 
-	if resp.StatusCode() != http.StatusOK {
-		s.logger.Error("ID de Usuario dado no existe", zap.Error(err))
-		return ErrUserNotFound
+	if err := s.setCurrency(ctx, sales); err != nil {
+		log.Warn("Moneda de la venta invalida", zap.Error(err))
+		return err
+	}
+
+	if len(sales.Lines) > 0 {
+		if err := s.reserveLines(ctx, sales); err != nil {
+			log.Warn("No se pudieron reservar las lineas de la venta", zap.Error(err))
+			return err
+		}
+	}
+
+	if err := s.prepare(sales, time.Now()); err != nil {
+		log.Error("Amount no puede ser un valor menor o igual a 0", zap.Error(err), zap.Any("sales", sales))
+		s.releaseLines(ctx, sales)
+		return err
+	}
+	// Los cupones se aplican sobre el monto final de las lineas
+	if len(sales.CouponCodes) > 0 {
+		if err := s.applyCoupons(ctx, sales); err != nil {
+			log.Warn("No se pudieron aplicar los cupones de la venta", zap.Error(err))
+			s.releaseLines(ctx, sales)
+			return err
+		}
+	}
+	// Los impuestos van sobre lo que se cobra, despues del descuento
+	if err := s.applyTaxes(ctx, sales, u.Address); err != nil {
+		log.Warn("No se pudieron calcular los impuestos de la venta", zap.Error(err))
+		s.release(ctx, sales)
+		return err
+	}
+	// Con el monto final ya calculado, el gateway decide si queda pendiente o rechazada
+	if err := s.authorize(ctx, sales); err != nil {
+		log.Warn("No se pudo autorizar el pago de la venta", zap.Error(err))
+		s.release(ctx, sales)
+		return err
+	}
+	if err := s.commitIfApproved(ctx, sales); err != nil {
+		s.release(ctx, sales)
+		return err
 	}
 
+	if err := s.storage.Set(ctx, sales); err != nil {
+		log.Error("Error al crear la venta", zap.Error(err), zap.Any("sales", sales))
+		s.release(ctx, sales)
+		return err
+	}
+	s.metrics.saleCreated(sales.Status)
+	if sales.Status == "rejected" {
+		s.release(ctx, sales)
+	}
+	return nil
+}
+
+// prepare validates a new sale and fills in the fields the system owns:
+// ID, initial status, timestamps and Version.
+// Returns ErrInvalidAmount if the amount is not positive.
+func (s *Service) prepare(sales *Sales, now time.Time) error {
 	sales.ID = uuid.NewString()
 	if sales.Amount <= 0 {
-		s.logger.Error("Amount no puede ser un valor menor o igual a 0", zap.Error(ErrInvalidAmount), zap.Any("sales", sales))
 		return ErrInvalidAmount
 	}
-	sales.Status = status_options[rand.Intn(len(status_options))]
+	sales.Status = s.initialStatus()
 
-	now := time.Now()
 	sales.CreatedAt = now
 	sales.UpdatedAt = now
 	sales.Version = 1
+	return nil
+}
+
+// remoteUser are the fields of a user of the users API the sales need.
+type remoteUser struct {
+	Address string `json:"address"`
+}
+
+// checkUser asks the users API whether userID exists and returns it.
+// Returns ErrUserNotFound only if the API answers 404, the error of ctx if it
+// is done, or ErrUsersUnavailable for any other failure.
+func (s *Service) checkUser(ctx context.Context, userID string) (*remoteUser, error) {
+	ctx, span := tracing.StartKind(ctx, "sales.userLookup", tracing.KindClient)
+	defer span.End()
+	log := logging.FromContext(ctx, s.logger)
+
+	client := resty.New()
+	req := client.R().SetContext(ctx)
+	if id := requestid.FromContext(ctx); id != "" {
+		req.SetHeader(requestid.Header, id)
+	}
+	if s.internalToken != "" {
+		req.SetHeader(InternalTokenHeader, s.internalToken)
+	}
+	tracing.Inject(ctx, req.Header)
+
+	start := time.Now()
+	resp, err := req.Get(fmt.Sprintf("%s/v1/users/%s", s.baseUrl, userID)) // http://localhost:8080
 
-	if err := s.storage.Set(sales); err != nil {
-		s.logger.Error("Error al crear la venta", zap.Error(err), zap.Any("sales", sales))
+	if err != nil {
+		s.metrics.userLookupDone(start, "error")
+		span.RecordError(err)
+		log.Error("Ocurrio un error al buscar el ID del usuario", zap.Error(err))
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("%w: %s", ErrUsersUnavailable, err)
+	}
+
+	span.SetAttribute("http.status_code", resp.StatusCode())
+	switch resp.StatusCode() {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		s.metrics.userLookupDone(start, "not_found")
+		log.Error("ID de Usuario dado no existe", zap.String("user_id", userID))
+		return nil, ErrUserNotFound
+	default:
+		// Un 429 o un 5xx no dice nada de si el usuario existe
+		s.metrics.userLookupDone(start, "error")
+		log.Error("El API de usuarios no pudo contestar",
+			zap.String("user_id", userID),
+			zap.Int("status", resp.StatusCode()))
+		return nil, fmt.Errorf("%w: users API answered %d", ErrUsersUnavailable, resp.StatusCode())
+	}
+	s.metrics.userLookupDone(start, "found")
+
+	// Si el cuerpo no se entiende el usuario igual existe, solo no sabemos su direccion
+	var u remoteUser
+	if body := resp.Body(); len(body) > 0 {
+		if err := json.Unmarshal(body, &u); err != nil {
+			log.Warn("Respuesta del API de usuarios ilegible", zap.String("user_id", userID), zap.Error(err))
+		}
+	}
+	return &u, nil
+}
+
+// PingUserAPI checks that the users API used to validate sales answers its liveness endpoint.
+func (s *Service) PingUserAPI(ctx context.Context) error {
+	resp, err := resty.New().R().SetContext(ctx).Get(s.baseUrl + "/healthz")
+	if err != nil {
 		return err
 	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("users API answered %d", resp.StatusCode())
+	}
 	return nil
 }
 
-func (s *Service) GetSales(user_id, status string) ([]*Sales, error) {
+// Get returns the sale with the given ID.
+// Returns ErrEmptyID or ErrNotFound.
+func (s *Service) Get(ctx context.Context, id string) (*Sales, error) {
+	ctx, span := tracing.Start(ctx, "sales.Service.Get")
+	defer span.End()
+
+	if id == "" {
+		return nil, ErrEmptyID
+	}
+	return s.storage.Read(ctx, id)
+}
+
+// GetForUser returns the sale saleID only if it belongs to userID.
+// Returns ErrNotFound if it does not exist or belongs to someone else.
+func (s *Service) GetForUser(ctx context.Context, userID, saleID string) (*Sales, error) {
+	ctx, span := tracing.Start(ctx, "sales.Service.GetForUser")
+	defer span.End()
+
+	sale, err := s.Get(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckOwner(sale, userID); err != nil {
+		logging.FromContext(ctx, s.logger).Warn("La venta pedida es de otro usuario",
+			zap.String("sale_id", saleID),
+			zap.String("user_id", userID))
+		return nil, err
+	}
+	return sale, nil
+}
+
+func (s *Service) GetSales(ctx context.Context, user_id, status string) ([]*Sales, error) {
+	ctx, span := tracing.Start(ctx, "sales.Service.GetSales")
+	defer span.End()
+
+	log := logging.FromContext(ctx, s.logger)
+
 	// Validar estado si fue dado
 	if status != "" {
-		validStatus := false
-		for _, st := range status_options {
-			if status == st {
-				validStatus = true
-				break
-			}
-		}
-		if !validStatus {
-			s.logger.Error("El estado dado es invalido", zap.String("status", status))
+		if !validStatus(status) {
+			log.Error("El estado dado es invalido", zap.String("status", status))
 			return nil, ErrInvalidStatus
 		}
-		sales, err := s.storage.GetByStatus(user_id, status)
+		sales, err := s.storage.GetByStatus(ctx, user_id, status)
 		if err != nil {
-			s.logger.Error("Error obteniendo ventas por estado",
+			log.Error("Error obteniendo ventas por estado",
 				zap.String("user_id", user_id),
 				zap.String("status", status),
 				zap.Error(err))
@@ -110,9 +339,9 @@ func (s *Service) GetSales(user_id, status string) ([]*Sales, error) {
 	}
 
 	// Si no se dio un estado, obtener todas las ventas
-	sales, err := s.storage.GetAll(user_id)
+	sales, err := s.storage.GetAll(ctx, user_id)
 	if err != nil {
-		s.logger.Error("Error obteniendo todas las ventas",
+		log.Error("Error obteniendo todas las ventas",
 			zap.String("user_id", user_id),
 			zap.Error(err))
 		return nil, err
@@ -120,68 +349,115 @@ func (s *Service) GetSales(user_id, status string) ([]*Sales, error) {
 	return sales, nil
 }
 
-func (s *Service) Update(saleID string, newStatus string) (*Sales, error) {
+// Update moves a pending sale to approved or rejected. Approving a sale
+// captures its payment and, with lines, commits its stock reservation;
+// rejecting it releases the stock, the uses of its coupons and voids its
+// payment.
+// Returns ErrNotFound, ErrInvalidStatus, ErrInvalidTransition,
+// ErrPaymentDeclined or the error of the PaymentGateway,
+// product.ErrReservationExpired if the stock is no longer held (the sale is
+// rejected and its payment voided then), or ErrVersionConflict if the sale changed while it was
+// being updated.
+func (s *Service) Update(ctx context.Context, saleID string, newStatus string) (*Sales, error) {
+	return s.update(ctx, saleID, newStatus, nil)
+}
+
+// update is Update, calling change, if not nil, on the sale before storing it.
+func (s *Service) update(ctx context.Context, saleID string, newStatus string, change func(*Sales)) (*Sales, error) {
+	ctx, span := tracing.Start(ctx, "sales.Service.Update")
+	defer span.End()
+
+	log := logging.FromContext(ctx, s.logger)
+
 	// Validar que el ID no esté vacío
 	if saleID == "" {
-		s.logger.Error("ID de venta está vacío")
+		log.Error("ID de venta está vacío")
 		return nil, ErrEmptyID
 	}
 
 	// Validar que el nuevo estado sea válido
-	validStatus := false
-	for _, st := range status_options {
-		if newStatus == st {
-			validStatus = true
-			break
-		}
-	}
-	if !validStatus {
-		s.logger.Error("El estado dado es inválido", zap.String("status", newStatus))
+	if !validStatus(newStatus) {
+		log.Error("El estado dado es inválido", zap.String("status", newStatus))
 		return nil, ErrInvalidStatus
 	}
 
 	// Obtener la venta actual
-	sale, err := s.storage.Read(saleID)
+	sale, err := s.storage.Read(ctx, saleID)
 	if err != nil {
-		s.logger.Error("Error obteniendo venta para actualizar",
+		log.Error("Error obteniendo venta para actualizar",
 			zap.String("sale_id", saleID),
 			zap.Error(err))
 		return nil, err
 	}
 
-	// Validar transición: solo se puede cambiar desde "pending"
-	if sale.Status != "pending" {
-		s.logger.Error("Transición inválida: la venta no está en estado pending",
+	// Validar transición: solo se puede cambiar de pending a approved o rejected
+	if err := checkTransition(sale.Status, newStatus); err != nil {
+		log.Error("Transición inválida",
 			zap.String("sale_id", saleID),
 			zap.String("current_status", sale.Status),
 			zap.String("new_status", newStatus))
-		return nil, ErrInvalidTransition
-	}
-
-	// Validar que solo se pueda cambiar a "approved" o "rejected"
-	if newStatus != "approved" && newStatus != "rejected" {
-		s.logger.Error("Solo se puede cambiar de pending a approved o rejected",
-			zap.String("sale_id", saleID),
-			zap.String("new_status", newStatus))
-		return nil, ErrInvalidTransition
+		return nil, err
 	}
 
 	// Actualizar la venta
+	oldStatus := sale.Status
 	sale.Status = newStatus
 	sale.UpdatedAt = time.Now()
 	sale.Version++
+	if change != nil {
+		change(sale)
+	}
+
+	// Si se aprueba, se cobra el pago y el stock reservado pasa a vendido antes de guardar
+	if err := s.approve(ctx, sale); err != nil {
+		log.Error("No se pudo aprobar la venta",
+			zap.String("sale_id", saleID),
+			zap.Error(err))
+		s.rejectIfExpired(ctx, sale, err)
+		return nil, err
+	}
 
-	// Guardar la venta actualizada
-	if err := s.storage.Set(sale); err != nil {
-		s.logger.Error("Error actualizando la venta",
+	// Guardar la venta actualizada, fallando si otro la modifico mientras tanto
+	if err := s.storage.SetVersioned(ctx, []*Sales{sale}); err != nil {
+		log.Error("Error actualizando la venta",
 			zap.String("sale_id", saleID),
 			zap.Error(err))
+		s.undoApprove(ctx, sale)
 		return nil, err
 	}
+	s.transitioned(ctx, oldStatus, sale)
 
-	s.logger.Info("Venta actualizada exitosamente",
+	log.Info("Venta actualizada exitosamente",
 		zap.String("sale_id", saleID),
 		zap.String("new_status", newStatus))
 
 	return sale, nil
 }
+
+// transitioned records a status change already stored, and gives back the
+// stock and coupons of the sales that will not be fulfilled.
+func (s *Service) transitioned(ctx context.Context, from string, sale *Sales) {
+	s.metrics.saleTransitioned(from, sale.Status)
+	if sale.Status == "rejected" || sale.Status == StatusCancelled {
+		s.release(ctx, sale)
+	}
+}
+
+// validStatus reports whether status is one of the known sale statuses.
+func validStatus(status string) bool {
+	for _, st := range knownStatuses {
+		if status == st {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTransition applies the transition rules: only pending sales can
+// change, and only to approved or rejected.
+func checkTransition(from, to string) error {
+	if from != "pending" || (to != "approved" && to != "rejected") {
+		return ErrInvalidTransition
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+package sales
+
+import (
+	"context"
+	"ej_final/internal/logging"
+	"ej_final/internal/tracing"
+	"errors"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrInvalidInterval is returned for an unknown stats Interval.
+var ErrInvalidInterval = errors.New("invalid interval")
+
+// ErrInvalidRange is returned when From is not before To, or the range
+// needs more than MaxStatsBuckets buckets.
+var ErrInvalidRange = errors.New("invalid date range")
+
+// MaxStatsBuckets bounds the buckets of a single stats query.
+const MaxStatsBuckets = 1000
+
+// DefaultTopUsers and MaxTopUsers bound StatsQuery.TopUsers.
+const (
+	DefaultTopUsers = 10
+	MaxTopUsers     = 100
+)
+
+// Interval is the width of the buckets of a stats query.
+type Interval string
+
+const (
+	IntervalDay   Interval = "day"
+	IntervalWeek  Interval = "week"
+	IntervalMonth Interval = "month"
+)
+
+// start returns the beginning of the bucket t falls in, in UTC. Weeks
+// start on Monday.
+func (i Interval) start(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch i {
+	case IntervalWeek:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case IntervalMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+// next returns the start of the bucket after the one starting at t.
+func (i Interval) next(t time.Time) time.Time {
+	switch i {
+	case IntervalWeek:
+		return t.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// StatsQuery selects the sales created in [From, To), optionally of a
+// single user, grouped in buckets of Interval.
+type StatsQuery struct {
+	From     time.Time
+	To       time.Time
+	Interval Interval
+	UserID   string
+
+	// TopUsers is how many users to rank by volume.
+	TopUsers int
+
+	// Currency is the currency to report the amounts in, the base one if
+	// empty.
+	Currency string
+}
+
+// Match reports whether s is counted by the query.
+func (q StatsQuery) Match(s *Sales) bool {
+	return (q.UserID == "" || s.UserID == q.UserID) &&
+		!s.CreatedAt.Before(q.From) && s.CreatedAt.Before(q.To)
+}
+
+// StatusTotals are the count and amount of the sales in one status.
+type StatusTotals struct {
+	Count  int     `json:"count"`
+	Amount float64 `json:"amount"`
+}
+
+// Totals aggregates a set of sales.
+type Totals struct {
+	Count    int                     `json:"count"`
+	Amount   float64                 `json:"amount"`
+	ByStatus map[string]StatusTotals `json:"by_status"`
+
+	// ApprovalRate is approved / (approved + rejected), where refunded and
+	// partially refunded sales were approved too; pending and cancelled sales
+	// do not count. AverageTicket is Amount / Count.
+	ApprovalRate  float64 `json:"approval_rate"`
+	AverageTicket float64 `json:"average_ticket"`
+}
+
+// Bucket is the Totals of the sales created in [Start, Start+Interval).
+type Bucket struct {
+	Start time.Time `json:"start"`
+	Totals
+}
+
+// UserVolume is the volume of a user in the range.
+type UserVolume struct {
+	UserID string  `json:"user_id"`
+	Count  int     `json:"count"`
+	Amount float64 `json:"amount"`
+}
+
+// Stats is the result of a stats query. Buckets cover the whole range, the
+// ones without sales included, and TopUsers is ordered by amount. Amounts
+// are in Currency, empty when the Service has no RateProvider.
+type Stats struct {
+	From     time.Time    `json:"from"`
+	To       time.Time    `json:"to"`
+	Interval Interval     `json:"interval"`
+	Currency string       `json:"currency,omitempty"`
+	Totals   Totals       `json:"totals"`
+	Buckets  []Bucket     `json:"buckets"`
+	TopUsers []UserVolume `json:"top_users"`
+}
+
+// Aggregator is implemented by storages able to compute Stats themselves,
+// like a SQL backend doing it with GROUP BY. Storages without it are
+// aggregated in memory through Iterate. Amounts are summed in the base
+// currency, Amount * ExchangeRate, and Service.Stats converts them to the
+// Currency of the query.
+type Aggregator interface {
+	Aggregate(ctx context.Context, q StatsQuery) (*Stats, error)
+}
+
+// Stats aggregates the sales matching q. An empty Interval means
+// IntervalDay and TopUsers is clamped to [1, MaxTopUsers]
+// (DefaultTopUsers when not set).
+// Returns ErrInvalidInterval or ErrInvalidRange for bad queries, ErrNoRates
+// or the error of the RateProvider for a bad Currency.
+func (s *Service) Stats(ctx context.Context, q StatsQuery) (*Stats, error) {
+	ctx, span := tracing.Start(ctx, "sales.Service.Stats")
+	defer span.End()
+
+	log := logging.FromContext(ctx, s.logger)
+
+	q, err := normalizeStatsQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	conv, err := s.Converter(ctx, q.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	if agg, ok := s.storage.(Aggregator); ok {
+		stats, err := agg.Aggregate(ctx, q)
+		if err != nil {
+			log.Error("Error agregando ventas en el storage", zap.Error(err))
+			return nil, err
+		}
+		return stats.convert(conv), nil
+	}
+
+	acc := NewStatsAccumulator(q)
+	err = s.storage.Iterate(ctx, Filter{UserID: q.UserID}, func(sale *Sales) error {
+		acc.Add(sale)
+		return nil
+	})
+	if err != nil {
+		log.Error("Error recorriendo ventas para las estadisticas", zap.Error(err))
+		return nil, err
+	}
+	return acc.Stats().convert(conv), nil
+}
+
+// convert takes the amounts of stats, in the base currency, to the one of c.
+func (stats *Stats) convert(c *Converter) *Stats {
+	stats.Currency = c.Currency
+	stats.Totals = stats.Totals.convert(c)
+	for i := range stats.Buckets {
+		stats.Buckets[i].Totals = stats.Buckets[i].Totals.convert(c)
+	}
+	for i := range stats.TopUsers {
+		stats.TopUsers[i].Amount = c.fromBase(stats.TopUsers[i].Amount)
+	}
+	return stats
+}
+
+func normalizeStatsQuery(q StatsQuery) (StatsQuery, error) {
+	if q.Interval == "" {
+		q.Interval = IntervalDay
+	}
+	if q.Interval != IntervalDay && q.Interval != IntervalWeek && q.Interval != IntervalMonth {
+		return q, ErrInvalidInterval
+	}
+
+	q.From, q.To = q.From.UTC(), q.To.UTC()
+	if !q.From.Before(q.To) {
+		return q, ErrInvalidRange
+	}
+	n := 0
+	for b := q.Interval.start(q.From); b.Before(q.To); b = q.Interval.next(b) {
+		if n++; n > MaxStatsBuckets {
+			return q, ErrInvalidRange
+		}
+	}
+
+	switch {
+	case q.TopUsers <= 0:
+		q.TopUsers = DefaultTopUsers
+	case q.TopUsers > MaxTopUsers:
+		q.TopUsers = MaxTopUsers
+	}
+	return q, nil
+}
+
+// StatsAccumulator builds Stats one sale at a time. Storages implementing
+// Aggregator can use it when they cannot push the aggregation further down.
+type StatsAccumulator struct {
+	q       StatsQuery
+	totals  Totals
+	buckets map[time.Time]*Totals
+	users   map[string]*UserVolume
+}
+
+// NewStatsAccumulator returns an empty accumulator for q. q must already be
+// valid, as Service.Stats hands it to Aggregator.Aggregate.
+func NewStatsAccumulator(q StatsQuery) *StatsAccumulator {
+	return &StatsAccumulator{
+		q:       q,
+		totals:  Totals{ByStatus: map[string]StatusTotals{}},
+		buckets: map[time.Time]*Totals{},
+		users:   map[string]*UserVolume{},
+	}
+}
+
+// Add counts s if the query matches it.
+func (a *StatsAccumulator) Add(s *Sales) {
+	if !a.q.Match(s) {
+		return
+	}
+
+	start := a.q.Interval.start(s.CreatedAt)
+	b, ok := a.buckets[start]
+	if !ok {
+		b = &Totals{ByStatus: map[string]StatusTotals{}}
+		a.buckets[start] = b
+	}
+	b.add(s)
+	a.totals.add(s)
+
+	u, ok := a.users[s.UserID]
+	if !ok {
+		u = &UserVolume{UserID: s.UserID}
+		a.users[s.UserID] = u
+	}
+	u.Count++
+	u.Amount += s.baseAmount()
+}
+
+// Stats returns the aggregated result.
+func (a *StatsAccumulator) Stats() *Stats {
+	stats := &Stats{
+		From:     a.q.From,
+		To:       a.q.To,
+		Interval: a.q.Interval,
+		Totals:   a.totals.finish(),
+		Buckets:  []Bucket{},
+		TopUsers: []UserVolume{},
+	}
+
+	for start := a.q.Interval.start(a.q.From); start.Before(a.q.To); start = a.q.Interval.next(start) {
+		t := Totals{ByStatus: map[string]StatusTotals{}}
+		if b, ok := a.buckets[start]; ok {
+			t = *b
+		}
+		stats.Buckets = append(stats.Buckets, Bucket{Start: start, Totals: t.finish()})
+	}
+
+	for _, u := range a.users {
+		stats.TopUsers = append(stats.TopUsers, *u)
+	}
+	sort.Slice(stats.TopUsers, func(i, j int) bool {
+		ui, uj := stats.TopUsers[i], stats.TopUsers[j]
+		if ui.Amount != uj.Amount {
+			return ui.Amount > uj.Amount
+		}
+		return ui.UserID < uj.UserID
+	})
+	if len(stats.TopUsers) > a.q.TopUsers {
+		stats.TopUsers = stats.TopUsers[:a.q.TopUsers]
+	}
+	return stats
+}
+
+func (t *Totals) add(s *Sales) {
+	t.Count++
+	t.Amount += s.baseAmount()
+	st := t.ByStatus[s.Status]
+	st.Count++
+	st.Amount += s.baseAmount()
+	t.ByStatus[s.Status] = st
+}
+
+// convert returns t with its amounts converted by c.
+func (t Totals) convert(c *Converter) Totals {
+	for status, st := range t.ByStatus {
+		st.Amount = c.fromBase(st.Amount)
+		t.ByStatus[status] = st
+	}
+	t.Amount = c.fromBase(t.Amount)
+	t.AverageTicket = c.fromBase(t.AverageTicket)
+	return t
+}
+
+// finish fills the derived fields of t.
+func (t Totals) finish() Totals {
+	if t.Count > 0 {
+		t.AverageTicket = t.Amount / float64(t.Count)
+	}
+	// Una venta devuelta se aprobo igual, devolverla no baja la tasa de aprobacion
+	approved := t.ByStatus["approved"].Count + t.ByStatus[StatusPartiallyRefunded].Count + t.ByStatus[StatusRefunded].Count
+	rejected := t.ByStatus["rejected"].Count
+	if decided := approved + rejected; decided > 0 {
+		t.ApprovalRate = float64(approved) / float64(decided)
+	}
+	return t
+}
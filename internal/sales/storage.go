@@ -1,6 +1,14 @@
 package sales
 
-import "errors"
+import (
+	"context"
+	"ej_final/internal/tracing"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
 
 // ErrNotFound is returned when a sale with the given ID is not found.
 var ErrNotFound = errors.New("sale not found")
@@ -14,79 +22,336 @@ var ErrInvalidAmount = errors.New("invalid amount")
 // ErrUserNotFound is returned when a user with the given ID is not found.
 var ErrUserNotFound = errors.New("user not found")
 
+// ErrUsersUnavailable is returned when the users API cannot tell whether a
+// user exists: it could not be reached or answered something other than
+// found or not found.
+var ErrUsersUnavailable = errors.New("users API unavailable")
+
+// ErrVersionConflict is returned when a sale was modified by someone else
+// since it was read.
+var ErrVersionConflict = errors.New("version conflict")
+
+// ItemError tells which element of a batch made a storage call fail.
+type ItemError struct {
+	Index int
+	Err   error
+}
+
+// Error implements the error interface.
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("item %d: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the error of the item.
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
 // Storage is the main interface for our storage layer.
+// Every method returns ctx.Err() if the context is already cancelled or past its deadline.
 type Storage interface {
-	Set(sales *Sales) error
-	Read(id string) (*Sales, error)
-	Delete(id string) error
-	GetAll(user_id string) ([]*Sales, error)
-	GetByStatus(user_id, status string) ([]*Sales, error)
+	Set(ctx context.Context, sales *Sales) error
+	Read(ctx context.Context, id string) (*Sales, error)
+	Delete(ctx context.Context, id string) error
+	Ping(ctx context.Context) error
+	GetAll(ctx context.Context, user_id string) ([]*Sales, error)
+	GetByStatus(ctx context.Context, user_id, status string) ([]*Sales, error)
+
+	// SetBatch stores every sale or none of them.
+	SetBatch(ctx context.Context, sales []*Sales) error
+
+	// SetVersioned updates existing sales with optimistic locking: each one must
+	// carry the stored Version plus one. Every sale is stored or none of them.
+	SetVersioned(ctx context.Context, sales []*Sales) error
+
+	// Iterate calls fn for every sale matching filter, oldest first, and stops
+	// at the first error fn returns. Sales are handed out one at a time so
+	// callers can stream them without holding the whole result.
+	Iterate(ctx context.Context, filter Filter, fn func(*Sales) error) error
+
+	// Summary returns the summary of the sales of userID, kept up to date by
+	// every write. A user without sales gets an empty summary.
+	Summary(ctx context.Context, userID string) (*Summary, error)
+
+	// RebuildSummaries recomputes every summary from the stored sales and
+	// returns how many users have one.
+	RebuildSummaries(ctx context.Context) (int, error)
+
+	// SetRefund stores a refund together with the sale it updates, with the
+	// same version check as SetVersioned. A refund with the ID of a stored
+	// one replaces it.
+	SetRefund(ctx context.Context, sale *Sales, refund *Refund) error
+
+	// UpdateRefund replaces a stored refund, leaving its sale as it is.
+	UpdateRefund(ctx context.Context, refund *Refund) error
+
+	// Refunds returns the refunds of a sale, oldest first.
+	Refunds(ctx context.Context, saleID string) ([]*Refund, error)
 }
 
 // LocalStorage provides an in-memory implementation for storing sales.
+// It is safe for concurrent use and keeps its own copies of the sales, so
+// callers must Set a sale again for their changes to be stored.
 type LocalStorage struct {
-	m map[string]*Sales
+	mu sync.RWMutex
+	m  map[string]*Sales
+
+	// summaries is the per-user projection, updated under the same lock as m
+	// so it always matches the stored sales.
+	summaries map[string]*Summary
+
+	// refunds holds the refunds of each sale by sale ID.
+	refunds map[string][]*Refund
 }
 
 // NewLocalStorage instantiates a new LocalStorage with an empty map.
 func NewLocalStorage() *LocalStorage {
 	return &LocalStorage{
-		m: map[string]*Sales{},
+		m:         map[string]*Sales{},
+		summaries: map[string]*Summary{},
+		refunds:   map[string][]*Refund{},
 	}
 }
 
 // Set stores or updates a sale in the local storage.
 // Returns ErrEmptyID if the sale has an empty ID.
-func (l *LocalStorage) Set(sales *Sales) error {
+func (l *LocalStorage) Set(ctx context.Context, sales *Sales) error {
+	ctx, span := tracing.Start(ctx, "sales.LocalStorage.Set")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	if sales.ID == "" {
 		return ErrEmptyID
 	}
 
-	l.m[sales.ID] = sales
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.put(sales.clone())
+	return nil
+}
+
+// SetBatch stores or updates all the given sales atomically: if any of them
+// has an empty ID nothing is stored and ErrEmptyID is returned.
+func (l *LocalStorage) SetBatch(ctx context.Context, sales []*Sales) error {
+	ctx, span := tracing.Start(ctx, "sales.LocalStorage.SetBatch")
+	defer span.End()
+	span.SetAttribute("batch.size", len(sales))
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for _, s := range sales {
+		if s.ID == "" {
+			return ErrEmptyID
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, s := range sales {
+		l.put(s.clone())
+	}
+	return nil
+}
+
+// SetVersioned updates all the given sales atomically, checking that each one
+// has the Version stored plus one.
+// Returns an *ItemError wrapping ErrNotFound or ErrVersionConflict for the
+// first sale that does not match; in that case nothing is stored.
+func (l *LocalStorage) SetVersioned(ctx context.Context, sales []*Sales) error {
+	ctx, span := tracing.Start(ctx, "sales.LocalStorage.SetVersioned")
+	defer span.End()
+	span.SetAttribute("batch.size", len(sales))
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, s := range sales {
+		stored, ok := l.m[s.ID]
+		if !ok {
+			return &ItemError{Index: i, Err: ErrNotFound}
+		}
+		if stored.Version+1 != s.Version {
+			return &ItemError{Index: i, Err: ErrVersionConflict}
+		}
+	}
+
+	for _, s := range sales {
+		l.put(s.clone())
+	}
 	return nil
 }
 
 // Read retrieves a sale from the local storage by ID.
 // Returns ErrNotFound if the sale is not found.
-func (l *LocalStorage) Read(id string) (*Sales, error) {
+func (l *LocalStorage) Read(ctx context.Context, id string) (*Sales, error) {
+	ctx, span := tracing.Start(ctx, "sales.LocalStorage.Read")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	s, ok := l.m[id]
 	if !ok {
 		return nil, ErrNotFound
 	}
 
-	return s, nil
+	return s.clone(), nil
 }
 
 // Delete removes a sale from the local storage by ID.
 // Returns ErrNotFound if the sale does not exist.
-func (l *LocalStorage) Delete(id string) error {
-	_, err := l.Read(id)
-	if err != nil {
+func (l *LocalStorage) Delete(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "sales.LocalStorage.Delete")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
 		return err
 	}
 
-	delete(l.m, id)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.m[id]; !ok {
+		return ErrNotFound
+	}
+
+	l.remove(id)
 	return nil
 }
 
 // GetAll retorna todas las ventas de un usuario dado su ID
-func (l *LocalStorage) GetAll(user_id string) ([]*Sales, error) {
+func (l *LocalStorage) GetAll(ctx context.Context, user_id string) ([]*Sales, error) {
+	ctx, span := tracing.Start(ctx, "sales.LocalStorage.GetAll")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	var sales []*Sales
 	for _, s := range l.m {
 		if s.UserID == user_id {
-			sales = append(sales, s)
+			sales = append(sales, s.clone())
 		}
 	}
 	return sales, nil
 }
 
 // GetByStatus returns todas las ventas de un usuario dado su ID y filtrando por estado
-func (l *LocalStorage) GetByStatus(user_id, status string) ([]*Sales, error) {
+func (l *LocalStorage) GetByStatus(ctx context.Context, user_id, status string) ([]*Sales, error) {
+	ctx, span := tracing.Start(ctx, "sales.LocalStorage.GetByStatus")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	var sales []*Sales
 	for _, s := range l.m {
 		if s.UserID == user_id && s.Status == status {
-			sales = append(sales, s)
+			sales = append(sales, s.clone())
 		}
 	}
 	return sales, nil
 }
+
+// Iterate walks the sales matching filter ordered by CreatedAt and ID.
+// Only the keys are collected under the lock; each sale is copied right
+// before fn is called, and sales deleted in the meantime are skipped.
+func (l *LocalStorage) Iterate(ctx context.Context, filter Filter, fn func(*Sales) error) error {
+	ctx, span := tracing.Start(ctx, "sales.LocalStorage.Iterate")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	type key struct {
+		createdAt time.Time
+		id        string
+	}
+	l.mu.RLock()
+	var keys []key
+	for _, s := range l.m {
+		if filter.Match(s) {
+			keys = append(keys, key{s.CreatedAt, s.ID})
+		}
+	}
+	l.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].createdAt.Equal(keys[j].createdAt) {
+			return keys[i].createdAt.Before(keys[j].createdAt)
+		}
+		return keys[i].id < keys[j].id
+	})
+
+	for _, k := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		l.mu.RLock()
+		s, ok := l.m[k.id]
+		if ok {
+			s = s.clone()
+		}
+		l.mu.RUnlock()
+
+		if !ok || !filter.Match(s) {
+			continue
+		}
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	span.SetAttribute("sales.count", len(keys))
+	return nil
+}
+
+// Aggregate implements Aggregator: it feeds every sale to a
+// StatsAccumulator under the read lock, without copying them.
+func (l *LocalStorage) Aggregate(ctx context.Context, q StatsQuery) (*Stats, error) {
+	ctx, span := tracing.Start(ctx, "sales.LocalStorage.Aggregate")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	acc := NewStatsAccumulator(q)
+	for _, s := range l.m {
+		acc.Add(s)
+	}
+	return acc.Stats(), nil
+}
+
+// Ping reports whether the storage is reachable. The in-memory storage always
+// is, so it only fails when ctx is done.
+func (l *LocalStorage) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
@@ -0,0 +1,282 @@
+package sales
+
+import (
+	"context"
+	"ej_final/internal/logging"
+	"ej_final/internal/tracing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Summary is the running projection of the sales of a user, so reading it
+// does not depend on how many sales the user has. Amounts are in the base
+// currency, each sale converted with the rate it was created with.
+type Summary struct {
+	UserID      string         `json:"user_id"`
+	Count       int            `json:"count"`
+	ByStatus    map[string]int `json:"by_status"`
+	TotalAmount float64        `json:"total_amount"`
+
+	// RefundedAmount is the sum of the refunds of the sales.
+	RefundedAmount float64 `json:"refunded_amount"`
+
+	// Currency is the base currency, empty when the Service has no
+	// RateProvider. Set by Service.Summary, storages leave it empty.
+	Currency string `json:"currency,omitempty"`
+
+	// LastSaleAt is the CreatedAt of the newest sale, nil without sales.
+	LastSaleAt *time.Time `json:"last_sale_at"`
+
+	// totals are the amounts of the sales of each status, for Totals.
+	totals map[string]*SummaryTotals
+}
+
+// SummaryTotals are the amounts of a set of sales in the base currency. The
+// sales without tax breakdown count their whole amount as net.
+type SummaryTotals struct {
+	Count    int
+	Amount   float64
+	Refunded float64
+	Net      float64
+	Tax      float64
+	Taxes    map[string]float64
+}
+
+// count adds s to t, or takes it out when sign is -1.
+func (t *SummaryTotals) count(s *Sales, sign float64) {
+	t.Count += int(sign)
+	t.Amount += sign * s.baseAmount()
+	t.Refunded += sign * s.baseRefunded()
+	if s.Taxes == nil {
+		t.Net += sign * s.baseAmount()
+		return
+	}
+	t.Net += sign * float64(s.Taxes.Net) * s.rate()
+	t.Tax += sign * float64(s.Taxes.Tax) * s.rate()
+	for _, l := range s.Taxes.Lines {
+		t.Taxes[l.Name] += sign * float64(l.Amount) * s.rate()
+	}
+}
+
+func (t *SummaryTotals) merge(other *SummaryTotals) {
+	t.Count += other.Count
+	t.Amount += other.Amount
+	t.Refunded += other.Refunded
+	t.Net += other.Net
+	t.Tax += other.Tax
+	for name, amount := range other.Taxes {
+		t.Taxes[name] += amount
+	}
+}
+
+// newSummary returns an empty summary with every known status at zero.
+func newSummary(userID string) *Summary {
+	sum := &Summary{UserID: userID, ByStatus: map[string]int{}, totals: map[string]*SummaryTotals{}}
+	for _, st := range knownStatuses {
+		sum.ByStatus[st] = 0
+	}
+	return sum
+}
+
+// Totals returns the amounts of the sales with status, or of every sale of
+// the user when status is empty.
+func (sum *Summary) Totals(status string) SummaryTotals {
+	t := SummaryTotals{Taxes: map[string]float64{}}
+	for st, other := range sum.totals {
+		if status == "" || st == status {
+			t.merge(other)
+		}
+	}
+	return t
+}
+
+// clone returns a copy of sum that shares no mutable state with it.
+func (sum *Summary) clone() *Summary {
+	c := *sum
+	c.ByStatus = make(map[string]int, len(sum.ByStatus))
+	for st, n := range sum.ByStatus {
+		c.ByStatus[st] = n
+	}
+	if sum.LastSaleAt != nil {
+		t := *sum.LastSaleAt
+		c.LastSaleAt = &t
+	}
+	c.totals = make(map[string]*SummaryTotals, len(sum.totals))
+	for st, t := range sum.totals {
+		ct := SummaryTotals{Taxes: map[string]float64{}}
+		ct.merge(t)
+		c.totals[st] = &ct
+	}
+	return &c
+}
+
+// count adds s to the totals of sum, or takes it out when sign is -1.
+// LastSaleAt is left to the caller.
+func (sum *Summary) count(s *Sales, sign float64) {
+	sum.Count += int(sign)
+	sum.ByStatus[s.Status] += int(sign)
+	sum.TotalAmount += sign * s.baseAmount()
+	sum.RefundedAmount += sign * s.baseRefunded()
+
+	t, ok := sum.totals[s.Status]
+	if !ok {
+		t = &SummaryTotals{Taxes: map[string]float64{}}
+		sum.totals[s.Status] = t
+	}
+	t.count(s, sign)
+	if t.Count == 0 {
+		// Sin ventas en ese estado se descarta, asi no se arrastran restos de redondeo
+		delete(sum.totals, s.Status)
+	}
+}
+
+func (sum *Summary) add(s *Sales) {
+	sum.count(s, 1)
+	if sum.LastSaleAt == nil || s.CreatedAt.After(*sum.LastSaleAt) {
+		t := s.CreatedAt
+		sum.LastSaleAt = &t
+	}
+}
+
+// Summary returns the sales summary of userID.
+// Returns ErrEmptyID if userID is empty.
+func (s *Service) Summary(ctx context.Context, userID string) (*Summary, error) {
+	ctx, span := tracing.Start(ctx, "sales.Service.Summary")
+	defer span.End()
+
+	if userID == "" {
+		return nil, ErrEmptyID
+	}
+
+	sum, err := s.storage.Summary(ctx, userID)
+	if err != nil {
+		logging.FromContext(ctx, s.logger).Error("Error obteniendo el resumen de ventas",
+			zap.String("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+	if s.rates != nil {
+		sum.Currency = s.rates.Base()
+	}
+	return sum, nil
+}
+
+// RebuildSummaries recomputes the summaries of every user from the stored
+// sales, to repair them or after loading sales by other means.
+// It returns how many users have a summary.
+func (s *Service) RebuildSummaries(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "sales.Service.RebuildSummaries")
+	defer span.End()
+
+	log := logging.FromContext(ctx, s.logger)
+
+	n, err := s.storage.RebuildSummaries(ctx)
+	if err != nil {
+		log.Error("Error reconstruyendo los resumenes de ventas", zap.Error(err))
+		return 0, err
+	}
+
+	log.Info("Resumenes de ventas reconstruidos", zap.Int("users", n))
+	return n, nil
+}
+
+// Summary implements Storage.
+func (l *LocalStorage) Summary(ctx context.Context, userID string) (*Summary, error) {
+	ctx, span := tracing.Start(ctx, "sales.LocalStorage.Summary")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if sum, ok := l.summaries[userID]; ok {
+		return sum.clone(), nil
+	}
+	return newSummary(userID), nil
+}
+
+// RebuildSummaries implements Storage.
+func (l *LocalStorage) RebuildSummaries(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "sales.LocalStorage.RebuildSummaries")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.summaries = map[string]*Summary{}
+	for _, s := range l.m {
+		l.summarize(s)
+	}
+	return len(l.summaries), nil
+}
+
+// put stores s, which must already be a copy, and updates the summaries.
+// The caller must hold the write lock.
+func (l *LocalStorage) put(s *Sales) {
+	old, ok := l.m[s.ID]
+	l.m[s.ID] = s
+	if ok && old.UserID == s.UserID && old.CreatedAt.Equal(s.CreatedAt) {
+		// El caso comun (un cambio de estado): LastSaleAt no cambia, solo se corren los totales
+		sum := l.summaries[s.UserID]
+		sum.count(old, -1)
+		sum.count(s, 1)
+		return
+	}
+	if ok {
+		l.unsummarize(old)
+	}
+	l.summarize(s)
+}
+
+// remove deletes the sale id with its refunds and updates the summaries.
+// The caller must hold the write lock.
+func (l *LocalStorage) remove(id string) {
+	if old, ok := l.m[id]; ok {
+		delete(l.m, id)
+		delete(l.refunds, id)
+		l.unsummarize(old)
+	}
+}
+
+func (l *LocalStorage) summarize(s *Sales) {
+	sum, ok := l.summaries[s.UserID]
+	if !ok {
+		sum = newSummary(s.UserID)
+		l.summaries[s.UserID] = sum
+	}
+	sum.add(s)
+}
+
+// unsummarize takes s out of the summary of its user. If s was the newest
+// sale, LastSaleAt is recomputed from the other sales of the user.
+func (l *LocalStorage) unsummarize(s *Sales) {
+	sum, ok := l.summaries[s.UserID]
+	if !ok {
+		return
+	}
+
+	sum.count(s, -1)
+	if sum.Count == 0 {
+		delete(l.summaries, s.UserID)
+		return
+	}
+
+	if sum.LastSaleAt != nil && s.CreatedAt.Equal(*sum.LastSaleAt) {
+		// Era la venta mas nueva, hay que buscar la siguiente (solo pasa al borrar o reescribir esa venta)
+		sum.LastSaleAt = nil
+		for _, other := range l.m {
+			if other.UserID == s.UserID && other != s &&
+				(sum.LastSaleAt == nil || other.CreatedAt.After(*sum.LastSaleAt)) {
+				t := other.CreatedAt
+				sum.LastSaleAt = &t
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package sales
+
+import (
+	"context"
+	"ej_final/internal/tax"
+	"errors"
+)
+
+// ErrNoTaxes is returned for a sale with a Jurisdiction when the Service has
+// no TaxCalculator.
+var ErrNoTaxes = errors.New("tax calculator not available")
+
+// TaxCalculator computes the taxes of a sale. It is implemented by *tax.Table.
+type TaxCalculator interface {
+	// Jurisdiction derives the jurisdiction of an address, "" for the default.
+	Jurisdiction(address string) string
+
+	// Compute splits amount in net and taxes with the rules of jurisdiction.
+	Compute(ctx context.Context, jurisdiction string, amount float32) (*tax.Breakdown, error)
+}
+
+// WithTaxes makes the Service compute the taxes of the sales it creates with c.
+func WithTaxes(c TaxCalculator) Option {
+	return func(s *Service) {
+		s.taxes = c
+	}
+}
+
+// applyTaxes computes the taxes of sale in its Jurisdiction, or in the one of
+// address if it has none, and sets Amount to the gross amount. Without a
+// TaxCalculator the sale is left untaxed.
+// Returns ErrNoTaxes if the sale asks for a jurisdiction but there is no
+// TaxCalculator, or the error of the TaxCalculator.
+func (s *Service) applyTaxes(ctx context.Context, sale *Sales, address string) error {
+	if s.taxes == nil {
+		if sale.Jurisdiction != "" {
+			return ErrNoTaxes
+		}
+		return nil
+	}
+
+	if sale.Jurisdiction == "" {
+		sale.Jurisdiction = s.taxes.Jurisdiction(address)
+	}
+	b, err := s.taxes.Compute(ctx, sale.Jurisdiction, sale.Amount)
+	if err != nil {
+		return err
+	}
+	sale.Taxes = b
+	sale.Amount = b.Gross
+	return nil
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"context"
+	"ej_final/internal/sales"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newUsersServer simula el API de usuarios: existen los IDs dados y cuenta las consultas por ID.
+func newUsersServer(t *testing.T, existing ...string) (*httptest.Server, map[string]int, *sync.Mutex) {
+	var mu sync.Mutex
+	calls := map[string]int{}
+	ok := map[string]bool{}
+	for _, id := range existing {
+		ok[id] = true
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/users/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/v1/users/")
+		mu.Lock()
+		calls[id]++
+		mu.Unlock()
+		if !ok[id] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, calls, &mu
+}
+
+func TestService_CreateBatch_BestEffort(t *testing.T) {
+	server, calls, _ := newUsersServer(t, "ana", "beto")
+	storage := sales.NewLocalStorage()
+	s := sales.NewService(storage, zap.NewNop(), server.URL)
+
+	items := []*sales.Sales{
+		{UserID: "ana", Amount: 10},
+		{UserID: "beto", Amount: 20},
+		{UserID: "ana", Amount: 0},
+		{UserID: "nadie", Amount: 5},
+		{UserID: "ana", Amount: 30},
+	}
+	results, err := s.CreateBatch(context.Background(), items, sales.BatchBestEffort)
+	require.NoError(t, err)
+	require.Len(t, results, 5)
+
+	require.NotNil(t, results[0].Sale)
+	require.NotNil(t, results[1].Sale)
+	require.ErrorIs(t, results[2].Err, sales.ErrInvalidAmount)
+	require.ErrorIs(t, results[3].Err, sales.ErrUserNotFound)
+	require.NotNil(t, results[4].Sale)
+	for i, r := range results {
+		require.Equal(t, i, r.Index)
+	}
+
+	// Un solo lookup por usuario distinto
+	require.Equal(t, map[string]int{"ana": 1, "beto": 1, "nadie": 1}, calls)
+
+	list, err := storage.GetAll(context.Background(), "ana")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+}
+
+func TestService_CreateBatch_AllOrNothing(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	storage := sales.NewLocalStorage()
+	s := sales.NewService(storage, zap.NewNop(), server.URL)
+
+	items := []*sales.Sales{
+		{UserID: "ana", Amount: 10},
+		{UserID: "nadie", Amount: 5},
+	}
+	results, err := s.CreateBatch(context.Background(), items, sales.BatchAllOrNothing)
+	require.NoError(t, err)
+	require.ErrorIs(t, results[0].Err, sales.ErrBatchAborted)
+	require.Nil(t, results[0].Sale)
+	require.ErrorIs(t, results[1].Err, sales.ErrUserNotFound)
+
+	list, err := storage.GetAll(context.Background(), "ana")
+	require.NoError(t, err)
+	require.Empty(t, list)
+
+	results, err = s.CreateBatch(context.Background(), items[:1], sales.BatchAllOrNothing)
+	require.NoError(t, err)
+	require.NoError(t, results[0].Err)
+	require.NotEmpty(t, results[0].Sale.ID)
+}
+
+func TestService_CreateBatch_InvalidBatch(t *testing.T) {
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), "http://localhost:0")
+	ctx := context.Background()
+
+	_, err := s.CreateBatch(ctx, nil, sales.BatchBestEffort)
+	require.ErrorIs(t, err, sales.ErrEmptyBatch)
+
+	_, err = s.CreateBatch(ctx, make([]*sales.Sales, sales.MaxBatchSize+1), sales.BatchBestEffort)
+	require.ErrorIs(t, err, sales.ErrBatchTooLarge)
+
+	_, err = s.CreateBatch(ctx, []*sales.Sales{{}}, "sometimes")
+	require.ErrorIs(t, err, sales.ErrInvalidBatchMode)
+}
+
+// batchResponse es la respuesta de POST /sales/batch y PATCH /sales.
+type batchResponse struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Failed  int `json:"failed"`
+	Results []struct {
+		Index  int          `json:"index"`
+		Status string       `json:"status"`
+		Sale   *sales.Sales `json:"sale"`
+		Error  *struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	} `json:"results"`
+}
+
+func TestService_Integracion_CreateBatch(t *testing.T) {
+	r := newRouter(t)
+	userID := createUser(t, r, "Juancito")
+	items := []map[string]any{{"user_id": userID, "amount": 1}, {"user_id": "nope", "amount": 2}}
+
+	rec := call(r, http.MethodPost, "/v1/sales/batch", map[string]any{"mode": "best_effort", "items": items})
+	require.Equal(t, http.StatusOK, rec.Code)
+	var res batchResponse
+	decode(t, rec, &res)
+	require.Equal(t, 1, res.Created)
+	require.Equal(t, 1, res.Failed)
+	require.Equal(t, "created", res.Results[0].Status)
+	require.Equal(t, float32(1), res.Results[0].Sale.Amount)
+	require.Equal(t, "failed", res.Results[1].Status)
+	require.Equal(t, "unknown_user", res.Results[1].Error.Code)
+
+	// Sin modo es all_or_nothing: el item valido tampoco se crea
+	rec = call(r, http.MethodPost, "/v1/sales/batch", map[string]any{"items": items})
+	res = batchResponse{}
+	decode(t, rec, &res)
+	require.Zero(t, res.Created)
+	require.Equal(t, "batch_aborted", res.Results[0].Error.Code)
+	require.Equal(t, "unknown_user", res.Results[1].Error.Code)
+}
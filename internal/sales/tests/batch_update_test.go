@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"context"
+	"ej_final/internal/payment"
+	"ej_final/internal/sales"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// seedSales guarda ventas con el estado dado y version 1, para probar las transiciones.
+func seedSales(t *testing.T, storage sales.Storage, status map[string]string) {
+	for id, st := range status {
+		require.NoError(t, storage.Set(context.Background(), &sales.Sales{ID: id, UserID: "ana", Amount: 10, Status: st, Version: 1}))
+	}
+}
+
+func TestService_UpdateBatch_BestEffort(t *testing.T) {
+	storage := sales.NewLocalStorage()
+	seedSales(t, storage, map[string]string{"a": "pending", "b": "pending", "c": "approved", "d": "pending"})
+	s := sales.NewService(storage, zap.NewNop(), "http://localhost:0")
+
+	results, err := s.UpdateBatch(context.Background(), []sales.StatusChange{
+		{ID: "a", Status: "approved", Version: 1},
+		{ID: "nope", Status: "approved"},
+		{ID: "c", Status: "rejected"},
+		{ID: "d", Status: "approved", Version: 7},
+		{ID: "b", Status: "rejected"},
+		{ID: "a", Status: "rejected"},
+	}, sales.BatchBestEffort)
+	require.NoError(t, err)
+	require.Len(t, results, 6)
+
+	require.NoError(t, results[0].Err)
+	require.Equal(t, 2, results[0].Sale.Version)
+	require.ErrorIs(t, results[1].Err, sales.ErrNotFound)
+	require.ErrorIs(t, results[2].Err, sales.ErrInvalidTransition)
+	require.ErrorIs(t, results[3].Err, sales.ErrVersionConflict)
+	require.NoError(t, results[4].Err)
+	// La segunda transicion de "a" ve el estado que dejo la primera
+	require.ErrorIs(t, results[5].Err, sales.ErrInvalidTransition)
+
+	a, err := storage.Read(context.Background(), "a")
+	require.NoError(t, err)
+	require.Equal(t, "approved", a.Status)
+	d, err := storage.Read(context.Background(), "d")
+	require.NoError(t, err)
+	require.Equal(t, "pending", d.Status)
+}
+
+func TestService_UpdateBatch_AllOrNothing(t *testing.T) {
+	storage := sales.NewLocalStorage()
+	seedSales(t, storage, map[string]string{"a": "pending", "b": "pending"})
+	s := sales.NewService(storage, zap.NewNop(), "http://localhost:0")
+
+	results, err := s.UpdateBatch(context.Background(), []sales.StatusChange{
+		{ID: "a", Status: "approved"},
+		{ID: "b", Status: "approved", Version: 2},
+	}, sales.BatchAllOrNothing)
+	require.NoError(t, err)
+	require.ErrorIs(t, results[0].Err, sales.ErrBatchAborted)
+	require.Nil(t, results[0].Sale)
+	require.ErrorIs(t, results[1].Err, sales.ErrVersionConflict)
+
+	a, err := storage.Read(context.Background(), "a")
+	require.NoError(t, err)
+	require.Equal(t, "pending", a.Status)
+	require.Equal(t, 1, a.Version)
+
+	results, err = s.UpdateBatch(context.Background(), []sales.StatusChange{
+		{ID: "a", Status: "approved", Version: 1},
+		{ID: "b", Status: "rejected", Version: 1},
+	}, sales.BatchAllOrNothing)
+	require.NoError(t, err)
+	require.NoError(t, results[0].Err)
+	require.NoError(t, results[1].Err)
+
+	b, err := storage.Read(context.Background(), "b")
+	require.NoError(t, err)
+	require.Equal(t, "rejected", b.Status)
+	require.Equal(t, 2, b.Version)
+}
+
+func TestService_UpdateBatch_InvalidBatch(t *testing.T) {
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), "http://localhost:0")
+	ctx := context.Background()
+
+	_, err := s.UpdateBatch(ctx, nil, sales.BatchBestEffort)
+	require.ErrorIs(t, err, sales.ErrEmptyBatch)
+
+	_, err = s.UpdateBatch(ctx, make([]sales.StatusChange, sales.MaxBatchSize+1), sales.BatchBestEffort)
+	require.ErrorIs(t, err, sales.ErrBatchTooLarge)
+
+	_, err = s.UpdateBatch(ctx, []sales.StatusChange{{ID: "a"}}, "sometimes")
+	require.ErrorIs(t, err, sales.ErrInvalidBatchMode)
+}
+
+func TestLocalStorage_SetVersioned(t *testing.T) {
+	storage := sales.NewLocalStorage()
+	seedSales(t, storage, map[string]string{"a": "pending", "b": "pending"})
+	ctx := context.Background()
+
+	err := storage.SetVersioned(ctx, []*sales.Sales{
+		{ID: "a", Status: "approved", Version: 2},
+		{ID: "b", Status: "approved", Version: 3},
+	})
+	var itemErr *sales.ItemError
+	require.ErrorAs(t, err, &itemErr)
+	require.Equal(t, 1, itemErr.Index)
+	require.ErrorIs(t, err, sales.ErrVersionConflict)
+
+	// Nada se escribio
+	a, err := storage.Read(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, "pending", a.Status)
+
+	err = storage.SetVersioned(ctx, []*sales.Sales{{ID: "nope", Version: 2}})
+	require.ErrorIs(t, err, sales.ErrNotFound)
+}
+
+func TestService_Integracion_UpdateBatch(t *testing.T) {
+	// Con el gateway simulado las ventas arrancan pendientes, sin el el estado es al azar
+	gateway := httptest.NewServer(payment.NewStub(time.Second))
+	defer gateway.Close()
+	t.Setenv("PAYMENT_GATEWAY_URL", gateway.URL)
+	r := newRouter(t)
+	userID := createUser(t, r, "Juancito")
+
+	rec := call(r, http.MethodPost, "/v1/sales", map[string]any{"user_id": userID, "amount": 10})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var sale sales.Sales
+	decode(t, rec, &sale)
+
+	items := []map[string]any{{"id": sale.ID, "status": "approved", "version": sale.Version}, {"id": "nope", "status": "approved"}}
+	rec = call(r, http.MethodPatch, "/v1/sales", map[string]any{"mode": "best_effort", "items": items})
+	require.Equal(t, http.StatusOK, rec.Code)
+	var res batchResponse
+	decode(t, rec, &res)
+	require.Equal(t, 1, res.Updated)
+	require.Equal(t, 1, res.Failed)
+	require.Equal(t, "approved", res.Results[0].Sale.Status)
+	require.Equal(t, sale.Version+1, res.Results[0].Sale.Version)
+	require.Equal(t, "sale_not_found", res.Results[1].Error.Code)
+
+	// La misma version otra vez ya no es la guardada
+	rec = call(r, http.MethodPatch, "/v1/sales", map[string]any{"mode": "best_effort", "items": items[:1]})
+	require.Equal(t, http.StatusOK, rec.Code)
+	res = batchResponse{}
+	decode(t, rec, &res)
+	require.Equal(t, "version_conflict", res.Results[0].Error.Code)
+}
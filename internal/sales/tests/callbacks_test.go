@@ -0,0 +1,237 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ej_final/internal/payment"
+	"ej_final/internal/sales"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// callbackFor arma el callback del gateway para la venta.
+func callbackFor(sale *sales.Sales, status string) *payment.Callback {
+	return &payment.Callback{EventID: "evt-" + status, TransactionID: sale.PaymentID, Reference: sale.ID, Status: status}
+}
+
+func TestService_ApplyPayment(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	catalog, productID := newCatalog(t, 10)
+	gateway := payment.NewFake()
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), server.URL,
+		sales.WithPayments(gateway), sales.WithCatalog(catalog))
+	ctx := context.Background()
+
+	sale := createPending(t, s, productID, 2)
+	outcome, err := s.ApplyPayment(ctx, callbackFor(sale, payment.StatusAuthorized))
+	require.NoError(t, err)
+	require.False(t, outcome.Applied)
+	require.Equal(t, "pending", outcome.Sale.Status)
+
+	// El cobro confirmado aprueba la venta como un PATCH
+	outcome, err = s.ApplyPayment(ctx, callbackFor(sale, payment.StatusCaptured))
+	require.NoError(t, err)
+	require.True(t, outcome.Applied)
+	require.Equal(t, "approved", outcome.Sale.Status)
+	require.Equal(t, sale.Version+1, outcome.Sale.Version)
+	require.Equal(t, payment.StatusCaptured, paymentStatus(t, gateway, sale))
+	require.Equal(t, 8, stockOf(t, catalog, productID))
+
+	// Repetido o atrasado no cambia nada, pero el rechazo contradice la venta aprobada
+	for _, status := range []string{payment.StatusCaptured, payment.StatusDeclined} {
+		outcome, err = s.ApplyPayment(ctx, callbackFor(sale, status))
+		require.NoError(t, err)
+		require.False(t, outcome.Applied)
+		require.Equal(t, status == payment.StatusDeclined, outcome.Conflict)
+		require.Equal(t, "approved", outcome.Sale.Status)
+		require.Equal(t, sale.Version+1, outcome.Sale.Version)
+	}
+
+	// Anulado en el gateway: se rechaza y se devuelve el stock
+	sale = createPending(t, s, productID, 3)
+	outcome, err = s.ApplyPayment(ctx, callbackFor(sale, payment.StatusVoided))
+	require.NoError(t, err)
+	require.True(t, outcome.Applied)
+	require.Equal(t, "rejected", outcome.Sale.Status)
+	require.Zero(t, reservedOf(t, catalog, productID))
+	outcome, err = s.ApplyPayment(ctx, callbackFor(sale, payment.StatusCaptured))
+	require.NoError(t, err)
+	require.True(t, outcome.Conflict)
+	require.Equal(t, "rejected", outcome.Sale.Status)
+
+	other := createPending(t, s, productID, 1)
+	cb := callbackFor(other, payment.StatusCaptured)
+	cb.TransactionID = sale.PaymentID
+	_, err = s.ApplyPayment(ctx, cb)
+	require.ErrorIs(t, err, sales.ErrPaymentMismatch)
+
+	cb.Reference = "no-existe"
+	_, err = s.ApplyPayment(ctx, cb)
+	require.ErrorIs(t, err, sales.ErrNotFound)
+}
+
+func TestService_ApplyPayment_Sequence(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	gateway := payment.NewFake()
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), server.URL, sales.WithPayments(gateway))
+	ctx := context.Background()
+
+	sale := &sales.Sales{UserID: "ana", Amount: 10}
+	require.NoError(t, s.Create(ctx, sale))
+	captured := callbackFor(sale, payment.StatusCaptured)
+	captured.Sequence = 2
+	outcome, err := s.ApplyPayment(ctx, captured)
+	require.NoError(t, err)
+	require.True(t, outcome.Applied)
+	require.Equal(t, int64(2), outcome.Sale.PaymentSequence)
+
+	// El rechazo que el gateway mando antes del cobro llega tarde: no es un conflicto
+	declined := callbackFor(sale, payment.StatusDeclined)
+	declined.Sequence = 1
+	outcome, err = s.ApplyPayment(ctx, declined)
+	require.NoError(t, err)
+	require.False(t, outcome.Applied)
+	require.False(t, outcome.Conflict)
+	require.Equal(t, "approved", outcome.Sale.Status)
+
+	// Anulado despues del cobro: la venta queda aprobada y se avisa
+	voided := callbackFor(sale, payment.StatusVoided)
+	voided.Sequence = 3
+	outcome, err = s.ApplyPayment(ctx, voided)
+	require.NoError(t, err)
+	require.False(t, outcome.Applied)
+	require.True(t, outcome.Conflict)
+	require.Equal(t, "approved", outcome.Sale.Status)
+	require.Equal(t, int64(2), outcome.Sale.PaymentSequence)
+
+	// Lo mismo con una venta cancelada que despues se cobro
+	sale = &sales.Sales{UserID: "ana", Amount: 10}
+	require.NoError(t, s.Create(ctx, sale))
+	_, err = s.Cancel(ctx, sale.ID, "se arrepintio")
+	require.NoError(t, err)
+	captured = callbackFor(sale, payment.StatusCaptured)
+	captured.Sequence = 5
+	outcome, err = s.ApplyPayment(ctx, captured)
+	require.NoError(t, err)
+	require.True(t, outcome.Conflict)
+	require.Equal(t, sales.StatusCancelled, outcome.Sale.Status)
+	voided = callbackFor(sale, payment.StatusVoided)
+	outcome, err = s.ApplyPayment(ctx, voided)
+	require.NoError(t, err)
+	require.False(t, outcome.Conflict)
+}
+
+// cancelBeforeUpdate cancela la venta justo antes de la primera escritura
+// versionada, como si otro pedido ganara la carrera.
+type cancelBeforeUpdate struct {
+	sales.Storage
+	done    bool
+	service *sales.Service
+	t       *testing.T
+}
+
+func (c *cancelBeforeUpdate) SetVersioned(ctx context.Context, ss []*sales.Sales) error {
+	if !c.done {
+		c.done = true
+		_, err := c.service.Cancel(ctx, ss[0].ID, "se arrepintio")
+		require.NoError(c.t, err)
+	}
+	return c.Storage.SetVersioned(ctx, ss)
+}
+
+func TestService_ApplyPayment_Concurrent(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	gateway := payment.NewFake()
+	storage := &cancelBeforeUpdate{Storage: sales.NewLocalStorage(), t: t}
+	s := sales.NewService(storage, zap.NewNop(), server.URL, sales.WithPayments(gateway))
+	storage.service = s
+	ctx := context.Background()
+
+	sale := &sales.Sales{UserID: "ana", Amount: 10}
+	require.NoError(t, s.Create(ctx, sale))
+
+	// La version cambio entre la lectura y la escritura: se vuelve a mirar y ya no esta pendiente
+	outcome, err := s.ApplyPayment(ctx, callbackFor(sale, payment.StatusDeclined))
+	require.NoError(t, err)
+	require.False(t, outcome.Applied)
+	require.Equal(t, sales.StatusCancelled, outcome.Sale.Status)
+	require.Equal(t, sale.Version+1, outcome.Sale.Version)
+}
+
+func TestService_Integracion_Callbacks(t *testing.T) {
+	gateway := httptest.NewServer(payment.NewStub(time.Second))
+	defer gateway.Close()
+	t.Setenv("PAYMENT_GATEWAY_URL", gateway.URL)
+	t.Setenv("PAYMENT_CALLBACK_SECRET", "secreto")
+	verifier := payment.NewVerifier("secreto")
+	r := newRouter(t)
+	userID := createUser(t, r, "Juancito")
+
+	// Los callbacks del gateway van firmados sobre el body crudo
+	send := func(cb payment.Callback, signature string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(cb)
+		if signature == "" {
+			signature = verifier.Sign(body)
+		}
+		req, _ := http.NewRequest(http.MethodPost, "/v1/payments/callback", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(payment.SignatureHeader, signature)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	var res struct {
+		Applied  bool        `json:"applied"`
+		Conflict bool        `json:"conflict"`
+		Sale     sales.Sales `json:"sale"`
+	}
+
+	rec := call(r, http.MethodPost, "/v1/sales", map[string]any{"user_id": userID, "amount": 4})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var sale sales.Sales
+	decode(t, rec, &sale)
+
+	captured := payment.Callback{EventID: "evt-1", TransactionID: sale.PaymentID, Reference: sale.ID, Status: payment.StatusCaptured}
+	rec = send(captured, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	decode(t, rec, &res)
+	require.True(t, res.Applied)
+	require.Equal(t, "approved", res.Sale.Status)
+
+	// El mismo evento otra vez no se aplica de nuevo
+	rec = send(captured, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	res.Applied = true
+	decode(t, rec, &res)
+	require.False(t, res.Applied)
+
+	// Un voided posterior contradice la venta aprobada: se informa y no se aplica
+	voided := captured
+	voided.Status, voided.Sequence = payment.StatusVoided, 3
+	rec = send(voided, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	decode(t, rec, &res)
+	require.True(t, res.Conflict)
+	require.Equal(t, "approved", res.Sale.Status)
+
+	rec = send(captured, "sha256=00")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Equal(t, "invalid_signature", problemCode(t, rec))
+
+	unknown := captured
+	unknown.Reference = "nope"
+	rec = send(unknown, "")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Equal(t, "sale_not_found", problemCode(t, rec))
+
+	rec = send(payment.Callback{TransactionID: "otra", Reference: sale.ID, Status: payment.StatusAuthorized}, "")
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.Equal(t, "payment_mismatch", problemCode(t, rec))
+}
@@ -0,0 +1,190 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ej_final/internal/coupon"
+	"ej_final/internal/payment"
+	"ej_final/internal/sales"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newCoupons arma un servicio de cupones con los cupones dados.
+func newCoupons(t *testing.T, coupons ...*coupon.Coupon) *coupon.Service {
+	s := coupon.NewService(coupon.NewLocalStorage(), zap.NewNop())
+	for _, c := range coupons {
+		require.NoError(t, s.Create(context.Background(), c))
+	}
+	return s
+}
+
+func usesOf(t *testing.T, coupons *coupon.Service, code string) int {
+	c, err := coupons.Get(context.Background(), code)
+	require.NoError(t, err)
+	return c.Uses
+}
+
+func TestService_Create_WithCoupons(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	coupons := newCoupons(t,
+		&coupon.Coupon{Code: "DIEZ", Kind: coupon.KindPercentage, Value: 10, Stackable: true},
+		&coupon.Coupon{Code: "DOS", Kind: coupon.KindFixed, Value: 2, Stackable: true})
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), server.URL, sales.WithCoupons(coupons))
+	ctx := context.Background()
+
+	// Solo las ventas no rechazadas siguen usando el cupon
+	used := 0
+	for i := 0; i < 20; i++ {
+		sale := &sales.Sales{UserID: "ana", Amount: 22, CouponCodes: []string{"dos", "diez"}}
+		require.NoError(t, s.Create(ctx, sale))
+		require.Equal(t, []string{"DOS", "DIEZ"}, sale.CouponCodes)
+		require.Equal(t, float32(22), sale.OriginalAmount)
+		require.Equal(t, float32(4), sale.Discount)
+		require.Equal(t, float32(18), sale.Amount)
+		if sale.Status != "rejected" {
+			used++
+		}
+		require.Equal(t, used, usesOf(t, coupons, "DIEZ"))
+
+		// Rechazar una pendiente devuelve el uso
+		if sale.Status == "pending" {
+			_, err := s.Update(ctx, sale.ID, "rejected")
+			require.NoError(t, err)
+			used--
+			require.Equal(t, used, usesOf(t, coupons, "DIEZ"))
+		}
+	}
+}
+
+func TestService_Create_WithCoupons_Invalid(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	catalog, productID := newCatalog(t, 10)
+	coupons := newCoupons(t,
+		&coupon.Coupon{Code: "UNO", Kind: coupon.KindFixed, Value: 1, MaxUses: 1},
+		&coupon.Coupon{Code: "MIN", Kind: coupon.KindFixed, Value: 1, MinAmount: 100})
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), server.URL,
+		sales.WithCatalog(catalog), sales.WithCoupons(coupons))
+	ctx := context.Background()
+
+	// Si el cupon no aplica tampoco queda stock reservado
+	err := s.Create(ctx, &sales.Sales{UserID: "ana", CouponCodes: []string{"MIN"},
+		Lines: []sales.Line{{ProductID: productID, Quantity: 2}}})
+	require.ErrorIs(t, err, coupon.ErrBelowMinAmount)
+	require.Equal(t, 10, stockOf(t, catalog, productID))
+
+	err = s.Create(ctx, &sales.Sales{UserID: "ana", Amount: 5, CouponCodes: []string{"NOPE"}})
+	require.ErrorIs(t, err, coupon.ErrNotFound)
+
+	// Con el limite agotado por una venta viva, la siguiente falla
+	for {
+		sale := &sales.Sales{UserID: "ana", Amount: 5, CouponCodes: []string{"UNO"}}
+		require.NoError(t, s.Create(ctx, sale))
+		if sale.Status != "rejected" {
+			break
+		}
+	}
+	err = s.Create(ctx, &sales.Sales{UserID: "ana", Amount: 5, CouponCodes: []string{"UNO"}})
+	require.ErrorIs(t, err, coupon.ErrUsageLimit)
+
+	withoutCoupons := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), server.URL)
+	err = withoutCoupons.Create(ctx, &sales.Sales{UserID: "ana", Amount: 5, CouponCodes: []string{"UNO"}})
+	require.ErrorIs(t, err, sales.ErrNoCoupons)
+
+	results, err := s.CreateBatch(ctx, []*sales.Sales{
+		{UserID: "ana", Amount: 5, CouponCodes: []string{"UNO"}},
+	}, sales.BatchBestEffort)
+	require.NoError(t, err)
+	require.ErrorIs(t, results[0].Err, sales.ErrBatchCoupon)
+}
+
+func TestService_Create_WithCoupons_NothingToCharge(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	catalog, productID := newCatalog(t, 10)
+	coupons := newCoupons(t,
+		&coupon.Coupon{Code: "GRATIS", Kind: coupon.KindPercentage, Value: 100},
+		&coupon.Coupon{Code: "CIEN", Kind: coupon.KindFixed, Value: 100})
+	gateway := payment.NewFake()
+	storage := sales.NewLocalStorage()
+	s := sales.NewService(storage, zap.NewNop(), server.URL,
+		sales.WithCatalog(catalog), sales.WithCoupons(coupons), sales.WithPayments(gateway))
+	ctx := context.Background()
+
+	// Ni se manda un cobro de 0 al gateway ni queda guardada, y los cupones y el stock vuelven
+	err := s.Create(ctx, &sales.Sales{UserID: "ana", Amount: 30, CouponCodes: []string{"GRATIS"}})
+	require.ErrorIs(t, err, sales.ErrInvalidAmount)
+	err = s.Create(ctx, &sales.Sales{UserID: "ana", CouponCodes: []string{"CIEN"},
+		Lines: []sales.Line{{ProductID: productID, Quantity: 2}}})
+	require.ErrorIs(t, err, sales.ErrInvalidAmount)
+	require.Zero(t, usesOf(t, coupons, "GRATIS"))
+	require.Zero(t, usesOf(t, coupons, "CIEN"))
+	require.Zero(t, reservedOf(t, catalog, productID))
+	all, err := storage.GetAll(ctx, "ana")
+	require.NoError(t, err)
+	require.Empty(t, all)
+
+	// Sin gateway tampoco se guarda
+	withoutPayments := sales.NewService(storage, zap.NewNop(), server.URL, sales.WithCoupons(coupons))
+	err = withoutPayments.Create(ctx, &sales.Sales{UserID: "ana", Amount: 30, CouponCodes: []string{"GRATIS"}})
+	require.ErrorIs(t, err, sales.ErrInvalidAmount)
+	all, err = storage.GetAll(ctx, "ana")
+	require.NoError(t, err)
+	require.Empty(t, all)
+}
+
+func TestService_Integracion_Coupons(t *testing.T) {
+	// Con el gateway simulado las ventas arrancan pendientes, sin el el estado es al azar
+	gateway := httptest.NewServer(payment.NewStub(time.Second))
+	defer gateway.Close()
+	t.Setenv("PAYMENT_GATEWAY_URL", gateway.URL)
+	r := newRouter(t)
+	userID := createUser(t, r, "Juancito")
+
+	rec := call(r, http.MethodPost, "/v1/coupons", map[string]any{"code": "verano10", "kind": "percentage", "value": 10,
+		"valid_until": "2099-01-01T00:00:00Z", "max_uses_per_user": 5, "stackable": true})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var c coupon.Coupon
+	decode(t, rec, &c)
+	require.Equal(t, "VERANO10", c.Code)
+
+	// El codigo no distingue mayusculas
+	rec = call(r, http.MethodPost, "/v1/coupons", map[string]any{"code": "VERANO10", "kind": "fixed", "value": 1})
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.Equal(t, "coupon_code_taken", problemCode(t, rec))
+
+	var list struct {
+		Results []coupon.Coupon `json:"results"`
+	}
+	rec = call(r, http.MethodGet, "/v1/coupons", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	decode(t, rec, &list)
+	require.Len(t, list.Results, 1)
+
+	rec = call(r, http.MethodPost, "/v1/sales", map[string]any{"user_id": userID, "amount": 20, "coupon_code": "VERANO10"})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var sale sales.Sales
+	decode(t, rec, &sale)
+	require.Equal(t, float32(18), sale.Amount)
+	require.Equal(t, float32(20), sale.OriginalAmount)
+	require.Equal(t, float32(2), sale.Discount)
+	require.Equal(t, []string{"VERANO10"}, sale.CouponCodes)
+
+	rec = call(r, http.MethodGet, "/v1/coupons/verano10", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	decode(t, rec, &c)
+	require.Equal(t, 1, c.Uses)
+
+	rec = call(r, http.MethodPost, "/v1/users/"+userID+"/sales", map[string]any{"amount": 20, "coupon_codes": []string{"nope"}})
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Equal(t, "coupon_not_found", problemCode(t, rec))
+
+	require.Equal(t, http.StatusNoContent, call(r, http.MethodDelete, "/v1/coupons/verano10", nil).Code)
+	rec = call(r, http.MethodDelete, "/v1/coupons/verano10", nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Equal(t, "coupon_not_found", problemCode(t, rec))
+}
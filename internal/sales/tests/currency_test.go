@@ -0,0 +1,221 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ej_final/api"
+	"ej_final/internal/coupon"
+	"ej_final/internal/currency"
+	"ej_final/internal/sales"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newRates(t *testing.T) *currency.Table {
+	table, err := currency.NewTable(currency.Rates{Base: "ARS", Rates: map[string]float64{"USD": 1000, "EUR": 1100}})
+	require.NoError(t, err)
+	return table
+}
+
+func TestService_Create_WithCurrency(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	catalog, productID := newCatalog(t, 10)
+	coupons := newCoupons(t, &coupon.Coupon{Code: "DOSMIL", Kind: coupon.KindFixed, Value: 2000})
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), server.URL,
+		sales.WithRates(newRates(t)), sales.WithCatalog(catalog), sales.WithCoupons(coupons))
+	ctx := context.Background()
+
+	sale := &sales.Sales{UserID: "ana", Amount: 10, Currency: " usd"}
+	require.NoError(t, s.Create(ctx, sale))
+	require.Equal(t, "USD", sale.Currency)
+	require.Equal(t, 1000.0, sale.ExchangeRate)
+
+	stored, err := s.Get(ctx, sale.ID)
+	require.NoError(t, err)
+	require.Equal(t, 1000.0, stored.ExchangeRate)
+
+	// Sin moneda la venta queda en la base
+	sale = &sales.Sales{UserID: "ana", Amount: 10}
+	require.NoError(t, s.Create(ctx, sale))
+	require.Equal(t, "ARS", sale.Currency)
+	require.Equal(t, 1.0, sale.ExchangeRate)
+
+	// El cupon esta en pesos: 2000 ARS son 2 USD
+	sale = &sales.Sales{UserID: "ana", Amount: 10, Currency: "USD", CouponCodes: []string{"DOSMIL"}}
+	require.NoError(t, s.Create(ctx, sale))
+	require.Equal(t, float32(2), sale.Discount)
+	require.Equal(t, float32(8), sale.Amount)
+
+	err = s.Create(ctx, &sales.Sales{UserID: "ana", Amount: 10, Currency: "BRL"})
+	require.ErrorIs(t, err, currency.ErrUnknownCurrency)
+
+	// Los precios del catalogo estan en la moneda base
+	err = s.Create(ctx, &sales.Sales{UserID: "ana", Currency: "USD",
+		Lines: []sales.Line{{ProductID: productID, Quantity: 1}}})
+	require.ErrorIs(t, err, sales.ErrLinesCurrency)
+	require.Equal(t, 10, stockOf(t, catalog, productID))
+
+	single := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), server.URL)
+	sale = &sales.Sales{UserID: "ana", Amount: 10}
+	require.NoError(t, single.Create(ctx, sale))
+	require.Empty(t, sale.Currency)
+	err = single.Create(ctx, &sales.Sales{UserID: "ana", Amount: 10, Currency: "USD"})
+	require.ErrorIs(t, err, sales.ErrNoRates)
+}
+
+func TestService_Stats_Currency(t *testing.T) {
+	storage := sales.NewLocalStorage()
+	now := time.Now().UTC()
+	// La venta en dolares se hizo con una cotizacion vieja de 900
+	for _, sale := range []*sales.Sales{
+		{ID: "a", UserID: "ana", Amount: 1000, Status: "approved", Currency: "ARS", ExchangeRate: 1},
+		{ID: "b", UserID: "beto", Amount: 2, Status: "approved", Currency: "USD", ExchangeRate: 900},
+		{ID: "c", UserID: "beto", Amount: 500, Status: "rejected"},
+	} {
+		sale.CreatedAt, sale.Version = now, 1
+		require.NoError(t, storage.Set(context.Background(), sale))
+	}
+	s := sales.NewService(storage, zap.NewNop(), "http://localhost:0", sales.WithRates(newRates(t)))
+	ctx := context.Background()
+	q := sales.StatsQuery{From: now.Add(-time.Hour), To: now.Add(time.Hour)}
+
+	stats, err := s.Stats(ctx, q)
+	require.NoError(t, err)
+	require.Equal(t, "ARS", stats.Currency)
+	require.Equal(t, 3300.0, stats.Totals.Amount)
+	require.Equal(t, 2800.0, stats.Totals.ByStatus["approved"].Amount)
+	require.Equal(t, "beto", stats.TopUsers[0].UserID)
+	require.Equal(t, 2300.0, stats.TopUsers[0].Amount)
+
+	q.Currency = "usd"
+	stats, err = s.Stats(ctx, q)
+	require.NoError(t, err)
+	require.Equal(t, "USD", stats.Currency)
+	require.Equal(t, 3.3, stats.Totals.Amount)
+	require.Equal(t, 1.1, stats.Totals.AverageTicket)
+	require.Equal(t, 2.8, stats.Buckets[len(stats.Buckets)-1].ByStatus["approved"].Amount)
+
+	q.Currency = "BRL"
+	_, err = s.Stats(ctx, q)
+	require.ErrorIs(t, err, currency.ErrUnknownCurrency)
+
+	single := sales.NewService(storage, zap.NewNop(), "http://localhost:0")
+	q.Currency = "USD"
+	_, err = single.Stats(ctx, q)
+	require.ErrorIs(t, err, sales.ErrNoRates)
+}
+
+func TestService_Summary_Currency(t *testing.T) {
+	storage := sales.NewLocalStorage()
+	ctx := context.Background()
+	now := time.Now().UTC()
+	for _, sale := range []*sales.Sales{
+		{ID: "a", UserID: "ana", Amount: 1000, Status: "approved", Currency: "ARS", ExchangeRate: 1},
+		{ID: "b", UserID: "ana", Amount: 2, Status: "approved", Currency: "USD", ExchangeRate: 900},
+		{ID: "c", UserID: "ana", Amount: 500, Status: "pending"},
+	} {
+		sale.CreatedAt, sale.Version = now, 1
+		require.NoError(t, storage.Set(ctx, sale))
+	}
+	s := sales.NewService(storage, zap.NewNop(), "http://localhost:0", sales.WithRates(newRates(t)))
+
+	// Los dolares van a la cotizacion de la venta, no se suman tal cual
+	sum, err := s.Summary(ctx, "ana")
+	require.NoError(t, err)
+	require.Equal(t, "ARS", sum.Currency)
+	require.InDelta(t, 3300, sum.TotalAmount, 0.001)
+
+	// Un cambio de la venta en dolares mueve los totales en la moneda base
+	require.NoError(t, storage.Set(ctx, &sales.Sales{ID: "b", UserID: "ana", Amount: 2, RefundedAmount: 1,
+		Status: sales.StatusPartiallyRefunded, Currency: "USD", ExchangeRate: 900, CreatedAt: now, Version: 2}))
+	sum, err = s.Summary(ctx, "ana")
+	require.NoError(t, err)
+	require.InDelta(t, 3300, sum.TotalAmount, 0.001)
+	require.InDelta(t, 900, sum.RefundedAmount, 0.001)
+
+	_, err = s.RebuildSummaries(ctx)
+	require.NoError(t, err)
+	rebuilt, err := s.Summary(ctx, "ana")
+	require.NoError(t, err)
+	require.InDelta(t, sum.TotalAmount, rebuilt.TotalAmount, 0.001)
+	require.InDelta(t, sum.RefundedAmount, rebuilt.RefundedAmount, 0.001)
+
+	single := sales.NewService(storage, zap.NewNop(), "http://localhost:0")
+	sum, err = single.Summary(ctx, "ana")
+	require.NoError(t, err)
+	require.Empty(t, sum.Currency)
+}
+
+func TestConverter_Amount(t *testing.T) {
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), "http://localhost:0", sales.WithRates(newRates(t)))
+	ctx := context.Background()
+
+	conv, err := s.Converter(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, "ARS", conv.Currency)
+	// Se usa la cotizacion guardada en la venta, no la actual
+	sale := &sales.Sales{Amount: 2, Currency: "USD", ExchangeRate: 900}
+	require.Equal(t, float32(1800), conv.Amount(sale, sale.Amount))
+
+	conv, err = s.Converter(ctx, "EUR")
+	require.NoError(t, err)
+	require.Equal(t, float32(1.64), conv.Amount(sale, sale.Amount))
+	require.Equal(t, float32(0.91), conv.Amount(&sales.Sales{}, 1000))
+}
+
+func TestService_Integracion_Currency(t *testing.T) {
+	rates := filepath.Join(t.TempDir(), "rates.json")
+	require.NoError(t, os.WriteFile(rates, []byte(`{"base": "ARS", "rates": {"USD": 1000}}`), 0o600))
+	t.Setenv("CURRENCY_RATES_FILE", rates)
+	r := newRouter(t)
+	userID := createUser(t, r, "Juancito")
+
+	rec := call(r, http.MethodPost, "/v1/sales", map[string]any{"user_id": userID, "amount": 20, "currency": "usd"})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var sale sales.Sales
+	decode(t, rec, &sale)
+	require.Equal(t, "USD", sale.Currency)
+	require.Equal(t, 1000.0, sale.ExchangeRate)
+	require.Equal(t, http.StatusCreated, call(r, http.MethodPost, "/v1/sales", map[string]any{"user_id": userID, "amount": 500}).Code)
+
+	rec = call(r, http.MethodPost, "/v1/sales", map[string]any{"user_id": userID, "amount": 20, "currency": "BRL"})
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, "unknown_currency", problemCode(t, rec))
+
+	// La metadata suma cada venta convertida a la moneda pedida
+	rec = call(r, http.MethodGet, "/v1/sales?user_id="+userID+"&currency=USD", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list api.SalesResponse
+	decode(t, rec, &list)
+	require.Equal(t, "USD", list.Metadata.Currency)
+	require.InDelta(t, 20.5, list.Metadata.TotalAmount, 0.001)
+
+	rec = call(r, http.MethodGet, "/v1/sales?user_id="+userID+"&currency=BRL", nil)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, "unknown_currency", problemCode(t, rec))
+
+	rec = call(r, http.MethodGet, "/v1/sales/stats?currency=usd", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var stats sales.Stats
+	decode(t, rec, &stats)
+	require.Equal(t, "USD", stats.Currency)
+	require.InDelta(t, 20.5, stats.Totals.Amount, 0.001)
+
+	// Las ventas con lineas van en la moneda base, que es la del catalogo
+	rec = call(r, http.MethodPost, "/v1/products", map[string]any{"sku": "MATE-01", "name": "Mate", "price": 12.5, "stock": 3})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var p struct {
+		ID string `json:"id"`
+	}
+	decode(t, rec, &p)
+	rec = call(r, http.MethodPost, "/v1/sales", map[string]any{"user_id": userID, "currency": "USD",
+		"lines": []map[string]any{{"product_id": p.ID, "quantity": 1}}})
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, "lines_currency", problemCode(t, rec))
+}
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ej_final/api"
+	"ej_final/internal/sales"
+	"ej_final/internal/tax"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// seedExport guarda tres ventas con fechas crecientes, desordenadas a proposito.
+func seedExport(t *testing.T, storage sales.Storage) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, s := range []*sales.Sales{
+		{ID: "c", UserID: "ana", Amount: 30, Status: "approved", CreatedAt: base.Add(2 * time.Hour)},
+		{ID: "a", UserID: "ana", Amount: 10.5, Status: "pending", CreatedAt: base},
+		{ID: "b", UserID: "beto", Amount: 20, Status: "partially_refunded", CreatedAt: base.Add(time.Hour),
+			Currency: "USD", ExchangeRate: 1050.5, RefundedAmount: 5, Taxes: &tax.Breakdown{Inclusive: true, Net: 16.53, Tax: 3.47, Gross: 20}},
+	} {
+		s.UpdatedAt = s.CreatedAt
+		s.Version = i + 1
+		require.NoError(t, storage.Set(context.Background(), s))
+	}
+}
+
+func TestService_Export_CSV(t *testing.T) {
+	storage := sales.NewLocalStorage()
+	seedExport(t, storage)
+	s := sales.NewService(storage, zap.NewNop(), "http://localhost:0")
+
+	var buf bytes.Buffer
+	exp, err := sales.NewExporter(&buf, sales.FormatCSV)
+	require.NoError(t, err)
+	require.NoError(t, s.Export(context.Background(), sales.Filter{}, exp))
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, []string{"id", "user_id", "amount", "status", "created_at", "updated_at", "version",
+		"currency", "exchange_rate", "refunded_amount", "tax"}, rows[0])
+	require.Len(t, rows, 4)
+	// Ordenadas por fecha de creacion; sin moneda ni impuestos esas columnas quedan vacias
+	require.Equal(t, []string{"a", "ana", "10.5", "pending", "2026-01-01T00:00:00Z", "2026-01-01T00:00:00Z", "2",
+		"", "", "0", ""}, rows[1])
+	require.Equal(t, []string{"b", "beto", "20", "partially_refunded", "2026-01-01T01:00:00Z", "2026-01-01T01:00:00Z", "3",
+		"USD", "1050.5", "5", "3.47"}, rows[2])
+	require.Equal(t, "c", rows[3][0])
+}
+
+func TestService_Export_NDJSONWithFilter(t *testing.T) {
+	storage := sales.NewLocalStorage()
+	seedExport(t, storage)
+	s := sales.NewService(storage, zap.NewNop(), "http://localhost:0")
+
+	var buf bytes.Buffer
+	exp, err := sales.NewExporter(&buf, sales.FormatNDJSON)
+	require.NoError(t, err)
+	require.NoError(t, s.Export(context.Background(), sales.Filter{UserID: "ana", Status: "approved"}, exp))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 1)
+	var got sales.Sales
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &got))
+	require.Equal(t, "c", got.ID)
+	require.Equal(t, 1, exp.Rows())
+}
+
+func TestService_Export_Errors(t *testing.T) {
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), "http://localhost:0")
+
+	var buf bytes.Buffer
+	exp, err := sales.NewExporter(&buf, sales.FormatCSV)
+	require.NoError(t, err)
+	require.ErrorIs(t, s.Export(context.Background(), sales.Filter{Status: "lost"}, exp), sales.ErrInvalidStatus)
+	require.Zero(t, buf.Len())
+
+	// Sin ventas igual sale el header
+	require.NoError(t, s.Export(context.Background(), sales.Filter{}, exp))
+	require.Equal(t, "id,user_id,amount,status,created_at,updated_at,version,currency,exchange_rate,refunded_amount,tax\n", buf.String())
+
+	_, err = sales.NewExporter(&buf, "xlsx")
+	require.ErrorIs(t, err, sales.ErrInvalidFormat)
+}
+
+func TestService_Integracion_Export(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	server := httptest.NewServer(r)
+	defer server.Close()
+	api.InitRoutes(r, server.URL)
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/v1/sales/export?user_id=nadie", nil)
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+	require.Equal(t, `attachment; filename="sales.csv"`, rec.Header().Get("Content-Disposition"))
+	require.True(t, strings.HasPrefix(rec.Body.String(), "id,user_id,"))
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/export", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/x-ndjson", rec.Header().Get("Content-Type"))
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/export?format=xlsx", nil)
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "invalid_format")
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/export?status=lost", nil)
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "invalid_status")
+}
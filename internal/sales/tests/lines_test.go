@@ -0,0 +1,274 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"ej_final/internal/payment"
+	"ej_final/internal/product"
+	"ej_final/internal/sales"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newCatalog arma un catalogo con un producto de precio 2.5 y el stock dado.
+func newCatalog(t *testing.T, stock int, opts ...product.Option) (*product.Service, string) {
+	catalog := product.NewService(product.NewLocalStorage(), zap.NewNop(), opts...)
+	p := &product.Product{SKU: "MATE-01", Name: "Mate", Price: 2.5, Stock: stock}
+	require.NoError(t, catalog.Create(context.Background(), p))
+	return catalog, p.ID
+}
+
+func stockOf(t *testing.T, catalog *product.Service, id string) int {
+	p, err := catalog.Get(context.Background(), id)
+	require.NoError(t, err)
+	return p.Stock
+}
+
+func reservedOf(t *testing.T, catalog *product.Service, id string) int {
+	p, err := catalog.Get(context.Background(), id)
+	require.NoError(t, err)
+	return p.Reserved
+}
+
+// createPending crea ventas con una linea hasta que alguna arranque pendiente.
+func createPending(t *testing.T, s *sales.Service, productID string, quantity int) *sales.Sales {
+	for i := 0; i < 50; i++ {
+		sale := &sales.Sales{UserID: "ana", Lines: []sales.Line{{ProductID: productID, Quantity: quantity}}}
+		require.NoError(t, s.Create(context.Background(), sale))
+		if sale.Status == "pending" {
+			return sale
+		}
+	}
+	t.Fatal("ninguna venta quedo pendiente")
+	return nil
+}
+
+func TestService_Create_WithLines(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	catalog, productID := newCatalog(t, 100)
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), server.URL, sales.WithCatalog(catalog))
+
+	// El estado inicial es aleatorio, creamos hasta tener una pendiente
+	var sale *sales.Sales
+	reserved := 0
+	for i := 0; i < 50 && (sale == nil || sale.Status != "pending"); i++ {
+		sale = &sales.Sales{UserID: "ana", Amount: 999, Lines: []sales.Line{{ProductID: productID, Quantity: 2}}}
+		require.NoError(t, s.Create(context.Background(), sale))
+		if sale.Status != "rejected" {
+			reserved += 2
+		}
+		// Una venta rechazada devuelve el stock en el momento
+		require.Equal(t, 100-reserved, stockOf(t, catalog, productID))
+	}
+	require.Equal(t, "pending", sale.Status)
+	require.Equal(t, float32(5), sale.Amount)
+	require.Equal(t, "MATE-01", sale.Lines[0].SKU)
+	require.Equal(t, float32(2.5), sale.Lines[0].UnitPrice)
+
+	// El precio queda congelado en la venta aunque cambie en el catalogo
+	price := float32(4)
+	_, err := catalog.Update(context.Background(), productID, &product.UpdateFields{Price: &price})
+	require.NoError(t, err)
+	stored, err := s.Get(context.Background(), sale.ID)
+	require.NoError(t, err)
+	require.Equal(t, float32(2.5), stored.Lines[0].UnitPrice)
+
+	_, err = s.Update(context.Background(), sale.ID, "rejected")
+	require.NoError(t, err)
+	require.Equal(t, 100-reserved+2, stockOf(t, catalog, productID))
+}
+
+func TestService_Create_WithLines_Invalid(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	catalog, productID := newCatalog(t, 1)
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), server.URL, sales.WithCatalog(catalog))
+	ctx := context.Background()
+
+	err := s.Create(ctx, &sales.Sales{UserID: "ana", Lines: []sales.Line{{ProductID: productID, Quantity: 0}}})
+	require.ErrorIs(t, err, sales.ErrInvalidLine)
+	err = s.Create(ctx, &sales.Sales{UserID: "ana", Lines: []sales.Line{{ProductID: productID, Quantity: 2}}})
+	require.ErrorIs(t, err, product.ErrInsufficientStock)
+	err = s.Create(ctx, &sales.Sales{UserID: "ana", Lines: []sales.Line{{ProductID: "nope", Quantity: 1}}})
+	require.ErrorIs(t, err, product.ErrNotFound)
+	require.Equal(t, 1, stockOf(t, catalog, productID))
+
+	withoutCatalog := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), server.URL)
+	err = withoutCatalog.Create(ctx, &sales.Sales{UserID: "ana", Lines: []sales.Line{{ProductID: productID, Quantity: 1}}})
+	require.ErrorIs(t, err, sales.ErrNoCatalog)
+
+	results, err := s.CreateBatch(ctx, []*sales.Sales{
+		{UserID: "ana", Lines: []sales.Line{{ProductID: productID, Quantity: 1}}},
+	}, sales.BatchBestEffort)
+	require.NoError(t, err)
+	require.ErrorIs(t, results[0].Err, sales.ErrInvalidLine)
+}
+
+func TestService_Create_WithLines_NoOversell(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	catalog, productID := newCatalog(t, 10)
+	storage := sales.NewLocalStorage()
+	s := sales.NewService(storage, zap.NewNop(), server.URL, sales.WithCatalog(catalog))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Create(context.Background(), &sales.Sales{UserID: "ana", Lines: []sales.Line{{ProductID: productID, Quantity: 1}}})
+		}()
+	}
+	wg.Wait()
+
+	// Lo que queda de stock mas lo que tienen las ventas no rechazadas es el stock inicial
+	held := 0
+	require.NoError(t, storage.Iterate(context.Background(), sales.Filter{UserID: "ana"}, func(sale *sales.Sales) error {
+		if sale.Status != "rejected" {
+			held += sale.Lines[0].Quantity
+		}
+		return nil
+	}))
+	stock := stockOf(t, catalog, productID)
+	require.GreaterOrEqual(t, stock, 0)
+	require.Equal(t, 10, stock+held)
+}
+
+func TestService_Update_CommitsReservation(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	catalog, productID := newCatalog(t, 1000)
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), server.URL, sales.WithCatalog(catalog))
+
+	sale := createPending(t, s, productID, 3)
+	before := stockOf(t, catalog, productID)
+	require.GreaterOrEqual(t, reservedOf(t, catalog, productID), 3)
+
+	// Aprobar pasa lo reservado a vendido: el disponible no cambia
+	reserved := reservedOf(t, catalog, productID)
+	_, err := s.Update(context.Background(), sale.ID, "approved")
+	require.NoError(t, err)
+	require.Equal(t, before, stockOf(t, catalog, productID))
+	require.Equal(t, reserved-3, reservedOf(t, catalog, productID))
+
+	// Cancelar una pendiente devuelve su stock
+	other := createPending(t, s, productID, 2)
+	before = stockOf(t, catalog, productID)
+	_, err = s.Cancel(context.Background(), other.ID, "se arrepintio")
+	require.NoError(t, err)
+	require.Equal(t, before+2, stockOf(t, catalog, productID))
+}
+
+func TestService_Update_ReservationExpired(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	catalog, productID := newCatalog(t, 1000, product.WithReservationTTL(time.Millisecond))
+	gateway := payment.NewFake()
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), server.URL,
+		sales.WithCatalog(catalog), sales.WithPayments(gateway))
+	ctx := context.Background()
+
+	// expire deja vencer las reservas de las ventas y devuelve su stock
+	expire := func() {
+		time.Sleep(5 * time.Millisecond)
+		_, err := catalog.ExpireReservations(ctx)
+		require.NoError(t, err)
+		require.Zero(t, reservedOf(t, catalog, productID))
+	}
+
+	sale := createPending(t, s, productID, 3)
+	expire()
+
+	// El stock ya volvio al catalogo, aprobarla venderia de mas: se rechaza y se anula el pago
+	before := stockOf(t, catalog, productID)
+	_, err := s.Update(ctx, sale.ID, "approved")
+	require.ErrorIs(t, err, product.ErrReservationExpired)
+	stored, err := s.Get(ctx, sale.ID)
+	require.NoError(t, err)
+	require.Equal(t, "rejected", stored.Status)
+	require.Equal(t, sale.Version+1, stored.Version)
+	require.Equal(t, payment.StatusVoided, paymentStatus(t, gateway, sale))
+	require.Equal(t, before, stockOf(t, catalog, productID))
+
+	_, err = s.Update(ctx, sale.ID, "approved")
+	require.ErrorIs(t, err, sales.ErrInvalidTransition)
+
+	// Igual en un batch, aunque se aborte
+	batched := createPending(t, s, productID, 1)
+	expire()
+	results, err := s.UpdateBatch(ctx, []sales.StatusChange{{ID: batched.ID, Status: "approved"}}, sales.BatchAllOrNothing)
+	require.NoError(t, err)
+	require.ErrorIs(t, results[0].Err, product.ErrReservationExpired)
+	stored, err = s.Get(ctx, batched.ID)
+	require.NoError(t, err)
+	require.Equal(t, "rejected", stored.Status)
+
+	// Y si el cobro llega por callback, queda marcado como conflicto
+	paid := createPending(t, s, productID, 1)
+	expire()
+	outcome, err := s.ApplyPayment(ctx, callbackFor(paid, payment.StatusCaptured))
+	require.NoError(t, err)
+	require.False(t, outcome.Applied)
+	require.True(t, outcome.Conflict)
+	require.Equal(t, "rejected", outcome.Sale.Status)
+	require.Equal(t, before, stockOf(t, catalog, productID))
+}
+
+func TestService_Integracion_Products(t *testing.T) {
+	// Con el gateway simulado las ventas arrancan pendientes, sin el el estado es al azar
+	gateway := httptest.NewServer(payment.NewStub(time.Second))
+	defer gateway.Close()
+	t.Setenv("PAYMENT_GATEWAY_URL", gateway.URL)
+	r := newRouter(t)
+	userID := createUser(t, r, "Juancito")
+
+	rec := call(r, http.MethodPost, "/v1/products", map[string]any{"sku": "MATE-01", "name": "Mate", "price": 12.5, "stock": 3})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var p product.Product
+	decode(t, rec, &p)
+	require.Equal(t, 3, p.Stock)
+
+	rec = call(r, http.MethodPost, "/v1/products", map[string]any{"sku": "MATE-01", "name": "Otro", "price": 1})
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.Equal(t, "sku_taken", problemCode(t, rec))
+
+	rec = call(r, http.MethodPatch, "/v1/products/"+p.ID, map[string]any{"price": 13})
+	require.Equal(t, http.StatusOK, rec.Code)
+	decode(t, rec, &p)
+	require.Equal(t, float32(13), p.Price)
+	require.Equal(t, 2, p.Version)
+
+	var list struct {
+		Results []product.Product `json:"results"`
+	}
+	rec = call(r, http.MethodGet, "/v1/products", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	decode(t, rec, &list)
+	require.Len(t, list.Results, 1)
+
+	// La venta toma el precio actual y reserva el stock
+	rec = call(r, http.MethodPost, "/v1/sales", map[string]any{"user_id": userID,
+		"lines": []map[string]any{{"product_id": p.ID, "quantity": 2}}})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var sale sales.Sales
+	decode(t, rec, &sale)
+	require.Equal(t, float32(26), sale.Amount)
+	require.Equal(t, "MATE-01", sale.Lines[0].SKU)
+	require.Equal(t, float32(13), sale.Lines[0].UnitPrice)
+
+	rec = call(r, http.MethodGet, "/v1/products/"+p.ID, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	decode(t, rec, &p)
+	require.Equal(t, 2, p.Reserved)
+
+	rec = call(r, http.MethodPost, "/v1/sales", map[string]any{"user_id": userID,
+		"lines": []map[string]any{{"product_id": p.ID, "quantity": 2}}})
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.Equal(t, "insufficient_stock", problemCode(t, rec))
+
+	rec = call(r, http.MethodDelete, "/v1/products/nope", nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Equal(t, "product_not_found", problemCode(t, rec))
+}
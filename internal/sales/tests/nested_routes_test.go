@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ej_final/api"
+	"ej_final/internal/sales"
+	"ej_final/internal/user"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestService_GetForUser(t *testing.T) {
+	storage := sales.NewLocalStorage()
+	require.NoError(t, storage.Set(context.Background(), &sales.Sales{ID: "s1", UserID: "ana", Amount: 10, Status: "pending"}))
+	s := sales.NewService(storage, zap.NewNop(), "http://localhost:0")
+
+	sale, err := s.GetForUser(context.Background(), "ana", "s1")
+	require.NoError(t, err)
+	require.Equal(t, "s1", sale.ID)
+
+	// De otro usuario se responde igual que si no existiera
+	_, err = s.GetForUser(context.Background(), "beto", "s1")
+	require.ErrorIs(t, err, sales.ErrNotFound)
+
+	_, err = s.Get(context.Background(), "")
+	require.ErrorIs(t, err, sales.ErrEmptyID)
+}
+
+func TestService_Integracion_NestedRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	server := httptest.NewServer(r)
+	defer server.Close()
+	api.InitRoutes(r, server.URL)
+
+	do := func(method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req, _ := http.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	code := func(rec *httptest.ResponseRecorder) string {
+		var p struct {
+			Code string `json:"code"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &p)
+		return p.Code
+	}
+
+	var ana, beto user.User
+	json.Unmarshal(do(http.MethodPost, "/v1/users", map[string]string{"name": "Ana"}).Body.Bytes(), &ana)
+	json.Unmarshal(do(http.MethodPost, "/v1/users", map[string]string{"name": "Beto"}).Body.Bytes(), &beto)
+
+	rec := do(http.MethodPost, "/v1/users/"+ana.ID+"/sales", map[string]any{"amount": 25})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var sale sales.Sales
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &sale))
+	require.Equal(t, ana.ID, sale.UserID)
+
+	rec = do(http.MethodPost, "/v1/users/nope/sales", map[string]any{"amount": 25})
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Equal(t, "user_not_found", code(rec))
+
+	rec = do(http.MethodGet, "/v1/users/"+ana.ID+"/sales", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list api.SalesResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	require.Equal(t, 1, list.Metadata.Quantity)
+
+	rec = do(http.MethodGet, "/v1/users/"+ana.ID+"/sales/"+sale.ID, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// La venta es de Ana: pedida como de Beto es un 404
+	rec = do(http.MethodGet, "/v1/users/"+beto.ID+"/sales/"+sale.ID, nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Equal(t, "sale_not_found", code(rec))
+
+	rec = do(http.MethodGet, "/v1/sales/"+sale.ID, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = do(http.MethodGet, "/v1/sales/nope", nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestService_Integracion_Ownership(t *testing.T) {
+	users, _, _ := newUsersServer(t, "ana", "beto")
+	t.Setenv("API_KEYS", "k-ana:ana,k-beto:beto,admin")
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api.InitRoutes(r, users.URL)
+
+	do := func(key, method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req, _ := http.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	code := func(rec *httptest.ResponseRecorder) string {
+		var p struct {
+			Code string `json:"code"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &p)
+		return p.Code
+	}
+
+	rec := do("k-ana", http.MethodPost, "/v1/sales", map[string]any{"user_id": "ana", "amount": 25})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var sale sales.Sales
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &sale))
+
+	// Ana ve su venta, Beto la ve como si no existiera en todas las rutas
+	require.Equal(t, http.StatusOK, do("k-ana", http.MethodGet, "/v1/sales/"+sale.ID, nil).Code)
+	require.Equal(t, http.StatusOK, do("k-ana", http.MethodGet, "/v1/sales/"+sale.ID+"/refunds", nil).Code)
+	for _, c := range []struct {
+		method, path string
+		body         any
+	}{
+		{http.MethodGet, "/v1/sales/" + sale.ID, nil},
+		{http.MethodPatch, "/v1/sales/" + sale.ID, map[string]string{"status": "rejected"}},
+		{http.MethodPost, "/v1/sales/" + sale.ID + "/cancel", map[string]string{"reason": "no"}},
+		{http.MethodPost, "/v1/sales/" + sale.ID + "/refunds", map[string]any{"amount": 5}},
+		{http.MethodGet, "/v1/sales/" + sale.ID + "/refunds", nil},
+		{http.MethodPatch, "/v1/sales", map[string]any{"mode": "best_effort",
+			"items": []map[string]any{{"id": sale.ID, "status": "rejected", "version": sale.Version}}}},
+	} {
+		rec := do("k-beto", c.method, c.path, c.body)
+		require.Equal(t, http.StatusNotFound, rec.Code, c.method+" "+c.path)
+		require.Equal(t, "sale_not_found", code(rec), c.method+" "+c.path)
+	}
+	for _, c := range []struct {
+		method, path string
+		body         any
+	}{
+		{http.MethodPost, "/v1/sales", map[string]any{"user_id": "ana", "amount": 25}},
+		{http.MethodPost, "/v1/sales/batch", map[string]any{"items": []map[string]any{{"user_id": "ana", "amount": 25}}}},
+		{http.MethodGet, "/v1/sales?user_id=ana", nil},
+		{http.MethodGet, "/v1/sales/export?user_id=ana", nil},
+		{http.MethodGet, "/v1/sales/stats?user_id=ana", nil},
+		{http.MethodGet, "/v1/users/ana/sales", nil},
+		{http.MethodGet, "/v1/users/ana/sales/summary", nil},
+		{http.MethodGet, "/v1/users/ana/sales/" + sale.ID, nil},
+	} {
+		rec := do("k-beto", c.method, c.path, c.body)
+		require.Equal(t, http.StatusNotFound, rec.Code, c.method+" "+c.path)
+		require.Equal(t, "user_not_found", code(rec), c.method+" "+c.path)
+	}
+
+	// Sin user_id el export queda en las ventas de Beto
+	rec = do("k-beto", http.MethodGet, "/v1/sales/export", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotContains(t, rec.Body.String(), sale.ID)
+
+	// Las operaciones sobre todos los usuarios no son para keys de un usuario
+	for _, path := range []string{"/v1/sales/summaries/rebuild", "/v1/imports/sales"} {
+		rec = do("k-beto", http.MethodPost, path, nil)
+		require.Equal(t, http.StatusForbidden, rec.Code, path)
+		require.Equal(t, "forbidden", code(rec), path)
+	}
+
+	// La key sin usuario actua sobre cualquier venta
+	rec = do("admin", http.MethodGet, "/v1/sales/"+sale.ID, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = do("admin", http.MethodPost, "/v1/sales/summaries/rebuild", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+}
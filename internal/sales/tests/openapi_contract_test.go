@@ -0,0 +1,210 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ej_final/api"
+	"ej_final/internal/payment"
+	"ej_final/internal/product"
+	"ej_final/internal/sales"
+	"ej_final/internal/user"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOpenAPI_Contract recorre los endpoints con el validador de OpenAPI activo,
+// si un handler se desvia del contrato el test falla.
+func TestOpenAPI_Contract(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	// Con cotizaciones cargadas para recorrer tambien las ventas en otras monedas
+	rates := filepath.Join(t.TempDir(), "rates.json")
+	require.NoError(t, os.WriteFile(rates, []byte(`{"base": "ARS", "rates": {"USD": 1000}}`), 0o600))
+	t.Setenv("CURRENCY_RATES_FILE", rates)
+
+	// Y con el gateway de pagos simulado, que deja las ventas pendientes hasta aprobarlas
+	gateway := httptest.NewServer(payment.NewStub(time.Second))
+	defer gateway.Close()
+	t.Setenv("PAYMENT_GATEWAY_URL", gateway.URL)
+	t.Setenv("PAYMENT_GATEWAY_TIMEOUT", "100ms")
+	t.Setenv("PAYMENT_CALLBACK_SECRET", "secreto")
+	verifier := payment.NewVerifier("secreto")
+
+	var mu sync.Mutex
+	var violations []error
+	r.Use(api.ValidateOpenAPI(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		violations = append(violations, err)
+	}))
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+	api.InitRoutes(r, server.URL)
+
+	rec := call(r, http.MethodPost, "/v1/users", map[string]string{"name": "Juancito", "address": "suyuque", "nickname": "juan"})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var u user.User
+	decode(t, rec, &u)
+
+	rec = call(r, http.MethodPost, "/v1/products", map[string]any{"sku": "MATE-01", "name": "Mate", "price": 12.5, "stock": 3})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var p product.Product
+	decode(t, rec, &p)
+
+	rec = call(r, http.MethodPost, "/v1/coupons", map[string]any{"code": "verano10", "kind": "percentage", "value": 10,
+		"valid_until": "2099-01-01T00:00:00Z", "max_uses_per_user": 5, "stackable": true})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = call(r, http.MethodPost, "/v1/sales", map[string]any{"user_id": u.ID, "amount": 10.5})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var s sales.Sales
+	decode(t, rec, &s)
+
+	rec = call(r, http.MethodPost, "/v1/sales", map[string]any{"user_id": u.ID, "amount": 4})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var paid sales.Sales
+	decode(t, rec, &paid)
+
+	// Cada paso se valida contra el contrato; el comportamiento de cada endpoint
+	// se prueba en el test de su funcionalidad
+	steps := []struct {
+		method string
+		path   string
+		body   any
+		status int
+	}{
+		{http.MethodGet, "/v1/users/" + u.ID, nil, http.StatusOK},
+		{http.MethodPatch, "/v1/users/" + u.ID, map[string]string{"nickname": "juancho"}, http.StatusOK},
+		{http.MethodGet, "/v1/users/nope", nil, http.StatusNotFound},
+		{http.MethodGet, "/v1/users?search=jua&sort=name&order=desc&limit=1", nil, http.StatusOK},
+		{http.MethodGet, "/v1/users?cursor=roto", nil, http.StatusBadRequest},
+
+		{http.MethodGet, "/v1/products", nil, http.StatusOK},
+		{http.MethodGet, "/v1/products/" + p.ID, nil, http.StatusOK},
+		{http.MethodPatch, "/v1/products/" + p.ID, map[string]any{"price": 13}, http.StatusOK},
+		{http.MethodPost, "/v1/products", map[string]any{"sku": "MATE-01", "name": "Otro", "price": 1}, http.StatusConflict},
+		{http.MethodPost, "/v1/sales", map[string]any{"user_id": u.ID, "lines": []map[string]any{{"product_id": p.ID, "quantity": 2}}}, http.StatusCreated},
+		{http.MethodPost, "/v1/sales", map[string]any{"user_id": u.ID, "lines": []map[string]any{{"product_id": p.ID, "quantity": 99}}}, http.StatusConflict},
+		{http.MethodDelete, "/v1/products/nope", nil, http.StatusNotFound},
+
+		{http.MethodPost, "/v1/coupons", map[string]any{"code": "VERANO10", "kind": "fixed", "value": 1}, http.StatusConflict},
+		{http.MethodGet, "/v1/coupons", nil, http.StatusOK},
+		{http.MethodGet, "/v1/coupons/verano10", nil, http.StatusOK},
+		{http.MethodPost, "/v1/sales", map[string]any{"user_id": u.ID, "amount": 20, "coupon_code": "VERANO10"}, http.StatusCreated},
+		{http.MethodPost, "/v1/users/" + u.ID + "/sales", map[string]any{"amount": 20, "coupon_codes": []string{"nope"}}, http.StatusNotFound},
+		{http.MethodPost, "/v1/sales", map[string]any{"user_id": u.ID, "amount": 20, "jurisdiction": "tierra del fuego"}, http.StatusCreated},
+		{http.MethodPost, "/v1/sales", map[string]any{"user_id": u.ID, "amount": 20, "jurisdiction": "Narnia"}, http.StatusBadRequest},
+		{http.MethodPost, "/v1/sales", map[string]any{"user_id": u.ID, "amount": 20, "currency": "usd"}, http.StatusCreated},
+		{http.MethodPost, "/v1/sales", map[string]any{"user_id": u.ID, "amount": 20, "currency": "BRL"}, http.StatusBadRequest},
+		{http.MethodPost, "/v1/sales", map[string]any{"user_id": u.ID, "amount": 7.51}, http.StatusCreated},
+		{http.MethodPost, "/v1/sales", map[string]any{"user_id": u.ID, "amount": 7.52}, http.StatusGatewayTimeout},
+		{http.MethodPost, "/v1/sales", map[string]any{"user_id": u.ID, "currency": "USD", "lines": []map[string]any{{"product_id": p.ID, "quantity": 1}}}, http.StatusBadRequest},
+		{http.MethodDelete, "/v1/coupons/verano10", nil, http.StatusNoContent},
+		{http.MethodDelete, "/v1/coupons/verano10", nil, http.StatusNotFound},
+
+		{http.MethodPost, "/v1/sales/batch", map[string]any{"mode": "best_effort", "items": []map[string]any{
+			{"user_id": u.ID, "amount": 1},
+			{"user_id": "nope", "amount": 2},
+		}}, http.StatusOK},
+		{http.MethodPatch, "/v1/sales/" + s.ID, map[string]string{"status": "approved"}, http.StatusOK},
+		{http.MethodPatch, "/v1/sales/nope", map[string]string{"status": "approved"}, http.StatusNotFound},
+		{http.MethodPatch, "/v1/sales", map[string]any{"mode": "best_effort", "items": []map[string]any{
+			{"id": s.ID, "status": "rejected", "version": 1},
+			{"id": "nope", "status": "approved"},
+		}}, http.StatusOK},
+		{http.MethodPost, "/v1/sales/" + s.ID + "/refunds", map[string]any{"amount": 1, "reason": "producto fallado"}, http.StatusCreated},
+		{http.MethodPost, "/v1/sales/" + s.ID + "/cancel", map[string]string{"reason": "se arrepintio"}, http.StatusConflict},
+		{http.MethodGet, "/v1/sales/" + s.ID + "/refunds", nil, http.StatusOK},
+		{http.MethodGet, "/v1/sales/nope/refunds", nil, http.StatusNotFound},
+
+		{http.MethodGet, "/v1/sales?user_id=" + u.ID, nil, http.StatusOK},
+		{http.MethodGet, "/v1/sales?user_id=" + u.ID + "&status=pending", nil, http.StatusOK},
+		{http.MethodGet, "/v1/sales?user_id=" + u.ID + "&currency=USD", nil, http.StatusOK},
+		{http.MethodGet, "/v1/sales?user_id=" + u.ID + "&currency=BRL", nil, http.StatusBadRequest},
+		{http.MethodGet, "/v2/sales?user_id=" + u.ID, nil, http.StatusOK},
+		{http.MethodGet, "/v1/sales/export?user_id=" + u.ID, nil, http.StatusOK},
+		{http.MethodGet, "/v1/sales/stats", nil, http.StatusOK},
+		{http.MethodGet, "/v1/sales/stats?currency=usd", nil, http.StatusOK},
+		{http.MethodGet, "/v1/users/" + u.ID + "/sales/summary", nil, http.StatusOK},
+		{http.MethodGet, "/v1/users/" + u.ID + "/sales?status=approved", nil, http.StatusOK},
+		{http.MethodPost, "/v1/users/" + u.ID + "/sales", map[string]any{"amount": 3}, http.StatusCreated},
+		{http.MethodGet, "/v1/users/" + u.ID + "/sales/" + s.ID, nil, http.StatusOK},
+		{http.MethodGet, "/v1/users/nope/sales/" + s.ID, nil, http.StatusNotFound},
+		{http.MethodGet, "/v1/sales/" + s.ID, nil, http.StatusOK},
+		{http.MethodGet, "/v1/users/nope/sales/summary", nil, http.StatusNotFound},
+		{http.MethodPost, "/v1/sales/summaries/rebuild", nil, http.StatusOK},
+		{http.MethodGet, "/v1/sales/stats?from=2020-01-01&to=2020-03-01&interval=week&user_id=" + u.ID + "&top=3", nil, http.StatusOK},
+		{http.MethodGet, "/v1/sales/export?format=ndjson&status=approved", nil, http.StatusOK},
+	}
+	for _, step := range steps {
+		rec := call(r, step.method, step.path, step.body)
+		assert.Equal(t, step.status, rec.Code, "%s %s", step.method, step.path)
+	}
+
+	// Los callbacks del gateway van firmados sobre el body crudo
+	captured := payment.Callback{EventID: "evt-1", TransactionID: paid.PaymentID, Reference: paid.ID, Status: payment.StatusCaptured}
+	voided := captured
+	voided.Status, voided.Sequence = payment.StatusVoided, 3
+	unknown := captured
+	unknown.Reference = "nope"
+	callbacks := []struct {
+		callback  payment.Callback
+		signature string
+		status    int
+	}{
+		{captured, "", http.StatusOK},
+		{captured, "", http.StatusOK},
+		{voided, "", http.StatusOK},
+		{captured, "sha256=00", http.StatusUnauthorized},
+		{unknown, "", http.StatusNotFound},
+		{payment.Callback{TransactionID: "otra", Reference: paid.ID, Status: payment.StatusAuthorized}, "", http.StatusConflict},
+	}
+	for _, c := range callbacks {
+		body, _ := json.Marshal(c.callback)
+		signature := c.signature
+		if signature == "" {
+			signature = verifier.Sign(body)
+		}
+		req, _ := http.NewRequest(http.MethodPost, "/v1/payments/callback", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(payment.SignatureHeader, signature)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		assert.Equal(t, c.status, rec.Code, "callback %s %s", c.callback.Reference, c.callback.Status)
+	}
+
+	imports := []struct {
+		path string
+		body string
+	}{
+		{"/v1/imports/users?dry_run=true", "id,name\nlegacy-1,Pepe\n"},
+		{"/v1/imports/sales", "user_id,amount,status,created_at\n" + u.ID + ",12.5,approved,2020-01-02T03:04:05Z\n" + u.ID + ",-1,approved,\n"},
+	}
+	for _, i := range imports {
+		req, _ := http.NewRequest(http.MethodPost, i.path, strings.NewReader(i.body))
+		req.Header.Set("Content-Type", "text/csv")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code, i.path)
+	}
+
+	for _, path := range []string{"/users/" + u.ID, "/healthz", "/readyz", "/metrics", "/openapi.json"} {
+		assert.Equal(t, http.StatusOK, call(r, http.MethodGet, path, nil).Code, path)
+	}
+	assert.Equal(t, http.StatusNoContent, call(r, http.MethodDelete, "/v1/users/"+u.ID, nil).Code)
+
+	assert.Empty(t, violations)
+}
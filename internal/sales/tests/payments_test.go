@@ -0,0 +1,446 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ej_final/internal/coupon"
+	"ej_final/internal/payment"
+	"ej_final/internal/sales"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func paymentStatus(t *testing.T, gateway *payment.Fake, sale *sales.Sales) string {
+	tx, err := gateway.Transaction(context.Background(), sale.PaymentID)
+	require.NoError(t, err)
+	return tx.Status
+}
+
+func TestService_Create_WithPayments(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	catalog, productID := newCatalog(t, 10)
+	coupons := newCoupons(t,
+		&coupon.Coupon{Code: "UNO", Kind: coupon.KindFixed, Value: 1},
+		&coupon.Coupon{Code: "CUELGA", Kind: coupon.KindFixed, Value: 1.48})
+	gateway := payment.NewFake()
+	storage := sales.NewLocalStorage()
+	s := sales.NewService(storage, zap.NewNop(), server.URL,
+		sales.WithPayments(gateway), sales.WithCatalog(catalog), sales.WithCoupons(coupons))
+	ctx := context.Background()
+
+	// Autorizada: queda pendiente hasta que se apruebe
+	for i := 0; i < 10; i++ {
+		sale := &sales.Sales{UserID: "ana", Amount: 10}
+		require.NoError(t, s.Create(ctx, sale))
+		require.Equal(t, "pending", sale.Status)
+		require.NotEmpty(t, sale.PaymentID)
+		require.Equal(t, payment.StatusAuthorized, paymentStatus(t, gateway, sale))
+	}
+
+	// Rechazada por el gateway: se devuelven el cupon y el stock
+	sale := &sales.Sales{UserID: "ana", Amount: 11.51, CouponCodes: []string{"UNO"}}
+	require.NoError(t, s.Create(ctx, sale))
+	require.Equal(t, float32(10.51), sale.Amount)
+	require.Equal(t, "rejected", sale.Status)
+	require.Equal(t, payment.StatusDeclined, paymentStatus(t, gateway, sale))
+	require.Zero(t, usesOf(t, coupons, "UNO"))
+
+	// Si el gateway no contesta la venta no se crea: 2 x 2.5 - 1.48 = 3.52
+	err := s.Create(ctx, &sales.Sales{UserID: "ana", CouponCodes: []string{"CUELGA"},
+		Lines: []sales.Line{{ProductID: productID, Quantity: 2}}})
+	require.ErrorIs(t, err, payment.ErrTimeout)
+	require.Equal(t, 10, stockOf(t, catalog, productID))
+	require.Zero(t, reservedOf(t, catalog, productID))
+	require.Zero(t, usesOf(t, coupons, "CUELGA"))
+	all, err := storage.GetAll(ctx, "ana")
+	require.NoError(t, err)
+	require.Len(t, all, 11)
+}
+
+func TestService_Update_WithPayments(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	catalog, productID := newCatalog(t, 10)
+	gateway := payment.NewFake()
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), server.URL,
+		sales.WithPayments(gateway), sales.WithCatalog(catalog))
+	ctx := context.Background()
+
+	sale := createPending(t, s, productID, 2)
+	updated, err := s.Update(ctx, sale.ID, "approved")
+	require.NoError(t, err)
+	require.Equal(t, "approved", updated.Status)
+	require.Equal(t, payment.StatusCaptured, paymentStatus(t, gateway, sale))
+	require.Equal(t, 8, stockOf(t, catalog, productID))
+
+	// La devolucion pasa primero por el gateway
+	_, _, err = s.Refund(ctx, sale.ID, 2, "se rompio")
+	require.NoError(t, err)
+	tx, err := gateway.Transaction(ctx, sale.PaymentID)
+	require.NoError(t, err)
+	require.Equal(t, float32(2), tx.Refunded)
+
+	// El cobro rechazado deja la venta pendiente
+	declined := &sales.Sales{UserID: "ana", Amount: 4.53}
+	require.NoError(t, s.Create(ctx, declined))
+	_, err = s.Update(ctx, declined.ID, "approved")
+	require.ErrorIs(t, err, sales.ErrPaymentDeclined)
+	stored, err := s.Get(ctx, declined.ID)
+	require.NoError(t, err)
+	require.Equal(t, "pending", stored.Status)
+
+	_, err = s.Update(ctx, declined.ID, "rejected")
+	require.NoError(t, err)
+
+	// Rechazar o cancelar anula el pago autorizado
+	sale = createPending(t, s, productID, 1)
+	_, err = s.Update(ctx, sale.ID, "rejected")
+	require.NoError(t, err)
+	require.Equal(t, payment.StatusVoided, paymentStatus(t, gateway, sale))
+
+	sale = createPending(t, s, productID, 1)
+	_, err = s.Cancel(ctx, sale.ID, "se arrepintio")
+	require.NoError(t, err)
+	require.Equal(t, payment.StatusVoided, paymentStatus(t, gateway, sale))
+	require.Equal(t, 8, stockOf(t, catalog, productID))
+}
+
+func TestService_CreateBatch_WithPayments(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	gateway := payment.NewFake()
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), server.URL, sales.WithPayments(gateway))
+	ctx := context.Background()
+
+	// Un item que no se pudo autorizar aborta el batch y anula los pagos de los demas
+	items := []*sales.Sales{{UserID: "ana", Amount: 5}, {UserID: "ana", Amount: 5.52}}
+	results, err := s.CreateBatch(ctx, items, sales.BatchAllOrNothing)
+	require.NoError(t, err)
+	require.ErrorIs(t, results[0].Err, sales.ErrBatchAborted)
+	require.ErrorIs(t, results[1].Err, payment.ErrTimeout)
+	require.Equal(t, payment.StatusVoided, paymentStatus(t, gateway, items[0]))
+
+	items = []*sales.Sales{{UserID: "ana", Amount: 5}, {UserID: "ana", Amount: 5.51}}
+	results, err = s.CreateBatch(ctx, items, sales.BatchBestEffort)
+	require.NoError(t, err)
+	require.Equal(t, "pending", results[0].Sale.Status)
+	require.Equal(t, "rejected", results[1].Sale.Status)
+
+	updates, err := s.UpdateBatch(ctx, []sales.StatusChange{{ID: items[0].ID, Status: "approved"}}, sales.BatchBestEffort)
+	require.NoError(t, err)
+	require.NoError(t, updates[0].Err)
+	require.Equal(t, payment.StatusCaptured, paymentStatus(t, gateway, items[0]))
+}
+
+// countingAuthorizations cuenta las autorizaciones pedidas al gateway.
+type countingAuthorizations struct {
+	*payment.Fake
+	calls atomic.Int32
+}
+
+func (g *countingAuthorizations) Authorize(ctx context.Context, req payment.Request) (*payment.Result, error) {
+	g.calls.Add(1)
+	return g.Fake.Authorize(ctx, req)
+}
+
+func TestService_CreateBatch_AllOrNothingAuthorizesOnlyValidBatches(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	gateway := &countingAuthorizations{Fake: payment.NewFake()}
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), server.URL, sales.WithPayments(gateway))
+	ctx := context.Background()
+
+	// Con un item invalido no se autoriza ninguno
+	items := []*sales.Sales{{UserID: "ana", Amount: 5}, {UserID: "nadie", Amount: 5}, {UserID: "ana", Amount: 6}}
+	results, err := s.CreateBatch(ctx, items, sales.BatchAllOrNothing)
+	require.NoError(t, err)
+	require.ErrorIs(t, results[0].Err, sales.ErrBatchAborted)
+	require.ErrorIs(t, results[1].Err, sales.ErrUserNotFound)
+	require.ErrorIs(t, results[2].Err, sales.ErrBatchAborted)
+	require.Zero(t, gateway.calls.Load())
+
+	// Despues de la primera autorizacion fallida no se autoriza el resto
+	items = []*sales.Sales{{UserID: "ana", Amount: 5}, {UserID: "ana", Amount: 5.52}, {UserID: "ana", Amount: 6}}
+	results, err = s.CreateBatch(ctx, items, sales.BatchAllOrNothing)
+	require.NoError(t, err)
+	require.ErrorIs(t, results[1].Err, payment.ErrTimeout)
+	require.ErrorIs(t, results[2].Err, sales.ErrBatchAborted)
+	require.Equal(t, int32(2), gateway.calls.Load())
+	require.Equal(t, payment.StatusVoided, paymentStatus(t, gateway.Fake, items[0]))
+	require.Empty(t, items[2].PaymentID)
+
+	// En best effort se autorizan todos los validos
+	gateway.calls.Store(0)
+	items = []*sales.Sales{{UserID: "ana", Amount: 5}, {UserID: "ana", Amount: 5.52}, {UserID: "ana", Amount: 6}}
+	results, err = s.CreateBatch(ctx, items, sales.BatchBestEffort)
+	require.NoError(t, err)
+	require.NotNil(t, results[2].Sale)
+	require.Equal(t, int32(3), gateway.calls.Load())
+}
+
+// slowRefunds tarda en devolver, para que dos devoluciones lean la venta antes
+// de que se guarde la primera.
+type slowRefunds struct {
+	*payment.Fake
+}
+
+func (g slowRefunds) Refund(ctx context.Context, transactionID string, amount float32) error {
+	time.Sleep(50 * time.Millisecond)
+	return g.Fake.Refund(ctx, transactionID, amount)
+}
+
+func TestService_Refund_ConcurrentWithPayments(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	gateway := payment.NewFake()
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), server.URL,
+		sales.WithPayments(slowRefunds{gateway}))
+	ctx := context.Background()
+
+	sale := &sales.Sales{UserID: "ana", Amount: 100}
+	require.NoError(t, s.Create(ctx, sale))
+	_, err := s.Update(ctx, sale.ID, "approved")
+	require.NoError(t, err)
+
+	// Las dos entran: lo devuelto en el gateway es lo que registra la venta
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, errs[i] = s.Refund(ctx, sale.ID, 40, "se rompio")
+		}(i)
+	}
+	wg.Wait()
+	require.NoError(t, errs[0])
+	require.NoError(t, errs[1])
+
+	stored, err := s.Get(ctx, sale.ID)
+	require.NoError(t, err)
+	require.Equal(t, float32(80), stored.RefundedAmount)
+	require.Equal(t, sales.StatusPartiallyRefunded, stored.Status)
+	tx, err := gateway.Transaction(ctx, sale.PaymentID)
+	require.NoError(t, err)
+	require.Equal(t, stored.RefundedAmount, tx.Refunded)
+	refunds, err := s.Refunds(ctx, sale.ID)
+	require.NoError(t, err)
+	require.Len(t, refunds, 2)
+
+	// Con lo que queda solo una de otras dos pasa, y el gateway no devuelve de mas
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, errs[i] = s.Refund(ctx, sale.ID, 15, "otra")
+		}(i)
+	}
+	wg.Wait()
+	if errs[0] != nil {
+		errs[0], errs[1] = errs[1], errs[0]
+	}
+	require.NoError(t, errs[0])
+	require.ErrorIs(t, errs[1], sales.ErrRefundExceedsAmount)
+	stored, err = s.Get(ctx, sale.ID)
+	require.NoError(t, err)
+	require.Equal(t, float32(95), stored.RefundedAmount)
+	tx, err = gateway.Transaction(ctx, sale.PaymentID)
+	require.NoError(t, err)
+	require.Equal(t, stored.RefundedAmount, tx.Refunded)
+}
+
+func TestService_UpdateBatch_AllOrNothingUndoesApprovals(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	catalog, productID := newCatalog(t, 10)
+	gateway := payment.NewFake()
+	storage := sales.NewLocalStorage()
+	s := sales.NewService(storage, zap.NewNop(), server.URL,
+		sales.WithPayments(gateway), sales.WithCatalog(catalog))
+	ctx := context.Background()
+
+	sale := createPending(t, s, productID, 2)
+	declined := &sales.Sales{UserID: "ana", Amount: 4.53}
+	require.NoError(t, s.Create(ctx, declined))
+
+	// El segundo no se cobra: el primero ya se habia cobrado y se devuelve todo
+	results, err := s.UpdateBatch(ctx, []sales.StatusChange{
+		{ID: sale.ID, Status: "approved"},
+		{ID: declined.ID, Status: "approved"},
+	}, sales.BatchAllOrNothing)
+	require.NoError(t, err)
+	require.ErrorIs(t, results[0].Err, sales.ErrBatchAborted)
+	require.ErrorIs(t, results[1].Err, sales.ErrPaymentDeclined)
+	require.Equal(t, payment.StatusVoided, paymentStatus(t, gateway, sale))
+	require.Equal(t, 10, stockOf(t, catalog, productID))
+	require.Zero(t, reservedOf(t, catalog, productID))
+	stored, err := storage.Read(ctx, sale.ID)
+	require.NoError(t, err)
+	require.Equal(t, "pending", stored.Status)
+}
+
+// recordedRefunds revisa que la devolucion ya este guardada cuando el gateway
+// devuelve la plata, y falla si fail esta en true.
+type recordedRefunds struct {
+	*payment.Fake
+	service *sales.Service
+	saleID  string
+	fail    bool
+	t       *testing.T
+}
+
+func (g *recordedRefunds) Refund(ctx context.Context, transactionID string, amount float32) error {
+	refunds, err := g.service.Refunds(ctx, g.saleID)
+	require.NoError(g.t, err)
+	require.NotEmpty(g.t, refunds)
+	require.Equal(g.t, sales.RefundPending, refunds[len(refunds)-1].Status)
+	if g.fail {
+		return payment.ErrTimeout
+	}
+	return g.Fake.Refund(ctx, transactionID, amount)
+}
+
+// unconfirmedRefunds no puede marcar las devoluciones como completas.
+type unconfirmedRefunds struct {
+	sales.Storage
+}
+
+func (unconfirmedRefunds) UpdateRefund(ctx context.Context, refund *sales.Refund) error {
+	return errors.New("storage caido")
+}
+
+func TestService_Refund_RecordedBeforePaying(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	gateway := &recordedRefunds{Fake: payment.NewFake(), t: t}
+	storage := &unconfirmedRefunds{Storage: sales.NewLocalStorage()}
+	s := sales.NewService(storage, zap.NewNop(), server.URL, sales.WithPayments(gateway))
+	gateway.service = s
+	ctx := context.Background()
+
+	sale := &sales.Sales{UserID: "ana", Amount: 100}
+	require.NoError(t, s.Create(ctx, sale))
+	_, err := s.Update(ctx, sale.ID, "approved")
+	require.NoError(t, err)
+	gateway.saleID = sale.ID
+
+	// Si el gateway falla la venta vuelve a como estaba y la devolucion queda fallida
+	gateway.fail = true
+	_, _, err = s.Refund(ctx, sale.ID, 40, "se rompio")
+	require.ErrorIs(t, err, payment.ErrTimeout)
+	stored, err := s.Get(ctx, sale.ID)
+	require.NoError(t, err)
+	require.Equal(t, "approved", stored.Status)
+	require.Zero(t, stored.RefundedAmount)
+	refunds, err := s.Refunds(ctx, sale.ID)
+	require.NoError(t, err)
+	require.Len(t, refunds, 1)
+	require.Equal(t, sales.RefundFailed, refunds[0].Status)
+
+	// Pagada pero sin poder confirmarla: la venta la cuenta y sigue pendiente, no se pierde
+	gateway.fail = false
+	updated, refund, err := s.Refund(ctx, sale.ID, 40, "se rompio")
+	require.NoError(t, err)
+	require.Equal(t, sales.RefundPending, refund.Status)
+	require.Equal(t, float32(40), updated.RefundedAmount)
+	stored, err = s.Get(ctx, sale.ID)
+	require.NoError(t, err)
+	require.Equal(t, float32(40), stored.RefundedAmount)
+	require.Equal(t, sales.StatusPartiallyRefunded, stored.Status)
+	tx, err := gateway.Transaction(ctx, sale.PaymentID)
+	require.NoError(t, err)
+	require.Equal(t, stored.RefundedAmount, tx.Refunded)
+	refunds, err = s.Refunds(ctx, sale.ID)
+	require.NoError(t, err)
+	require.Len(t, refunds, 2)
+	require.Equal(t, sales.RefundPending, refunds[1].Status)
+}
+
+// approveBeforeWrite aprueba la venta justo antes de la primera escritura
+// versionada y despues la hace fallar, como si otro pedido ganara la carrera.
+type approveBeforeWrite struct {
+	sales.Storage
+	done    bool
+	approve bool
+	service *sales.Service
+	t       *testing.T
+}
+
+func (a *approveBeforeWrite) SetVersioned(ctx context.Context, ss []*sales.Sales) error {
+	if a.done {
+		return a.Storage.SetVersioned(ctx, ss)
+	}
+	a.done = true
+	if a.approve {
+		_, err := a.service.Update(ctx, ss[0].ID, "approved")
+		require.NoError(a.t, err)
+	}
+	return sales.ErrVersionConflict
+}
+
+func TestService_Update_WriteFailsUndoesApproval(t *testing.T) {
+	server, _, _ := newUsersServer(t, "ana")
+	catalog, productID := newCatalog(t, 10)
+	gateway := payment.NewFake()
+	storage := &approveBeforeWrite{Storage: sales.NewLocalStorage(), t: t}
+	s := sales.NewService(storage, zap.NewNop(), server.URL,
+		sales.WithPayments(gateway), sales.WithCatalog(catalog))
+	storage.service = s
+	ctx := context.Background()
+
+	// La venta no se guardo aprobada: se anula el cobro y vuelve el stock
+	sale := createPending(t, s, productID, 2)
+	_, err := s.Update(ctx, sale.ID, "approved")
+	require.ErrorIs(t, err, sales.ErrVersionConflict)
+	require.Equal(t, payment.StatusVoided, paymentStatus(t, gateway, sale))
+	require.Equal(t, 10, stockOf(t, catalog, productID))
+	require.Zero(t, reservedOf(t, catalog, productID))
+
+	// Si el que gano tambien la aprobo, el cobro y el stock son los suyos
+	storage.done, storage.approve = false, true
+	sale = createPending(t, s, productID, 2)
+	_, err = s.Update(ctx, sale.ID, "approved")
+	require.ErrorIs(t, err, sales.ErrVersionConflict)
+	require.Equal(t, payment.StatusCaptured, paymentStatus(t, gateway, sale))
+	require.Equal(t, 8, stockOf(t, catalog, productID))
+	stored, err := s.Get(ctx, sale.ID)
+	require.NoError(t, err)
+	require.Equal(t, "approved", stored.Status)
+}
+
+func TestService_Integracion_Payments(t *testing.T) {
+	stub := payment.NewStub(time.Second)
+	gateway := httptest.NewServer(stub)
+	defer gateway.Close()
+	t.Setenv("PAYMENT_GATEWAY_URL", gateway.URL)
+	t.Setenv("PAYMENT_GATEWAY_TIMEOUT", "100ms")
+	r := newRouter(t)
+	userID := createUser(t, r, "Juancito")
+
+	// Un pago rechazado al autorizar deja la venta rechazada
+	rec := call(r, http.MethodPost, "/v1/sales", map[string]any{"user_id": userID, "amount": 7.51})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var sale sales.Sales
+	decode(t, rec, &sale)
+	require.Equal(t, "rejected", sale.Status)
+	require.NotEmpty(t, sale.PaymentID)
+
+	rec = call(r, http.MethodPost, "/v1/sales", map[string]any{"user_id": userID, "amount": 7.52})
+	require.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	require.Equal(t, "payment_timeout", problemCode(t, rec))
+
+	// Autorizada queda pendiente, y aprobarla cobra el pago
+	rec = call(r, http.MethodPost, "/v1/sales", map[string]any{"user_id": userID, "amount": 10})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	sale = sales.Sales{}
+	decode(t, rec, &sale)
+	require.Equal(t, "pending", sale.Status)
+
+	rec = call(r, http.MethodPatch, "/v1/sales/"+sale.ID, map[string]string{"status": "approved"})
+	require.Equal(t, http.StatusOK, rec.Code)
+	decode(t, rec, &sale)
+	require.Equal(t, "approved", sale.Status)
+	require.Equal(t, payment.StatusCaptured, paymentStatus(t, stub.Fake, &sale))
+}
@@ -0,0 +1,220 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ej_final/api"
+	"ej_final/internal/sales"
+	"ej_final/internal/user"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestService_Cancel(t *testing.T) {
+	storage := sales.NewLocalStorage()
+	seedSales(t, storage, map[string]string{"p": "pending", "a": "approved"})
+	s := sales.NewService(storage, zap.NewNop(), "http://localhost:0")
+
+	_, err := s.Cancel(context.Background(), "p", "  ")
+	require.ErrorIs(t, err, sales.ErrMissingReason)
+
+	sale, err := s.Cancel(context.Background(), "p", "se arrepintio")
+	require.NoError(t, err)
+	require.Equal(t, sales.StatusCancelled, sale.Status)
+	require.Equal(t, "se arrepintio", sale.CancelReason)
+	require.Equal(t, 2, sale.Version)
+
+	// Ni una aprobada ni una ya cancelada se pueden cancelar
+	_, err = s.Cancel(context.Background(), "a", "tarde")
+	require.ErrorIs(t, err, sales.ErrInvalidTransition)
+	_, err = s.Cancel(context.Background(), "p", "otra vez")
+	require.ErrorIs(t, err, sales.ErrInvalidTransition)
+	_, err = s.Cancel(context.Background(), "nope", "no existe")
+	require.ErrorIs(t, err, sales.ErrNotFound)
+}
+
+func TestService_Refund_PartialThenFull(t *testing.T) {
+	storage := sales.NewLocalStorage()
+	seedSales(t, storage, map[string]string{"a": "approved"})
+	s := sales.NewService(storage, zap.NewNop(), "http://localhost:0")
+
+	sale, refund, err := s.Refund(context.Background(), "a", 3.3, "faltaba una pieza")
+	require.NoError(t, err)
+	require.Equal(t, sales.StatusPartiallyRefunded, sale.Status)
+	require.InDelta(t, 3.3, sale.RefundedAmount, 0.001)
+	require.Equal(t, "a", refund.SaleID)
+	require.Equal(t, "ana", refund.UserID)
+	require.Equal(t, sales.RefundCompleted, refund.Status)
+
+	_, _, err = s.Refund(context.Background(), "a", 7, "todo")
+	require.ErrorIs(t, err, sales.ErrRefundExceedsAmount)
+
+	// El resto con redondeo de float32 devuelve la venta completa
+	sale, _, err = s.Refund(context.Background(), "a", 6.7, "el resto")
+	require.NoError(t, err)
+	require.Equal(t, sales.StatusRefunded, sale.Status)
+	require.Equal(t, sale.Amount, sale.RefundedAmount)
+	require.Equal(t, 3, sale.Version)
+
+	_, _, err = s.Refund(context.Background(), "a", 0.01, "de mas")
+	require.ErrorIs(t, err, sales.ErrInvalidTransition)
+
+	refunds, err := s.Refunds(context.Background(), "a")
+	require.NoError(t, err)
+	require.Len(t, refunds, 2)
+	require.Equal(t, "faltaba una pieza", refunds[0].Reason)
+	require.Equal(t, "el resto", refunds[1].Reason)
+
+	sum, err := s.Summary(context.Background(), "ana")
+	require.NoError(t, err)
+	require.Equal(t, 1, sum.ByStatus[sales.StatusRefunded])
+	require.InDelta(t, 10, sum.RefundedAmount, 0.001)
+}
+
+func TestService_Refund_ClampsToRemaining(t *testing.T) {
+	storage := sales.NewLocalStorage()
+	seedSales(t, storage, map[string]string{"a": "approved"})
+	s := sales.NewService(storage, zap.NewNop(), "http://localhost:0")
+	ctx := context.Background()
+
+	_, _, err := s.Refund(ctx, "a", 4, "una parte")
+	require.NoError(t, err)
+
+	// Medio centavo de mas se acepta, pero se registra solo lo que quedaba
+	sale, refund, err := s.Refund(ctx, "a", 6.004, "el resto")
+	require.NoError(t, err)
+	require.Equal(t, sales.StatusRefunded, sale.Status)
+	require.Equal(t, float32(6), refund.Amount)
+
+	refunds, err := s.Refunds(ctx, "a")
+	require.NoError(t, err)
+	var total float32
+	for _, r := range refunds {
+		total += r.Amount
+	}
+	require.LessOrEqual(t, total, sale.Amount)
+	require.Equal(t, sale.RefundedAmount, total)
+}
+
+func TestService_Refund_Invalid(t *testing.T) {
+	storage := sales.NewLocalStorage()
+	seedSales(t, storage, map[string]string{"p": "pending", "a": "approved"})
+	s := sales.NewService(storage, zap.NewNop(), "http://localhost:0")
+
+	_, _, err := s.Refund(context.Background(), "a", 0, "nada")
+	require.ErrorIs(t, err, sales.ErrInvalidAmount)
+	_, _, err = s.Refund(context.Background(), "a", 1, "")
+	require.ErrorIs(t, err, sales.ErrMissingReason)
+	_, _, err = s.Refund(context.Background(), "p", 1, "no se cobro")
+	require.ErrorIs(t, err, sales.ErrInvalidTransition)
+	_, _, err = s.Refund(context.Background(), "a", 10.5, "de mas")
+	require.ErrorIs(t, err, sales.ErrRefundExceedsAmount)
+	_, err = s.Refunds(context.Background(), "nope")
+	require.ErrorIs(t, err, sales.ErrNotFound)
+
+	refunds, err := s.Refunds(context.Background(), "a")
+	require.NoError(t, err)
+	require.Empty(t, refunds)
+}
+
+func TestLocalStorage_SetRefund_VersionConflict(t *testing.T) {
+	storage := sales.NewLocalStorage()
+	seedSales(t, storage, map[string]string{"a": "approved"})
+
+	sale, err := storage.Read(context.Background(), "a")
+	require.NoError(t, err)
+	// Sin subir la version es una escritura vieja y no se guarda nada
+	err = storage.SetRefund(context.Background(), sale, &sales.Refund{ID: "r1", SaleID: "a", Amount: 1})
+	require.ErrorIs(t, err, sales.ErrVersionConflict)
+
+	refunds, err := storage.Refunds(context.Background(), "a")
+	require.NoError(t, err)
+	require.Empty(t, refunds)
+
+	// Borrar la venta se lleva sus devoluciones
+	sale.Version++
+	require.NoError(t, storage.SetRefund(context.Background(), sale, &sales.Refund{ID: "r1", SaleID: "a", Amount: 1}))
+	require.NoError(t, storage.Delete(context.Background(), "a"))
+	refunds, err = storage.Refunds(context.Background(), "a")
+	require.NoError(t, err)
+	require.Empty(t, refunds)
+}
+
+func TestService_Integracion_Refunds(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	server := httptest.NewServer(r)
+	defer server.Close()
+	api.InitRoutes(r, server.URL)
+
+	do := func(method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req, _ := http.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var ana user.User
+	json.Unmarshal(do(http.MethodPost, "/v1/users", map[string]string{"name": "Ana"}).Body.Bytes(), &ana)
+
+	// El estado inicial es aleatorio, creamos hasta tener una pendiente
+	var sale sales.Sales
+	for i := 0; i < 50 && sale.Status != "pending"; i++ {
+		rec := do(http.MethodPost, "/v1/sales", map[string]any{"user_id": ana.ID, "amount": 20})
+		require.Equal(t, http.StatusCreated, rec.Code)
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &sale))
+	}
+	require.Equal(t, "pending", sale.Status)
+
+	rec := do(http.MethodPost, "/v1/sales/"+sale.ID+"/refunds", map[string]any{"amount": 5, "reason": "x"})
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = do(http.MethodPatch, "/v1/sales/"+sale.ID, map[string]string{"status": "approved"})
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = do(http.MethodPost, "/v1/sales/"+sale.ID+"/refunds", map[string]any{"amount": 5, "reason": "llego roto"})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var created struct {
+		Sale   sales.Sales  `json:"sale"`
+		Refund sales.Refund `json:"refund"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	require.Equal(t, sales.StatusPartiallyRefunded, created.Sale.Status)
+	require.Equal(t, float32(5), created.Refund.Amount)
+
+	rec = do(http.MethodPost, "/v1/sales/"+sale.ID+"/refunds", map[string]any{"amount": 16, "reason": "todo"})
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.Contains(t, rec.Body.String(), "refund_exceeds_amount")
+
+	rec = do(http.MethodGet, "/v1/sales/"+sale.ID+"/refunds", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list struct {
+		Results       []sales.Refund `json:"results"`
+		TotalRefunded float32        `json:"total_refunded"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	require.Len(t, list.Results, 1)
+	require.Equal(t, float32(5), list.TotalRefunded)
+
+	rec = do(http.MethodGet, "/v1/sales?user_id="+ana.ID+"&status=partially_refunded", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp api.SalesResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, 1, resp.Metadata.PartiallyRefunded)
+	require.Equal(t, float32(5), resp.Metadata.RefundedAmount)
+
+	rec = do(http.MethodPost, "/v1/sales/"+sale.ID+"/cancel", map[string]string{"reason": "tarde"})
+	require.Equal(t, http.StatusConflict, rec.Code)
+}
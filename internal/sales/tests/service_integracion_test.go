@@ -3,16 +3,21 @@ package tests
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"ej_final/api"
+	"ej_final/internal/apperror"
+	"ej_final/internal/health"
 	"ej_final/internal/sales"
 	"ej_final/internal/user"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestService_Integracion_HappyPath(t *testing.T) {
@@ -128,4 +133,379 @@ func TestService_Integracion_HappyPath(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, quantity_sales, response.Metadata.Quantity)
 	assert.InDelta(t, amount_sales, response.Metadata.TotalAmount, 0.1)
+
+	// Con las reglas por defecto el IVA va incluido: neto mas impuestos da el total
+	assert.Greater(t, response.Metadata.TaxAmount, float32(0))
+	assert.InDelta(t, response.Metadata.TotalAmount, response.Metadata.NetAmount+response.Metadata.TaxAmount, 0.01)
+	assert.InDelta(t, response.Metadata.TaxAmount, response.Metadata.Taxes["IVA"], 0.01)
+}
+
+func TestService_Integracion_Metrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	server := httptest.NewServer(r)
+	defer server.Close()
+	api.InitRoutes(r, server.URL)
+
+	// Crear usuario y venta para que haya metricas de negocio
+	userBody, _ := json.Marshal(map[string]string{"name": "Juancito"})
+	userRecorder := httptest.NewRecorder()
+	userReq, _ := http.NewRequest(http.MethodPost, "/users", bytes.NewBuffer(userBody))
+	r.ServeHTTP(userRecorder, userReq)
+
+	var createdUser user.User
+	json.Unmarshal(userRecorder.Body.Bytes(), &createdUser)
+
+	saleBody, _ := json.Marshal(map[string]interface{}{"user_id": createdUser.ID, "amount": 10})
+	saleRecorder := httptest.NewRecorder()
+	saleReq, _ := http.NewRequest(http.MethodPost, "/sales", bytes.NewBuffer(saleBody))
+	r.ServeHTTP(saleRecorder, saleReq)
+	assert.Equal(t, http.StatusCreated, saleRecorder.Code)
+
+	metricsRecorder := httptest.NewRecorder()
+	metricsReq, _ := http.NewRequest(http.MethodGet, "/metrics", nil)
+	r.ServeHTTP(metricsRecorder, metricsReq)
+
+	assert.Equal(t, http.StatusOK, metricsRecorder.Code)
+	body := metricsRecorder.Body.String()
+	assert.Contains(t, body, `http_requests_total{method="POST",route="/sales",status="201"} 1`)
+	assert.Contains(t, body, `sales_user_lookup_duration_seconds_count{outcome="found"} 1`)
+	assert.Contains(t, body, "# TYPE sales_created_total counter")
+	assert.Contains(t, body, "# TYPE sales_pending gauge")
+}
+
+func TestService_Integracion_Health(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	server := httptest.NewServer(r)
+	defer server.Close()
+	api.InitRoutes(r, server.URL)
+
+	liveRecorder := httptest.NewRecorder()
+	liveReq, _ := http.NewRequest(http.MethodGet, "/healthz", nil)
+	r.ServeHTTP(liveRecorder, liveReq)
+	assert.Equal(t, http.StatusOK, liveRecorder.Code)
+
+	readyRecorder := httptest.NewRecorder()
+	readyReq, _ := http.NewRequest(http.MethodGet, "/readyz", nil)
+	r.ServeHTTP(readyRecorder, readyReq)
+	assert.Equal(t, http.StatusOK, readyRecorder.Code)
+
+	var report health.Report
+	err := json.Unmarshal(readyRecorder.Body.Bytes(), &report)
+	assert.NoError(t, err)
+	assert.Equal(t, health.StatusUp, report.Status)
+	assert.Len(t, report.Checks, 5)
+
+	// Si el API de usuarios no responde, la instancia no esta lista
+	server.Close()
+	downRecorder := httptest.NewRecorder()
+	r.ServeHTTP(downRecorder, readyReq)
+	assert.Equal(t, http.StatusServiceUnavailable, downRecorder.Code)
+}
+
+func TestService_Integracion_ProblemDetails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	server := httptest.NewServer(r)
+	defer server.Close()
+	api.InitRoutes(r, server.URL)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{"missing user_id", http.MethodGet, "/sales", "", http.StatusBadRequest, apperror.CodeMissingParameter},
+		{"invalid status filter", http.MethodGet, "/sales?user_id=1&status=foo", "", http.StatusBadRequest, "invalid_status"},
+		{"sale not found", http.MethodPatch, "/sales/nope", `{"status":"approved"}`, http.StatusNotFound, "sale_not_found"},
+		{"user not found", http.MethodGet, "/users/nope", "", http.StatusNotFound, "user_not_found"},
+		{"invalid body", http.MethodPost, "/sales", `{"amount":"mucho"}`, http.StatusBadRequest, apperror.CodeInvalidBody},
+		{"unknown user", http.MethodPost, "/sales", `{"user_id":"nope","amount":10}`, http.StatusBadRequest, "unknown_user"},
+		{"unknown route", http.MethodGet, "/nada", "", http.StatusNotFound, apperror.CodeRouteNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			r.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.status, recorder.Code)
+			assert.Equal(t, apperror.ContentType, recorder.Header().Get("Content-Type"))
+
+			var problem apperror.Problem
+			err := json.Unmarshal(recorder.Body.Bytes(), &problem)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.code, problem.Code)
+			assert.Equal(t, tt.status, problem.Status)
+			assert.NotEmpty(t, problem.RequestID)
+		})
+	}
+}
+
+func TestService_Integracion_Versioning(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	server := httptest.NewServer(r)
+	defer server.Close()
+	api.InitRoutes(r, server.URL)
+
+	userBody, _ := json.Marshal(map[string]string{"name": "Juancito"})
+	createRecorder := httptest.NewRecorder()
+	createReq, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBuffer(userBody))
+	r.ServeHTTP(createRecorder, createReq)
+	assert.Equal(t, http.StatusCreated, createRecorder.Code)
+	assert.Empty(t, createRecorder.Header().Get("Deprecation"))
+
+	var createdUser user.User
+	json.Unmarshal(createRecorder.Body.Bytes(), &createdUser)
+
+	// Las mismas entidades se ven desde todas las versiones
+	for _, prefix := range []string{"/v1", "/v2", ""} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, prefix+"/users/"+createdUser.ID, nil)
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code, prefix)
+	}
+
+	// La ruta sin version es un alias deprecado de v1
+	legacyRecorder := httptest.NewRecorder()
+	legacyReq, _ := http.NewRequest(http.MethodGet, "/users/"+createdUser.ID, nil)
+	r.ServeHTTP(legacyRecorder, legacyReq)
+	assert.True(t, strings.HasPrefix(legacyRecorder.Header().Get("Deprecation"), "@"))
+	assert.NotEmpty(t, legacyRecorder.Header().Get("Sunset"))
+	assert.Equal(t, `</v1/users/`+createdUser.ID+`>; rel="successor-version"`, legacyRecorder.Header().Get("Link"))
+}
+
+func TestService_Integracion_BatchManyUsers(t *testing.T) {
+	t.Setenv("API_KEYS", "test-0,test-1,test-2")
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	server := httptest.NewServer(r)
+	defer server.Close()
+	api.InitRoutes(r, server.URL)
+
+	// Mas usuarios distintos que el burst de GET /users/:id: las consultas internas no se limitan
+	const users = 150
+	items := make([]map[string]any, 0, users)
+	for i := 0; i < users; i++ {
+		body, _ := json.Marshal(map[string]string{"name": fmt.Sprintf("usuario %d", i)})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBuffer(body))
+		// Cada tanda con su propia key, si no el que se limita es el test creando usuarios
+		req.Header.Set("X-API-Key", fmt.Sprintf("test-%d", i/50))
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		var u user.User
+		json.Unmarshal(rec.Body.Bytes(), &u)
+		items = append(items, map[string]any{"user_id": u.ID, "amount": 10})
+	}
+
+	body, _ := json.Marshal(map[string]any{"mode": "best_effort", "items": items})
+	req, _ := http.NewRequest(http.MethodPost, "/v1/sales/batch", bytes.NewBuffer(body))
+	req.Header.Set("X-API-Key", "test-0")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response struct {
+		Created int `json:"created"`
+		Failed  int `json:"failed"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	assert.Equal(t, users, response.Created)
+	assert.Zero(t, response.Failed)
+
+	// Un token inventado no saltea el limite
+	req, _ = http.NewRequest(http.MethodGet, "/v1/users/nope", nil)
+	req.Header.Set("X-API-Key", "test-1")
+	req.Header.Set(sales.InternalTokenHeader, "inventado")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.NotEmpty(t, rec.Header().Get("RateLimit-Limit"))
+}
+
+func TestService_Integracion_RateLimitInventedKeys(t *testing.T) {
+	t.Setenv("API_KEYS", "valida,otra")
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api.InitRoutes(r, "http://localhost:0")
+
+	do := func(key string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, "/v1/users/nope", nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Una key nueva por request no da un bucket nuevo: ni siquiera pasa
+	for i := 0; i < 3; i++ {
+		rec := do(fmt.Sprintf("inventada-%d", i))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		var problem apperror.Problem
+		json.Unmarshal(rec.Body.Bytes(), &problem)
+		assert.Equal(t, "invalid_api_key", problem.Code)
+	}
+
+	// Sin key tampoco, con API_KEYS configuradas la key es obligatoria
+	rec := do("")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	var problem apperror.Problem
+	json.Unmarshal(rec.Body.Bytes(), &problem)
+	assert.Equal(t, "missing_api_key", problem.Code)
+
+	// Cada key valida se limita hasta agotar su burst, y la otra tiene su propio bucket
+	var last *httptest.ResponseRecorder
+	for i := 0; i < 101; i++ {
+		last = do("valida")
+	}
+	assert.Equal(t, http.StatusTooManyRequests, last.Code)
+	rec = do("otra")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "99", rec.Header().Get("RateLimit-Remaining"))
+
+	// Las rutas publicas siguen sin key
+	req, _ := http.NewRequest(http.MethodGet, "/healthz", nil)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+// newRouter levanta la API completa con InitRoutes; las consultas de usuarios
+// de sales van contra la misma API.
+func newRouter(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	api.InitRoutes(r, server.URL)
+	return r
+}
+
+// call manda body como JSON a path y devuelve la respuesta.
+func call(r http.Handler, method, path string, body any) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req, _ := http.NewRequest(method, path, &buf)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+// decode lee el body JSON de rec en v.
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v), rec.Body.String())
+}
+
+// problemCode es el code del problem+json de rec.
+func problemCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var p apperror.Problem
+	decode(t, rec, &p)
+	return p.Code
+}
+
+// createUser da de alta un usuario por la API y devuelve su ID.
+func createUser(t *testing.T, r http.Handler, name string) string {
+	t.Helper()
+	rec := call(r, http.MethodPost, "/v1/users", map[string]string{"name": name, "address": "suyuque"})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var u user.User
+	decode(t, rec, &u)
+	return u.ID
+}
+
+func TestService_Integracion_ListUsers(t *testing.T) {
+	r := newRouter(t)
+	for _, name := range []string{"Juancito", "Juana", "Pedro"} {
+		createUser(t, r, name)
+	}
+
+	rec := call(r, http.MethodGet, "/v1/users?search=jua&sort=name&order=desc&limit=1", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var page user.ListResult
+	decode(t, rec, &page)
+	require.Len(t, page.Users, 1)
+	require.Equal(t, "Juancito", page.Users[0].Name)
+	require.NotEmpty(t, page.NextCursor)
+
+	// La pagina siguiente con el mismo orden trae el resto de la busqueda
+	rec = call(r, http.MethodGet, "/v1/users?search=jua&sort=name&order=desc&limit=1&cursor="+page.NextCursor, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	page = user.ListResult{}
+	decode(t, rec, &page)
+	require.Len(t, page.Users, 1)
+	require.Equal(t, "Juana", page.Users[0].Name)
+	require.Empty(t, page.NextCursor)
+
+	rec = call(r, http.MethodGet, "/v1/users?cursor=roto", nil)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, "invalid_cursor", problemCode(t, rec))
+}
+
+func TestService_Integracion_Imports(t *testing.T) {
+	r := newRouter(t)
+	userID := createUser(t, r, "Juancito")
+
+	importCSV := func(path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/csv")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	type report struct {
+		Rows    int  `json:"rows"`
+		Valid   int  `json:"valid"`
+		Invalid int  `json:"invalid"`
+		Written int  `json:"written"`
+		DryRun  bool `json:"dry_run"`
+		Errors  []struct {
+			Row  int    `json:"row"`
+			Code string `json:"code"`
+		} `json:"errors"`
+	}
+
+	// En dry run solo se valida, el usuario no queda creado
+	rec := importCSV("/v1/imports/users?dry_run=true", "id,name\nlegacy-1,Pepe\n")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var rep report
+	decode(t, rec, &rep)
+	require.True(t, rep.DryRun)
+	require.Equal(t, 1, rep.Valid)
+	require.Zero(t, rep.Written)
+	require.Equal(t, http.StatusNotFound, call(r, http.MethodGet, "/v1/users/legacy-1", nil).Code)
+
+	rec = importCSV("/v1/imports/sales", "user_id,amount,status,created_at\n"+
+		userID+",12.5,approved,2020-01-02T03:04:05Z\n"+userID+",-1,approved,\n")
+	require.Equal(t, http.StatusOK, rec.Code)
+	rep = report{}
+	decode(t, rec, &rep)
+	require.Equal(t, 2, rep.Rows)
+	require.Equal(t, 1, rep.Written)
+	require.Len(t, rep.Errors, 1)
+	require.Equal(t, 3, rep.Errors[0].Row)
+	require.Equal(t, "invalid_amount", rep.Errors[0].Code)
+
+	// La venta importada conserva su estado y su fecha
+	rec = call(r, http.MethodGet, "/v1/sales?user_id="+userID, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list api.SalesResponse
+	decode(t, rec, &list)
+	require.Len(t, list.Results, 1)
+	require.Equal(t, "approved", list.Results[0].Status)
+	require.Equal(t, 2020, list.Results[0].CreatedAt.Year())
 }
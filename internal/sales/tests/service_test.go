@@ -1,7 +1,10 @@
 package tests
 
 import (
+	"context"
+	"ej_final/internal/requestid"
 	"ej_final/internal/sales"
+	"ej_final/internal/tracing"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -22,9 +25,99 @@ func TestService_Create_UserNotFound(t *testing.T) {
 		Amount: 1.0,
 	}
 
-	err := s.Create(input)
+	err := s.Create(context.Background(), input)
 
 	require.EqualError(t, err, sales.ErrUserNotFound.Error())
 	require.NotEmpty(t, input.UserID)
 	require.NotEmpty(t, input.Amount)
 }
+
+func TestService_Create_ForwardsRequestID(t *testing.T) {
+	var gotID string
+	mockHandler := http.NewServeMux()
+	mockHandler.HandleFunc("/v1/users/", func(w http.ResponseWriter, r *http.Request) {
+		gotID = r.Header.Get(requestid.Header)
+		w.WriteHeader(http.StatusOK)
+	})
+	mockServer := httptest.NewServer(mockHandler)
+	defer mockServer.Close()
+
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), mockServer.URL)
+
+	ctx := requestid.NewContext(context.Background(), "req-123")
+	err := s.Create(ctx, &sales.Sales{UserID: "Pepe", Amount: 10})
+
+	require.NoError(t, err)
+	require.Equal(t, "req-123", gotID)
+}
+
+func TestService_Create_ContextCancelled(t *testing.T) {
+	mockHandler := http.NewServeMux()
+	mockHandler.HandleFunc("/v1/users/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mockServer := httptest.NewServer(mockHandler)
+	defer mockServer.Close()
+
+	storage := sales.NewLocalStorage()
+	s := sales.NewService(storage, zap.NewNop(), mockServer.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := s.Create(ctx, &sales.Sales{UserID: "Pepe", Amount: 10})
+	require.ErrorIs(t, err, context.Canceled)
+
+	list, err := storage.GetAll(context.Background(), "Pepe")
+	require.NoError(t, err)
+	require.Empty(t, list)
+}
+
+func TestService_Create_PropagatesTraceparent(t *testing.T) {
+	var got string
+	mockHandler := http.NewServeMux()
+	mockHandler.HandleFunc("/v1/users/", func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(tracing.TraceparentHeader)
+		w.WriteHeader(http.StatusOK)
+	})
+	mockServer := httptest.NewServer(mockHandler)
+	defer mockServer.Close()
+
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), mockServer.URL)
+
+	ctx, root := tracing.NewTracer(nil).Start(context.Background(), "test", tracing.KindServer, tracing.SpanContext{})
+	defer root.End()
+
+	err := s.Create(ctx, &sales.Sales{UserID: "Pepe", Amount: 10})
+	require.NoError(t, err)
+
+	sc, ok := tracing.ParseTraceparent(got)
+	require.True(t, ok)
+	require.Equal(t, root.SpanContext().TraceID, sc.TraceID)
+	require.NotEqual(t, root.SpanContext().SpanID, sc.SpanID)
+}
+
+func TestService_Create_UsersUnavailable(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusServiceUnavailable} {
+		mockHandler := http.NewServeMux()
+		mockHandler.HandleFunc("/v1/users/", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		})
+		mockServer := httptest.NewServer(mockHandler)
+
+		// Solo un 404 quiere decir que el usuario no existe
+		s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), mockServer.URL)
+		err := s.Create(context.Background(), &sales.Sales{UserID: "Pepe", Amount: 10})
+		require.ErrorIs(t, err, sales.ErrUsersUnavailable, status)
+		require.NotErrorIs(t, err, sales.ErrUserNotFound)
+
+		results, err := s.CreateBatch(context.Background(), []*sales.Sales{{UserID: "Pepe", Amount: 1}}, sales.BatchBestEffort)
+		require.NoError(t, err)
+		require.ErrorIs(t, results[0].Err, sales.ErrUsersUnavailable)
+		mockServer.Close()
+	}
+
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), "http://127.0.0.1:1")
+	err := s.Create(context.Background(), &sales.Sales{UserID: "Pepe", Amount: 10})
+	require.ErrorIs(t, err, sales.ErrUsersUnavailable)
+}
@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ej_final/api"
+	"ej_final/internal/sales"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// iterateOnly esconde el Aggregate de LocalStorage para probar el camino en memoria del servicio.
+type iterateOnly struct {
+	sales.Storage
+}
+
+// seedStats carga ventas repartidas en enero de 2026 (el 5 es lunes).
+func seedStats(t *testing.T, storage sales.Storage) {
+	day := func(d int) time.Time { return time.Date(2026, 1, d, 12, 0, 0, 0, time.UTC) }
+	for _, s := range []*sales.Sales{
+		{ID: "1", UserID: "ana", Amount: 100, Status: "approved", CreatedAt: day(5)},
+		{ID: "2", UserID: "ana", Amount: 50, Status: "rejected", CreatedAt: day(5)},
+		{ID: "3", UserID: "beto", Amount: 30, Status: "approved", CreatedAt: day(6)},
+		{ID: "4", UserID: "beto", Amount: 20, Status: "pending", CreatedAt: day(13)},
+		{ID: "5", UserID: "carla", Amount: 500, Status: "approved", CreatedAt: day(31)},
+		{ID: "6", UserID: "carla", Amount: 999, Status: "approved", CreatedAt: time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)},
+	} {
+		require.NoError(t, storage.Set(context.Background(), s))
+	}
+}
+
+func TestService_Stats(t *testing.T) {
+	local := sales.NewLocalStorage()
+	seedStats(t, local)
+
+	for name, storage := range map[string]sales.Storage{"aggregator": local, "iterate": iterateOnly{local}} {
+		t.Run(name, func(t *testing.T) {
+			s := sales.NewService(storage, zap.NewNop(), "http://localhost:0")
+			stats, err := s.Stats(context.Background(), sales.StatsQuery{
+				From:     time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC),
+				To:       time.Date(2026, 1, 19, 0, 0, 0, 0, time.UTC),
+				Interval: sales.IntervalWeek,
+				TopUsers: 1,
+			})
+			require.NoError(t, err)
+
+			require.Equal(t, 4, stats.Totals.Count)
+			require.Equal(t, 200.0, stats.Totals.Amount)
+			require.Equal(t, 50.0, stats.Totals.AverageTicket)
+			require.InDelta(t, 2.0/3.0, stats.Totals.ApprovalRate, 1e-9)
+			require.Equal(t, sales.StatusTotals{Count: 2, Amount: 130}, stats.Totals.ByStatus["approved"])
+
+			require.Len(t, stats.Buckets, 2)
+			require.Equal(t, time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC), stats.Buckets[0].Start)
+			require.Equal(t, 3, stats.Buckets[0].Count)
+			require.Equal(t, 1, stats.Buckets[1].Count)
+			require.Zero(t, stats.Buckets[1].ApprovalRate)
+
+			require.Equal(t, []sales.UserVolume{{UserID: "ana", Count: 2, Amount: 150}}, stats.TopUsers)
+		})
+	}
+}
+
+func TestService_Stats_RefundedCountAsApproved(t *testing.T) {
+	storage := sales.NewLocalStorage()
+	seedStats(t, storage)
+	s := sales.NewService(storage, zap.NewNop(), "http://localhost:0")
+	query := sales.StatsQuery{
+		From: time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2026, 1, 19, 0, 0, 0, 0, time.UTC),
+	}
+
+	before, err := s.Stats(context.Background(), query)
+	require.NoError(t, err)
+
+	// Devolver una venta aprobada no cambia la tasa de aprobacion
+	_, _, err = s.Refund(context.Background(), "1", 40, "una parte")
+	require.NoError(t, err)
+	_, _, err = s.Refund(context.Background(), "3", 30, "todo")
+	require.NoError(t, err)
+
+	after, err := s.Stats(context.Background(), query)
+	require.NoError(t, err)
+	require.Equal(t, 1, after.Totals.ByStatus[sales.StatusPartiallyRefunded].Count)
+	require.Equal(t, 1, after.Totals.ByStatus[sales.StatusRefunded].Count)
+	require.InDelta(t, before.Totals.ApprovalRate, after.Totals.ApprovalRate, 1e-9)
+}
+
+func TestService_Stats_MonthlyWithEmptyBuckets(t *testing.T) {
+	storage := sales.NewLocalStorage()
+	seedStats(t, storage)
+	s := sales.NewService(storage, zap.NewNop(), "http://localhost:0")
+
+	stats, err := s.Stats(context.Background(), sales.StatsQuery{
+		From:     time.Date(2025, 12, 15, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		Interval: sales.IntervalMonth,
+		UserID:   "carla",
+	})
+	require.NoError(t, err)
+	require.Len(t, stats.Buckets, 3)
+	require.Equal(t, 999.0, stats.Buckets[0].Amount)
+	require.Equal(t, 500.0, stats.Buckets[1].Amount)
+	require.Zero(t, stats.Buckets[2].Count)
+	require.Equal(t, 1.0, stats.Totals.ApprovalRate)
+}
+
+func TestService_Stats_InvalidQuery(t *testing.T) {
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), "http://localhost:0")
+	ctx := context.Background()
+	now := time.Now()
+
+	_, err := s.Stats(ctx, sales.StatsQuery{From: now, To: now.Add(time.Hour), Interval: "hour"})
+	require.ErrorIs(t, err, sales.ErrInvalidInterval)
+
+	_, err = s.Stats(ctx, sales.StatsQuery{From: now, To: now})
+	require.ErrorIs(t, err, sales.ErrInvalidRange)
+
+	_, err = s.Stats(ctx, sales.StatsQuery{From: now.AddDate(-10, 0, 0), To: now})
+	require.ErrorIs(t, err, sales.ErrInvalidRange)
+}
+
+func TestService_Integracion_Stats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	server := httptest.NewServer(r)
+	defer server.Close()
+	api.InitRoutes(r, server.URL)
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/v1/sales/stats?from=2026-01-01&to=2026-01-08", nil)
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var stats sales.Stats
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+	require.Equal(t, sales.IntervalDay, stats.Interval)
+	require.Len(t, stats.Buckets, 7)
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/stats?from=ayer", nil)
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "invalid_parameter")
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/stats?from=2026-02-01&to=2026-01-01", nil)
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "invalid_range")
+}
@@ -0,0 +1,203 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ej_final/api"
+	"ej_final/internal/sales"
+	"ej_final/internal/tax"
+	"ej_final/internal/user"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestLocalStorage_Summary(t *testing.T) {
+	storage := sales.NewLocalStorage()
+	ctx := context.Background()
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	sum, err := storage.Summary(ctx, "ana")
+	require.NoError(t, err)
+	require.Zero(t, sum.Count)
+	require.Nil(t, sum.LastSaleAt)
+	require.Equal(t, map[string]int{"pending": 0, "approved": 0, "rejected": 0, "cancelled": 0, "partially_refunded": 0, "refunded": 0}, sum.ByStatus)
+
+	require.NoError(t, storage.Set(ctx, &sales.Sales{ID: "a", UserID: "ana", Amount: 10, Status: "pending", CreatedAt: t0, Version: 1}))
+	require.NoError(t, storage.SetBatch(ctx, []*sales.Sales{
+		{ID: "b", UserID: "ana", Amount: 20, Status: "approved", CreatedAt: t0.Add(time.Hour), Version: 1},
+		{ID: "c", UserID: "beto", Amount: 5, Status: "pending", CreatedAt: t0, Version: 1},
+	}))
+	require.NoError(t, storage.SetVersioned(ctx, []*sales.Sales{
+		{ID: "a", UserID: "ana", Amount: 10, Status: "rejected", CreatedAt: t0, Version: 2},
+	}))
+
+	sum, err = storage.Summary(ctx, "ana")
+	require.NoError(t, err)
+	require.Equal(t, 2, sum.Count)
+	require.Equal(t, 30.0, sum.TotalAmount)
+	require.Equal(t, map[string]int{"pending": 0, "approved": 1, "rejected": 1, "cancelled": 0, "partially_refunded": 0, "refunded": 0}, sum.ByStatus)
+	require.Equal(t, t0.Add(time.Hour), *sum.LastSaleAt)
+
+	// Al borrar la venta mas nueva, LastSaleAt vuelve a la anterior
+	require.NoError(t, storage.Delete(ctx, "b"))
+	sum, err = storage.Summary(ctx, "ana")
+	require.NoError(t, err)
+	require.Equal(t, 1, sum.Count)
+	require.Equal(t, t0, *sum.LastSaleAt)
+
+	// El resumen devuelto es una copia
+	sum.ByStatus["rejected"] = 99
+	again, _ := storage.Summary(ctx, "ana")
+	require.Equal(t, 1, again.ByStatus["rejected"])
+}
+
+// TestLocalStorage_SummaryMatchesRebuild aplica escrituras al azar y compara el
+// resumen mantenido incrementalmente contra uno recalculado desde cero.
+func TestLocalStorage_SummaryMatchesRebuild(t *testing.T) {
+	storage := sales.NewLocalStorage()
+	ctx := context.Background()
+	rnd := rand.New(rand.NewSource(1))
+	users := []string{"ana", "beto", "carla"}
+	statuses := []string{"pending", "approved", "rejected"}
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 500; i++ {
+		id := fmt.Sprint(rnd.Intn(50))
+		if rnd.Intn(5) == 0 {
+			storage.Delete(ctx, id)
+			continue
+		}
+		require.NoError(t, storage.Set(ctx, &sales.Sales{
+			ID:        id,
+			UserID:    users[rnd.Intn(len(users))],
+			Amount:    float32(rnd.Intn(100) + 1),
+			Status:    statuses[rnd.Intn(len(statuses))],
+			CreatedAt: t0.Add(time.Duration(rnd.Intn(1000)) * time.Minute),
+		}))
+	}
+
+	before := map[string]*sales.Summary{}
+	for _, u := range users {
+		before[u], _ = storage.Summary(ctx, u)
+	}
+
+	n, err := storage.RebuildSummaries(ctx)
+	require.NoError(t, err)
+	require.LessOrEqual(t, n, len(users))
+
+	for _, u := range users {
+		after, _ := storage.Summary(ctx, u)
+		require.Equal(t, after.Count, before[u].Count, u)
+		require.Equal(t, after.LastSaleAt, before[u].LastSaleAt, u)
+		require.InDelta(t, after.TotalAmount, before[u].TotalAmount, 1e-6, u)
+		for st, c := range after.ByStatus {
+			require.Equal(t, c, before[u].ByStatus[st], u+" "+st)
+			require.Equal(t, after.Totals(st).Count, before[u].Totals(st).Count, u+" "+st)
+			require.InDelta(t, after.Totals(st).Amount, before[u].Totals(st).Amount, 1e-6, u+" "+st)
+		}
+	}
+}
+
+func TestLocalStorage_SummaryTotals(t *testing.T) {
+	storage := sales.NewLocalStorage()
+	ctx := context.Background()
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	iva := &tax.Breakdown{Inclusive: true, Net: 100, Tax: 21, Gross: 121, Lines: []tax.Line{{Name: "IVA", Rate: 0.21, Amount: 21}}}
+
+	require.NoError(t, storage.SetBatch(ctx, []*sales.Sales{
+		{ID: "a", UserID: "ana", Amount: 121, Status: "approved", Taxes: iva, CreatedAt: t0, Version: 1},
+		{ID: "b", UserID: "ana", Amount: 2, Status: "approved", Currency: "USD", ExchangeRate: 900, CreatedAt: t0, Version: 1},
+		{ID: "c", UserID: "ana", Amount: 50, Status: "pending", CreatedAt: t0, Version: 1},
+	}))
+
+	sum, err := storage.Summary(ctx, "ana")
+	require.NoError(t, err)
+	all := sum.Totals("")
+	require.Equal(t, 3, all.Count)
+	require.InDelta(t, 1971, all.Amount, 1e-6)
+	require.InDelta(t, 1950, all.Net, 1e-6)
+	require.InDelta(t, 21, all.Tax, 1e-6)
+	require.InDelta(t, 21, all.Taxes["IVA"], 1e-6)
+
+	approved := sum.Totals("approved")
+	require.Equal(t, 2, approved.Count)
+	require.InDelta(t, 1921, approved.Amount, 1e-6)
+	require.Zero(t, sum.Totals("rejected").Count)
+
+	// Un cambio de estado mueve la venta de un total al otro, con su devolucion
+	require.NoError(t, storage.SetVersioned(ctx, []*sales.Sales{
+		{ID: "a", UserID: "ana", Amount: 121, RefundedAmount: 121, Status: "refunded", Taxes: iva, CreatedAt: t0, Version: 2},
+	}))
+	require.NoError(t, storage.Delete(ctx, "c"))
+	sum, err = storage.Summary(ctx, "ana")
+	require.NoError(t, err)
+	require.Equal(t, 1, sum.Totals("approved").Count)
+	require.InDelta(t, 1800, sum.Totals("approved").Amount, 1e-6)
+	require.Zero(t, sum.Totals("approved").Tax)
+	require.InDelta(t, 121, sum.Totals("refunded").Refunded, 1e-6)
+	require.InDelta(t, 21, sum.Totals("refunded").Taxes["IVA"], 1e-6)
+	require.Zero(t, sum.Totals("pending").Count)
+	require.InDelta(t, 1921, sum.Totals("").Amount, 1e-6)
+}
+
+func TestService_Summary(t *testing.T) {
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), "http://localhost:0")
+
+	_, err := s.Summary(context.Background(), "")
+	require.ErrorIs(t, err, sales.ErrEmptyID)
+}
+
+func TestService_Integracion_Summary(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	server := httptest.NewServer(r)
+	defer server.Close()
+	api.InitRoutes(r, server.URL)
+
+	do := func(method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req, _ := http.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/v1/users", map[string]string{"name": "Juancito"})
+	var u user.User
+	json.Unmarshal(rec.Body.Bytes(), &u)
+
+	for _, amount := range []float64{10, 20, 30} {
+		rec = do(http.MethodPost, "/v1/sales", map[string]any{"user_id": u.ID, "amount": amount})
+		require.Equal(t, http.StatusCreated, rec.Code)
+	}
+
+	rec = do(http.MethodGet, "/v1/users/"+u.ID+"/sales/summary", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var sum sales.Summary
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &sum))
+	require.Equal(t, 3, sum.Count)
+	require.Equal(t, 60.0, sum.TotalAmount)
+	require.Equal(t, 3, sum.ByStatus["pending"]+sum.ByStatus["approved"]+sum.ByStatus["rejected"])
+	require.NotNil(t, sum.LastSaleAt)
+
+	rec = do(http.MethodGet, "/v1/users/nope/sales/summary", nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = do(http.MethodPost, "/v1/sales/summaries/rebuild", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"users": 1}`, rec.Body.String())
+}
@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ej_final/api"
+	"ej_final/internal/sales"
+	"ej_final/internal/tax"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newAddressServer simula el API de usuarios devolviendo la direccion de cada usuario.
+func newAddressServer(t *testing.T, addresses map[string]string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/users/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/v1/users/")
+		address, ok := addresses[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id": id, "address": address})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestService_Create_WithTaxes(t *testing.T) {
+	server := newAddressServer(t, map[string]string{
+		"ana":  "San Martin 123, Mendoza",
+		"beto": "Maipu 50, Ushuaia, Tierra del Fuego",
+	})
+	table, err := tax.NewTable([]tax.Rule{
+		{Inclusive: true, Rates: []tax.Rate{{Name: "IVA", Rate: 0.21}}},
+		{Jurisdiction: "TIERRA DEL FUEGO", Inclusive: true},
+		{Jurisdiction: "CABA", Rates: []tax.Rate{{Name: "IVA", Rate: 0.21}, {Name: "IIBB", Rate: 0.03}}},
+	})
+	require.NoError(t, err)
+	s := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), server.URL, sales.WithTaxes(table))
+	ctx := context.Background()
+
+	// Mendoza no tiene regla propia, va la de por defecto con IVA incluido
+	sale := &sales.Sales{UserID: "ana", Amount: 121}
+	require.NoError(t, s.Create(ctx, sale))
+	require.Empty(t, sale.Jurisdiction)
+	require.Equal(t, float32(121), sale.Amount)
+	require.Equal(t, &tax.Breakdown{Inclusive: true, Net: 100, Tax: 21, Gross: 121,
+		Lines: []tax.Line{{Name: "IVA", Rate: 0.21, Amount: 21}}}, sale.Taxes)
+
+	sale = &sales.Sales{UserID: "beto", Amount: 50}
+	require.NoError(t, s.Create(ctx, sale))
+	require.Equal(t, "TIERRA DEL FUEGO", sale.Jurisdiction)
+	require.Zero(t, sale.Taxes.Tax)
+
+	// La jurisdiccion explicita gana sobre la direccion, y sin incluir se suma al monto
+	sale = &sales.Sales{UserID: "beto", Amount: 10, Jurisdiction: "CABA"}
+	require.NoError(t, s.Create(ctx, sale))
+	require.Equal(t, float32(12.4), sale.Amount)
+	require.Equal(t, float32(10), sale.Taxes.Net)
+	require.Len(t, sale.Taxes.Lines, 2)
+
+	stored, err := s.Get(ctx, sale.ID)
+	require.NoError(t, err)
+	require.Equal(t, sale.Taxes, stored.Taxes)
+
+	err = s.Create(ctx, &sales.Sales{UserID: "ana", Amount: 10, Jurisdiction: "Narnia"})
+	require.ErrorIs(t, err, tax.ErrUnknownJurisdiction)
+
+	untaxed := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), server.URL)
+	sale = &sales.Sales{UserID: "ana", Amount: 10}
+	require.NoError(t, untaxed.Create(ctx, sale))
+	require.Nil(t, sale.Taxes)
+	err = untaxed.Create(ctx, &sales.Sales{UserID: "ana", Amount: 10, Jurisdiction: "CABA"})
+	require.ErrorIs(t, err, sales.ErrNoTaxes)
+}
+
+func TestService_CreateBatch_WithTaxes(t *testing.T) {
+	server := newAddressServer(t, map[string]string{
+		"ana":  "San Martin 123, Mendoza",
+		"beto": "Maipu 50, Ushuaia, Tierra del Fuego",
+	})
+	table, err := tax.NewTable([]tax.Rule{
+		{Inclusive: true, Rates: []tax.Rate{{Name: "IVA", Rate: 0.21}}},
+		{Jurisdiction: "TIERRA DEL FUEGO", Inclusive: true},
+		{Jurisdiction: "CABA", Rates: []tax.Rate{{Name: "IVA", Rate: 0.21}, {Name: "IIBB", Rate: 0.03}}},
+	})
+	require.NoError(t, err)
+	storage := sales.NewLocalStorage()
+	s := sales.NewService(storage, zap.NewNop(), server.URL, sales.WithTaxes(table))
+	ctx := context.Background()
+
+	results, err := s.CreateBatch(ctx, []*sales.Sales{
+		{UserID: "ana", Amount: 121},
+		{UserID: "beto", Amount: 50},
+		{UserID: "beto", Amount: 10, Jurisdiction: "CABA"},
+		{UserID: "ana", Amount: 10, Jurisdiction: "Narnia"},
+	}, sales.BatchBestEffort)
+	require.NoError(t, err)
+
+	// Cada item usa la direccion de su usuario, salvo que traiga jurisdiccion
+	require.Equal(t, float32(21), results[0].Sale.Taxes.Tax)
+	require.Equal(t, float32(121), results[0].Sale.Amount)
+	require.Equal(t, "TIERRA DEL FUEGO", results[1].Sale.Jurisdiction)
+	require.Zero(t, results[1].Sale.Taxes.Tax)
+	require.Equal(t, float32(12.4), results[2].Sale.Amount)
+	require.Equal(t, float32(10), results[2].Sale.Taxes.Net)
+	require.ErrorIs(t, results[3].Err, tax.ErrUnknownJurisdiction)
+
+	stored, err := s.Get(ctx, results[2].Sale.ID)
+	require.NoError(t, err)
+	require.Equal(t, results[2].Sale.Taxes, stored.Taxes)
+
+	// Sin calculadora, pedir una jurisdiccion hace fallar el item
+	untaxed := sales.NewService(sales.NewLocalStorage(), zap.NewNop(), server.URL)
+	results, err = untaxed.CreateBatch(ctx, []*sales.Sales{{UserID: "ana", Amount: 10, Jurisdiction: "CABA"}}, sales.BatchBestEffort)
+	require.NoError(t, err)
+	require.ErrorIs(t, results[0].Err, sales.ErrNoTaxes)
+}
+
+func TestService_Integracion_Taxes(t *testing.T) {
+	r := newRouter(t)
+	userID := createUser(t, r, "Juancito")
+
+	// Sin TAX_RULES_FILE va el IVA del 21% incluido en el precio
+	rec := call(r, http.MethodPost, "/v1/sales", map[string]any{"user_id": userID, "amount": 20})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var sale sales.Sales
+	decode(t, rec, &sale)
+	require.InDelta(t, 16.53, sale.Taxes.Net, 0.001)
+	require.InDelta(t, 3.47, sale.Taxes.Tax, 0.001)
+	require.Equal(t, "IVA", sale.Taxes.Lines[0].Name)
+
+	// Tierra del Fuego esta exenta, sin importar mayusculas
+	rec = call(r, http.MethodPost, "/v1/sales", map[string]any{"user_id": userID, "amount": 20, "jurisdiction": "tierra del fuego"})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	sale = sales.Sales{}
+	decode(t, rec, &sale)
+	require.Zero(t, sale.Taxes.Tax)
+	require.Equal(t, float32(20), sale.Taxes.Net)
+
+	rec = call(r, http.MethodPost, "/v1/sales", map[string]any{"user_id": userID, "amount": 20, "jurisdiction": "Narnia"})
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, "unknown_jurisdiction", problemCode(t, rec))
+
+	rec = call(r, http.MethodGet, "/v1/sales?user_id="+userID, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list api.SalesResponse
+	decode(t, rec, &list)
+	require.InDelta(t, 36.53, list.Metadata.NetAmount, 0.001)
+	require.InDelta(t, 3.47, list.Metadata.TaxAmount, 0.001)
+	require.InDelta(t, 3.47, list.Metadata.Taxes["IVA"], 0.001)
+}
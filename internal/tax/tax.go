@@ -0,0 +1,182 @@
+// Package tax computes the taxes of a sale from rules by jurisdiction.
+package tax
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// ErrUnknownJurisdiction is returned when there is no rule for a jurisdiction.
+var ErrUnknownJurisdiction = errors.New("unknown tax jurisdiction")
+
+// ErrInvalidRule is returned when a rule is repeated or has a tax without
+// name or with a negative rate.
+var ErrInvalidRule = errors.New("invalid tax rule")
+
+// Rate is a tax applied on the net amount, 0.21 for 21%.
+type Rate struct {
+	Name string  `json:"name"`
+	Rate float64 `json:"rate"`
+}
+
+// Rule are the taxes of a jurisdiction. The rule with an empty Jurisdiction
+// is the default, used for addresses that match no other rule.
+type Rule struct {
+	Jurisdiction string `json:"jurisdiction"`
+
+	// Inclusive means prices already include the taxes; otherwise they are
+	// added on top.
+	Inclusive bool   `json:"inclusive"`
+	Rates     []Rate `json:"rates"`
+}
+
+// Line is the amount of one tax of a sale.
+type Line struct {
+	Name   string  `json:"name"`
+	Rate   float32 `json:"rate"`
+	Amount float32 `json:"amount"`
+}
+
+// Breakdown splits the amount of a sale in Net and Tax, Gross being what the
+// customer pays. Tax is the sum of the Lines and Net + Tax is Gross.
+type Breakdown struct {
+	Inclusive bool    `json:"inclusive"`
+	Net       float32 `json:"net"`
+	Tax       float32 `json:"tax"`
+	Gross     float32 `json:"gross"`
+	Lines     []Line  `json:"lines"`
+}
+
+// DefaultRules are used when TAX_RULES_FILE is not set: IVA of 21% included
+// in prices, except in Tierra del Fuego which is exempt.
+var DefaultRules = []Rule{
+	{Inclusive: true, Rates: []Rate{{Name: "IVA", Rate: 0.21}}},
+	{Jurisdiction: "TIERRA DEL FUEGO", Inclusive: true},
+}
+
+// Table is a TaxCalculator for the sales service backed by a fixed set of rules.
+type Table struct {
+	rules map[string]Rule
+}
+
+// NewTable builds a Table from rules. Jurisdictions are matched regardless
+// of case and surrounding spaces.
+// Returns ErrInvalidRule if a jurisdiction is repeated or a rate is invalid.
+func NewTable(rules []Rule) (*Table, error) {
+	t := &Table{rules: make(map[string]Rule, len(rules))}
+	for _, r := range rules {
+		r.Jurisdiction = normalize(r.Jurisdiction)
+		if _, ok := t.rules[r.Jurisdiction]; ok {
+			return nil, fmt.Errorf("%w: %q repeated", ErrInvalidRule, r.Jurisdiction)
+		}
+		for _, rate := range r.Rates {
+			if rate.Name == "" || rate.Rate < 0 {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidRule, r.Jurisdiction)
+			}
+		}
+		t.rules[r.Jurisdiction] = r
+	}
+	return t, nil
+}
+
+// LoadRules reads rules as a JSON array.
+func LoadRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	if err := json.NewDecoder(r).Decode(&rules); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRule, err)
+	}
+	return rules, nil
+}
+
+// TableFromEnv builds the Table with the rules of the JSON file in
+// TAX_RULES_FILE, or with DefaultRules if it is not set.
+func TableFromEnv() (*Table, error) {
+	path := os.Getenv("TAX_RULES_FILE")
+	if path == "" {
+		return NewTable(DefaultRules)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rules, err := LoadRules(f)
+	if err != nil {
+		return nil, err
+	}
+	return NewTable(rules)
+}
+
+// Jurisdiction derives the jurisdiction of an address from its last
+// comma-separated part, as in "Av. San Martin 123, Mendoza". It returns ""
+// (the default rule) if that part matches no rule.
+func (t *Table) Jurisdiction(address string) string {
+	parts := strings.Split(address, ",")
+	j := normalize(parts[len(parts)-1])
+	if _, ok := t.rules[j]; !ok {
+		return ""
+	}
+	return j
+}
+
+// Compute applies the rule of jurisdiction to amount. Every tax is rounded to
+// cents; with inclusive pricing the rounding difference goes to the last tax
+// so that Net + Tax is exactly amount.
+// Returns ErrUnknownJurisdiction if there is no rule for it.
+func (t *Table) Compute(ctx context.Context, jurisdiction string, amount float32) (*Breakdown, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	rule, ok := t.rules[normalize(jurisdiction)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownJurisdiction, jurisdiction)
+	}
+	return rule.apply(amount), nil
+}
+
+// apply computes the breakdown of amount, working in cents to avoid
+// accumulating rounding errors.
+func (r Rule) apply(amount float32) *Breakdown {
+	total := math.Round(float64(amount) * 100)
+
+	rate := 0.0
+	for _, x := range r.Rates {
+		rate += x.Rate
+	}
+	net := total
+	if r.Inclusive {
+		net = math.Round(total / (1 + rate))
+	}
+
+	b := &Breakdown{Inclusive: r.Inclusive, Lines: make([]Line, 0, len(r.Rates))}
+	tax := 0.0
+	for _, x := range r.Rates {
+		cents := math.Round(net * x.Rate)
+		tax += cents
+		b.Lines = append(b.Lines, Line{Name: x.Name, Rate: float32(x.Rate), Amount: float32(cents / 100)})
+	}
+	if r.Inclusive && len(b.Lines) > 0 {
+		last := &b.Lines[len(b.Lines)-1]
+		diff := total - net - tax
+		last.Amount = float32((float64(last.Amount)*100 + diff) / 100)
+		tax += diff
+	}
+
+	b.Net = float32(net / 100)
+	b.Tax = float32(tax / 100)
+	b.Gross = float32((net + tax) / 100)
+	return b
+}
+
+func normalize(jurisdiction string) string {
+	return strings.ToUpper(strings.TrimSpace(jurisdiction))
+}
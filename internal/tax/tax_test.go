@@ -0,0 +1,68 @@
+package tax
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTable_Compute(t *testing.T) {
+	table, err := NewTable([]Rule{
+		{Inclusive: true, Rates: []Rate{{Name: "IVA", Rate: 0.21}}},
+		{Jurisdiction: "caba", Rates: []Rate{{Name: "IVA", Rate: 0.21}, {Name: "IIBB", Rate: 0.03}}},
+		{Jurisdiction: "Tierra del Fuego", Inclusive: true},
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Precio con IVA incluido: neto mas impuesto da justo el monto
+	b, err := table.Compute(ctx, "", 100)
+	require.NoError(t, err)
+	require.Equal(t, float32(82.64), b.Net)
+	require.Equal(t, float32(17.36), b.Tax)
+	require.Equal(t, float32(100), b.Gross)
+	require.Equal(t, []Line{{Name: "IVA", Rate: 0.21, Amount: 17.36}}, b.Lines)
+
+	// Sin incluir, los impuestos se suman por linea
+	b, err = table.Compute(ctx, " CABA ", 10)
+	require.NoError(t, err)
+	require.False(t, b.Inclusive)
+	require.Equal(t, float32(10), b.Net)
+	require.Equal(t, float32(2.4), b.Tax)
+	require.Equal(t, float32(12.4), b.Gross)
+	require.Len(t, b.Lines, 2)
+	require.Equal(t, float32(0.3), b.Lines[1].Amount)
+
+	b, err = table.Compute(ctx, "TIERRA DEL FUEGO", 10)
+	require.NoError(t, err)
+	require.Equal(t, float32(10), b.Net)
+	require.Zero(t, b.Tax)
+	require.Empty(t, b.Lines)
+
+	_, err = table.Compute(ctx, "Narnia", 10)
+	require.ErrorIs(t, err, ErrUnknownJurisdiction)
+}
+
+func TestTable_Jurisdiction(t *testing.T) {
+	table, err := NewTable(DefaultRules)
+	require.NoError(t, err)
+
+	require.Equal(t, "TIERRA DEL FUEGO", table.Jurisdiction("San Martin 123, Ushuaia, tierra del fuego"))
+	require.Equal(t, "", table.Jurisdiction("San Martin 123, Mendoza"))
+	require.Equal(t, "", table.Jurisdiction(""))
+}
+
+func TestNewTable_Invalid(t *testing.T) {
+	_, err := NewTable([]Rule{{Jurisdiction: "a"}, {Jurisdiction: " A "}})
+	require.ErrorIs(t, err, ErrInvalidRule)
+	_, err = NewTable([]Rule{{Rates: []Rate{{Name: "IVA", Rate: -0.1}}}})
+	require.ErrorIs(t, err, ErrInvalidRule)
+
+	rules, err := LoadRules(strings.NewReader(`[{"jurisdiction": "caba", "rates": [{"name": "IVA", "rate": 0.21}]}]`))
+	require.NoError(t, err)
+	require.Equal(t, "caba", rules[0].Jurisdiction)
+	_, err = LoadRules(strings.NewReader(`{`))
+	require.ErrorIs(t, err, ErrInvalidRule)
+}
@@ -0,0 +1,280 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Exporter receives finished spans. Implementations must be safe for
+// concurrent use and must not block the caller for long.
+type Exporter interface {
+	Export(span SpanData)
+	Shutdown(ctx context.Context) error
+}
+
+// WriterExporter writes one JSON object per span to an io.Writer.
+type WriterExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	c   io.Closer
+}
+
+// NewWriterExporter creates a WriterExporter over w.
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{enc: json.NewEncoder(w)}
+}
+
+// NewStdoutExporter creates a WriterExporter over os.Stdout, handy for local runs.
+func NewStdoutExporter() *WriterExporter {
+	return NewWriterExporter(os.Stdout)
+}
+
+// NewFileExporter creates a WriterExporter appending to the file at path.
+func NewFileExporter(path string) (*WriterExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	e := NewWriterExporter(f)
+	e.c = f
+	return e, nil
+}
+
+// Export writes span as a JSON line. Write errors are dropped, tracing must never break requests.
+func (e *WriterExporter) Export(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_ = e.enc.Encode(span)
+}
+
+// Shutdown closes the underlying file, if any.
+func (e *WriterExporter) Shutdown(ctx context.Context) error {
+	if e.c == nil {
+		return nil
+	}
+	return e.c.Close()
+}
+
+// otlpBatchSize is how many spans the OTLP exporter buffers before sending them.
+const otlpBatchSize = 64
+
+// otlpFlushInterval is the longest a span waits in the OTLP buffer.
+const otlpFlushInterval = 5 * time.Second
+
+// OTLPExporter sends spans in batches to an OTLP/HTTP collector using the JSON encoding.
+type OTLPExporter struct {
+	url         string
+	serviceName string
+	client      *http.Client
+
+	mu     sync.Mutex
+	buf    []SpanData
+	stop   chan struct{}
+	done   chan struct{}
+	closed bool
+}
+
+// NewOTLPExporter creates an exporter posting to endpoint + "/v1/traces"
+// and starts its background flush loop.
+func NewOTLPExporter(endpoint, serviceName string) *OTLPExporter {
+	e := &OTLPExporter{
+		url:         endpoint + "/v1/traces",
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go e.loop()
+	return e
+}
+
+// Export buffers span, sending the batch when it is full.
+func (e *OTLPExporter) Export(span SpanData) {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return
+	}
+	e.buf = append(e.buf, span)
+	var batch []SpanData
+	if len(e.buf) >= otlpBatchSize {
+		batch, e.buf = e.buf, nil
+	}
+	e.mu.Unlock()
+
+	if batch != nil {
+		go e.send(context.Background(), batch)
+	}
+}
+
+// Shutdown stops the flush loop and sends what is left in the buffer.
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return nil
+	}
+	e.closed = true
+	batch := e.buf
+	e.buf = nil
+	e.mu.Unlock()
+
+	close(e.stop)
+	<-e.done
+	if len(batch) == 0 {
+		return nil
+	}
+	return e.send(ctx, batch)
+}
+
+func (e *OTLPExporter) loop() {
+	defer close(e.done)
+
+	t := time.NewTicker(otlpFlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-t.C:
+			e.mu.Lock()
+			batch := e.buf
+			e.buf = nil
+			e.mu.Unlock()
+			if len(batch) > 0 {
+				_ = e.send(context.Background(), batch)
+			}
+		}
+	}
+}
+
+func (e *OTLPExporter) send(ctx context.Context, batch []SpanData) error {
+	body, err := json.Marshal(e.payload(batch))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("otlp collector answered %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// otlpKinds maps our kinds to the OTLP SpanKind enum.
+var otlpKinds = map[SpanKind]int{
+	KindInternal: 1,
+	KindServer:   2,
+	KindClient:   3,
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+func (e *OTLPExporter) payload(batch []SpanData) map[string]any {
+	spans := make([]map[string]any, 0, len(batch))
+	for _, s := range batch {
+		attrs := make([]otlpAttribute, 0, len(s.Attributes))
+		for k, v := range s.Attributes {
+			attrs = append(attrs, otlpAttribute{Key: k, Value: otlpValue{StringValue: fmt.Sprint(v)}})
+		}
+
+		span := map[string]any{
+			"traceId":           s.TraceID,
+			"spanId":            s.SpanID,
+			"name":              s.Name,
+			"kind":              otlpKinds[s.Kind],
+			"startTimeUnixNano": strconv.FormatInt(s.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.End.UnixNano(), 10),
+			"attributes":        attrs,
+		}
+		if s.ParentSpanID != "" {
+			span["parentSpanId"] = s.ParentSpanID
+		}
+		if s.Error != "" {
+			span["status"] = map[string]any{"code": 2, "message": s.Error}
+		}
+		spans = append(spans, span)
+	}
+
+	return map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: e.serviceName}}},
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "ej_final/internal/tracing"},
+				"spans": spans,
+			}},
+		}},
+	}
+}
+
+// ExporterFromEnv builds the exporter selected by TRACES_EXPORTER:
+//   - "stdout": JSON lines on standard output
+//   - "file":   JSON lines appended to TRACES_FILE (default traces.jsonl)
+//   - "otlp":   OTLP/HTTP to OTEL_EXPORTER_OTLP_ENDPOINT (default http://localhost:4318)
+//
+// When TRACES_EXPORTER is empty, OTLP is used if OTEL_EXPORTER_OTLP_ENDPOINT
+// is set, otherwise nil is returned and spans are not exported.
+func ExporterFromEnv() (Exporter, error) {
+	kind := os.Getenv("TRACES_EXPORTER")
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	if kind == "" && endpoint != "" {
+		kind = "otlp"
+	}
+
+	switch kind {
+	case "", "none":
+		return nil, nil
+	case "stdout":
+		return NewStdoutExporter(), nil
+	case "file":
+		path := os.Getenv("TRACES_FILE")
+		if path == "" {
+			path = "traces.jsonl"
+		}
+		e, err := NewFileExporter(path)
+		if err != nil {
+			return nil, err
+		}
+		return e, nil
+	case "otlp":
+		if endpoint == "" {
+			endpoint = "http://localhost:4318"
+		}
+		name := os.Getenv("OTEL_SERVICE_NAME")
+		if name == "" {
+			name = "sales-api"
+		}
+		return NewOTLPExporter(endpoint, name), nil
+	default:
+		return nil, fmt.Errorf("unknown TRACES_EXPORTER %q", kind)
+	}
+}
@@ -0,0 +1,170 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SpanKind tells whether a span serves a request, makes one or is internal.
+type SpanKind string
+
+const (
+	KindInternal SpanKind = "internal"
+	KindServer   SpanKind = "server"
+	KindClient   SpanKind = "client"
+)
+
+// SpanData is the finished, immutable view of a span handed to exporters.
+type SpanData struct {
+	Name         string         `json:"name"`
+	Kind         SpanKind       `json:"kind"`
+	TraceID      string         `json:"trace_id"`
+	SpanID       string         `json:"span_id"`
+	ParentSpanID string         `json:"parent_span_id,omitempty"`
+	Start        time.Time      `json:"start"`
+	End          time.Time      `json:"end"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	Error        string         `json:"error,omitempty"`
+}
+
+// Tracer creates spans and sends them to its Exporter when they end.
+type Tracer struct {
+	exporter Exporter
+}
+
+// NewTracer creates a Tracer exporting to exp. A nil exporter still creates and
+// propagates spans (so logs get trace IDs) but drops them when they end.
+func NewTracer(exp Exporter) *Tracer {
+	return &Tracer{exporter: exp}
+}
+
+// Span is a timed operation inside a trace. A nil *Span is a valid no-op span.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent SpanID
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+type ctxKey struct{}
+
+// Start begins a root span, or a child of remote if it is valid (for
+// requests arriving with a traceparent header).
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind, remote SpanContext) (context.Context, *Span) {
+	sc := SpanContext{TraceID: newTraceID(), SpanID: newSpanID(), Sampled: true}
+	var parent SpanID
+	if remote.IsValid() {
+		sc.TraceID = remote.TraceID
+		sc.Sampled = remote.Sampled
+		parent = remote.SpanID
+	}
+
+	return t.start(ctx, name, kind, sc, parent)
+}
+
+func (t *Tracer) start(ctx context.Context, name string, kind SpanKind, sc SpanContext, parent SpanID) (context.Context, *Span) {
+	s := &Span{
+		tracer: t,
+		sc:     sc,
+		parent: parent,
+		data: SpanData{
+			Name:    name,
+			Kind:    kind,
+			TraceID: sc.TraceID.String(),
+			SpanID:  sc.SpanID.String(),
+			Start:   time.Now(),
+		},
+	}
+	if parent.IsValid() {
+		s.data.ParentSpanID = parent.String()
+	}
+
+	return context.WithValue(ctx, ctxKey{}, s), s
+}
+
+// Start begins a child of the span stored in ctx. If ctx has no span the
+// returned span is nil (a no-op) and ctx is returned unchanged, so layers
+// can be instrumented without caring whether tracing is configured.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return StartKind(ctx, name, KindInternal)
+}
+
+// StartKind is like Start but sets the kind of the new span.
+func StartKind(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+
+	sc := SpanContext{TraceID: parent.sc.TraceID, SpanID: newSpanID(), Sampled: parent.sc.Sampled}
+	return parent.tracer.start(ctx, name, kind, sc, parent.sc.SpanID)
+}
+
+// SpanFromContext returns the current span, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(ctxKey{}).(*Span)
+	return s
+}
+
+// SpanContextFromContext returns the SpanContext of the current span, or the zero value.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	return SpanFromContext(ctx).SpanContext()
+}
+
+// SpanContext returns the IDs of the span.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttribute attaches a key/value pair to the span.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Attributes == nil {
+		s.data.Attributes = map[string]any{}
+	}
+	s.data.Attributes[key] = value
+}
+
+// RecordError marks the span as failed. A nil err is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = err.Error()
+}
+
+// End finishes the span and exports it if it is sampled. Calling End twice is a no-op.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if s.sc.Sampled && s.tracer.exporter != nil {
+		s.tracer.exporter.Export(data)
+	}
+}
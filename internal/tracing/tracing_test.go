@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (m *memoryExporter) Export(span SpanData) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spans = append(m.spans, span)
+}
+
+func (m *memoryExporter) Shutdown(ctx context.Context) error { return nil }
+
+func TestParseTraceparent(t *testing.T) {
+	sc, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.True(t, ok)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	require.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	require.True(t, sc.Sampled)
+	require.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.Traceparent())
+
+	invalid := []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4bf92f-00f067aa0ba902b7-01",
+	}
+	for _, v := range invalid {
+		_, ok := ParseTraceparent(v)
+		require.False(t, ok, v)
+	}
+}
+
+func TestTracer_ChildSpans(t *testing.T) {
+	exp := &memoryExporter{}
+	tracer := NewTracer(exp)
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, root := tracer.Start(context.Background(), "GET /sales", KindServer, remote)
+
+	child, span := Start(ctx, "sales.Service.GetSales")
+	h := http.Header{}
+	Inject(child, h)
+	span.End()
+	root.End()
+	root.End()
+
+	require.Len(t, exp.spans, 2)
+	require.Equal(t, "sales.Service.GetSales", exp.spans[0].Name)
+	require.Equal(t, exp.spans[1].SpanID, exp.spans[0].ParentSpanID)
+	require.Equal(t, "00f067aa0ba902b7", exp.spans[1].ParentSpanID)
+	require.Equal(t, remote.TraceID.String(), exp.spans[0].TraceID)
+	require.Equal(t, "00-"+exp.spans[0].TraceID+"-"+exp.spans[0].SpanID+"-01", h.Get(TraceparentHeader))
+}
+
+func TestStart_WithoutTracer(t *testing.T) {
+	ctx := context.Background()
+
+	got, span := Start(ctx, "noop")
+	require.Nil(t, span)
+	require.Equal(t, ctx, got)
+
+	// Un span nil no tiene que romper nada
+	span.SetAttribute("k", "v")
+	span.RecordError(context.Canceled)
+	span.End()
+}
@@ -0,0 +1,64 @@
+package user
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidCursor is returned when a list cursor cannot be decoded or was
+// issued for a different sort.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrInvalidSort is returned when listing with an unknown sort field.
+var ErrInvalidSort = errors.New("invalid sort field")
+
+// cursor is the position after which the next page starts: the sort key and
+// ID of the last user returned. It is opaque to clients.
+type cursor struct {
+	SortBy string `json:"s"`
+	Desc   bool   `json:"d,omitempty"`
+	Key    string `json:"k"`
+	ID     string `json:"id"`
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor parses raw and checks it belongs to the same listing as q.
+func decodeCursor(raw string, q ListQuery) (cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return cursor{}, ErrInvalidCursor
+	}
+	if c.SortBy != q.SortBy || c.Desc != q.Desc {
+		return cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// sortKey returns the value users are ordered by for the given field.
+// Timestamps are fixed width so they compare correctly as strings.
+func sortKey(u *User, sortBy string) string {
+	if sortBy == SortByName {
+		return strings.ToLower(u.Name)
+	}
+	return u.CreatedAt.UTC().Format("2006-01-02T15:04:05.000000000Z07:00")
+}
+
+// keyLess orders by key and breaks ties by ID, so the order is total and
+// cursors are stable.
+func keyLess(keyA, idA, keyB, idB string) bool {
+	if keyA != keyB {
+		return keyA < keyB
+	}
+	return idA < idB
+}
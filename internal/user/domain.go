@@ -20,3 +20,40 @@ type UpdateFields struct {
 	Address  *string `json:"address"`
 	NickName *string `json:"nickname"`
 }
+
+// Sort fields accepted by ListQuery.SortBy.
+const (
+	SortByCreatedAt = "created_at"
+	SortByName      = "name"
+)
+
+// Page sizes for ListQuery.Limit.
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
+// ListQuery describes a page of users to list.
+type ListQuery struct {
+	// Search filters users whose name or nickname starts with it, ignoring case.
+	Search string
+
+	// SortBy is SortByCreatedAt (default) or SortByName.
+	SortBy string
+
+	// Desc reverses the order.
+	Desc bool
+
+	// Limit is the maximum number of users in the page.
+	Limit int
+
+	// Cursor is the NextCursor of the previous page, empty for the first one.
+	Cursor string
+}
+
+// ListResult is a page of users.
+// NextCursor is empty when there are no more users.
+type ListResult struct {
+	Users      []*User `json:"results"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
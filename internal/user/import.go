@@ -0,0 +1,74 @@
+package user
+
+import (
+	"context"
+	"ej_final/internal/logging"
+	"ej_final/internal/tracing"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ErrAlreadyExists is returned when importing a user whose ID is taken.
+var ErrAlreadyExists = errors.New("user already exists")
+
+// Import loads users coming from another system. Unlike Create it keeps the
+// ID and timestamps of each user when they are set; missing ones are filled
+// in as Create would. Users whose ID already exists, in the storage or
+// earlier in users, get ErrAlreadyExists.
+// It returns one error per user (nil for the valid ones). Unless dryRun is
+// set the valid users are written with a single SetBatch call; the error is
+// only non-nil if that call failed, and then nothing was written.
+func (s *Service) Import(ctx context.Context, users []*User, dryRun bool) ([]error, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.Import")
+	defer span.End()
+	span.SetAttribute("batch.size", len(users))
+
+	log := logging.FromContext(ctx, s.logger)
+
+	now := time.Now()
+	errs := make([]error, len(users))
+	seen := map[string]bool{}
+	valid := make([]*User, 0, len(users))
+	for i, u := range users {
+		if u.ID == "" {
+			u.ID = uuid.NewString()
+		}
+		if seen[u.ID] {
+			errs[i] = ErrAlreadyExists
+			continue
+		}
+		seen[u.ID] = true
+
+		if _, err := s.storage.Read(ctx, u.ID); err == nil {
+			errs[i] = ErrAlreadyExists
+			continue
+		} else if !errors.Is(err, ErrNotFound) {
+			errs[i] = err
+			continue
+		}
+
+		if u.CreatedAt.IsZero() {
+			u.CreatedAt = now
+		}
+		if u.UpdatedAt.IsZero() {
+			u.UpdatedAt = u.CreatedAt
+		}
+		u.Version = 1
+		valid = append(valid, u)
+	}
+
+	if dryRun || len(valid) == 0 {
+		return errs, nil
+	}
+	if err := s.storage.SetBatch(ctx, valid); err != nil {
+		span.RecordError(err)
+		log.Error("failed to import users", zap.Int("size", len(valid)), zap.Error(err))
+		return nil, err
+	}
+
+	log.Info("users imported", zap.Int("size", len(users)), zap.Int("imported", len(valid)))
+	return errs, nil
+}
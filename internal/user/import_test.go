@@ -0,0 +1,60 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Import(t *testing.T) {
+	storage := NewLocalStorage()
+	s := NewService(storage, nil)
+	ctx := context.Background()
+	require.NoError(t, storage.Set(ctx, &User{ID: "taken", Name: "Viejo"}))
+
+	created := time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC)
+	users := []*User{
+		{ID: "legacy-1", Name: "Ayrton", CreatedAt: created},
+		{Name: "Sin ID"},
+		{ID: "taken", Name: "Repetido"},
+		{ID: "legacy-1", Name: "Otra vez"},
+	}
+
+	// En dry run se valida pero no se escribe nada
+	errs, err := s.Import(ctx, users, true)
+	require.NoError(t, err)
+	require.NoError(t, errs[0])
+	require.NoError(t, errs[1])
+	require.ErrorIs(t, errs[2], ErrAlreadyExists)
+	require.ErrorIs(t, errs[3], ErrAlreadyExists)
+	_, err = storage.Read(ctx, "legacy-1")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	errs, err = s.Import(ctx, users[:2], false)
+	require.NoError(t, err)
+	require.Equal(t, []error{nil, nil}, errs)
+
+	u, err := storage.Read(ctx, "legacy-1")
+	require.NoError(t, err)
+	require.Equal(t, created, u.CreatedAt)
+	require.Equal(t, created, u.UpdatedAt)
+	require.Equal(t, 1, u.Version)
+	require.NotEmpty(t, users[1].ID)
+}
+
+func TestService_Import_StorageError(t *testing.T) {
+	s := NewService(&mockStorage{
+		mockRead: func(ctx context.Context, id string) (*User, error) {
+			return nil, ErrNotFound
+		},
+		mockSetBatch: func(ctx context.Context, users []*User) error {
+			return errors.New("fake error trying to set users")
+		},
+	}, nil)
+
+	_, err := s.Import(context.Background(), []*User{{Name: "Ayrton"}}, false)
+	require.EqualError(t, err, "fake error trying to set users")
+}
@@ -1,9 +1,13 @@
 package user
 
 import (
+	"context"
+	"ej_final/internal/logging"
+	"ej_final/internal/tracing"
+	"time"
+
 	"github.com/google/uuid"
 	"go.uber.org/zap"
-	"time"
 )
 
 // Service provides high-level user management operations on a LocalStorage backend.
@@ -31,15 +35,18 @@ func NewService(storage Storage, logger *zap.Logger) *Service {
 // Create adds a brand-new user to the system.
 // It sets CreatedAt and UpdatedAt to the current time and initializes Version to 1.
 // Returns ErrEmptyID if user.ID is empty.
-func (s *Service) Create(user *User) error {
+func (s *Service) Create(ctx context.Context, user *User) error {
+	ctx, span := tracing.Start(ctx, "user.Service.Create")
+	defer span.End()
+
 	user.ID = uuid.NewString()
 	now := time.Now()
 	user.CreatedAt = now
 	user.UpdatedAt = now
 	user.Version = 1
 
-	if err := s.storage.Set(user); err != nil {
-		s.logger.Error("failed to set user", zap.Error(err), zap.Any("user", user))
+	if err := s.storage.Set(ctx, user); err != nil {
+		logging.FromContext(ctx, s.logger).Error("failed to set user", zap.Error(err), zap.Any("user", user))
 		return err
 	}
 
@@ -48,15 +55,46 @@ func (s *Service) Create(user *User) error {
 
 // Get retrieves a user by its ID.
 // Returns ErrNotFound if no user exists with the given ID.
-func (s *Service) Get(id string) (*User, error) {
-	return s.storage.Read(id)
+func (s *Service) Get(ctx context.Context, id string) (*User, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.Get")
+	defer span.End()
+
+	return s.storage.Read(ctx, id)
+}
+
+// List returns a page of users matching query.
+// An empty SortBy means SortByCreatedAt, and Limit is clamped to [1, MaxListLimit]
+// (DefaultListLimit when not set).
+// Returns ErrInvalidSort or ErrInvalidCursor for bad queries.
+func (s *Service) List(ctx context.Context, query ListQuery) (*ListResult, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.List")
+	defer span.End()
+
+	if query.SortBy == "" {
+		query.SortBy = SortByCreatedAt
+	}
+	if query.SortBy != SortByCreatedAt && query.SortBy != SortByName {
+		return nil, ErrInvalidSort
+	}
+
+	switch {
+	case query.Limit <= 0:
+		query.Limit = DefaultListLimit
+	case query.Limit > MaxListLimit:
+		query.Limit = MaxListLimit
+	}
+
+	return s.storage.List(ctx, query)
 }
 
 // Update modifies an existing user's data.
 // It updates Name, Address, NickName, sets UpdatedAt to now and increments Version.
 // Returns ErrNotFound if the user does not exist, or ErrEmptyID if user.ID is empty.
-func (s *Service) Update(id string, user *UpdateFields) (*User, error) {
-	existing, err := s.storage.Read(id)
+func (s *Service) Update(ctx context.Context, id string, user *UpdateFields) (*User, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.Update")
+	defer span.End()
+
+	existing, err := s.storage.Read(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -76,7 +114,7 @@ func (s *Service) Update(id string, user *UpdateFields) (*User, error) {
 	existing.UpdatedAt = time.Now()
 	existing.Version++
 
-	if err := s.storage.Set(existing); err != nil {
+	if err := s.storage.Set(ctx, existing); err != nil {
 		return nil, err
 	}
 
@@ -85,6 +123,9 @@ func (s *Service) Update(id string, user *UpdateFields) (*User, error) {
 
 // Delete removes a user from the system by its ID.
 // Returns ErrNotFound if the user does not exist.
-func (s *Service) Delete(id string) error {
-	return s.storage.Delete(id)
+func (s *Service) Delete(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "user.Service.Delete")
+	defer span.End()
+
+	return s.storage.Delete(ctx, id)
 }
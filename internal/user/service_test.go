@@ -1,6 +1,7 @@
 package user
 
 import (
+	"context"
 	"errors"
 	"github.com/stretchr/testify/require"
 	"testing"
@@ -15,7 +16,7 @@ func TestService_Create_Simple(t *testing.T) {
 		NickName: "Chiche",
 	}
 
-	err := s.Create(input)
+	err := s.Create(context.Background(), input)
 
 	require.Nil(t, err)
 	require.NotEmpty(t, input.ID)
@@ -24,12 +25,12 @@ func TestService_Create_Simple(t *testing.T) {
 	require.Equal(t, 1, input.Version)
 
 	s = NewService(&mockStorage{
-		mockSet: func(user *User) error {
+		mockSet: func(ctx context.Context, user *User) error {
 			return errors.New("fake error trying to set user")
 		},
 	}, nil)
 
-	err = s.Create(input)
+	err = s.Create(context.Background(), input)
 	require.NotNil(t, err)
 	require.EqualError(t, err, "fake error trying to set user")
 }
@@ -54,7 +55,7 @@ func TestService_Create(t *testing.T) {
 			name: "error",
 			fields: fields{
 				storage: &mockStorage{
-					mockSet: func(user *User) error {
+					mockSet: func(ctx context.Context, user *User) error {
 						return errors.New("fake error trying to set user")
 					},
 				},
@@ -97,7 +98,7 @@ func TestService_Create(t *testing.T) {
 				storage: tt.fields.storage,
 			}
 
-			err := s.Create(tt.args.user)
+			err := s.Create(context.Background(), tt.args.user)
 			if tt.wantErr != nil {
 				tt.wantErr(t, err)
 			}
@@ -110,19 +111,34 @@ func TestService_Create(t *testing.T) {
 }
 
 type mockStorage struct {
-	mockSet    func(user *User) error
-	mockRead   func(id string) (*User, error)
-	mockDelete func(id string) error
+	mockSet      func(ctx context.Context, user *User) error
+	mockRead     func(ctx context.Context, id string) (*User, error)
+	mockDelete   func(ctx context.Context, id string) error
+	mockPing     func(ctx context.Context) error
+	mockList     func(ctx context.Context, query ListQuery) (*ListResult, error)
+	mockSetBatch func(ctx context.Context, users []*User) error
 }
 
-func (m *mockStorage) Set(user *User) error {
-	return m.mockSet(user)
+func (m *mockStorage) Set(ctx context.Context, user *User) error {
+	return m.mockSet(ctx, user)
 }
 
-func (m *mockStorage) Read(id string) (*User, error) {
-	return m.mockRead(id)
+func (m *mockStorage) Read(ctx context.Context, id string) (*User, error) {
+	return m.mockRead(ctx, id)
 }
 
-func (m *mockStorage) Delete(id string) error {
-	return m.mockDelete(id)
+func (m *mockStorage) Delete(ctx context.Context, id string) error {
+	return m.mockDelete(ctx, id)
+}
+
+func (m *mockStorage) Ping(ctx context.Context) error {
+	return m.mockPing(ctx)
+}
+
+func (m *mockStorage) List(ctx context.Context, query ListQuery) (*ListResult, error) {
+	return m.mockList(ctx, query)
+}
+
+func (m *mockStorage) SetBatch(ctx context.Context, users []*User) error {
+	return m.mockSetBatch(ctx, users)
 }
@@ -1,6 +1,13 @@
 package user
 
-import "errors"
+import (
+	"context"
+	"ej_final/internal/tracing"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
 
 // ErrNotFound is returned when a user with the given ID is not found.
 var ErrNotFound = errors.New("user not found")
@@ -9,54 +16,252 @@ var ErrNotFound = errors.New("user not found")
 var ErrEmptyID = errors.New("empty user ID")
 
 // Storage is the main interface for our storage layer.
+// Every method returns ctx.Err() if the context is already cancelled or past its deadline.
 type Storage interface {
-	Set(user *User) error
-	Read(id string) (*User, error)
-	Delete(id string) error
+	Set(ctx context.Context, user *User) error
+	Read(ctx context.Context, id string) (*User, error)
+	Delete(ctx context.Context, id string) error
+	Ping(ctx context.Context) error
+	List(ctx context.Context, query ListQuery) (*ListResult, error)
+
+	// SetBatch stores every user or none of them.
+	SetBatch(ctx context.Context, users []*User) error
 }
 
 // LocalStorage provides an in-memory implementation for storing users.
+// It keeps one sorted index per sort field so listing pages does not need
+// to sort the whole map, and it is safe for concurrent use.
 type LocalStorage struct {
-	m map[string]*User
+	mu sync.RWMutex
+	m  map[string]*User
+
+	// indexes holds the users ordered by each sort field.
+	indexes map[string][]*User
 }
 
 // NewLocalStorage instantiates a new LocalStorage with an empty map.
 func NewLocalStorage() *LocalStorage {
 	return &LocalStorage{
 		m: map[string]*User{},
+		indexes: map[string][]*User{
+			SortByCreatedAt: nil,
+			SortByName:      nil,
+		},
 	}
 }
 
 // Set stores or updates a user in the local storage.
+// The storage keeps its own copy, so later changes to user are not visible
+// until Set is called again.
 // Returns ErrEmptyID if the user has an empty ID.
-func (l *LocalStorage) Set(user *User) error {
+func (l *LocalStorage) Set(ctx context.Context, user *User) error {
+	ctx, span := tracing.Start(ctx, "user.LocalStorage.Set")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	if user.ID == "" {
 		return ErrEmptyID
 	}
 
-	l.m[user.ID] = user
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if old, ok := l.m[user.ID]; ok {
+		l.unindex(old)
+	}
+	u := *user
+	l.m[user.ID] = &u
+	l.index(&u)
+	return nil
+}
+
+// SetBatch stores or updates all the given users atomically: if any of them
+// has an empty ID nothing is stored and ErrEmptyID is returned.
+func (l *LocalStorage) SetBatch(ctx context.Context, users []*User) error {
+	ctx, span := tracing.Start(ctx, "user.LocalStorage.SetBatch")
+	defer span.End()
+	span.SetAttribute("batch.size", len(users))
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		if u.ID == "" {
+			return ErrEmptyID
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, user := range users {
+		if old, ok := l.m[user.ID]; ok {
+			l.unindex(old)
+		}
+		u := *user
+		l.m[user.ID] = &u
+		l.index(&u)
+	}
 	return nil
 }
 
 // Read retrieves a user from the local storage by ID.
 // Returns ErrNotFound if the user is not found.
-func (l *LocalStorage) Read(id string) (*User, error) {
+func (l *LocalStorage) Read(ctx context.Context, id string) (*User, error) {
+	ctx, span := tracing.Start(ctx, "user.LocalStorage.Read")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	u, ok := l.m[id]
 	if !ok {
 		return nil, ErrNotFound
 	}
 
-	return u, nil
+	c := *u
+	return &c, nil
 }
 
 // Delete removes a user from the local storage by ID.
 // Returns ErrNotFound if the user does not exist.
-func (l *LocalStorage) Delete(id string) error {
-	_, err := l.Read(id)
-	if err != nil {
+func (l *LocalStorage) Delete(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "user.LocalStorage.Delete")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
 		return err
 	}
 
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	u, ok := l.m[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	l.unindex(u)
 	delete(l.m, id)
 	return nil
 }
+
+// Ping reports whether the storage is reachable. The in-memory storage always
+// is, so it only fails when ctx is done.
+func (l *LocalStorage) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// List returns a page of users ordered by query.SortBy, starting after
+// query.Cursor. The start of the page is found by binary search on the index,
+// so the cost depends on the page size rather than on the number of users
+// (plus the users skipped by Search).
+// Returns ErrInvalidSort or ErrInvalidCursor for bad queries.
+func (l *LocalStorage) List(ctx context.Context, query ListQuery) (*ListResult, error) {
+	ctx, span := tracing.Start(ctx, "user.LocalStorage.List")
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	idx, ok := l.indexes[query.SortBy]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+
+	// Posicion del primer elemento de la pagina en el indice ascendente
+	pos, step := 0, 1
+	if query.Desc {
+		pos, step = len(idx)-1, -1
+	}
+	if query.Cursor != "" {
+		c, err := decodeCursor(query.Cursor, query)
+		if err != nil {
+			return nil, err
+		}
+		after := sort.Search(len(idx), func(i int) bool {
+			return keyLess(c.Key, c.ID, sortKey(idx[i], query.SortBy), idx[i].ID)
+		})
+		pos = after
+		if query.Desc {
+			pos = sort.Search(len(idx), func(i int) bool {
+				return !keyLess(sortKey(idx[i], query.SortBy), idx[i].ID, c.Key, c.ID)
+			}) - 1
+		}
+	}
+
+	if query.Limit <= 0 {
+		query.Limit = DefaultListLimit
+	}
+
+	search := strings.ToLower(query.Search)
+	res := &ListResult{Users: []*User{}}
+	for i := pos; i >= 0 && i < len(idx); i += step {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		u := idx[i]
+		if search != "" &&
+			!strings.HasPrefix(strings.ToLower(u.Name), search) &&
+			!strings.HasPrefix(strings.ToLower(u.NickName), search) {
+			continue
+		}
+
+		if len(res.Users) == query.Limit {
+			last := res.Users[len(res.Users)-1]
+			res.NextCursor = encodeCursor(cursor{
+				SortBy: query.SortBy,
+				Desc:   query.Desc,
+				Key:    sortKey(last, query.SortBy),
+				ID:     last.ID,
+			})
+			break
+		}
+
+		c := *u
+		res.Users = append(res.Users, &c)
+	}
+	return res, nil
+}
+
+// index inserts u in every sorted index. Must hold l.mu.
+func (l *LocalStorage) index(u *User) {
+	for field, idx := range l.indexes {
+		i := l.position(idx, u, field)
+		idx = append(idx, nil)
+		copy(idx[i+1:], idx[i:])
+		idx[i] = u
+		l.indexes[field] = idx
+	}
+}
+
+// unindex removes u from every sorted index. Must hold l.mu.
+func (l *LocalStorage) unindex(u *User) {
+	for field, idx := range l.indexes {
+		i := l.position(idx, u, field)
+		if i < len(idx) && idx[i].ID == u.ID {
+			l.indexes[field] = append(idx[:i], idx[i+1:]...)
+		}
+	}
+}
+
+// position returns where u is, or would be inserted, in idx.
+func (l *LocalStorage) position(idx []*User, u *User, field string) int {
+	key := sortKey(u, field)
+	return sort.Search(len(idx), func(i int) bool {
+		return !keyLess(sortKey(idx[i], field), idx[i].ID, key, u.ID)
+	})
+}
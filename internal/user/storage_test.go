@@ -0,0 +1,104 @@
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newListStorage(t *testing.T) *LocalStorage {
+	l := NewLocalStorage()
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	users := []*User{
+		{ID: "1", Name: "Juan", NickName: "juancito", CreatedAt: base},
+		{ID: "2", Name: "ana", NickName: "La Anita", CreatedAt: base.Add(time.Hour)},
+		{ID: "3", Name: "Pedro", NickName: "Juampi", CreatedAt: base.Add(2 * time.Hour)},
+		{ID: "4", Name: "juana", NickName: "jj", CreatedAt: base.Add(2 * time.Hour)},
+		{ID: "5", Name: "Beto", NickName: "b", CreatedAt: base.Add(3 * time.Hour)},
+	}
+	for _, u := range users {
+		require.NoError(t, l.Set(context.Background(), u))
+	}
+	return l
+}
+
+func ids(users []*User) []string {
+	out := make([]string, 0, len(users))
+	for _, u := range users {
+		out = append(out, u.ID)
+	}
+	return out
+}
+
+func TestLocalStorage_List_Pagination(t *testing.T) {
+	l := newListStorage(t)
+	ctx := context.Background()
+
+	q := ListQuery{SortBy: SortByCreatedAt, Limit: 2}
+	var got []string
+	for {
+		res, err := l.List(ctx, q)
+		require.NoError(t, err)
+		got = append(got, ids(res.Users)...)
+		if res.NextCursor == "" {
+			break
+		}
+		q.Cursor = res.NextCursor
+	}
+	// Empate en created_at entre 3 y 4: se desempata por ID
+	require.Equal(t, []string{"1", "2", "3", "4", "5"}, got)
+
+	q = ListQuery{SortBy: SortByName, Desc: true, Limit: 3}
+	res, err := l.List(ctx, q)
+	require.NoError(t, err)
+	require.Equal(t, []string{"3", "4", "1"}, ids(res.Users))
+
+	q.Cursor = res.NextCursor
+	res, err = l.List(ctx, q)
+	require.NoError(t, err)
+	require.Equal(t, []string{"5", "2"}, ids(res.Users))
+	require.Empty(t, res.NextCursor)
+}
+
+func TestLocalStorage_List_Search(t *testing.T) {
+	l := newListStorage(t)
+
+	res, err := l.List(context.Background(), ListQuery{SortBy: SortByName, Search: "JUA", Limit: 10})
+	require.NoError(t, err)
+	// "Pedro" entra por el nickname "Juampi"
+	require.Equal(t, []string{"1", "4", "3"}, ids(res.Users))
+}
+
+func TestLocalStorage_List_ReindexOnUpdate(t *testing.T) {
+	l := newListStorage(t)
+	ctx := context.Background()
+
+	u, err := l.Read(ctx, "5")
+	require.NoError(t, err)
+	u.Name = "Zoe"
+	require.NoError(t, l.Set(ctx, u))
+	require.NoError(t, l.Delete(ctx, "2"))
+
+	res, err := l.List(ctx, ListQuery{SortBy: SortByName, Limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "4", "3", "5"}, ids(res.Users))
+}
+
+func TestLocalStorage_List_InvalidCursor(t *testing.T) {
+	l := newListStorage(t)
+	ctx := context.Background()
+
+	_, err := l.List(ctx, ListQuery{SortBy: SortByName, Cursor: "%%%"})
+	require.ErrorIs(t, err, ErrInvalidCursor)
+
+	// Un cursor de otro orden no sirve
+	res, err := l.List(ctx, ListQuery{SortBy: SortByCreatedAt, Limit: 1})
+	require.NoError(t, err)
+	_, err = l.List(ctx, ListQuery{SortBy: SortByName, Cursor: res.NextCursor})
+	require.ErrorIs(t, err, ErrInvalidCursor)
+
+	_, err = l.List(ctx, ListQuery{SortBy: "address"})
+	require.ErrorIs(t, err, ErrInvalidSort)
+}